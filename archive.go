@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/chuhlomin/slack-exporter/pkg/structs"
+)
+
+// readArchive calls fn for every channel export in the directory.
+// Channels are read one at a time to keep memory usage low on large archives.
+func readArchive(dir string, fn func(path string, data *structs.Data) error) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("could not read directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !structs.IsChannelFile(entry.Name()) {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+
+		content, err := structs.ReadChannelFile(path)
+		if err != nil {
+			return fmt.Errorf("could not read file %q: %w", path, err)
+		}
+
+		var data structs.Data
+		if err := json.Unmarshal(content, &data); err != nil {
+			return fmt.Errorf("could not unmarshal file %q: %w", path, err)
+		}
+
+		if err := fn(path, &data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeChannelFile replaces the channel export read by readArchive,
+// keeping the file compressed if it was written with --compress.
+func writeChannelFile(path string, data *structs.Data) error {
+	content, err := marshalJSON(data)
+	if err != nil {
+		return fmt.Errorf("could not marshal messages: %w", err)
+	}
+
+	if filepath.Ext(path) == ".gz" {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(content); err != nil {
+			return fmt.Errorf("could not compress file: %w", err)
+		}
+		if err := zw.Close(); err != nil {
+			return fmt.Errorf("could not compress file: %w", err)
+		}
+		content = buf.Bytes()
+	}
+
+	return writePending(path, content)
+}
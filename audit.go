@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"path/filepath"
+	"strconv"
+
+	"github.com/slack-go/slack"
+
+	"github.com/chuhlomin/slack-exporter/pkg/structs"
+)
+
+// Audit logs of the workspace in the output directory.
+const (
+	accessLogsFilename      = "access_logs.json"
+	integrationLogsFilename = "integration_logs.json"
+)
+
+// maxLogsPage is the last page team.accessLogs returns.
+const maxLogsPage = 100
+
+// GetAccessLogs returns logins to the workspace, the most recent first (requires admin scope and a paid plan).
+func (sc *SlackClient) GetAccessLogs() ([]slack.Login, error) {
+	var logins []slack.Login
+
+	params := slack.AccessLogParameters{Count: pageLimit("team.accessLogs", cfg.PageSize), Page: 1}
+	for {
+		if err := sc.limiters.forMethod("team.accessLogs").Wait(sc.ctx); err != nil {
+			return nil, fmt.Errorf("rate limit error: %w", err)
+		}
+
+		page, paging, err := sc.api.GetAccessLogs(params)
+		if err != nil {
+			return nil, err
+		}
+
+		logins = append(logins, page...)
+
+		if paging == nil || params.Page >= paging.Pages || params.Page >= maxLogsPage {
+			break
+		}
+
+		params.Page++
+	}
+
+	return logins, nil
+}
+
+// GetIntegrationLogs returns changes of apps and integrations of the workspace (requires admin scope).
+func (sc *SlackClient) GetIntegrationLogs() ([]structs.IntegrationLog, error) {
+	var logs []structs.IntegrationLog
+
+	for page := 1; ; page++ {
+		var resp struct {
+			Logs   []structs.IntegrationLog `json:"logs"`
+			Paging slack.Paging             `json:"paging"`
+		}
+
+		err := sc.callAPI("team.integrationLogs", url.Values{
+			"count": {strconv.Itoa(pageLimit("team.integrationLogs", cfg.PageSize))},
+			"page":  {strconv.Itoa(page)},
+		}, &resp)
+		if err != nil {
+			return nil, err
+		}
+
+		logs = append(logs, resp.Logs...)
+
+		if page >= resp.Paging.Pages || page >= maxLogsPage {
+			return logs, nil
+		}
+	}
+}
+
+// exportAuditLogs writes access and integration logs, the logs the token is not allowed to read are skipped.
+func exportAuditLogs(c *SlackClient) error {
+	logins, err := c.GetAccessLogs()
+	if err != nil {
+		if isTokenRevoked(err) {
+			return err
+		}
+		log.Printf("Could not get access logs, skipping: %v", err)
+		failures.Add(statusSkipped, "access_logs", "", err)
+	} else if err := writeAuditLog(accessLogsFilename, logins); err != nil {
+		return err
+	}
+
+	logs, err := c.GetIntegrationLogs()
+	if err != nil {
+		if isTokenRevoked(err) {
+			return err
+		}
+		log.Printf("Could not get integration logs, skipping: %v", err)
+		failures.Add(statusSkipped, "integration_logs", "", err)
+	} else if err := writeAuditLog(integrationLogsFilename, logs); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func writeAuditLog(filename string, v interface{}) error {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("could not marshal %s: %w", filename, err)
+	}
+
+	if err := writePending(filepath.Join(cfg.Output, filename), content); err != nil {
+		return fmt.Errorf("could not write %s: %w", filename, err)
+	}
+
+	return nil
+}
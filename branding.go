@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/chuhlomin/slack-exporter/pkg/structs"
+)
+
+const (
+	// brandingFilename is the identity of the workspace shown by the viewers, with --branding.
+	brandingFilename = "branding.json"
+	// brandingDirname keeps the downloaded icons by workspace ID, like branding/T0123.png.
+	brandingDirname = "branding"
+)
+
+// exportBranding downloads icons of the workspace and of its Enterprise Grid org
+// and writes them with names and domains to branding.json.
+// The export goes on without the icons which can't be downloaded.
+func exportBranding(c *SlackClient) error {
+	workspace, _, err := c.Origin()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Join(cfg.Output, brandingDirname), 0o755); err != nil {
+		return fmt.Errorf("could not create branding directory: %w", err)
+	}
+
+	branding := structs.Branding{Workspace: workspace}
+	branding.Icon = downloadIcon(workspace)
+
+	if workspace.EnterpriseID != "" {
+		enterprise, err := c.teamInfo(workspace.EnterpriseID)
+		switch {
+		case err == nil:
+			branding.Enterprise = enterprise
+			branding.EnterpriseIcon = downloadIcon(enterprise)
+		case isTokenRevoked(err):
+			return err
+		default:
+			log.Printf("Could not get info of org %s: %v", workspace.EnterpriseID, err)
+			failures.Add(statusSkipped, "team", workspace.EnterpriseID, err)
+		}
+	}
+
+	content, err := marshalJSON(branding)
+	if err != nil {
+		return fmt.Errorf("could not marshal branding: %w", err)
+	}
+
+	if err := writePending(filepath.Join(cfg.Output, brandingFilename), content); err != nil {
+		return fmt.Errorf("could not write branding: %w", err)
+	}
+
+	log.Printf("Branding of %s is written to %s", first(workspace.Name, workspace.ID), brandingFilename)
+
+	return nil
+}
+
+// downloadIcon downloads the icon of the workspace to branding/, returns its path
+// relative to the output directory, empty if there is no icon or it can't be downloaded.
+func downloadIcon(workspace *structs.Workspace) string {
+	if workspace.Icon == "" {
+		return ""
+	}
+
+	ext := ".png"
+	if u, err := url.Parse(workspace.Icon); err == nil && path.Ext(u.Path) != "" {
+		ext = strings.ToLower(path.Ext(u.Path))
+	}
+
+	p := filepath.Join(brandingDirname, workspace.ID+ext)
+	if err := downloadURL(workspace.Icon, filepath.Join(cfg.Output, p)); err != nil {
+		log.Printf("Could not download icon of %s: %v", workspace.ID, err)
+		failures.Add(statusFailed, "team", workspace.ID, err)
+		return ""
+	}
+
+	return filepath.ToSlash(p)
+}
+
+// readBranding reads branding.json of the export, nil if it was exported without --branding.
+func readBranding(dir string) (*structs.Branding, error) {
+	content, err := os.ReadFile(filepath.Join(dir, brandingFilename))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read branding: %w", err)
+	}
+
+	var branding structs.Branding
+	if err := json.Unmarshal(content, &branding); err != nil {
+		return nil, fmt.Errorf("could not unmarshal branding: %w", err)
+	}
+
+	return &branding, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+
+	"github.com/chuhlomin/slack-exporter/pkg/structs"
+)
+
+// channelHistory collects changes of the channel settings from its messages by timestamp.
+type channelHistory map[string]structs.ChannelChange
+
+// Add records the change if the message is posted by Slack about the topic, purpose or name change,
+// archiving or unarchiving of the channel (or the private group of older workspaces).
+func (h channelHistory) Add(msg slack.Message) {
+	change := structs.ChannelChange{User: msg.User, Timestamp: msg.Timestamp}
+
+	subtype := strings.TrimPrefix(strings.TrimPrefix(msg.SubType, "channel_"), "group_")
+	switch subtype {
+	case structs.ChannelChangeTopic:
+		change.Value = msg.Topic
+	case structs.ChannelChangePurpose:
+		change.Value = msg.Purpose
+	case structs.ChannelChangeName:
+		change.Value, change.OldValue = msg.Name, msg.OldName
+	case structs.ChannelChangeArchive, structs.ChannelChangeUnarchive:
+	default:
+		return
+	}
+	if subtype == msg.SubType {
+		return
+	}
+
+	change.Type = subtype
+	h[msg.Timestamp] = change
+}
+
+// channelMetadataFilename returns the path of <channel>.channel.json.
+func channelMetadataFilename(channelID string) string {
+	return filepath.Join(cfg.Output, channelID+".channel.json")
+}
+
+// writeChannelMetadata writes the channel info and the history of its settings,
+// keeping changes recorded by previous exports (like ones out of --since and --until).
+func writeChannelMetadata(channel *slack.Channel, history channelHistory) error {
+	filename := channelMetadataFilename(channel.ID)
+
+	content, err := os.ReadFile(filename)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("could not read previous channel metadata: %w", err)
+	}
+	if err == nil {
+		var previous structs.ChannelMetadata
+		if err := json.Unmarshal(content, &previous); err != nil {
+			return fmt.Errorf("could not unmarshal previous channel metadata: %w", err)
+		}
+
+		for _, change := range previous.History {
+			if _, ok := history[change.Timestamp]; !ok {
+				history[change.Timestamp] = change
+			}
+		}
+	}
+
+	meta := structs.ChannelMetadata{
+		ID:               channel.ID,
+		Name:             channel.Name,
+		Created:          channel.Created.Time().UTC(),
+		Creator:          channel.Creator,
+		Archived:         channel.IsArchived,
+		Private:          channel.IsPrivate,
+		Shared:           channel.IsShared,
+		ExtShared:        channel.IsExtShared,
+		OrgShared:        channel.IsOrgShared,
+		SharedTeamIDs:    channel.SharedTeamIDs,
+		ConnectedTeamIDs: channel.ConnectedTeamIDs,
+		Topic:            setting(channel.Topic.Value, channel.Topic.Creator, channel.Topic.LastSet),
+		Purpose:          setting(channel.Purpose.Value, channel.Purpose.Creator, channel.Purpose.LastSet),
+		Exported:         time.Now().UTC(),
+	}
+
+	for _, change := range history {
+		meta.History = append(meta.History, change)
+	}
+	sort.Slice(meta.History, func(i, j int) bool {
+		return parseTimestamp(meta.History[i].Timestamp).Before(parseTimestamp(meta.History[j].Timestamp))
+	})
+
+	file, err := createPending(filename)
+	if err != nil {
+		return err
+	}
+
+	if err := json.NewEncoder(file).Encode(meta); err != nil {
+		file.Abort()
+		return fmt.Errorf("could not encode channel metadata: %w", err)
+	}
+
+	return file.Commit()
+}
+
+func setting(value, setBy string, set slack.JSONTime) structs.Setting {
+	s := structs.Setting{Value: value, SetBy: setBy}
+	if set > 0 {
+		t := set.Time().UTC()
+		s.Set = &t
+	}
+
+	return s
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/chuhlomin/slack-exporter/pkg/atomicfile"
+	"github.com/chuhlomin/slack-exporter/pkg/structs"
+)
+
+const (
+	progressFilename = ".progress.json"
+	// spoolDirname keeps messages of fetched pages of the channel being exported.
+	spoolDirname = ".progress"
+)
+
+// runProgress keeps track of exported channels, so an interrupted run
+// can be resumed (with `--resume`) without redoing completed channels.
+type runProgress struct {
+	path      string
+	Completed map[string]time.Time `json:"completed"`
+	// Pages are fetched history pages of channels which are not exported yet,
+	// so the channel is resumed from the last cursor instead of the first page.
+	Pages map[string]channelPages `json:"pages,omitempty"`
+
+	spool   *os.File
+	spooled int
+}
+
+// channelPages is the cursor of the next history page and the number of messages
+// of fetched pages, which are kept in the spool file until the channel is exported.
+type channelPages struct {
+	Cursor   string `json:"cursor"`
+	Messages int    `json:"messages"`
+}
+
+var checkpoint *runProgress
+
+// loadProgress returns the progress of the previous run if resume is set,
+// otherwise a fresh progress is started.
+func loadProgress(output string, resume bool) (*runProgress, error) {
+	p := &runProgress{
+		path:      filepath.Join(output, progressFilename),
+		Completed: map[string]time.Time{},
+		Pages:     map[string]channelPages{},
+	}
+
+	if !resume {
+		return p, nil
+	}
+
+	content, err := os.ReadFile(p.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return p, nil
+		}
+		return nil, fmt.Errorf("could not read progress: %w", err)
+	}
+
+	if err := json.Unmarshal(content, p); err != nil {
+		return nil, fmt.Errorf("could not unmarshal progress: %w", err)
+	}
+
+	if p.Pages == nil {
+		p.Pages = map[string]channelPages{}
+	}
+
+	return p, nil
+}
+
+// Done reports whether the channel was exported.
+func (p *runProgress) Done(channelID string) bool {
+	_, ok := p.Completed[channelID]
+	return ok
+}
+
+// Resume calls fn for messages of pages fetched by the previous run
+// and returns the cursor to continue the history from, empty to start from the first page.
+func (p *runProgress) Resume(channelID string, fn func(msg structs.Message) error) (string, error) {
+	p.closeSpool()
+
+	if err := os.MkdirAll(filepath.Join(filepath.Dir(p.path), spoolDirname), 0o755); err != nil {
+		return "", fmt.Errorf("could not create spool directory: %w", err)
+	}
+
+	pages, ok := p.Pages[channelID]
+	if !ok || pages.Cursor == "" {
+		file, err := os.Create(p.spoolPath(channelID))
+		if err != nil {
+			return "", fmt.Errorf("could not create spool: %w", err)
+		}
+		p.spool = file
+		return "", nil
+	}
+
+	file, err := os.OpenFile(p.spoolPath(channelID), os.O_RDWR, 0o600)
+	if err != nil {
+		return "", fmt.Errorf("could not open spool: %w", err)
+	}
+	p.spool = file
+
+	dec := json.NewDecoder(file)
+	for p.spooled < pages.Messages {
+		var msg structs.Message
+		if err := dec.Decode(&msg); err != nil {
+			return "", fmt.Errorf("could not read spooled message: %w", err)
+		}
+
+		p.spooled++
+		if err := fn(msg); err != nil {
+			return "", err
+		}
+	}
+
+	// messages spooled after the last saved page are fetched again
+	if err := file.Truncate(dec.InputOffset()); err != nil {
+		return "", fmt.Errorf("could not truncate spool: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekEnd); err != nil {
+		return "", fmt.Errorf("could not seek spool: %w", err)
+	}
+
+	return pages.Cursor, nil
+}
+
+// Spool keeps the fetched message until its page is saved.
+func (p *runProgress) Spool(msg structs.Message) error {
+	if err := json.NewEncoder(p.spool).Encode(msg); err != nil {
+		return fmt.Errorf("could not spool message: %w", err)
+	}
+
+	p.spooled++
+	return nil
+}
+
+// SavePage saves the cursor of the next history page of the channel,
+// once messages of fetched pages are on disk.
+func (p *runProgress) SavePage(channelID, cursor string) error {
+	if err := p.spool.Sync(); err != nil {
+		return fmt.Errorf("could not sync spool: %w", err)
+	}
+
+	p.Pages[channelID] = channelPages{Cursor: cursor, Messages: p.spooled}
+	return p.save()
+}
+
+// Complete marks the channel as exported and saves the progress.
+func (p *runProgress) Complete(channelID string) error {
+	p.closeSpool()
+
+	if err := os.Remove(p.spoolPath(channelID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("could not remove spool: %w", err)
+	}
+
+	delete(p.Pages, channelID)
+	p.Completed[channelID] = time.Now()
+
+	return p.save()
+}
+
+// Remove deletes the progress file once the run is finished.
+func (p *runProgress) Remove() error {
+	p.closeSpool()
+
+	if err := os.RemoveAll(filepath.Join(filepath.Dir(p.path), spoolDirname)); err != nil {
+		return fmt.Errorf("could not remove spool directory: %w", err)
+	}
+
+	if err := os.Remove(p.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("could not remove progress: %w", err)
+	}
+	return nil
+}
+
+func (p *runProgress) save() error {
+	content, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("could not marshal progress: %w", err)
+	}
+
+	if err := atomicfile.WriteFile(p.path, content); err != nil {
+		return fmt.Errorf("could not write progress: %w", err)
+	}
+
+	return nil
+}
+
+func (p *runProgress) spoolPath(channelID string) string {
+	return filepath.Join(filepath.Dir(p.path), spoolDirname, channelID+".ndjson")
+}
+
+func (p *runProgress) closeSpool() {
+	if p.spool != nil {
+		p.spool.Close()
+		p.spool = nil
+	}
+	p.spooled = 0
+}
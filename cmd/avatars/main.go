@@ -14,6 +14,7 @@ import (
 
 	"github.com/jessevdk/go-flags"
 
+	"github.com/chuhlomin/slack-exporter/pkg/atomicfile"
 	"github.com/chuhlomin/slack-exporter/pkg/structs"
 )
 
@@ -79,17 +80,17 @@ func downloadFile(id, fileURL, output string) error {
 	}
 
 	filename := filepath.Join(output, "avatars", id+".png")
-	file, err := os.Create(filename)
+	file, err := atomicfile.Create(filename)
 	if err != nil {
 		return err
 	}
 
-	defer file.Close()
+	defer file.Abort()
 
 	_, err = io.Copy(file, resp.Body)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return file.Commit()
 }
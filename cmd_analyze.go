@@ -0,0 +1,380 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/slack-go/slack"
+
+	"github.com/chuhlomin/slack-exporter/pkg/structs"
+)
+
+// Reports of the analyze command in the output directory.
+const (
+	analyticsFilename         = "analytics.json"
+	analyticsUsersFilename    = "analytics_users.csv"
+	analyticsChannelsFilename = "analytics_channels.csv"
+	analyticsHTMLFilename     = "analytics.html"
+)
+
+//go:embed analyze.html
+var analyzeHTML string
+
+type analyzeCommand struct {
+	CSV   bool `long:"csv" description:"Also write users and channels to analytics_users.csv and analytics_channels.csv"`
+	HTML  bool `long:"html" description:"Also write analytics.html with charts"`
+	Limit int  `long:"limit" description:"Number of the most active users to print, 0 for all" default:"10"`
+}
+
+// analyticsReport is the activity of the export, times are in --timezone.
+type analyticsReport struct {
+	Users    []*userActivity    `json:"users"`
+	Channels []*channelActivity `json:"channels"`
+	// Hours are messages and replies by the hour of the day.
+	Hours [24]int `json:"hours"`
+	// Weekdays are messages and replies by the day of the week, Sunday first.
+	Weekdays [7]int `json:"weekdays"`
+	// Reactions are reactions by emoji, the most used first.
+	Reactions []emojiCount `json:"reactions"`
+	// Emoji are emoji used in text and reactions, the most used first.
+	Emoji []emojiCount `json:"emoji"`
+}
+
+type userActivity struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Messages int    `json:"messages"`
+	Replies  int    `json:"replies"`
+	// Threads is the number of threads the user started or replied to.
+	Threads           int `json:"threads"`
+	ReactionsGiven    int `json:"reactions_given"`
+	ReactionsReceived int `json:"reactions_received"`
+
+	threads map[string]bool
+}
+
+type channelActivity struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Messages int    `json:"messages"`
+	Replies  int    `json:"replies"`
+	Threads  int    `json:"threads"`
+	// Users is the number of users who posted to the channel.
+	Users int `json:"users"`
+}
+
+type emojiCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// Execute reads the export in the output directory and writes the activity of users and channels
+// to analytics.json (and optionally CSV and HTML).
+func (ac *analyzeCommand) Execute(_ []string) error {
+	src, err := newSource(cfg.Output)
+	if err != nil {
+		return err
+	}
+
+	report := &analyticsReport{}
+	users := map[string]*userActivity{}
+	reactions, emojiUsed := map[string]int{}, map[string]int{}
+
+	// users who are the same person (with --identities) are counted as one
+	user := func(id string) *userActivity {
+		id = identities.Canonical(id)
+		u, ok := users[id]
+		if !ok {
+			u = &userActivity{ID: id, Name: id, threads: map[string]bool{}}
+			users[id] = u
+		}
+		return u
+	}
+
+	err = src.Channels(func(data *structs.Data) error {
+		channel := &channelActivity{ID: data.Channel.ID, Name: data.Channel.Name}
+		posted := map[string]bool{}
+
+		for id, u := range data.Users {
+			if u != nil {
+				user(id).Name = userDisplayName(u)
+			}
+		}
+
+		count := func(msg slack.Message, thread string) {
+			t := localTime(msg.Timestamp)
+			report.Hours[t.Hour()]++
+			report.Weekdays[t.Weekday()]++
+
+			for _, name := range textEmoji(msg.Text) {
+				emojiUsed[name]++
+			}
+
+			for _, r := range msg.Reactions {
+				name := baseEmojiName(r.Name)
+				reactions[name] += r.Count
+				emojiUsed[name] += r.Count
+
+				for _, id := range r.Users {
+					user(id).ReactionsGiven++
+				}
+			}
+
+			if msg.User == "" {
+				return
+			}
+
+			u := user(msg.User)
+			posted[u.ID] = true
+
+			for _, r := range msg.Reactions {
+				u.ReactionsReceived += r.Count
+			}
+
+			if thread != "" {
+				u.threads[channel.ID+"/"+thread] = true
+			}
+		}
+
+		for _, msg := range data.Messages {
+			thread := ""
+			if len(msg.Replies) > 0 {
+				thread = msg.Timestamp
+				channel.Threads++
+			}
+
+			count(msg.Message, thread)
+			channel.Messages++
+			if msg.User != "" {
+				user(msg.User).Messages++
+			}
+
+			for _, reply := range msg.Replies {
+				count(reply, thread)
+				channel.Replies++
+				if reply.User != "" {
+					user(reply.User).Replies++
+				}
+			}
+		}
+
+		channel.Users = len(posted)
+		report.Channels = append(report.Channels, channel)
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not read export: %w", err)
+	}
+
+	for _, u := range users {
+		u.Threads = len(u.threads)
+		if u.Messages+u.Replies+u.ReactionsGiven > 0 {
+			report.Users = append(report.Users, u)
+		}
+	}
+
+	sort.Slice(report.Users, func(i, j int) bool {
+		ti, tj := report.Users[i].Messages+report.Users[i].Replies, report.Users[j].Messages+report.Users[j].Replies
+		if ti != tj {
+			return ti > tj
+		}
+		return report.Users[i].ID < report.Users[j].ID
+	})
+	sort.Slice(report.Channels, func(i, j int) bool {
+		ti, tj := report.Channels[i].Messages+report.Channels[i].Replies, report.Channels[j].Messages+report.Channels[j].Replies
+		if ti != tj {
+			return ti > tj
+		}
+		return report.Channels[i].ID < report.Channels[j].ID
+	})
+	report.Reactions = sortedCounts(reactions)
+	report.Emoji = sortedCounts(emojiUsed)
+
+	if err := ac.write(report); err != nil {
+		return err
+	}
+
+	shown := report.Users
+	if ac.Limit > 0 && len(shown) > ac.Limit {
+		shown = shown[:ac.Limit]
+	}
+
+	for _, u := range shown {
+		fmt.Printf("%6d messages %6d replies %5d threads  %s\n", u.Messages, u.Replies, u.Threads, u.Name)
+	}
+
+	log.Printf("%d users in %d channels, the report is written to %s", len(report.Users), len(report.Channels), analyticsFilename)
+
+	return nil
+}
+
+func (ac *analyzeCommand) write(report *analyticsReport) error {
+	content, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("could not marshal analytics: %w", err)
+	}
+
+	if err := writePending(filepath.Join(cfg.Output, analyticsFilename), content); err != nil {
+		return fmt.Errorf("could not write analytics to file: %w", err)
+	}
+
+	if ac.CSV {
+		rows := [][]string{{"id", "name", "messages", "replies", "threads", "reactions_given", "reactions_received"}}
+		for _, u := range report.Users {
+			rows = append(rows, []string{
+				u.ID,
+				csvCell(u.Name),
+				strconv.Itoa(u.Messages),
+				strconv.Itoa(u.Replies),
+				strconv.Itoa(u.Threads),
+				strconv.Itoa(u.ReactionsGiven),
+				strconv.Itoa(u.ReactionsReceived),
+			})
+		}
+		if err := writeCSV(analyticsUsersFilename, rows); err != nil {
+			return err
+		}
+
+		rows = [][]string{{"id", "name", "messages", "replies", "threads", "users"}}
+		for _, c := range report.Channels {
+			rows = append(rows, []string{
+				c.ID,
+				csvCell(c.Name),
+				strconv.Itoa(c.Messages),
+				strconv.Itoa(c.Replies),
+				strconv.Itoa(c.Threads),
+				strconv.Itoa(c.Users),
+			})
+		}
+		if err := writeCSV(analyticsChannelsFilename, rows); err != nil {
+			return err
+		}
+	}
+
+	if ac.HTML {
+		if err := writeAnalyticsHTML(report); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeCSV(filename string, rows [][]string) error {
+	file, err := createPending(filepath.Join(cfg.Output, filename))
+	if err != nil {
+		return err
+	}
+	defer file.Abort()
+
+	w := csv.NewWriter(file)
+	if err := w.WriteAll(rows); err != nil {
+		return fmt.Errorf("could not write %s: %w", filename, err)
+	}
+
+	return file.Commit()
+}
+
+// chartBar is the bar of the chart in analytics.html, Percent is relative to the largest bar.
+type chartBar struct {
+	Label   string
+	Value   int
+	Percent float64
+}
+
+func writeAnalyticsHTML(report *analyticsReport) error {
+	tmpl, err := template.New("analytics").Parse(analyzeHTML)
+	if err != nil {
+		return fmt.Errorf("could not parse template: %w", err)
+	}
+
+	hours := make([]chartBar, 0, len(report.Hours))
+	for h, n := range report.Hours {
+		hours = append(hours, chartBar{Label: fmt.Sprintf("%02d", h), Value: n})
+	}
+
+	weekdays := make([]chartBar, 0, len(report.Weekdays))
+	for d, n := range report.Weekdays {
+		weekdays = append(weekdays, chartBar{Label: time.Weekday(d).String()[:3], Value: n})
+	}
+
+	users := []chartBar{}
+	for _, u := range report.Users {
+		users = append(users, chartBar{Label: u.Name, Value: u.Messages + u.Replies})
+	}
+
+	channels := []chartBar{}
+	for _, c := range report.Channels {
+		channels = append(channels, chartBar{Label: "#" + c.Name, Value: c.Messages + c.Replies})
+	}
+
+	reactions := []chartBar{}
+	for _, r := range report.Reactions {
+		reactions = append(reactions, chartBar{Label: ":" + r.Name + ":", Value: r.Count})
+	}
+
+	file, err := createPending(filepath.Join(cfg.Output, analyticsHTMLFilename))
+	if err != nil {
+		return err
+	}
+	defer file.Abort()
+
+	err = tmpl.Execute(file, map[string][]chartBar{
+		"Hours":     scaleBars(hours, 0),
+		"Weekdays":  scaleBars(weekdays, 0),
+		"Users":     scaleBars(users, 20),
+		"Channels":  scaleBars(channels, 20),
+		"Reactions": scaleBars(reactions, 20),
+	})
+	if err != nil {
+		return fmt.Errorf("could not render analytics: %w", err)
+	}
+
+	return file.Commit()
+}
+
+// scaleBars sets percents of the bars and keeps the first limit of them, 0 for all.
+func scaleBars(bars []chartBar, limit int) []chartBar {
+	if limit > 0 && len(bars) > limit {
+		bars = bars[:limit]
+	}
+
+	largest := 0
+	for _, b := range bars {
+		largest = max(largest, b.Value)
+	}
+
+	for i := range bars {
+		if largest > 0 {
+			bars[i].Percent = float64(bars[i].Value) * 100 / float64(largest)
+		}
+	}
+
+	return bars
+}
+
+// sortedCounts returns the counts by name, the largest first.
+func sortedCounts(counts map[string]int) []emojiCount {
+	list := make([]emojiCount, 0, len(counts))
+	for name, n := range counts {
+		list = append(list, emojiCount{Name: name, Count: n})
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return list[i].Name < list[j].Name
+	})
+
+	return list
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+type authCommand struct{}
+
+// Execute checks --api-token, without it the app is authorized in the browser
+// and the token is printed to reuse with --api-token or to keep in the secret
+// (followed by the refresh token for --refresh-token when the app rotates tokens).
+func (ac *authCommand) Execute(_ []string) error {
+	c, err := newAuthorizedClient()
+	if err != nil {
+		return err
+	}
+
+	if cfg.APIToken == "" {
+		fmt.Println(c.token)
+
+		// the app has token rotation enabled
+		if refreshToken := c.rotation.current().RefreshToken; refreshToken != "" {
+			fmt.Println(refreshToken)
+		}
+	}
+
+	auth, err := c.AuthTest()
+	if err != nil {
+		return fmt.Errorf("could not check token: %w", err)
+	}
+
+	log.Printf("The token of %s (%s) in %s (%s) is valid", auth.User, auth.UserID, auth.Team, auth.URL)
+
+	return nil
+}
+
+// newAuthorizedClient returns the client with --api-token, without it the app is authorized
+// in the browser, asking for its client ID and secret when they are not set.
+func newAuthorizedClient() (*SlackClient, error) {
+	if cfg.APIToken != "" {
+		c := NewSlackClient(cfg.AppClientID, cfg.AppClientSecret)
+		c.SetToken(cfg.APIToken)
+		return c, nil
+	}
+
+	if err := promptApp(); err != nil {
+		return nil, err
+	}
+
+	c := NewSlackClient(cfg.AppClientID, cfg.AppClientSecret)
+
+	// the token could be entered at the prompt
+	if cfg.APIToken != "" {
+		c.SetToken(cfg.APIToken)
+		return c, nil
+	}
+
+	if err := getToken(c); err != nil {
+		return nil, fmt.Errorf("could not get token: %w", err)
+	}
+
+	return c, nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/slack-go/slack"
+
+	"github.com/chuhlomin/slack-exporter/pkg/render"
+	"github.com/chuhlomin/slack-exporter/pkg/structs"
+)
+
+// Changes of messages between two exports.
+const (
+	changeAdded   = "added"
+	changeEdited  = "edited"
+	changeDeleted = "deleted"
+)
+
+type diffCommand struct {
+	JSON bool `long:"json" description:"Print changes as JSON"`
+
+	Args struct {
+		Old string `positional-arg-name:"old" description:"Earlier export: the output directory or <channel>.json"`
+		New string `positional-arg-name:"new" description:"Later export: the output directory or <channel>.json"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+// messageChange is the message (or the thread reply) added, edited or deleted between two exports.
+type messageChange struct {
+	Change    string `json:"change"`
+	Channel   string `json:"channel"`
+	Timestamp string `json:"ts"`
+	ThreadTS  string `json:"thread_ts,omitempty"`
+	User      string `json:"user,omitempty"`
+	// OldText is the text in the earlier export of edited and deleted messages.
+	OldText string `json:"old_text,omitempty"`
+	Text    string `json:"text,omitempty"`
+}
+
+// Execute compares messages and replies of channels in both exports by their timestamps
+// and prints the ones added, edited (the text or the edit time changed) and deleted.
+// Messages older than the oldest message of the later export are not reported as deleted,
+// they could be left out by --since or the retention policy; all messages of channels
+// which are empty or missing in the later export are.
+func (dc *diffCommand) Execute(_ []string) error {
+	before, err := readChannels(dc.Args.Old)
+	if err != nil {
+		return err
+	}
+
+	after, err := readChannels(dc.Args.New)
+	if err != nil {
+		return err
+	}
+
+	var changes []messageChange
+	for id, data := range after {
+		if previous, ok := before[id]; ok {
+			changes = append(changes, diffChannel(id, previous, data)...)
+		}
+	}
+
+	for id, previous := range before {
+		if _, ok := after[id]; !ok {
+			changes = append(changes, diffChannel(id, previous, &structs.Data{})...)
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Channel != changes[j].Channel {
+			return changes[i].Channel < changes[j].Channel
+		}
+		return parseTimestamp(changes[i].Timestamp).Before(parseTimestamp(changes[j].Timestamp))
+	})
+
+	if dc.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(changes)
+	}
+
+	for _, c := range changes {
+		text := c.Text
+		if c.Change == changeDeleted {
+			text = c.OldText
+		}
+		fmt.Printf("%s\t%s\t%s\t%s\t%s\n", c.Change, c.Channel, c.Timestamp, c.User, strings.ReplaceAll(text, "\n", " "))
+	}
+
+	return nil
+}
+
+// readChannels reads the channel export or all channel exports of the directory by channel ID.
+func readChannels(path string) (map[string]*structs.Data, error) {
+	channels := map[string]*structs.Data{}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read export: %w", err)
+	}
+
+	if info.IsDir() {
+		err := readArchive(path, func(_ string, data *structs.Data) error {
+			channels[data.Channel.ID] = data
+			return nil
+		})
+		return channels, err
+	}
+
+	content, err := structs.ReadChannelFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read file %q: %w", path, err)
+	}
+
+	var data structs.Data
+	if err := json.Unmarshal(content, &data); err != nil {
+		return nil, fmt.Errorf("could not unmarshal file %q: %w", path, err)
+	}
+
+	channels[data.Channel.ID] = &data
+	return channels, nil
+}
+
+// diffChannel returns changes of messages and replies of the channel.
+func diffChannel(channelID string, before, after *structs.Data) []messageChange {
+	old, current := channelMessages(before), channelMessages(after)
+
+	var (
+		changes []messageChange
+		oldest  string
+	)
+
+	for ts, msg := range current {
+		if oldest == "" || parseTimestamp(ts).Before(parseTimestamp(oldest)) {
+			oldest = ts
+		}
+
+		change := messageChange{
+			Channel:   channelID,
+			Timestamp: ts,
+			ThreadTS:  msg.ThreadTimestamp,
+			User:      msg.User,
+			Text:      render.Text(msg),
+		}
+
+		prev, ok := old[ts]
+		switch {
+		case !ok:
+			change.Change = changeAdded
+		case render.Text(prev) != change.Text || editedAt(prev) != editedAt(msg):
+			change.Change = changeEdited
+			change.OldText = render.Text(prev)
+		default:
+			continue
+		}
+
+		changes = append(changes, change)
+	}
+
+	for ts, msg := range old {
+		if _, ok := current[ts]; ok || oldest != "" && parseTimestamp(ts).Before(parseTimestamp(oldest)) {
+			continue
+		}
+
+		changes = append(changes, messageChange{
+			Change:    changeDeleted,
+			Channel:   channelID,
+			Timestamp: ts,
+			ThreadTS:  msg.ThreadTimestamp,
+			User:      msg.User,
+			OldText:   render.Text(msg),
+		})
+	}
+
+	return changes
+}
+
+// channelMessages returns messages and replies of the channel by their timestamps.
+func channelMessages(data *structs.Data) map[string]slack.Message {
+	msgs := map[string]slack.Message{}
+	for _, msg := range data.Messages {
+		msgs[msg.Timestamp] = msg.Message
+		for _, reply := range msg.Replies {
+			msgs[reply.Timestamp] = reply
+		}
+	}
+	return msgs
+}
+
+func editedAt(msg slack.Message) string {
+	if msg.Edited == nil {
+		return ""
+	}
+	return msg.Edited.Timestamp
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/enescakir/emoji"
+	"github.com/slack-go/slack"
+
+	"github.com/chuhlomin/slack-exporter/pkg/structs"
+)
+
+// emojiUsageFilename is the emoji usage report in the output directory.
+const emojiUsageFilename = "emoji_usage.json"
+
+// Kinds of the used emoji.
+const (
+	emojiKindCustom   = "custom"
+	emojiKindAlias    = "alias"
+	emojiKindStandard = "standard"
+	// emojiKindUnknown is neither in the emoji archive nor standard,
+	// like removed custom emoji or the archive not given.
+	emojiKindUnknown = "unknown"
+)
+
+type emojiCommand struct {
+	EmojiDir string `long:"emoji-dir" description:"Emoji archive downloaded with emoji download, to tell custom emoji and link their images"`
+	Limit    int    `long:"limit" description:"Number of the most used emoji to print, 0 for all" default:"30"`
+
+	Download emojiDownloadCommand `command:"download" description:"Download custom emoji of the workspace to the emoji archive"`
+}
+
+// emojiUsage is the number of times the emoji was used in the export.
+type emojiUsage struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind"`
+	Text      int    `json:"text"`
+	Reactions int    `json:"reactions"`
+	// AliasOf is the custom emoji the alias points to.
+	AliasOf string `json:"alias_of,omitempty"`
+	// File is the image of the custom emoji in the emoji archive.
+	File string `json:"file,omitempty"`
+	// UploadedBy and Created are from emoji_metadata.json of the archive downloaded with the admin token.
+	UploadedBy string     `json:"uploaded_by,omitempty"`
+	Created    *time.Time `json:"created,omitempty"`
+}
+
+// emojiMetadata is the custom emoji in emoji_metadata.json written by emoji download with --admin.
+type emojiMetadata struct {
+	URL        string    `json:"url"`
+	UploadedBy string    `json:"uploaded_by,omitempty"`
+	Created    time.Time `json:"created"`
+}
+
+// Execute counts emoji used in message text and reactions across the export in the output directory
+// and writes the report to emoji_usage.json, so it's known which custom emoji are worth migrating.
+func (ec *emojiCommand) Execute(_ []string) error {
+	archive, err := ec.loadArchive()
+	if err != nil {
+		return err
+	}
+
+	metadata, err := ec.loadMetadata()
+	if err != nil {
+		return err
+	}
+
+	src, err := newSource(cfg.Output)
+	if err != nil {
+		return err
+	}
+
+	usage := map[string]*emojiUsage{}
+	get := func(name string) *emojiUsage {
+		u, ok := usage[name]
+		if !ok {
+			u = &emojiUsage{Name: name}
+			usage[name] = u
+		}
+		return u
+	}
+
+	err = src.Channels(func(data *structs.Data) error {
+		count := func(msg slack.Message) {
+			for _, name := range textEmoji(msg.Text) {
+				get(name).Text++
+			}
+			for _, r := range msg.Reactions {
+				get(baseEmojiName(r.Name)).Reactions += r.Count
+			}
+		}
+
+		for _, msg := range data.Messages {
+			count(msg.Message)
+			for _, reply := range msg.Replies {
+				count(reply)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not read export: %w", err)
+	}
+
+	list := make([]emojiUsage, 0, len(usage))
+	for _, u := range usage {
+		ec.link(u, archive)
+		if m, ok := metadata[u.Name]; ok {
+			u.UploadedBy = m.UploadedBy
+			u.Created = &m.Created
+		}
+		list = append(list, *u)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		ti, tj := list[i].Text+list[i].Reactions, list[j].Text+list[j].Reactions
+		if ti != tj {
+			return ti > tj
+		}
+		return list[i].Name < list[j].Name
+	})
+
+	content, err := json.Marshal(list)
+	if err != nil {
+		return fmt.Errorf("could not marshal emoji usage: %w", err)
+	}
+
+	if err := writePending(filepath.Join(cfg.Output, emojiUsageFilename), content); err != nil {
+		return fmt.Errorf("could not write emoji usage to file: %w", err)
+	}
+
+	shown := list
+	if ec.Limit > 0 && len(shown) > ec.Limit {
+		shown = shown[:ec.Limit]
+	}
+
+	for _, u := range shown {
+		fmt.Printf("%6d text %6d reactions  :%s: (%s)\n", u.Text, u.Reactions, u.Name, u.Kind)
+	}
+
+	log.Printf("%d emoji used, the report is written to %s", len(list), emojiUsageFilename)
+
+	return nil
+}
+
+// loadArchive reads emoji.json of the emoji archive: names mapped to image URLs or "alias:<name>".
+func (ec *emojiCommand) loadArchive() (map[string]string, error) {
+	if ec.EmojiDir == "" {
+		return nil, nil
+	}
+
+	content, err := os.ReadFile(filepath.Join(ec.EmojiDir, emojiArchiveFilename))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			log.Printf("Emoji archive not found, custom emoji are reported as unknown")
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not read emoji archive: %w", err)
+	}
+
+	archive := map[string]string{}
+	if err := json.Unmarshal(content, &archive); err != nil {
+		return nil, fmt.Errorf("could not unmarshal emoji archive: %w", err)
+	}
+
+	return archive, nil
+}
+
+// loadMetadata reads emoji_metadata.json of the emoji archive, it's there only
+// when the archive was downloaded with the admin token.
+func (ec *emojiCommand) loadMetadata() (map[string]emojiMetadata, error) {
+	if ec.EmojiDir == "" {
+		return nil, nil
+	}
+
+	content, err := os.ReadFile(filepath.Join(ec.EmojiDir, emojiMetadataFilename))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not read emoji metadata: %w", err)
+	}
+
+	metadata := map[string]emojiMetadata{}
+	if err := json.Unmarshal(content, &metadata); err != nil {
+		return nil, fmt.Errorf("could not unmarshal emoji metadata: %w", err)
+	}
+
+	return metadata, nil
+}
+
+// link sets the kind of the emoji and the image file of the custom one in the archive.
+func (ec *emojiCommand) link(u *emojiUsage, archive map[string]string) {
+	url, ok := archive[u.Name]
+	if !ok {
+		if emoji.Exist(":" + u.Name + ":") {
+			u.Kind = emojiKindStandard
+		} else {
+			u.Kind = emojiKindUnknown
+		}
+		return
+	}
+
+	u.Kind = emojiKindCustom
+	name := u.Name
+	if target, ok := strings.CutPrefix(url, "alias:"); ok {
+		u.Kind = emojiKindAlias
+		u.AliasOf = target
+		name, url = target, archive[target]
+	}
+
+	// aliases of standard emoji have no image
+	if url != "" && !strings.HasPrefix(url, "alias:") {
+		u.File = filepath.Join(ec.EmojiDir, name+filepath.Ext(url))
+	}
+}
+
+var (
+	emojiCode      = regexp.MustCompile(`:([a-z0-9_+'-]+):`)
+	codeSpan       = regexp.MustCompile("(?s)```.*?```|`[^`\n]*`")
+	skinToneSuffix = regexp.MustCompile(`::skin-tone-\d$`)
+)
+
+// textEmoji returns names of the emoji in the message text like ":tada:",
+// skipping code and things like times (10:30:00) which look like emoji.
+func textEmoji(text string) []string {
+	text = codeSpan.ReplaceAllString(text, " ")
+
+	var names []string
+	for _, m := range emojiCode.FindAllStringSubmatchIndex(text, -1) {
+		if m[0] > 0 {
+			r, _ := utf8.DecodeLastRuneInString(text[:m[0]])
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				continue
+			}
+		}
+
+		name := text[m[2]:m[3]]
+		if strings.HasPrefix(name, "skin-tone-") {
+			continue
+		}
+		names = append(names, name)
+	}
+
+	return names
+}
+
+// baseEmojiName returns the name of the reaction without the skin tone, like "+1" for "+1::skin-tone-2".
+func baseEmojiName(name string) string {
+	return skinToneSuffix.ReplaceAllString(name, "")
+}
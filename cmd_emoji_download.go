@@ -0,0 +1,312 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Files of the emoji archive.
+const (
+	// emojiArchiveFilename maps names of custom emoji to image URLs or "alias:<name>".
+	emojiArchiveFilename = "emoji.json"
+	// emojiMetadataFilename has uploaders and creation dates of custom emoji from admin.emoji.list,
+	// apart from emoji.json, which render and emoji tools read as the name to URL map.
+	emojiMetadataFilename = "emoji_metadata.json"
+	// emojiArchiveDirname is the emoji archive in the output directory.
+	emojiArchiveDirname = "emoji"
+)
+
+type emojiDownloadCommand struct {
+	Dir    string `long:"dir" description:"Directory of the emoji archive, <output>/emoji by default"`
+	Admin  bool   `long:"admin" description:"--api-token is the Enterprise Grid org admin token with admin.teams:read scope: also write who uploaded every emoji and when to emoji_metadata.json"`
+	Pack   string `long:"pack" description:"Also write the emoji pack <pack>.yaml with images and aliases of custom emoji for emoji upload tools of Slack, Discord and Mattermost, <pack> is its title"`
+	DryRun bool   `long:"dry-run" description:"Only list emoji that would be added, changed or removed"`
+}
+
+// Execute downloads images of custom emoji of the workspace to the emoji archive
+// and writes emoji.json, used to render custom emoji and to count their usage.
+func (ed *emojiDownloadCommand) Execute(_ []string) error {
+	if cfg.APIToken == "" {
+		return errAPITokenRequired
+	}
+
+	if ed.Dir == "" {
+		ed.Dir = filepath.Join(cfg.Output, emojiArchiveDirname)
+	}
+
+	c := NewSlackClient(cfg.AppClientID, cfg.AppClientSecret)
+	c.SetToken(cfg.APIToken)
+
+	if cfg.CacheDir != "" {
+		if err := c.SetCacheDir(cfg.CacheDir, cfg.CacheTTL); err != nil {
+			return fmt.Errorf("could not set cache: %w", err)
+		}
+
+		defer func() {
+			if err := c.SaveCache(); err != nil {
+				log.Printf("Could not save cache: %v", err)
+			}
+		}()
+	}
+
+	emoji, err := c.getEmoji()
+	if err != nil {
+		return fmt.Errorf("could not get emoji: %w", err)
+	}
+
+	if ed.DryRun {
+		return ed.diff(emoji)
+	}
+
+	if err := os.MkdirAll(ed.Dir, 0o755); err != nil {
+		return fmt.Errorf("could not create directory: %w", err)
+	}
+
+	for name, url := range emoji {
+		if strings.HasPrefix(url, "alias:") {
+			continue
+		}
+
+		if err := c.downloadEmoji(filepath.Join(ed.Dir, name+filepath.Ext(url)), url); err != nil {
+			return fmt.Errorf("could not download emoji %q: %w", name, err)
+		}
+	}
+
+	if err := writeEmojiJSON(filepath.Join(ed.Dir, emojiArchiveFilename), emoji); err != nil {
+		return err
+	}
+
+	if ed.Pack != "" {
+		if err := ed.writePack(emoji); err != nil {
+			return fmt.Errorf("could not write emoji pack: %w", err)
+		}
+	}
+
+	if ed.Admin {
+		metadata, err := c.getEmojiMetadata()
+		if err != nil {
+			return fmt.Errorf("could not get emoji metadata: %w", err)
+		}
+
+		if err := writeEmojiJSON(filepath.Join(ed.Dir, emojiMetadataFilename), metadata); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("%d custom emoji are downloaded to %s", len(emoji), ed.Dir)
+
+	return nil
+}
+
+func writeEmojiJSON(path string, v interface{}) error {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("could not marshal %s: %w", filepath.Base(path), err)
+	}
+
+	return writePending(path, content)
+}
+
+// diff prints emoji that would be added, changed (URL differs) or removed
+// compared to emoji.json and the images in the emoji archive.
+func (ed *emojiDownloadCommand) diff(emoji map[string]string) error {
+	local := map[string]string{}
+
+	content, err := os.ReadFile(filepath.Join(ed.Dir, emojiArchiveFilename))
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(content, &local); err != nil {
+			return fmt.Errorf("could not unmarshal emoji archive: %w", err)
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return fmt.Errorf("could not read emoji archive: %w", err)
+	}
+
+	var added, changed, removed []string
+
+	for name, url := range emoji {
+		localURL, ok := local[name]
+		switch {
+		case !ok:
+			added = append(added, name)
+		case localURL != url:
+			changed = append(changed, name)
+		case !strings.HasPrefix(url, "alias:"):
+			// present in emoji.json, but the image was never downloaded
+			if _, err := os.Stat(filepath.Join(ed.Dir, name+filepath.Ext(url))); err != nil {
+				added = append(added, name)
+			}
+		}
+	}
+
+	for name := range local {
+		if _, ok := emoji[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+
+	for _, group := range []struct {
+		sign  string
+		names []string
+	}{
+		{"+", added},
+		{"~", changed},
+		{"-", removed},
+	} {
+		sort.Strings(group.names)
+		for _, name := range group.names {
+			fmt.Printf("%s :%s:\n", group.sign, name)
+		}
+	}
+
+	fmt.Printf("%d to add, %d to change, %d to remove\n", len(added), len(changed), len(removed))
+
+	return nil
+}
+
+// writePack writes the emoji pack manifest next to the images:
+//
+//	title: <pack>
+//	emojis:
+//	  - name: <name>
+//	    src: <name>.<ext>
+//	    aliases:
+//	      - <alias>
+//
+// Strings are double-quoted, so names are never read as other YAML types.
+// Aliases of standard emoji are left out, upload tools have no image for them.
+func (ed *emojiDownloadCommand) writePack(emoji map[string]string) error {
+	aliases := map[string][]string{}
+	names := make([]string, 0, len(emoji))
+
+	for name, url := range emoji {
+		if target, ok := strings.CutPrefix(url, "alias:"); ok {
+			aliases[target] = append(aliases[target], name)
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "title: %s\nemojis:\n", strconv.Quote(ed.Pack))
+
+	for _, name := range names {
+		fmt.Fprintf(&sb, "  - name: %s\n    src: %s\n", strconv.Quote(name), strconv.Quote(name+filepath.Ext(emoji[name])))
+
+		if len(aliases[name]) == 0 {
+			continue
+		}
+
+		sort.Strings(aliases[name])
+		sb.WriteString("    aliases:\n")
+		for _, alias := range aliases[name] {
+			fmt.Fprintf(&sb, "      - %s\n", strconv.Quote(alias))
+		}
+	}
+
+	return writePending(filepath.Join(ed.Dir, filepath.Base(ed.Pack)+".yaml"), []byte(sb.String()))
+}
+
+// getEmoji returns custom emoji of the workspace, cached in --cache-dir.
+func (sc *SlackClient) getEmoji() (map[string]string, error) {
+	// tokens belong to a single workspace, so the cache key is derived from the token
+	key := fmt.Sprintf("%x", sha256.Sum256([]byte(sc.token)))
+	if emoji, ok := sc.emojiCache.Get(key); ok {
+		return emoji, nil
+	}
+
+	var resp struct {
+		Emoji map[string]string `json:"emoji"`
+	}
+	if err := sc.callAPI("emoji.list", url.Values{}, &resp); err != nil {
+		return nil, err
+	}
+
+	sc.emojiCache.Set(key, resp.Emoji)
+
+	return resp.Emoji, nil
+}
+
+// getEmojiMetadata returns custom emoji of the Enterprise Grid org with their uploaders
+// and creation dates (requires admin.teams:read scope).
+func (sc *SlackClient) getEmojiMetadata() (map[string]emojiMetadata, error) {
+	metadata := map[string]emojiMetadata{}
+	values := url.Values{"limit": {strconv.Itoa(pageLimit("admin.emoji.list", cfg.PageSize))}}
+
+	for {
+		var resp struct {
+			Emoji map[string]struct {
+				URL         string `json:"url"`
+				UploadedBy  string `json:"uploaded_by"`
+				DateCreated int64  `json:"date_created"`
+			} `json:"emoji"`
+			ResponseMetadata struct {
+				NextCursor string `json:"next_cursor"`
+			} `json:"response_metadata"`
+		}
+
+		if err := sc.callAPI("admin.emoji.list", values, &resp); err != nil {
+			return nil, err
+		}
+
+		for name, e := range resp.Emoji {
+			metadata[name] = emojiMetadata{
+				URL:        e.URL,
+				UploadedBy: e.UploadedBy,
+				Created:    time.Unix(e.DateCreated, 0).UTC(),
+			}
+		}
+
+		if resp.ResponseMetadata.NextCursor == "" {
+			return metadata, nil
+		}
+		values.Set("cursor", resp.ResponseMetadata.NextCursor)
+	}
+}
+
+// downloadEmoji downloads the emoji image to the path, images are public.
+func (sc *SlackClient) downloadEmoji(path, imageURL string) error {
+	req, err := http.NewRequestWithContext(sc.ctx, http.MethodGet, imageURL, http.NoBody)
+	if err != nil {
+		return fmt.Errorf("could not create request: %w", err)
+	}
+
+	if err := sc.limiters[limiterFiles].Wait(sc.ctx); err != nil {
+		return fmt.Errorf("rate limit error: %w", err)
+	}
+
+	resp, err := sc.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %d", errBadStatus, resp.StatusCode)
+	}
+
+	file, err := createPending(path)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(file, resp.Body); err != nil {
+		file.Abort()
+		return fmt.Errorf("could not write file: %w", err)
+	}
+
+	return file.Commit()
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/jessevdk/go-flags"
+)
+
+// exportOptions are the flags of the export command. They are embedded in config,
+// so the export reads them as cfg fields like the global flags.
+type exportOptions struct {
+	Interactive        bool       `env:"INTERACTIVE" long:"interactive" description:"Pick channels and DMs to export from the list, searched by name, instead of --channels"`
+	Yes                bool       `env:"YES" long:"yes" description:"Do not report the estimated number of messages and ask to confirm large exports"`
+	PreflightThreshold int        `env:"PREFLIGHT_THRESHOLD" long:"preflight-threshold" description:"Ask to confirm the export when channels have more messages (estimated from the first page of every channel), 0 to never ask" default:"100000"`
+	DownloadFiles      bool       `env:"DOWNLOAD_FILES" long:"download-files" description:"Download files"`
+	UnfurlThumbnails   bool       `env:"UNFURL_THUMBNAILS" long:"unfurl-thumbnails" description:"Download preview images of links (unfurls) to unfurls/, so shared links keep their previews in the archive"`
+	DownloadAvatars    bool       `env:"DOWNLOAD_AVATARS" long:"download-avatars" description:"Download avatars"`
+	Branding           bool       `env:"BRANDING" long:"branding" description:"Download icons of the workspace and of its Enterprise Grid org to branding/ for the HTML viewers (requires team:read scope)"`
+	IncludeArchived    bool       `env:"INCLUDE_ARCHIVED" long:"include-archived" description:"Include archived channels, listed ones with --channels all (or other types) too; their manifests have archived set"`
+	User               []string   `env:"AUTHORS" env-delim:"," long:"user" description:"Export only messages of the user: ID, @username, display name or email; the parent of the thread the user replied to is kept; can be repeated"`
+	UserThreads        bool       `env:"USER_THREADS" long:"user-threads" description:"Keep whole threads of messages of --user for context"`
+	Grep               string     `env:"GREP" long:"grep" description:"Export only messages (with threads) containing the text, case-insensitive"`
+	GrepRegex          pattern    `env:"GREP_REGEX" long:"grep-regex" description:"Export only messages (with threads) matching the regular expression, like (?i)invoice-\\d+"`
+	Context            int        `env:"CONTEXT" long:"context" description:"Also export N messages (with threads) before and after every message matched by --grep or --grep-regex"`
+	ExcludeBots        bool       `env:"EXCLUDE_BOTS" long:"exclude-bots" description:"Export only messages of people, without messages of bots, apps and integrations"`
+	OnlyBots           bool       `env:"ONLY_BOTS" long:"only-bots" description:"Export only messages of bots, apps and integrations"`
+	HasReaction        []string   `env:"HAS_REACTION" env-delim:"," long:"has-reaction" description:"Export only messages (with threads) that have the reaction, like :bookmark:; can be repeated"`
+	MaxFailures        int        `env:"MAX_FAILURES" long:"max-failures" description:"Channels, users, files and other items which may fail (listed in errors.json) before the run exits with an error, -1 for any number" default:"0"`
+	Sample             sampleRate `env:"SAMPLE" long:"sample" description:"Export only a sample of messages (with threads): percentage like 1% or rate like 1/100, every message is selected with the probability by the hash of --sample-seed, the channel and the message ts, so the sample size is approximate"`
+	SampleSeed         string     `env:"SAMPLE_SEED" long:"sample-seed" description:"Seed of the sample; the same seed selects the same messages"`
+	Permalinks         bool       `env:"PERMALINKS" long:"permalinks" description:"Include permalinks of messages and thread replies, built from the workspace URL"`
+	FilesOnly          bool       `env:"FILES_ONLY" long:"files-only" description:"Download files of messages and thread replies with the index in <channel>.files.csv (ts, uploader, filename, local path) instead of the messages"`
+	SkipFiles          bool       `env:"SKIP_FILES" long:"skip-files" description:"Export messages and metadata without calling the files API and downloading files (file entries of messages are kept as Slack returns them), for fast text backups"`
+	NoContent          bool       `env:"NO_CONTENT" long:"no-content" description:"Export channels, members, users, file metadata and message counts, without message text and files"`
+	SharedMessages     bool       `env:"SHARED_MESSAGES" long:"shared-messages" description:"Resolve messages shared (forwarded) into messages by their permalinks and embed them as they are now; without it shared_messages have the text as it was shared"`
+	Calls              bool       `env:"CALLS" long:"calls" description:"Export participants, duration and links of huddles and calls; their recordings and notes are added to the files of the message and downloaded with --download-files"`
+	Lists              bool       `env:"LISTS" long:"lists" description:"Export columns and items of Slack Lists shared in channels (requires lists:read scope)"`
+	SharedTeams        bool       `env:"SHARED_TEAMS" long:"shared-teams" description:"For shared channels (Slack Connect), export connected workspaces with their names to teams and set the workspace of the author of every message (requires team:read scope)"`
+	ChannelMetadata    bool       `env:"CHANNEL_METADATA" long:"channel-metadata" description:"Write creation time, creator, archive and sharing status, topic and purpose (with who set them and when) and the history of their changes to <channel>.channel.json"`
+	FileMetadata       bool       `env:"FILE_METADATA" long:"file-metadata" description:"Include full files metadata (shares, initial comment) and file comments"`
+	ExternalUsersToken string     `env:"EXTERNAL_USERS_TOKEN" long:"external-users-token" description:"Token of the other workspace of shared channels, used to resolve external users"`
+	Resume             bool       `env:"RESUME" long:"resume" description:"Skip channels exported by the previous interrupted run and continue the interrupted channel from its last history page"`
+	Sidebar            bool       `env:"SIDEBAR" long:"sidebar" description:"Export sidebar sections and channel order of the authed user (if the token allows)"`
+	Pins               bool       `env:"PINS" long:"pins" description:"Export messages and files pinned in channels to pins of the channel (requires pins:read scope)"`
+	Saved              bool       `env:"SAVED" long:"saved" description:"Export items saved by the authed user to saved.json with the messages (with threads) and files they refer to (requires stars:read scope)"`
+	Reminders          bool       `env:"REMINDERS" long:"reminders" description:"Export reminders to reminders.json and reminders.ics (requires reminders:read scope)"`
+	AuditLogs          bool       `env:"AUDIT_LOGS" long:"audit-logs" description:"Export logins with IP addresses and devices to access_logs.json (requires admin scope and a paid plan) and changes of apps and integrations to integration_logs.json (requires admin scope), the logs the token can't read are skipped"`
+	WebhookURLs        []string   `env:"WEBHOOK_URL" env-delim:"," long:"webhook-url" description:"URL to POST a run summary to (Slack incoming webhook or JSON endpoint); can be repeated"`
+	WebhookSecret      string     `env:"WEBHOOK_SECRET" long:"webhook-secret" description:"Secret to sign webhooks with HMAC-SHA256 (X-Signature header)"`
+	WebhookChannels    bool       `env:"WEBHOOK_CHANNELS" long:"webhook-channels" description:"Also POST a summary when every channel is exported"`
+	Workspaces         string     `env:"WORKSPACES" long:"workspaces" description:"JSON file listing workspaces to export in one run, every one with name, api_token or secrets and optionally team_id (of the Enterprise Grid org token), external_users_token and channels; workspaces are exported to <output>/<name> and listed with their summaries in <output>/workspaces.json"`
+	Org                bool       `env:"ORG" long:"org" description:"Export public and private channels of every workspace of the Enterprise Grid org, found with admin APIs (requires the org admin token with admin.teams:read and admin.conversations:read scopes), to <output>/<workspace domain>, every workspace paced by its own rate limiter"`
+	FinalSnapshot      bool       `env:"FINAL_SNAPSHOT" long:"final-snapshot" description:"Export everything of the workspace being shut down: all channels (with archived and DMs), files with metadata, channel metadata, workspaces of shared channels, huddles and calls, Slack Lists, avatars, profile fields, permalinks, pins, sidebar, reminders, saved items, audit logs, custom emoji, emoji usage, all users, activity report and HTML, then write manifest.json with SHA-256 of every file, verify it and compress the output to <output>.tar.gz"`
+}
+
+type exportCommand struct {
+	Options *exportOptions `group:"Export Options"`
+}
+
+// Execute exports messages to the output directory.
+func (ec *exportCommand) Execute(_ []string) error {
+	return runExport()
+}
+
+// exportArgs returns the arguments with the export command added when they have no command:
+// running the app without a command is the deprecated alias of export.
+// Asking for help without a command shows the help of the app.
+func exportArgs(args []string) []string {
+	// export flags are known before the command too, so their values are not taken for commands
+	var probe struct {
+		config
+		Options exportOptions `group:"Export Options"`
+	}
+	parser := flags.NewParser(&probe, flags.IgnoreUnknown)
+	parser.SubcommandsOptional = true
+	parser.CommandHandler = func(flags.Commander, []string) error {
+		return nil
+	}
+
+	// errors are reported by the parser of the arguments, only the command matters here
+	_, _ = parser.ParseArgs(args)
+	if parser.Active != nil {
+		return args
+	}
+
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if arg == "-h" || arg == "--help" {
+			return args
+		}
+	}
+
+	log.Printf("Running without a command is deprecated, run `%s export` instead", os.Args[0])
+
+	return append([]string{"export"}, args...)
+}
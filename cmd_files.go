@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+
+	"github.com/slack-go/slack"
+
+	"github.com/chuhlomin/slack-exporter/pkg/structs"
+)
+
+var (
+	errAPITokenRequired = fmt.Errorf("API token is required")
+	errFetchFilesArgs   = fmt.Errorf("pass at most one path to the ZIP file (or the unzipped directory) of the Slack export")
+)
+
+type filesCommand struct {
+	Backfill filesBackfillCommand `command:"backfill" description:"Download files of the existing export which were never downloaded"`
+}
+
+type filesBackfillCommand struct {
+	DryRun bool `long:"dry-run" description:"Only list the missing files"`
+}
+
+// Execute walks the export in the output directory, finds files attached to the messages
+// which are missing on disk (skipped or older runs) and downloads just those.
+func (fc *filesBackfillCommand) Execute(_ []string) error {
+	if cfg.APIToken == "" {
+		return errAPITokenRequired
+	}
+
+	c := NewSlackClient(cfg.AppClientID, cfg.AppClientSecret)
+	c.SetToken(cfg.APIToken)
+
+	var total, downloaded int
+
+	err := readArchive(cfg.Output, func(path string, data *structs.Data) error {
+		channelID := data.Channel.ID
+
+		missing := missingFiles(data)
+		if len(missing) == 0 {
+			return nil
+		}
+
+		total += len(missing)
+
+		if fc.DryRun {
+			for id, file := range missing {
+				fmt.Printf("%s\t%s\t%s\n", channelID, id, file.name)
+			}
+			return nil
+		}
+
+		n, err := fetchFiles(c, data, missing)
+		if err != nil {
+			return err
+		}
+
+		downloaded += n
+		if n == 0 {
+			return nil
+		}
+
+		if err := writeChannelFile(path, data); err != nil {
+			return fmt.Errorf("could not write file: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("%d files were missing, %d downloaded", total, downloaded)
+
+	return nil
+}
+
+type fetchFilesCommand struct {
+	DryRun bool `long:"dry-run" description:"Only list the missing files"`
+}
+
+// Execute downloads files of the messages-only export: the export in the output directory
+// (like files backfill) or the official Slack export given as the argument, which never has them.
+// Files of the official export are linked by --file-layout and are added to <channel ID>.json
+// written by import-slack-export, before or after it.
+func (fc *fetchFilesCommand) Execute(args []string) error {
+	if len(args) > 1 {
+		return errFetchFilesArgs
+	}
+	if len(args) == 0 {
+		return (&filesBackfillCommand{DryRun: fc.DryRun}).Execute(nil)
+	}
+
+	if cfg.APIToken == "" {
+		return errAPITokenRequired
+	}
+
+	src, err := openSlackExport(args[0])
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	c := NewSlackClient(cfg.AppClientID, cfg.AppClientSecret)
+	c.SetToken(cfg.APIToken)
+
+	var total, downloaded int
+
+	err = src.Channels(func(data *structs.Data) error {
+		missing := missingFiles(data)
+		total += len(missing)
+
+		if fc.DryRun {
+			for id, file := range missing {
+				fmt.Printf("%s\t%s\t%s\n", data.Channel.ID, id, file.name)
+			}
+			return nil
+		}
+
+		if len(missing) == 0 {
+			return nil
+		}
+
+		n, err := fetchFiles(c, data, missing)
+		if err != nil {
+			return err
+		}
+		downloaded += n
+		if n == 0 {
+			return nil
+		}
+
+		return addImportedFiles(data.Channel.ID, data.Files, data.FilePaths)
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("%d files were missing, %d downloaded", total, downloaded)
+
+	return nil
+}
+
+// addImportedFiles adds names and paths of the downloaded files to the channel imported
+// with import-slack-export, it's a no-op before the import.
+func addImportedFiles(channelID string, files, paths map[string]string) error {
+	path := filepath.Join(cfg.Output, channelID+".json")
+	if cfg.Compress {
+		path += ".gz"
+	}
+
+	content, err := structs.ReadChannelFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not read file: %w", err)
+	}
+
+	var data structs.Data
+	if err := json.Unmarshal(content, &data); err != nil {
+		return fmt.Errorf("could not unmarshal file %q: %w", path, err)
+	}
+
+	if data.Files == nil {
+		data.Files = map[string]string{}
+	}
+	if data.FilePaths == nil {
+		data.FilePaths = map[string]string{}
+	}
+	for id, filename := range files {
+		data.Files[id] = filename
+		data.FilePaths[id] = paths[id]
+	}
+
+	return writeChannelFile(path, &data)
+}
+
+// missingFiles returns files of messages and replies of the channel which are not on disk,
+// without the ones filtered out by --max-file-size and file types.
+func missingFiles(data *structs.Data) map[string]collectedFile {
+	missing := map[string]collectedFile{}
+	collect := func(files []slack.File, thread string) {
+		for _, file := range files {
+			if !collectable(file) {
+				continue
+			}
+			if fileExists(data, file.ID) {
+				continue
+			}
+			missing[file.ID] = newCollectedFile(file, thread)
+		}
+	}
+
+	for _, msg := range data.Messages {
+		collect(msg.Files, msg.Timestamp)
+		for _, reply := range msg.Replies {
+			collect(reply.Files, msg.Timestamp)
+		}
+	}
+
+	return missing
+}
+
+// fetchFiles downloads the files, links them by --file-layout, adds their names, paths
+// (and thumbnails) to the channel and returns how many were downloaded. Files already in the store are only linked,
+// so the interrupted run continues where it stopped.
+func fetchFiles(c *SlackClient, data *structs.Data, missing map[string]collectedFile) (int, error) {
+	if data.Files == nil {
+		data.Files = map[string]string{}
+	}
+	if data.FilePaths == nil {
+		data.FilePaths = map[string]string{}
+	}
+
+	downloaded := 0
+	for id, file := range missing {
+		filename, err := c.downloadFile(id, file)
+		if err == nil {
+			err = linkStored(layoutPath(data.Channel.ID, id, filename, file), id+"-"+filename)
+		}
+		if err != nil {
+			if isTokenRevoked(err) || isOutOfSpace(err) {
+				return downloaded, err
+			}
+			log.Printf("could not download file %q: %v", id, err)
+
+			if data.MissingFiles == nil {
+				data.MissingFiles = map[string]string{}
+			}
+			data.MissingFiles[id] = missingReason(err)
+			continue
+		}
+
+		delete(data.MissingFiles, id)
+		data.Files[id] = filename
+		data.FilePaths[id] = layoutPath(data.Channel.ID, id, filename, file)
+		downloaded++
+
+		if cfg.Thumbnails {
+			if data.Thumbnails == nil {
+				data.Thumbnails = map[string]string{}
+			}
+			maps.Copy(data.Thumbnails, makeThumbnails(map[string]string{id: filename}))
+		}
+	}
+
+	return downloaded, nil
+}
+
+// fileExists reports whether the file of the channel was downloaded and is on disk.
+func fileExists(data *structs.Data, id string) bool {
+	path := localFilePath(data, id)
+	if path == "" {
+		return false
+	}
+
+	_, err := os.Stat(filepath.Join(cfg.Output, path))
+	return !errors.Is(err, os.ErrNotExist)
+}
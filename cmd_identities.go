@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/slack-go/slack"
+
+	"github.com/chuhlomin/slack-exporter/pkg/identity"
+	"github.com/chuhlomin/slack-exporter/pkg/structs"
+)
+
+// identities maps users to people with --identities, nil maps every user to itself.
+var identities *identity.Map
+
+type identitiesCommand struct {
+	Inputs []string `long:"input" description:"Export directory of a workspace; can be repeated" required:"true"`
+	Out    string   `long:"out" description:"Output JSON file" default:"identities.json"`
+}
+
+// Execute builds the cross-workspace identity map from the users of several exports.
+func (ic *identitiesCommand) Execute(_ []string) error {
+	users := map[string]*slack.User{}
+
+	for _, input := range ic.Inputs {
+		err := readArchive(input, func(_ string, data *structs.Data) error {
+			for id, u := range data.Users {
+				users[id] = u
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("could not read export %q: %w", input, err)
+		}
+	}
+
+	list := make([]*slack.User, 0, len(users))
+	for _, u := range users {
+		list = append(list, u)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+
+	m := identity.Build(list)
+	if err := m.Save(ic.Out); err != nil {
+		return err
+	}
+
+	log.Printf("%d users belong to %d people", len(users), len(m.People))
+
+	return nil
+}
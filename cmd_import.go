@@ -0,0 +1,227 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/slack-go/slack"
+
+	"github.com/chuhlomin/slack-exporter/pkg/structs"
+)
+
+var errImportArgs = fmt.Errorf("pass the path to the ZIP file (or the unzipped directory) of the Slack export")
+
+type importCommand struct{}
+
+// Execute converts the export downloaded by the workspace admin (Settings & administration,
+// Import/Export Data) to the output directory in --format, so it's browsed with serve,
+// searched and rendered like the export made by the app. Files are not in such exports,
+// their URLs are kept in messages.
+func (ic *importCommand) Execute(args []string) error {
+	if len(args) != 1 {
+		return errImportArgs
+	}
+
+	src, err := openSlackExport(args[0])
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if err := os.MkdirAll(cfg.Output, 0o755); err != nil {
+		return fmt.Errorf("could not create output directory: %w", err)
+	}
+
+	channels := 0
+	err = src.Channels(func(data *structs.Data) error {
+		if err := renderChannel(data); err != nil {
+			return fmt.Errorf("could not write channel %s: %w", data.Channel.ID, err)
+		}
+		channels++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("%d channels of %s are imported to %s", channels, args[0], cfg.Output)
+
+	return nil
+}
+
+// slackExportSource reads the official Slack export, the ZIP file or the unzipped directory:
+// users.json, channels.json, groups.json, mpims.json and dms.json list conversations,
+// messages of every conversation are in <name or ID>/<YYYY-MM-DD>.json with thread replies
+// next to other messages.
+type slackExportSource struct {
+	fsys   fs.FS
+	closer io.Closer
+	// days are message files by the conversation directory
+	days map[string][]string
+}
+
+func openSlackExport(filename string) (*slackExportSource, error) {
+	ss := &slackExportSource{days: map[string][]string{}}
+
+	if info, err := os.Stat(filename); err == nil && info.IsDir() {
+		ss.fsys = os.DirFS(filename)
+	} else {
+		r, err := zip.OpenReader(filename)
+		if err != nil {
+			return nil, fmt.Errorf("could not open export: %w", err)
+		}
+		ss.fsys, ss.closer = r, r
+	}
+
+	days, err := fs.Glob(ss.fsys, "*/*.json")
+	if err != nil {
+		ss.Close()
+		return nil, fmt.Errorf("could not list messages: %w", err)
+	}
+
+	// sorted by the name of the directory and then by the day
+	for _, name := range days {
+		dir := path.Dir(name)
+		ss.days[dir] = append(ss.days[dir], name)
+	}
+
+	return ss, nil
+}
+
+// Close closes the ZIP file.
+func (ss *slackExportSource) Close() error {
+	if ss.closer == nil {
+		return nil
+	}
+	return ss.closer.Close()
+}
+
+func (ss *slackExportSource) Channels(fn func(data *structs.Data) error) error {
+	var users []slack.User
+	if err := ss.readJSON("users.json", &users); err != nil {
+		return err
+	}
+
+	allUsers := make(map[string]*slack.User, len(users))
+	for i := range users {
+		allUsers[users[i].ID] = &users[i]
+	}
+
+	// the lists don't have the type of conversations,
+	// DMs have no names, their directories are named by ID
+	lists := []struct {
+		filename string
+		mark     func(c *slack.Channel)
+		byID     bool
+	}{
+		{"channels.json", func(c *slack.Channel) { c.IsChannel = true }, false},
+		{"groups.json", func(c *slack.Channel) { c.IsPrivate, c.IsGroup = true, true }, false},
+		{"mpims.json", func(c *slack.Channel) { c.IsPrivate, c.IsMpIM = true, true }, false},
+		{"dms.json", func(c *slack.Channel) { c.IsIM = true }, true},
+	}
+
+	for _, list := range lists {
+		var channels []slack.Channel
+		if err := ss.readJSON(list.filename, &channels); err != nil {
+			return err
+		}
+
+		for _, channel := range channels {
+			list.mark(&channel)
+
+			dir := channel.Name
+			if list.byID {
+				dir = channel.ID
+			}
+
+			data, err := ss.channel(channel, dir, allUsers)
+			if err != nil {
+				return fmt.Errorf("could not read channel %s: %w", dir, err)
+			}
+
+			if err := fn(data); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// channel returns messages of the channel newest first with thread replies,
+// like the app exports them, and users of the messages.
+func (ss *slackExportSource) channel(channel slack.Channel, dir string, allUsers map[string]*slack.User) (*structs.Data, error) {
+	var msgs []slack.Message
+	for _, name := range ss.days[dir] {
+		var day []slack.Message
+		if err := ss.readJSON(name, &day); err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, day...)
+	}
+
+	data := &structs.Data{
+		Channel:   channel,
+		Members:   channel.Members,
+		Users:     map[string]*slack.User{},
+		Files:     map[string]string{},
+		FilePaths: map[string]string{},
+	}
+
+	replies := map[string][]slack.Message{}
+	for _, msg := range msgs {
+		if u, ok := allUsers[msg.User]; ok {
+			data.Users[msg.User] = u
+		}
+
+		// files fetched with fetch-files before the import
+		for _, file := range msg.Files {
+			if filename := storedFilename(file.ID); filename != "" {
+				data.Files[file.ID] = filename
+				data.FilePaths[file.ID] = layoutPath(channel.ID, file.ID, filename, newCollectedFile(file, first(msg.ThreadTimestamp, msg.Timestamp)))
+			}
+		}
+
+		if msg.ThreadTimestamp != "" && msg.ThreadTimestamp != msg.Timestamp {
+			replies[msg.ThreadTimestamp] = append(replies[msg.ThreadTimestamp], msg)
+			continue
+		}
+		data.Messages = append(data.Messages, structs.Message{Message: msg})
+	}
+
+	for i := range data.Messages {
+		data.Messages[i].Replies = replies[data.Messages[i].Timestamp]
+	}
+
+	sort.SliceStable(data.Messages, func(i, j int) bool {
+		return parseTimestamp(data.Messages[i].Timestamp).After(parseTimestamp(data.Messages[j].Timestamp))
+	})
+
+	return data, nil
+}
+
+// readJSON reads the file of the export, the missing file is the export
+// without such conversations (like groups.json of the public export).
+func (ss *slackExportSource) readJSON(name string, v interface{}) error {
+	content, err := fs.ReadFile(ss.fsys, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not read %s: %w", name, err)
+	}
+
+	if err := json.Unmarshal(content, v); err != nil {
+		return fmt.Errorf("could not decode %s: %w", name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/chuhlomin/slack-exporter/pkg/structs"
+)
+
+var errNoMigration = fmt.Errorf("no migration to the latest schema version")
+
+// migrations upgrade the channel export from the schema version (the index) to the next one.
+var migrations = []func(data *structs.Data){
+	0: migrateLocalFiles,
+}
+
+type migrateCommand struct {
+	DryRun bool `long:"dry-run" description:"Only list the channels which would be migrated"`
+}
+
+// Execute upgrades channels of the export in the output directory (<channel>.json of the json format)
+// to the latest schema version, so archives made by older versions are read as new ones.
+// Channels exported by newer versions are left as is.
+func (mc *migrateCommand) Execute(_ []string) error {
+	if len(migrations) != structs.SchemaVersion {
+		return errNoMigration
+	}
+
+	var migrated int
+
+	err := readArchive(cfg.Output, func(path string, data *structs.Data) error {
+		if data.SchemaVersion > structs.SchemaVersion {
+			log.Printf("Channel %s has the newer schema version %d, skipping", data.Channel.ID, data.SchemaVersion)
+			return nil
+		}
+		if data.SchemaVersion == structs.SchemaVersion {
+			return nil
+		}
+
+		migrated++
+
+		if mc.DryRun {
+			fmt.Printf("%s\t%d\n", data.Channel.ID, data.SchemaVersion)
+			return nil
+		}
+
+		for version := data.SchemaVersion; version < structs.SchemaVersion; version++ {
+			migrations[version](data)
+		}
+		data.SchemaVersion = structs.SchemaVersion
+
+		if err := writeChannelFile(path, data); err != nil {
+			return fmt.Errorf("could not write file: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("%d channels migrated to schema version %d", migrated, structs.SchemaVersion)
+
+	return nil
+}
+
+// migrateLocalFiles upgrades exports made before schema versions: downloaded files get paths
+// (they were in the directory of the channel) and messages get their local, external and shared files
+// and messages and link previews, which were only in the message content.
+func migrateLocalFiles(data *structs.Data) {
+	if len(data.Files) > 0 && data.FilePaths == nil {
+		data.FilePaths = map[string]string{}
+	}
+	for id := range data.Files {
+		if _, ok := data.FilePaths[id]; !ok {
+			if path := localFilePath(data, id); path != "" {
+				data.FilePaths[id] = path
+			}
+		}
+	}
+
+	for i, msg := range data.Messages {
+		if msg.LocalFiles == nil && data.Files != nil {
+			data.Messages[i].LocalFiles = localFiles(msg, data.FilePaths, data.Thumbnails, data.MissingFiles)
+		}
+		if msg.ExternalFiles == nil {
+			data.Messages[i].ExternalFiles = externalFiles(msg)
+		}
+		if msg.SharedMessages == nil {
+			data.Messages[i].SharedMessages = sharedMessages(msg)
+		}
+		if msg.Unfurls == nil {
+			data.Messages[i].Unfurls = unfurls(msg)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/slack-go/slack"
+
+	"github.com/chuhlomin/slack-exporter/pkg/elastic"
+	"github.com/chuhlomin/slack-exporter/pkg/structs"
+)
+
+var errNothingToPrune = fmt.Errorf("--before or --channel is required")
+
+type pruneCommand struct {
+	Before   date     `long:"before" description:"Remove messages (with threads) posted before the day, like 2022-01-01, and their downloaded files"`
+	Channels []string `long:"channel" description:"Remove the channel export with its files entirely; can be repeated"`
+	DryRun   bool     `long:"dry-run" description:"Only print what would be removed"`
+}
+
+// Execute removes old messages and whole channels from the export in the output directory
+// to honor retention policies on the archive itself. Downloaded files of the removed messages are deleted,
+// the search index is dropped to be rebuilt and documents are deleted from --index when it's set.
+func (pc *pruneCommand) Execute(_ []string) error {
+	if pc.Before.IsZero() && len(pc.Channels) == 0 {
+		return errNothingToPrune
+	}
+
+	var (
+		channels, messages, files int
+		changed                   bool
+	)
+
+	for _, channelID := range pc.Channels {
+		removed, err := pc.removeChannel(channelID)
+		if err != nil {
+			return fmt.Errorf("could not remove channel %q: %w", channelID, err)
+		}
+		if removed {
+			channels++
+			changed = true
+		}
+	}
+
+	if !pc.Before.IsZero() {
+		err := readArchive(cfg.Output, func(path string, data *structs.Data) error {
+			m, f, err := pc.pruneChannel(path, data)
+			messages += m
+			files += f
+			if m > 0 {
+				changed = true
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if changed && !pc.DryRun {
+		if err := os.Remove(filepath.Join(cfg.Output, searchIndexFilename)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("could not remove search index: %w", err)
+		}
+
+		if cfg.Index != "" {
+			if err := pc.pruneIndex(context.Background()); err != nil {
+				return fmt.Errorf("could not prune index: %w", err)
+			}
+		}
+	}
+
+	log.Printf("%d channels, %d messages and %d files removed", channels, messages, files)
+
+	return nil
+}
+
+// removeChannel removes all the files of the channel export in any format and the downloaded files.
+func (pc *pruneCommand) removeChannel(channelID string) (bool, error) {
+	paths, err := filepath.Glob(filepath.Join(cfg.Output, channelID+".*"))
+	if err != nil {
+		return false, fmt.Errorf("could not list files: %w", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(cfg.Output, channelID)); err == nil {
+		paths = append(paths, filepath.Join(cfg.Output, channelID))
+	}
+
+	for _, path := range paths {
+		if pc.DryRun {
+			fmt.Println(path)
+			continue
+		}
+
+		if err := os.RemoveAll(path); err != nil {
+			return false, fmt.Errorf("could not remove %q: %w", path, err)
+		}
+	}
+
+	return len(paths) > 0, nil
+}
+
+// pruneChannel removes messages posted before the cutoff with their threads from the channel export,
+// and the downloaded files which are no longer attached to any message.
+func (pc *pruneCommand) pruneChannel(path string, data *structs.Data) (messages, files int, err error) {
+	kept := data.Messages[:0]
+	for _, msg := range data.Messages {
+		if parseTimestamp(msg.Timestamp).Before(pc.Before.Time) {
+			messages += 1 + len(msg.Replies)
+			if pc.DryRun {
+				fmt.Printf("%s\t%s\n", data.Channel.ID, msg.Timestamp)
+			}
+			continue
+		}
+		kept = append(kept, msg)
+	}
+
+	if messages == 0 {
+		return 0, 0, nil
+	}
+
+	data.Messages = kept
+
+	attached := map[string]bool{}
+	collect := func(msg slack.Message) {
+		for _, f := range msg.Files {
+			attached[f.ID] = true
+		}
+	}
+	for _, msg := range data.Messages {
+		collect(msg.Message)
+		for _, reply := range msg.Replies {
+			collect(reply)
+		}
+	}
+
+	for id := range data.Files {
+		if attached[id] {
+			continue
+		}
+
+		path := localFilePath(data, id)
+
+		files++
+		delete(data.Files, id)
+		delete(data.FilePaths, id)
+		delete(data.Thumbnails, id)
+		delete(data.FileComments, id)
+
+		if pc.DryRun || path == "" {
+			continue
+		}
+
+		err := os.Remove(filepath.Join(cfg.Output, path))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return messages, files, fmt.Errorf("could not remove file %q: %w", id, err)
+		}
+	}
+
+	for id := range data.Lists {
+		if !attached[id] {
+			delete(data.Lists, id)
+		}
+	}
+
+	for id := range data.MissingFiles {
+		if !attached[id] {
+			delete(data.MissingFiles, id)
+		}
+	}
+
+	if pc.DryRun {
+		return messages, files, nil
+	}
+
+	return messages, files, writeChannelFile(path, data)
+}
+
+// pruneIndex deletes the documents of the removed channels and the messages before the cutoff from the index.
+func (pc *pruneCommand) pruneIndex(ctx context.Context) error {
+	ix, err := elastic.New(cfg.Index, httpTransport)
+	if err != nil {
+		return err
+	}
+
+	var should []interface{}
+	if len(pc.Channels) > 0 {
+		should = append(should, map[string]interface{}{
+			"terms": map[string]interface{}{"channel_id": pc.Channels},
+		})
+	}
+	if !pc.Before.IsZero() {
+		// replies are removed with their threads
+		should = append(should, map[string]interface{}{
+			"range": map[string]interface{}{
+				"thread_ts": map[string]string{"lt": strconv.FormatInt(pc.Before.Unix(), 10)},
+			},
+		}, map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must_not": map[string]interface{}{"exists": map[string]string{"field": "thread_ts"}},
+				"filter": map[string]interface{}{
+					"range": map[string]interface{}{
+						"ts": map[string]string{"lt": strconv.FormatInt(pc.Before.Unix(), 10)},
+					},
+				},
+			},
+		})
+	}
+
+	deleted, err := ix.DeleteByQuery(ctx, map[string]interface{}{
+		"bool": map[string]interface{}{"should": should},
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("%d documents deleted from the index", deleted)
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/slack-go/slack"
+
+	"github.com/chuhlomin/slack-exporter/pkg/structs"
+)
+
+var errRenderInput = fmt.Errorf("the export would be rendered over itself, set --input or --output")
+
+type renderCommand struct {
+	Input string `long:"input" description:"Directory of the JSON export to render with --source archive, the output directory by default"`
+}
+
+// Execute writes channels of the source to the output directory in --format (with --split-by),
+// so the export is made once and rendered as PDF, CSV, mbox and others many times.
+func (rc *renderCommand) Execute(_ []string) error {
+	input := rc.Input
+	if input == "" {
+		input = cfg.Output
+	}
+
+	if cfg.Source != sourceSlack && cfg.Format == formatJSON && cfg.SplitBy == "" &&
+		filepath.Clean(input) == filepath.Clean(cfg.Output) {
+		return errRenderInput
+	}
+
+	src, err := newSource(input)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(cfg.Output, 0o755); err != nil {
+		return fmt.Errorf("could not create output directory: %w", err)
+	}
+
+	channels := 0
+	err = src.Channels(func(data *structs.Data) error {
+		if err := renderChannel(data); err != nil {
+			return fmt.Errorf("could not render channel %s: %w", data.Channel.ID, err)
+		}
+		channels++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("%d channels are rendered to %s as %s", channels, cfg.Output, cfg.Format)
+
+	return nil
+}
+
+// renderChannel writes the channel to the sink of the output format.
+func renderChannel(data *structs.Data) error {
+	// users missing in the export (like deleted ones) are shown by ID
+	users := func(id string) (*slack.User, error) {
+		if u := data.Users[id]; u != nil {
+			return u, nil
+		}
+		return &slack.User{ID: id, Name: id}, nil
+	}
+
+	sink := newChannelSink(data.Members, users)
+	if err := sink.WriteChannel(&data.Channel); err != nil {
+		return err
+	}
+
+	for _, msg := range data.Messages {
+		if err := sink.WriteMessage(data.Channel.ID, msg); err != nil {
+			sink.Close(err)
+			return err
+		}
+	}
+
+	if err := sink.WriteData(data.Channel.ID, *data); err != nil {
+		sink.Close(err)
+		return err
+	}
+
+	return sink.Close(nil)
+}
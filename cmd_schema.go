@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/slack-go/slack"
+
+	"github.com/chuhlomin/slack-exporter/pkg/identity"
+	"github.com/chuhlomin/slack-exporter/pkg/parquet"
+	"github.com/chuhlomin/slack-exporter/pkg/schema"
+	"github.com/chuhlomin/slack-exporter/pkg/structs"
+)
+
+// archiveEntry describes a file (or a group of files) in the export output directory.
+type archiveEntry struct {
+	Path        string
+	Description string
+	// Type is the Go type the file is encoded from, nil for binary files.
+	Type interface{}
+	// Schema is the name of the generated JSON Schema file.
+	Schema string
+}
+
+// archiveLayout lists all the outputs of the exporter.
+// Update it whenever a new output is added, `schema` command generates
+// the documentation and JSON Schemas from it.
+var archiveLayout = []archiveEntry{
+	{
+		Path:        "<channel>.json",
+		Description: "Channel info, members, messages with thread replies, users and downloaded files; `<channel>.json.gz` with `--compress`",
+		Type:        structs.Data{},
+		Schema:      "data.schema.json",
+	},
+	{
+		Path:        "<channel>.ndjson",
+		Description: "Messages with thread replies, one per line (with `--format ndjson`)",
+		Type:        structs.Message{},
+		Schema:      "message.schema.json",
+	},
+	{
+		Path:        "<channel>.csv",
+		Description: "Messages and thread replies, one per row: " + strings.Join(csvHeader, ", ") + " and time after ts with `--human-time` (with `--format csv`)",
+	},
+	{
+		Path:        "<channel>.files.csv",
+		Description: "Files of messages and thread replies, one per row: " + strings.Join(filesIndexColumns, ", ") + " (with `--files-only`, instead of the messages)",
+	},
+	{
+		Path:        "<channel>.parquet",
+		Description: "Messages and thread replies, one per row: " + columnNames(messagesColumns) + " and time_iso after time with `--human-time` (with `--format parquet`)",
+	},
+	{
+		Path:        "users.parquet",
+		Description: "All the exported users: " + columnNames(usersColumns) + " (with `--format parquet`)",
+	},
+	{
+		Path:        "<channel>.pdf",
+		Description: "Conversation rendered to A4 pages with thread replies and downloaded images inline (with `--format pdf`)",
+	},
+	{
+		Path:        "<channel>.mbox",
+		Description: "Threads as e-mails from the author of the parent message to the repliers, in mboxrd format (with `--format mbox`)",
+	},
+	{
+		Path:        "<channel>.eml/<ts>.eml",
+		Description: "Threads as e-mails from the author of the parent message to the repliers, one file per thread (with `--format eml`)",
+	},
+	{
+		Path:        "<channel>.<period>.<format>",
+		Description: "Messages with thread replies of the day, month or year in the output format (with `--split-by`); other than json formats write channel info and members to `<channel>.<period>.meta.json`",
+	},
+	{
+		Path:        "<channel>.meta.json",
+		Description: "Channel info, members, users and downloaded files, without messages (with `--format ndjson`, `csv`, `parquet`, `pdf`, `mbox` or `eml`, or with `--split-by`)",
+		Type:        structs.Data{},
+		Schema:      "data.schema.json",
+	},
+	{
+		Path:        "<channel>.manifest.json",
+		Description: "How the channel was exported: version of the exporter, schema version, export time, format, filters, counts of messages, replies, downloaded files and users, and scopes of the token",
+		Type:        structs.ChannelManifest{},
+		Schema:      "channel_manifest.schema.json",
+	},
+	{
+		Path:        "<channel>.channel.json",
+		Description: "Channel creation time, creator, archive and sharing status, topic and purpose with the history of their changes (with `--channel-metadata`)",
+		Type:        structs.ChannelMetadata{},
+		Schema:      "channel_metadata.schema.json",
+	},
+	{
+		Path:        "files/<file>-<name>",
+		Description: "Every downloaded file once, even if it's shared into several channels (with `--download-files`)",
+	},
+	{
+		Path:        "<channel>/<file>-<name>",
+		Description: "Files attached to the channel messages, hard links to `files/<file>-<name>` (with `--download-files`); `--file-layout` changes where they are, their paths are in `file_paths` of `<channel>.json`",
+	},
+	{
+		Path:        "thumbnails/<file>.jpg",
+		Description: "Thumbnails of downloaded images and videos (with `--thumbnails`), their paths are in `thumbnails` of `<channel>.json` and in `local_files` of messages",
+	},
+	{
+		Path:        "sidebar.json",
+		Description: "Sidebar sections of the authed user in display order (with `--sidebar`)",
+		Type:        []structs.SidebarSection{},
+		Schema:      "sidebar.schema.json",
+	},
+	{
+		Path:        "reminders.json",
+		Description: "Reminders of the authed user (with `--reminders`)",
+		Type:        []slack.Reminder{},
+		Schema:      "reminders.schema.json",
+	},
+	{
+		Path:        "reminders.ics",
+		Description: "Pending reminders with due dates as calendar events (with `--reminders`)",
+	},
+	{
+		Path:        accessLogsFilename,
+		Description: "Logins to the workspace with IP addresses and devices (with `--audit-logs`)",
+		Type:        []slack.Login{},
+		Schema:      "access_logs.schema.json",
+	},
+	{
+		Path:        integrationLogsFilename,
+		Description: "Apps and integrations added, changed and removed (with `--audit-logs`)",
+		Type:        []structs.IntegrationLog{},
+		Schema:      "integration_logs.schema.json",
+	},
+	{
+		Path:        "saved.json",
+		Description: "Items saved by the authed user with the messages (with threads) and files they refer to (with `--saved`)",
+		Type:        structs.Saved{},
+		Schema:      "saved.schema.json",
+	},
+	{
+		Path:        savedDir + "/<file>-<name>",
+		Description: "Files of the saved items (with `--saved` and `--download-files`)",
+	},
+	{
+		Path:        brandingFilename,
+		Description: "Names, domains and downloaded icons of the workspace and of its Enterprise Grid org (with `--branding`)",
+		Type:        structs.Branding{},
+		Schema:      "branding.schema.json",
+	},
+	{
+		Path:        brandingDirname + "/<team>.png",
+		Description: "Icons of the workspace and of its Enterprise Grid org (with `--branding`)",
+	},
+	{
+		Path:        unfurlsDirname + "/<hash>.<ext>",
+		Description: "Preview images of links in messages, referenced by `thumbnail` of `unfurls` (with `--unfurl-thumbnails`)",
+	},
+	{
+		Path:        "avatars/<user>.png",
+		Description: "User avatars (with `--download-avatars`)",
+	},
+	{
+		Path:        searchIndexFilename,
+		Description: "Search index of the export, built by `search` command",
+	},
+	{
+		Path:        emojiArchiveDirname + "/" + emojiArchiveFilename,
+		Description: "Custom emoji names mapped to image URLs or `alias:<name>` as emoji.list returns them, with the images next to it (`emoji download` command); `render` and emoji tools read this map as is",
+		Type:        map[string]string{},
+		Schema:      "emoji.schema.json",
+	},
+	{
+		Path:        emojiArchiveDirname + "/" + emojiMetadataFilename,
+		Description: "Who uploaded every custom emoji and when (`emoji download --admin`); kept apart from `emoji.json`, since only the org admin token can read it and `emoji.json` stays the plain map for its readers",
+		Type:        map[string]emojiMetadata{},
+		Schema:      "emoji_metadata.schema.json",
+	},
+	{
+		Path:        emojiUsageFilename,
+		Description: "Emoji used in message text and reactions, most used first, linked to the emoji archive (`emoji` command)",
+		Type:        []emojiUsage{},
+		Schema:      "emoji_usage.schema.json",
+	},
+	{
+		Path:        analyticsFilename,
+		Description: "Activity of users and channels, messages by hour and day of the week, most used reactions and emoji (`analyze` command)",
+		Type:        analyticsReport{},
+		Schema:      "analytics.schema.json",
+	},
+	{
+		Path:        analyticsUsersFilename + ", " + analyticsChannelsFilename,
+		Description: "Activity of users and channels, one per row (`analyze --csv`)",
+	},
+	{
+		Path:        analyticsHTMLFilename,
+		Description: "Charts of the activity (`analyze --html`)",
+	},
+	{
+		Path:        usersFilename,
+		Description: "All users of the workspace sorted by ID (`users` command)",
+		Type:        []*slack.User{},
+		Schema:      "users.schema.json",
+	},
+	{
+		Path:        verifyFilename,
+		Description: "Days of channels where the number of messages or replies differs from Slack (`verify` command)",
+		Type:        verifyReport{},
+		Schema:      "verify.schema.json",
+	},
+	{
+		Path:        manifestFilename,
+		Description: "Every file of the final snapshot with its size and SHA-256, and the run summary (with `--final-snapshot`)",
+		Type:        snapshotManifest{},
+		Schema:      "manifest.schema.json",
+	},
+	{
+		Path:        workspacesFilename,
+		Description: "Workspaces exported in one run to `<name>/` directories with their teams and summaries, and the combined summary (with `--workspaces`)",
+		Type:        workspacesManifest{},
+		Schema:      "workspaces.schema.json",
+	},
+	{
+		Path:        errorsFilename,
+		Description: "Channels, users, files and other items of the last run which could not be exported, with their status and error",
+		Type:        failureReport{},
+		Schema:      "errors.schema.json",
+	},
+	{
+		Path:        resultFilename,
+		Description: "Exit code and its category, the error, counts of `errors.json` items and the summary of the last run",
+		Type:        runResult{},
+		Schema:      "result.schema.json",
+	},
+	{
+		Path:        deadLetterFilename,
+		Description: "Webhooks which could not be delivered, one per line (with `--webhook-url`)",
+	},
+	{
+		Path:        "identities.json",
+		Description: "People matched by email across several workspaces (`identities` command)",
+		Type:        identity.Map{},
+		Schema:      "identities.schema.json",
+	},
+}
+
+// columnNames returns comma-separated names of the Parquet columns, repeated ones are marked as lists.
+func columnNames(columns []parquet.Column) string {
+	names := make([]string, 0, len(columns))
+	for _, col := range columns {
+		if col.Repeated {
+			names = append(names, col.Name+" (list)")
+			continue
+		}
+		names = append(names, col.Name)
+	}
+
+	return strings.Join(names, ", ")
+}
+
+type schemaCommand struct {
+	Dir string `long:"dir" description:"Directory to write the layout documentation and JSON Schemas to" default:"schema"`
+}
+
+// Execute writes archive layout documentation and JSON Schemas for all outputs.
+func (sc *schemaCommand) Execute(_ []string) error {
+	if err := os.MkdirAll(sc.Dir, 0o755); err != nil {
+		return fmt.Errorf("could not create schema directory: %w", err)
+	}
+
+	b := &strings.Builder{}
+	b.WriteString("# Archive layout\n\n")
+	b.WriteString("<!-- Code generated by `slack-exporter schema`. DO NOT EDIT. -->\n\n")
+	b.WriteString("| Path | Description | Schema |\n")
+	b.WriteString("|------|-------------|--------|\n")
+
+	for _, entry := range archiveLayout {
+		schemaLink := ""
+
+		if entry.Type != nil {
+			s := schema.Generate(entry.Type, entry.Path, entry.Description)
+
+			content := &bytes.Buffer{}
+			enc := json.NewEncoder(content)
+			enc.SetEscapeHTML(false)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(s); err != nil {
+				return fmt.Errorf("could not marshal schema for %q: %w", entry.Path, err)
+			}
+
+			filename := filepath.Join(sc.Dir, entry.Schema)
+			if err := writePending(filename, content.Bytes()); err != nil {
+				return fmt.Errorf("could not write schema %q: %w", filename, err)
+			}
+
+			schemaLink = fmt.Sprintf("[%s](%s)", entry.Schema, entry.Schema)
+		}
+
+		fmt.Fprintf(b, "| `%s` | %s | %s |\n", entry.Path, entry.Description, schemaLink)
+	}
+
+	filename := filepath.Join(sc.Dir, "layout.md")
+	if err := writePending(filename, []byte(b.String())); err != nil {
+		return fmt.Errorf("could not write layout %q: %w", filename, err)
+	}
+
+	return nil
+}
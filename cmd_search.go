@@ -0,0 +1,231 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+
+	"github.com/chuhlomin/slack-exporter/pkg/render"
+	"github.com/chuhlomin/slack-exporter/pkg/search"
+	"github.com/chuhlomin/slack-exporter/pkg/structs"
+)
+
+// searchIndexFilename is the search index in the output directory.
+const searchIndexFilename = ".search.gob"
+
+const dateFormat = "2006-01-02"
+
+type searchCommand struct {
+	Channel      string `long:"channel" description:"Channel ID or name"`
+	User         string `long:"user" description:"User ID or name"`
+	From         string `long:"from" description:"Messages sent on or after the date, like 2024-01-31"`
+	To           string `long:"to" description:"Messages sent on or before the date, like 2024-12-31"`
+	Context      int    `long:"context" description:"Number of messages to show before and after every match" default:"0"`
+	Limit        int    `long:"limit" description:"Maximum number of matches to print, 0 for all" default:"50"`
+	WorkspaceURL string `long:"workspace-url" description:"Workspace URL for permalinks, like https://acme.slack.com" default:"https://slack.com"`
+	Reindex      bool   `long:"reindex" description:"Rebuild the index even if it's up to date"`
+
+	Args struct {
+		Terms []string `positional-arg-name:"terms"`
+	} `positional-args:"yes"`
+}
+
+// Execute searches messages of the export in the output directory,
+// building the index on first use and whenever the export changes.
+func (sc *searchCommand) Execute(_ []string) error {
+	q := search.Query{
+		Channel: sc.Channel,
+		User:    sc.User,
+	}
+
+	for _, term := range sc.Args.Terms {
+		q.Terms = append(q.Terms, search.Tokenize(term)...)
+	}
+
+	var err error
+	if sc.From != "" {
+		if q.From, err = time.ParseInLocation(dateFormat, sc.From, time.Local); err != nil {
+			return fmt.Errorf("could not parse --from: %w", err)
+		}
+	}
+	if sc.To != "" {
+		if q.To, err = time.ParseInLocation(dateFormat, sc.To, time.Local); err != nil {
+			return fmt.Errorf("could not parse --to: %w", err)
+		}
+		// the query excludes To, the day itself is included
+		q.To = q.To.AddDate(0, 0, 1)
+	}
+
+	ix, err := sc.index()
+	if err != nil {
+		return err
+	}
+
+	ids := ix.Search(q)
+	if len(ids) == 0 {
+		log.Printf("No messages found")
+		return nil
+	}
+
+	shown := ids
+	if sc.Limit > 0 && len(shown) > sc.Limit {
+		shown = shown[:sc.Limit]
+	}
+
+	for _, id := range shown {
+		before, after := ix.Context(id, sc.Context)
+
+		for _, i := range before {
+			fmt.Println(sc.formatDoc(ix.Docs[i], "  │ "))
+		}
+		fmt.Println(sc.formatDoc(ix.Docs[id], ""))
+		fmt.Println("  " + sc.permalink(ix.Docs[id]))
+		for _, i := range after {
+			fmt.Println(sc.formatDoc(ix.Docs[i], "  │ "))
+		}
+		fmt.Println()
+	}
+
+	if len(shown) < len(ids) {
+		log.Printf("Showing %d of %d matches, use --limit to see more", len(shown), len(ids))
+	}
+
+	return nil
+}
+
+// index loads the index of the export, rebuilding it when it's older than the export files.
+func (sc *searchCommand) index() (*search.Index, error) {
+	filename := filepath.Join(cfg.Output, searchIndexFilename)
+
+	if !sc.Reindex {
+		ix, err := search.Load(filename)
+		if err == nil && !exportChangedSince(ix.Built) {
+			return ix, nil
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Could not load search index, rebuilding: %v", err)
+		}
+	}
+
+	log.Printf("Indexing %s", cfg.Output)
+
+	ix := search.New()
+	err := readArchive(cfg.Output, func(_ string, data *structs.Data) error {
+		var docs []search.Doc
+
+		add := func(msg slack.Message) {
+			doc := search.Doc{
+				Channel:     data.Channel.ID,
+				ChannelName: data.Channel.Name,
+				Timestamp:   msg.Timestamp,
+				ThreadTS:    msg.ThreadTimestamp,
+				User:        msg.User,
+				UserName:    msg.Username,
+				Text:        render.Text(msg),
+				Time:        parseTimestamp(msg.Timestamp),
+				Permalink:   msg.Permalink,
+			}
+			if u, ok := data.Users[msg.User]; ok && u != nil {
+				doc.UserName = first(u.Name, userDisplayName(u))
+			}
+			docs = append(docs, doc)
+		}
+
+		for _, msg := range data.Messages {
+			add(msg.Message)
+			for _, reply := range msg.Replies {
+				add(reply)
+			}
+		}
+
+		// channel messages in chronological order, so neighbors are the context
+		sort.SliceStable(docs, func(i, j int) bool {
+			return docs[i].Time.Before(docs[j].Time)
+		})
+
+		for _, doc := range docs {
+			ix.Add(doc)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not index export: %w", err)
+	}
+
+	if err := ix.Save(filename); err != nil {
+		log.Printf("Could not save search index: %v", err)
+	}
+
+	return ix, nil
+}
+
+// exportChangedSince reports whether any channel file was modified after the time.
+func exportChangedSince(t time.Time) bool {
+	entries, err := os.ReadDir(cfg.Output)
+	if err != nil {
+		return true
+	}
+
+	for _, entry := range entries {
+		if !structs.IsChannelFile(entry.Name()) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (sc *searchCommand) formatDoc(doc search.Doc, prefix string) string {
+	channel := doc.ChannelName
+	if channel == "" {
+		channel = doc.Channel
+	}
+
+	user := first(doc.UserName, doc.User)
+
+	text := strings.ReplaceAll(doc.Text, "\n", "\n"+prefix+"    ")
+
+	return fmt.Sprintf(
+		"%s%s  #%s  @%s\n%s    %s",
+		prefix,
+		doc.Time.Local().Format("2006-01-02 15:04"),
+		channel,
+		user,
+		prefix,
+		text,
+	)
+}
+
+// permalink returns the link to the message in Slack:
+// the exported one (with --permalinks) or the one built from the workspace URL.
+func (sc *searchCommand) permalink(doc search.Doc) string {
+	if doc.Permalink != "" {
+		return doc.Permalink
+	}
+
+	return permalink(sc.WorkspaceURL, doc.Channel, doc.Timestamp, doc.ThreadTS)
+}
+
+// first returns the first non-empty string.
+func first(ss ...string) string {
+	for _, s := range ss {
+		if s != "" {
+			return s
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+
+	"github.com/chuhlomin/slack-exporter/pkg/mrkdwn"
+	"github.com/chuhlomin/slack-exporter/pkg/render"
+	"github.com/chuhlomin/slack-exporter/pkg/search"
+	"github.com/chuhlomin/slack-exporter/pkg/structs"
+)
+
+//go:embed serve.html
+var serveHTML []byte
+
+type serveCommand struct {
+	Address string `long:"listen" description:"Address to listen on" default:"localhost:8080"`
+}
+
+// viewerChannel is a channel in the viewer list.
+type viewerChannel struct {
+	ID       string `json:"id"`
+	Title    string `json:"title"`
+	Messages int    `json:"messages"`
+}
+
+// viewerFile is a file attached to the message.
+type viewerFile struct {
+	Name     string `json:"name"`
+	Mimetype string `json:"mimetype"`
+	// URL is the downloaded file (served by the viewer) or the original Slack URL.
+	URL   string `json:"url"`
+	Local bool   `json:"local"`
+	// Thumbnail is the URL of the thumbnail of the downloaded image or video, with --thumbnails.
+	Thumbnail string `json:"thumbnail,omitempty"`
+}
+
+// viewerBranding is the workspace shown in the header, exported with --branding.
+type viewerBranding struct {
+	Name       string `json:"name,omitempty"`
+	Domain     string `json:"domain,omitempty"`
+	Icon       string `json:"icon,omitempty"`
+	Enterprise string `json:"enterprise,omitempty"`
+}
+
+// viewerMessage is a message or thread reply, as rendered by the viewer.
+type viewerMessage struct {
+	Channel    string       `json:"channel"`
+	Timestamp  string       `json:"ts"`
+	ThreadTS   string       `json:"thread_ts,omitempty"`
+	Time       time.Time    `json:"time"`
+	User       string       `json:"user"`
+	Avatar     string       `json:"avatar,omitempty"`
+	Text       string       `json:"text"`
+	HTML       string       `json:"html"`
+	ReplyCount int          `json:"reply_count,omitempty"`
+	Broadcast  bool         `json:"broadcast,omitempty"`
+	Reactions  string       `json:"reactions,omitempty"`
+	Files      []viewerFile `json:"files,omitempty"`
+}
+
+// viewer serves the export loaded into memory.
+type viewer struct {
+	channels []viewerChannel
+	data     map[string]*structs.Data
+	// messages of the channels in chronological order
+	messages map[string][]structs.Message
+	index    *search.Index
+	branding viewerBranding
+}
+
+// Execute serves the export in the output directory with a web UI.
+func (sc *serveCommand) Execute(_ []string) error {
+	v := &viewer{
+		data:     map[string]*structs.Data{},
+		messages: map[string][]structs.Message{},
+	}
+
+	err := readArchive(cfg.Output, func(_ string, data *structs.Data) error {
+		id := data.Channel.ID
+		v.data[id] = data
+
+		msgs := data.Messages
+		sort.SliceStable(msgs, func(i, j int) bool {
+			return parseTimestamp(msgs[i].Timestamp).Before(parseTimestamp(msgs[j].Timestamp))
+		})
+		v.messages[id] = msgs
+
+		v.channels = append(v.channels, viewerChannel{
+			ID:       id,
+			Title:    channelTitle(data),
+			Messages: len(msgs),
+		})
+
+		// messages are kept by the viewer
+		data.Messages = nil
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not read export: %w", err)
+	}
+
+	sort.Slice(v.channels, func(i, j int) bool {
+		return strings.ToLower(v.channels[i].Title) < strings.ToLower(v.channels[j].Title)
+	})
+
+	v.index, err = (&searchCommand{}).index()
+	if err != nil {
+		return err
+	}
+
+	branding, err := readBranding(cfg.Output)
+	if err != nil {
+		return err
+	}
+	if branding != nil && branding.Workspace != nil {
+		v.branding = viewerBranding{
+			Name:   first(branding.Workspace.Name, branding.Workspace.ID),
+			Domain: branding.Workspace.Domain,
+		}
+		if branding.Icon != "" {
+			v.branding.Icon = "/" + branding.Icon
+		}
+		if branding.Enterprise != nil {
+			v.branding.Enterprise = branding.Enterprise.Name
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(serveHTML)
+	})
+	mux.HandleFunc("GET /api/branding", v.handleBranding)
+	mux.HandleFunc("GET /api/channels", v.handleChannels)
+	mux.HandleFunc("GET /api/channels/{id}/messages", v.handleMessages)
+	mux.HandleFunc("GET /api/channels/{id}/threads/{ts}", v.handleThread)
+	mux.HandleFunc("GET /api/search", v.handleSearch)
+	mux.HandleFunc("GET /files/{channel}/{id}/{name}", v.handleFile)
+	mux.HandleFunc("GET /thumbnails/{channel}/{id}", v.handleThumbnail)
+	mux.HandleFunc("GET /branding/{name}", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, filepath.Join(cfg.Output, brandingDirname, filepath.Base(r.PathValue("name"))))
+	})
+	mux.HandleFunc("GET /avatars/{name}", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, filepath.Join(cfg.Output, "avatars", filepath.Base(r.PathValue("name"))))
+	})
+
+	listener, err := net.Listen("tcp", sc.Address)
+	if err != nil {
+		return fmt.Errorf("could not listen: %w", err)
+	}
+
+	log.Printf("Serving %d channels of %s on http://%s", len(v.channels), cfg.Output, listener.Addr())
+
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	return server.Serve(listener)
+}
+
+func (v *viewer) handleBranding(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, v.branding)
+}
+
+func (v *viewer) handleChannels(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, v.channels)
+}
+
+// handleMessages returns up to limit messages sent before the "before" timestamp (latest by default),
+// in chronological order.
+func (v *viewer) handleMessages(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	msgs, ok := v.messages[id]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	end := len(msgs)
+	if before := r.URL.Query().Get("before"); before != "" {
+		t := parseTimestamp(before)
+		end = sort.Search(len(msgs), func(i int) bool {
+			return !parseTimestamp(msgs[i].Timestamp).Before(t)
+		})
+	}
+	start := max(0, end-limit)
+
+	result := make([]viewerMessage, 0, end-start)
+	for _, msg := range msgs[start:end] {
+		result = append(result, v.message(id, msg.Message))
+	}
+
+	writeJSON(w, result)
+}
+
+func (v *viewer) handleThread(w http.ResponseWriter, r *http.Request) {
+	id, ts := r.PathValue("id"), r.PathValue("ts")
+	msgs := v.messages[id]
+
+	i := sort.Search(len(msgs), func(i int) bool {
+		return !parseTimestamp(msgs[i].Timestamp).Before(parseTimestamp(ts))
+	})
+	if i == len(msgs) || msgs[i].Timestamp != ts {
+		http.NotFound(w, r)
+		return
+	}
+
+	result := []viewerMessage{v.message(id, msgs[i].Message)}
+	for _, reply := range msgs[i].Replies {
+		result = append(result, v.message(id, reply))
+	}
+
+	writeJSON(w, result)
+}
+
+func (v *viewer) handleSearch(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	q := search.Query{
+		Terms:   search.Tokenize(params.Get("q")),
+		Channel: params.Get("channel"),
+		User:    params.Get("user"),
+	}
+	if from := params.Get("from"); from != "" {
+		q.From, _ = time.ParseInLocation(dateFormat, from, time.Local)
+	}
+	if to := params.Get("to"); to != "" {
+		q.To, _ = time.ParseInLocation(dateFormat, to, time.Local)
+	}
+
+	ids := v.index.Search(q)
+	if len(ids) > 200 {
+		ids = ids[len(ids)-200:]
+	}
+
+	result := make([]viewerMessage, 0, len(ids))
+	for _, i := range ids {
+		doc := v.index.Docs[i]
+		result = append(result, viewerMessage{
+			Channel:   doc.Channel,
+			Timestamp: doc.Timestamp,
+			ThreadTS:  doc.ThreadTS,
+			Time:      doc.Time,
+			User:      first(doc.UserName, doc.User),
+			Text:      doc.Text,
+			HTML:      v.html(doc.Channel, doc.Text),
+		})
+	}
+
+	writeJSON(w, result)
+}
+
+// handleFile serves the downloaded file of the channel by its ID, the name is for the browser.
+func (v *viewer) handleFile(w http.ResponseWriter, r *http.Request) {
+	data, ok := v.data[r.PathValue("channel")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	path := localFilePath(data, r.PathValue("id"))
+	if path == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	http.ServeFile(w, r, filepath.Join(cfg.Output, path))
+}
+
+// handleThumbnail serves the thumbnail of the downloaded file of the channel by its ID.
+func (v *viewer) handleThumbnail(w http.ResponseWriter, r *http.Request) {
+	data, ok := v.data[r.PathValue("channel")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	path, ok := data.Thumbnails[r.PathValue("id")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	http.ServeFile(w, r, filepath.Join(cfg.Output, path))
+}
+
+// html converts mrkdwn of the message text to HTML with names of users and channels of the export.
+func (v *viewer) html(channel, text string) string {
+	data := v.data[channel]
+
+	return mrkdwn.HTML(text, mrkdwn.Options{
+		User: func(id string) string {
+			if u := data.Users[id]; u != nil {
+				return userDisplayName(u)
+			}
+			return ""
+		},
+		Channel: func(id string) string {
+			if d, ok := v.data[id]; ok {
+				return d.Channel.Name
+			}
+			return ""
+		},
+		Date: func(t time.Time, format string) string {
+			return render.Date(inTimezone(t), format)
+		},
+	})
+}
+
+func (v *viewer) message(channel string, msg slack.Message) viewerMessage {
+	data := v.data[channel]
+
+	vm := viewerMessage{
+		Channel:    channel,
+		Timestamp:  msg.Timestamp,
+		ThreadTS:   msg.ThreadTimestamp,
+		Time:       parseTimestamp(msg.Timestamp),
+		User:       first(msg.Username, msg.User),
+		Text:       render.Text(msg),
+		HTML:       v.html(channel, render.Text(msg)),
+		ReplyCount: msg.ReplyCount,
+		Broadcast:  structs.IsBroadcast(msg),
+		Reactions:  reactionsSummary(msg),
+	}
+
+	if u, ok := data.Users[msg.User]; ok && u != nil {
+		vm.User = first(userDisplayName(u), msg.User)
+		vm.Avatar = "/avatars/" + u.ID + ".png"
+	}
+
+	for _, f := range msg.Files {
+		vf := viewerFile{
+			Name:     first(f.Title, f.Name),
+			Mimetype: f.Mimetype,
+			URL:      first(f.URLPrivateDownload, f.URLPrivate, f.Permalink),
+		}
+		if filename := data.Files[f.ID]; localFilePath(data, f.ID) != "" {
+			vf.URL = "/files/" + channel + "/" + f.ID + "/" + url.PathEscape(filename)
+			vf.Local = true
+		}
+		if _, ok := data.Thumbnails[f.ID]; ok {
+			vf.Thumbnail = "/thumbnails/" + channel + "/" + f.ID
+		}
+		vm.Files = append(vm.Files, vf)
+	}
+
+	return vm
+}
+
+// channelTitle returns the name of the channel as shown in the Slack sidebar.
+func channelTitle(data *structs.Data) string {
+	channel := data.Channel
+
+	switch {
+	case channel.IsIM:
+		if u, ok := data.Users[channel.User]; ok && u != nil {
+			return "@" + first(userDisplayName(u), channel.User)
+		}
+		return "@" + channel.User
+	case channel.IsMpIM:
+		return strings.Replace(channel.Purpose.Value, "Group messaging with: ", "", 1)
+	case channel.Name != "":
+		return "#" + channel.Name
+	default:
+		return channel.ID
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Could not write response: %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/slack-go/slack"
+)
+
+// usersFilename lists all users of the workspace exported by the users command.
+const usersFilename = "users.json"
+
+type usersCommand struct{}
+
+// Execute writes all users of the workspace (with --profile-fields, with custom profile fields)
+// to users.json, sorted by ID, without exporting messages.
+func (uc *usersCommand) Execute(_ []string) error {
+	c, err := newAuthorizedClient()
+	if err != nil {
+		return err
+	}
+
+	return writeUsers(c)
+}
+
+// writeUsers writes all users of the workspace of the client to users.json.
+func writeUsers(c *SlackClient) error {
+	if err := c.listUsers(); err != nil {
+		return fmt.Errorf("could not list users: %w", err)
+	}
+
+	users := make([]*slack.User, 0, len(c.UsersCache))
+	for _, u := range c.UsersCache {
+		if cfg.ProfileFields {
+			if err := c.enrichProfile(u); err != nil && !isUserNotFound(err) {
+				return fmt.Errorf("could not get profile of user %q: %w", u.ID, err)
+			}
+		}
+		users = append(users, u)
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+
+	content, err := json.MarshalIndent(users, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal users: %w", err)
+	}
+
+	if err := os.MkdirAll(cfg.Output, 0o755); err != nil {
+		return fmt.Errorf("could not create output directory: %w", err)
+	}
+
+	if err := writePending(filepath.Join(cfg.Output, usersFilename), content); err != nil {
+		return fmt.Errorf("could not write users: %w", err)
+	}
+
+	log.Printf("%d users are written to %s", len(users), usersFilename)
+
+	return nil
+}
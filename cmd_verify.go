@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/slack-go/slack"
+
+	"github.com/chuhlomin/slack-exporter/pkg/exporter"
+	"github.com/chuhlomin/slack-exporter/pkg/structs"
+)
+
+// verifyFilename is the report of the verify command in the output directory.
+const verifyFilename = "verify.json"
+
+var errVerifyGaps = fmt.Errorf("the export differs from Slack")
+
+type verifyCommand struct {
+	Channels []string `long:"channel" description:"Verify only the channel ID; can be repeated"`
+	Sample   int      `long:"sample" description:"Spot check N random days of every channel instead of its whole history"`
+}
+
+// verifyReport lists days of channels where the export differs from Slack, times are in --timezone.
+type verifyReport struct {
+	Verified time.Time       `json:"verified"`
+	Channels []verifyChannel `json:"channels"`
+	// Gaps is the number of days which differ across all channels.
+	Gaps int `json:"gaps"`
+}
+
+type verifyChannel struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Days is the number of days checked: the sampled ones or the ones with messages in the export or in Slack.
+	Days int         `json:"days"`
+	Gaps []verifyDay `json:"gaps,omitempty"`
+}
+
+// verifyDay is the number of messages and replies of the day in the export and in Slack,
+// replies are counted on the day of their thread.
+type verifyDay struct {
+	Day             string `json:"day"`
+	Exported        int    `json:"exported"`
+	Slack           int    `json:"slack"`
+	ExportedReplies int    `json:"exported_replies"`
+	SlackReplies    int    `json:"slack_replies"`
+}
+
+// dayCounts are messages and replies by the day.
+type dayCounts map[string]*verifyDay
+
+func (dc dayCounts) day(t time.Time) *verifyDay {
+	name := t.Format(dateFormat)
+	d, ok := dc[name]
+	if !ok {
+		d = &verifyDay{Day: name}
+		dc[name] = d
+	}
+	return d
+}
+
+// Execute compares the number of messages and replies of every day of channels in the output directory
+// with the Slack history, so the archive can be trusted before the history is deleted.
+// Days are checked from the creation of the channel to the time of its export (from its manifest),
+// so history missing from an interrupted export is reported too; the export is expected
+// to be made without filters, like --since, --user or --grep.
+func (vc *verifyCommand) Execute(_ []string) error {
+	if cfg.APIToken == "" {
+		return errAPITokenRequired
+	}
+
+	c := NewSlackClient(cfg.AppClientID, cfg.AppClientSecret)
+	c.SetToken(cfg.APIToken)
+
+	only := map[string]bool{}
+	for _, id := range vc.Channels {
+		only[id] = true
+	}
+
+	report := verifyReport{Verified: time.Now().UTC()}
+
+	err := readArchive(cfg.Output, func(_ string, data *structs.Data) error {
+		if len(only) > 0 && !only[data.Channel.ID] {
+			return nil
+		}
+
+		channel, err := vc.verifyChannel(c, data)
+		if err != nil {
+			return fmt.Errorf("could not verify channel %s: %w", data.Channel.ID, err)
+		}
+
+		for _, gap := range channel.Gaps {
+			fmt.Printf(
+				"%s\t%s\t%d of %d messages\t%d of %d replies\n",
+				first(data.Channel.Name, data.Channel.ID), gap.Day,
+				gap.Exported, gap.Slack, gap.ExportedReplies, gap.SlackReplies,
+			)
+		}
+
+		report.Gaps += len(channel.Gaps)
+		report.Channels = append(report.Channels, channel)
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal report: %w", err)
+	}
+
+	if err := writePending(filepath.Join(cfg.Output, verifyFilename), content); err != nil {
+		return fmt.Errorf("could not write report: %w", err)
+	}
+
+	log.Printf("%d channels verified, %d days differ, see %s", len(report.Channels), report.Gaps, verifyFilename)
+
+	if report.Gaps > 0 {
+		return fmt.Errorf("%w: %d days", errVerifyGaps, report.Gaps)
+	}
+
+	return nil
+}
+
+func (vc *verifyCommand) verifyChannel(c *SlackClient, data *structs.Data) (verifyChannel, error) {
+	channel := verifyChannel{ID: data.Channel.ID, Name: data.Channel.Name}
+
+	counts := dayCounts{}
+	var oldest time.Time
+	if data.Channel.Created != 0 {
+		oldest = inTimezone(data.Channel.Created.Time())
+	}
+
+	for _, msg := range data.Messages {
+		t := localTime(msg.Timestamp)
+		if oldest.IsZero() || t.Before(oldest) {
+			oldest = t
+		}
+
+		d := counts.day(t)
+		d.Exported++
+		d.ExportedReplies += len(msg.Replies)
+	}
+
+	latest, err := exportTime(data.Channel.ID)
+	if err != nil {
+		return channel, err
+	}
+
+	if vc.Sample > 0 && !oldest.IsZero() {
+		if days := verifyDays(oldest, latest); vc.Sample < len(days) {
+			return vc.verifySample(c, channel, days, counts)
+		}
+	}
+
+	// the whole history, without the oldest time: messages older than the channel (like imported ones) count too
+	if err := c.countHistory(data.Channel.ID, time.Time{}, latest, counts); err != nil {
+		return channel, err
+	}
+
+	channel.Days = len(counts)
+	for _, d := range counts {
+		if d.differs() {
+			channel.Gaps = append(channel.Gaps, *d)
+		}
+	}
+	sort.Slice(channel.Gaps, func(i, j int) bool { return channel.Gaps[i].Day < channel.Gaps[j].Day })
+
+	return channel, nil
+}
+
+// verifySample compares random days of the channel with Slack.
+func (vc *verifyCommand) verifySample(c *SlackClient, channel verifyChannel, days []time.Time, counts dayCounts) (verifyChannel, error) {
+	rand.Shuffle(len(days), func(i, j int) { days[i], days[j] = days[j], days[i] })
+	days = days[:vc.Sample]
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+
+	for _, day := range days {
+		if err := c.countHistory(channel.ID, day, day.AddDate(0, 0, 1), counts); err != nil {
+			return channel, err
+		}
+	}
+
+	channel.Days = len(days)
+	for _, day := range days {
+		if d, ok := counts[day.Format(dateFormat)]; ok && d.differs() {
+			channel.Gaps = append(channel.Gaps, *d)
+		}
+	}
+
+	return channel, nil
+}
+
+func (d verifyDay) differs() bool {
+	return d.Exported != d.Slack || d.ExportedReplies != d.SlackReplies
+}
+
+// exportTime returns the time the channel was exported from its manifest,
+// now for exports without manifests (made before them).
+func exportTime(channelID string) (time.Time, error) {
+	manifest, err := readChannelManifest(channelID)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return inTimezone(time.Now()), nil
+		}
+		return time.Time{}, fmt.Errorf("could not read manifest: %w", err)
+	}
+
+	return inTimezone(manifest.Exported), nil
+}
+
+// verifyDays returns the starts of days from the day of oldest to the day of latest.
+func verifyDays(oldest, latest time.Time) []time.Time {
+	var days []time.Time
+	for day := startOfDay(oldest); !day.After(latest); day = day.AddDate(0, 0, 1) {
+		days = append(days, day)
+	}
+	return days
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// countHistory adds messages and replies of the channel posted between oldest (from the first message
+// when zero) and latest to the Slack counts of their days.
+func (sc *SlackClient) countHistory(channelID string, oldest, latest time.Time, counts dayCounts) error {
+	params := &slack.GetConversationHistoryParameters{
+		ChannelID: channelID,
+		Limit:     pageLimit("conversations.history", cfg.PageSize),
+		Latest:    strconv.FormatInt(latest.Unix(), 10),
+		Inclusive: true,
+	}
+	if !oldest.IsZero() {
+		params.Oldest = strconv.FormatInt(oldest.Unix(), 10)
+	}
+
+	for {
+		if err := sc.limiters.forMethod("conversations.history").Wait(sc.ctx); err != nil {
+			return fmt.Errorf("rate limit error: %w", err)
+		}
+
+		resp, err := sc.api.GetConversationHistoryContext(sc.ctx, params)
+		if err != nil {
+			if smaller, ok := exporter.SmallerPage(params.Limit, err); ok {
+				params.Limit = smaller
+				continue
+			}
+			return fmt.Errorf("could not get history: %w", err)
+		}
+
+		for _, msg := range resp.Messages {
+			d := counts.day(localTime(msg.Timestamp))
+			d.Slack++
+			d.SlackReplies += msg.ReplyCount
+		}
+
+		if resp.ResponseMetaData.NextCursor == "" {
+			return nil
+		}
+		params.Cursor = resp.ResponseMetaData.NextCursor
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// minFreeSpace is kept free on the disk of the output directory for output files
+// written after the downloaded ones.
+const minFreeSpace = 100 << 20
+
+var (
+	errDiskSpace    = fmt.Errorf("not enough disk space")
+	errMaxTotalSize = fmt.Errorf("--max-total-size is reached")
+)
+
+// written is the size of files written by the run, limited by --max-total-size.
+var written atomic.Int64
+
+// reserveSpace checks that size more bytes fit into the free space of the output directory
+// and under --max-total-size, so the run stops before the disk is full.
+func reserveSpace(size int64) error {
+	if cfg.MaxTotalSize > 0 && written.Load()+size > int64(cfg.MaxTotalSize) {
+		return fmt.Errorf(
+			"%w: %s written, %s more to write",
+			errMaxTotalSize,
+			byteSize(written.Load()),
+			byteSize(size),
+		)
+	}
+
+	free, ok := freeSpace(cfg.Output)
+	if ok && free < size+minFreeSpace {
+		return fmt.Errorf("%w: %s free, %s more to write", errDiskSpace, byteSize(free), byteSize(size))
+	}
+
+	return nil
+}
+
+// isOutOfSpace reports whether the error stops the run as the disk or --max-total-size is full.
+func isOutOfSpace(err error) bool {
+	return errors.Is(err, errDiskSpace) || errors.Is(err, errMaxTotalSize)
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/slack-go/slack"
+
+	"github.com/chuhlomin/slack-exporter/pkg/structs"
+)
+
+const (
+	googleDriveAPI = "https://www.googleapis.com/drive/v3/files/"
+	dropboxAPI     = "https://content.dropboxapi.com/2/sharing/get_shared_link_file"
+)
+
+var (
+	errNoDriveID  = fmt.Errorf("no Google Drive file ID in the link")
+	errNoProvider = fmt.Errorf("files of the provider can't be downloaded")
+)
+
+var (
+	// driveID is the file ID in Google Drive and Docs links, like /file/d/<id>/view or /document/d/<id>/edit
+	driveID = regexp.MustCompile(`/d/([A-Za-z0-9_-]+)`)
+	// driveEditors are the Google Docs editors, their files are exported to PDF
+	driveEditors = regexp.MustCompile(`^https://docs\.google\.com/(document|spreadsheets|presentation|drawings)/`)
+)
+
+// externalProvider returns the service the external file is stored in,
+// from the file type or from the link of older messages without it.
+func externalProvider(file slack.File) string {
+	if !file.IsExternal {
+		return ""
+	}
+	if file.ExternalType != "" {
+		return file.ExternalType
+	}
+
+	u, err := url.Parse(file.URLPrivate)
+	if err != nil {
+		return ""
+	}
+
+	switch host := strings.TrimPrefix(u.Hostname(), "www."); {
+	case host == "drive.google.com" || host == "docs.google.com":
+		return structs.ProviderGoogleDrive
+	case host == "dropbox.com" || strings.HasSuffix(host, ".dropbox.com"):
+		return structs.ProviderDropbox
+	}
+
+	return ""
+}
+
+// externalToken returns the token to download files of the provider, empty if it's not set.
+func externalToken(provider string) string {
+	switch provider {
+	case structs.ProviderGoogleDrive:
+		return cfg.GoogleDriveToken
+	case structs.ProviderDropbox:
+		return cfg.DropboxToken
+	}
+	return ""
+}
+
+// collectable reports whether the file can be downloaded and passes the filters:
+// Slack files and external files of providers with the token.
+func collectable(file slack.File) bool {
+	if file.IsExternal {
+		return externalToken(externalProvider(file)) != "" && downloadable(file)
+	}
+	return file.URLPrivateDownload != "" && downloadable(file)
+}
+
+// externalFiles returns the links to the external files of the message and its replies.
+func externalFiles(msg structs.Message) map[string]structs.ExternalFile {
+	result := map[string]structs.ExternalFile{}
+	add := func(files []slack.File) {
+		for _, file := range files {
+			if !file.IsExternal {
+				continue
+			}
+			result[file.ID] = structs.ExternalFile{
+				URL:      first(file.URLPrivate, file.Permalink),
+				Provider: externalProvider(file),
+				Title:    first(file.Title, file.Name),
+			}
+		}
+	}
+
+	add(msg.Files)
+	for _, reply := range msg.Replies {
+		add(reply.Files)
+	}
+
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+// downloadExternal downloads the external file to the store with the token of its provider,
+// returns the name of the file without the ID prefix.
+func (sc *SlackClient) downloadExternal(id string, file collectedFile) (string, error) {
+	var (
+		req *http.Request
+		err error
+	)
+	filename := file.name
+
+	switch file.provider {
+	case structs.ProviderGoogleDrive:
+		req, filename, err = sc.driveRequest(file)
+	case structs.ProviderDropbox:
+		req, err = sc.dropboxRequest(file)
+	default:
+		return "", fmt.Errorf("%w: %s", errNoProvider, file.provider)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+externalToken(file.provider))
+
+	resp, err := sc.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("could not send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fileStatusError(resp.StatusCode)
+	}
+
+	// Dropbox returns the metadata of the shared file
+	var result struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal([]byte(resp.Header.Get("Dropbox-API-Result")), &result); err == nil && result.Name != "" {
+		filename = result.Name
+	}
+
+	filename = strings.ReplaceAll(first(filename, id), "/", "_")
+
+	if err := reserveSpace(max(resp.ContentLength, 0)); err != nil {
+		return "", err
+	}
+
+	dst, err := createPending(filepath.Join(cfg.Output, storeDirname, id+"-"+filename))
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := io.Copy(dst, resp.Body); err != nil {
+		dst.Abort()
+		return "", fmt.Errorf("could not download file: %w", err)
+	}
+
+	if err := dst.Commit(); err != nil {
+		return "", err
+	}
+
+	return filename, nil
+}
+
+// driveRequest returns the request of the Google Drive file content, Google Docs files
+// are exported to PDF, so the name of the file gets the extension.
+func (sc *SlackClient) driveRequest(file collectedFile) (*http.Request, string, error) {
+	match := driveID.FindStringSubmatch(file.url)
+	if match == nil {
+		u, err := url.Parse(file.url)
+		if err != nil || u.Query().Get("id") == "" {
+			return nil, "", errNoDriveID
+		}
+		match = []string{"", u.Query().Get("id")}
+	}
+
+	endpoint := googleDriveAPI + url.PathEscape(match[1]) + "?alt=media&supportsAllDrives=true"
+	filename := file.name
+	if driveEditors.MatchString(file.url) {
+		endpoint = googleDriveAPI + url.PathEscape(match[1]) + "/export?mimeType=application%2Fpdf"
+		filename = strings.TrimSuffix(filename, ".pdf") + ".pdf"
+	}
+
+	req, err := http.NewRequestWithContext(sc.ctx, http.MethodGet, endpoint, http.NoBody)
+	if err != nil {
+		return nil, "", fmt.Errorf("could not create request: %w", err)
+	}
+
+	return req, filename, nil
+}
+
+// dropboxRequest returns the request of the Dropbox file content by its shared link.
+func (sc *SlackClient) dropboxRequest(file collectedFile) (*http.Request, error) {
+	arg, err := json.Marshal(map[string]string{"url": file.url})
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal link: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(sc.ctx, http.MethodPost, dropboxAPI, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("could not create request: %w", err)
+	}
+	req.Header.Set("Dropbox-API-Arg", string(arg))
+
+	return req, nil
+}
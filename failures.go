@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/chuhlomin/slack-exporter/pkg/redact"
+)
+
+// errorsFilename lists items of the run which could not be exported.
+const errorsFilename = "errors.json"
+
+// Statuses of items in errors.json, only failed items count towards --max-failures.
+const (
+	statusFailed = "failed"
+	// statusSkipped is the item the token is not allowed to read, like the sidebar.
+	statusSkipped = "skipped"
+	// statusNotFound is the item which is gone, like a deleted user.
+	statusNotFound = "not_found"
+	// statusIncomplete is the item exported in part, like the thread with fewer replies than its reply_count.
+	statusIncomplete = "incomplete"
+)
+
+var errTooManyFailures = fmt.Errorf("too many items failed")
+
+// failedItem is the channel, user, file or another item which could not be exported,
+// the run continues without it.
+type failedItem struct {
+	// Kind is the type of the item, like channel, user, file or replies.
+	Kind   string    `json:"kind"`
+	ID     string    `json:"id"`
+	Status string    `json:"status"`
+	Error  string    `json:"error"`
+	Time   time.Time `json:"time"`
+}
+
+// failureReport collects items which could not be exported, threads are fetched concurrently.
+type failureReport struct {
+	mu    sync.Mutex
+	Items []failedItem `json:"items"`
+}
+
+// failures are items of the workspace being exported.
+var failures = &failureReport{}
+
+// Add records the item which could not be exported.
+func (r *failureReport) Add(status, kind, id string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Items = append(r.Items, failedItem{
+		Kind:   kind,
+		ID:     id,
+		Status: status,
+		Error:  redact.String(err.Error()),
+		Time:   time.Now().UTC(),
+	})
+}
+
+// Failed returns the number of failed items.
+func (r *failureReport) Failed() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	for _, item := range r.Items {
+		if item.Status == statusFailed {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Counts returns the number of items by "<kind>/<status>".
+func (r *failureReport) Counts() map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	counts := map[string]int{}
+	for _, item := range r.Items {
+		counts[item.Kind+"/"+item.Status]++
+	}
+
+	return counts
+}
+
+// Write writes errors.json to the directory, the report of the previous run is removed
+// when nothing failed.
+func (r *failureReport) Write(dir string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	path := filepath.Join(dir, errorsFilename)
+	if len(r.Items) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("could not remove %s: %w", errorsFilename, err)
+		}
+		return nil
+	}
+
+	content, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal errors: %w", err)
+	}
+
+	return writePending(path, content)
+}
+
+// checkFailures returns the error when more items failed than --max-failures allows.
+func checkFailures() error {
+	failed := failures.Failed()
+	if cfg.MaxFailures < 0 || failed <= cfg.MaxFailures {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %d failed, see %s", errTooManyFailures, failed, errorsFilename)
+}
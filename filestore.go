@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+
+	"github.com/chuhlomin/slack-exporter/pkg/atomicfile"
+	"github.com/chuhlomin/slack-exporter/pkg/structs"
+)
+
+// storeDirname keeps every downloaded file once by its ID, like files/F0123-report.pdf;
+// directories of channels (and saved items) have hard links to the stored files,
+// so the file shared into several channels is downloaded and stored once.
+const storeDirname = "files"
+
+// defaultFileLayout links files to the directory of the channel, like C0123/F0123-report.pdf.
+const defaultFileLayout = "{channel}/{id}-{name}"
+
+var errFileLayout = fmt.Errorf("--file-layout must have {id}, so files with the same name don't collide")
+
+// collectedFile is the file to download with the thread it's attached to.
+type collectedFile struct {
+	url     string
+	name    string
+	created time.Time
+	// thread is the timestamp of the thread (or the message without replies) of the file
+	thread string
+	// provider is the service of the external file, like gdrive, downloaded with its token
+	provider string
+}
+
+func newCollectedFile(file slack.File, thread string) collectedFile {
+	created := file.Created.Time()
+	if file.Created == 0 {
+		created = parseTimestamp(thread)
+	}
+
+	if provider := externalProvider(file); provider != "" {
+		return collectedFile{
+			url:      file.URLPrivate,
+			name:     first(file.Name, file.Title),
+			created:  created,
+			thread:   thread,
+			provider: provider,
+		}
+	}
+
+	return collectedFile{
+		url:     file.URLPrivateDownload,
+		name:    file.Name,
+		created: created,
+		thread:  thread,
+	}
+}
+
+// checkFileLayout validates --file-layout.
+func checkFileLayout() error {
+	if !strings.Contains(cfg.FileLayout, "{id}") {
+		return errFileLayout
+	}
+	return nil
+}
+
+// layoutPath returns the path of the file relative to the output directory by --file-layout,
+// the date is the upload date of the file in --timezone.
+func layoutPath(dir, id, filename string, file collectedFile) string {
+	layout := cfg.FileLayout
+	if layout == "" {
+		layout = defaultFileLayout
+	}
+
+	created := inTimezone(file.created)
+
+	return filepath.FromSlash(strings.NewReplacer(
+		"{channel}", dir,
+		"{yyyy}", created.Format("2006"),
+		"{mm}", created.Format("01"),
+		"{dd}", created.Format("02"),
+		"{thread}", file.thread,
+		"{id}", id,
+		"{name}", filename,
+	).Replace(layout))
+}
+
+// localFiles returns the files of the message and its replies with their paths (and thumbnails) of the downloaded ones
+// and why the others are missing.
+func localFiles(msg structs.Message, paths, thumbnails, missing map[string]string) map[string]structs.LocalFile {
+	result := map[string]structs.LocalFile{}
+	add := func(files []slack.File) {
+		for _, file := range files {
+			switch path, ok := paths[file.ID]; {
+			case ok:
+				result[file.ID] = structs.LocalFile{
+					Path:      filepath.ToSlash(path),
+					Status:    structs.FileDownloaded,
+					Thumbnail: filepath.ToSlash(thumbnails[file.ID]),
+				}
+			case file.Mode == "tombstone":
+				result[file.ID] = structs.LocalFile{Status: structs.FileDeleted}
+			case file.Mode == "hidden_by_limit":
+				result[file.ID] = structs.LocalFile{Status: structs.FileAccessDenied}
+			case !collectable(file):
+				result[file.ID] = structs.LocalFile{Status: structs.FileSkipped}
+			default:
+				result[file.ID] = structs.LocalFile{Status: first(missing[file.ID], structs.FileFailed)}
+			}
+		}
+	}
+
+	add(msg.Files)
+	for _, reply := range msg.Replies {
+		add(reply.Files)
+	}
+
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+// localFilePath returns the path of the downloaded file relative to the output directory,
+// empty if the file was not downloaded. Exports before --file-layout have only names of files
+// in the directory of the channel.
+func localFilePath(data *structs.Data, id string) string {
+	if path, ok := data.FilePaths[id]; ok {
+		return path
+	}
+	if filename := data.Files[id]; filename != "" {
+		return filepath.Join(data.Channel.ID, id+"-"+filename)
+	}
+	return ""
+}
+
+// storedFilename returns the name of the file in the store, empty if it was never downloaded.
+func storedFilename(id string) string {
+	matches, err := filepath.Glob(filepath.Join(cfg.Output, storeDirname, id+"-*"))
+	if err != nil {
+		return ""
+	}
+
+	for _, match := range matches {
+		if !strings.HasSuffix(match, atomicfile.Suffix) {
+			return strings.TrimPrefix(filepath.Base(match), id+"-")
+		}
+	}
+
+	return ""
+}
+
+// linkStored adds the stored file to the path relative to the output directory,
+// it's copied where the file system does not support hard links.
+func linkStored(path, name string) error {
+	stored := filepath.Join(cfg.Output, storeDirname, name)
+	target := filepath.Join(cfg.Output, path)
+
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return fmt.Errorf("could not create directory: %w", err)
+	}
+
+	if _, err := os.Lstat(target); err == nil {
+		return nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("could not stat file: %w", err)
+	}
+
+	if err := os.Link(stored, target); err == nil {
+		return nil
+	}
+
+	src, err := os.Open(stored)
+	if err != nil {
+		return fmt.Errorf("could not open stored file: %w", err)
+	}
+	defer src.Close()
+
+	dst, err := createPending(target)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Abort()
+		return fmt.Errorf("could not copy stored file: %w", err)
+	}
+
+	return dst.Commit()
+}
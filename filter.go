@@ -0,0 +1,527 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+
+	"github.com/chuhlomin/slack-exporter/pkg/render"
+	"github.com/chuhlomin/slack-exporter/pkg/structs"
+)
+
+var errBotsFilters = fmt.Errorf("--exclude-bots and --only-bots cannot be used together")
+
+// messageFilter reports whether the message (with its thread replies) should be exported.
+type messageFilter func(msg structs.Message) bool
+
+// messageFilters returns filters of the channel messages enabled in the config.
+func messageFilters(channelID string) []messageFilter {
+	var filters []messageFilter
+
+	if len(cfg.HasReaction) > 0 {
+		filters = append(filters, hasReaction(cfg.HasReaction))
+	}
+
+	if len(cfg.User) > 0 {
+		filters = append(filters, byUser(cfg.User))
+	}
+
+	if cfg.ExcludeBots || cfg.OnlyBots {
+		filters = append(filters, byBots(cfg.OnlyBots))
+	}
+
+	if cfg.Sample.enabled() {
+		filters = append(filters, sample(cfg.Sample, cfg.SampleSeed, channelID))
+	}
+
+	if cfg.FilesOnly {
+		filters = append(filters, hasFiles)
+	}
+
+	return filters
+}
+
+// acceptMessage reports whether the message is accepted by all the filters.
+func acceptMessage(msg structs.Message, filters []messageFilter) bool {
+	for _, filter := range filters {
+		if !filter(msg) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hasReaction accepts messages where the message itself
+// or any of its replies has one of the reactions.
+func hasReaction(names []string) messageFilter {
+	wanted := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		wanted[strings.Trim(name, ":")] = struct{}{}
+	}
+
+	match := func(reactions []slack.ItemReaction) bool {
+		for _, r := range reactions {
+			// reactions with skin tones are named like "thumbsup::skin-tone-2"
+			name, _, _ := strings.Cut(r.Name, "::")
+			if _, ok := wanted[name]; ok {
+				return true
+			}
+			if _, ok := wanted[r.Name]; ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(msg structs.Message) bool {
+		if match(msg.Reactions) {
+			return true
+		}
+
+		for _, reply := range msg.Replies {
+			if match(reply.Reactions) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// hasFiles accepts messages where the message itself or any of its replies has files.
+func hasFiles(msg structs.Message) bool {
+	if len(msg.Files) > 0 {
+		return true
+	}
+
+	for _, reply := range msg.Replies {
+		if len(reply.Files) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// byUser accepts messages where the message itself or any of its replies is posted by one of the users.
+func byUser(users []string) messageFilter {
+	return func(msg structs.Message) bool {
+		if slices.Contains(users, msg.User) {
+			return true
+		}
+
+		for _, reply := range msg.Replies {
+			if slices.Contains(users, reply.User) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// byBots accepts messages where the message itself or any of its replies is posted by a bot or an app
+// (with bots) or by a person (without bots).
+func byBots(bots bool) messageFilter {
+	return func(msg structs.Message) bool {
+		if isBot(msg.Message) == bots {
+			return true
+		}
+
+		for _, reply := range msg.Replies {
+			if isBot(reply) == bots {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// isBot reports whether the message is posted by a bot, an app or an integration.
+func isBot(msg slack.Message) bool {
+	return msg.BotID != "" || msg.SubType == slack.MsgSubTypeBotMessage
+}
+
+// trimReplies drops replies which are not exported with --user (without --user-threads),
+// --exclude-bots or --only-bots; the parent message is kept as the context of the thread.
+func trimReplies(replies []slack.Message) []slack.Message {
+	byUsers := len(cfg.User) > 0 && !cfg.UserThreads
+	if !byUsers && !cfg.ExcludeBots && !cfg.OnlyBots {
+		return replies
+	}
+
+	var result []slack.Message
+	for _, reply := range replies {
+		switch {
+		case byUsers && !slices.Contains(cfg.User, reply.User):
+		case cfg.ExcludeBots && isBot(reply):
+		case cfg.OnlyBots && !isBot(reply):
+		default:
+			result = append(result, reply)
+		}
+	}
+
+	return result
+}
+
+// grepMatch returns the matcher of --grep and --grep-regex, nil when neither is set.
+// The message (with its thread) matches if its text (or rendered blocks and attachments)
+// or the text of any reply contains the text and matches the expression.
+func grepMatch() messageFilter {
+	if cfg.Grep == "" && cfg.GrepRegex.Regexp == nil {
+		return nil
+	}
+
+	text := strings.ToLower(cfg.Grep)
+	match := func(msg slack.Message) bool {
+		t := render.Text(msg)
+		return strings.Contains(strings.ToLower(t), text) &&
+			(cfg.GrepRegex.Regexp == nil || cfg.GrepRegex.MatchString(t))
+	}
+
+	return func(msg structs.Message) bool {
+		if match(msg.Message) {
+			return true
+		}
+
+		for _, reply := range msg.Replies {
+			if match(reply) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// grepContext passes messages matched by --grep or --grep-regex with up to --context messages
+// before and after them. Messages come newest first, so the messages after the match
+// are held until the match comes and dropped when it does not.
+type grepContext struct {
+	match messageFilter
+	size  int
+	held  []structs.Message
+	// left is the number of messages before the last match still to be passed.
+	left int
+}
+
+func newGrepContext() *grepContext {
+	match := grepMatch()
+	if match == nil {
+		return nil
+	}
+
+	return &grepContext{match: match, size: max(cfg.Context, 0)}
+}
+
+// Push returns the messages to export once the message comes.
+func (gc *grepContext) Push(msg structs.Message) []structs.Message {
+	if gc.match(msg) {
+		passed := append(gc.held, msg)
+		gc.held = nil
+		gc.left = gc.size
+		return passed
+	}
+
+	if gc.left > 0 {
+		gc.left--
+		return []structs.Message{msg}
+	}
+
+	if gc.size == 0 {
+		return nil
+	}
+
+	gc.held = append(gc.held, msg)
+	if len(gc.held) > gc.size {
+		gc.held = gc.held[1:]
+	}
+
+	return nil
+}
+
+// sampleRate is the --sample flag: a percentage of messages like "1%"
+// or the rate of one in N messages like "1/100".
+type sampleRate struct {
+	percent float64
+	every   uint64
+}
+
+var errInvalidSample = fmt.Errorf("invalid sample, expected percentage like 1%% or rate like 1/100")
+
+// UnmarshalFlag implements flags.Unmarshaler.
+func (sr *sampleRate) UnmarshalFlag(value string) error {
+	value = strings.TrimSpace(value)
+
+	if p, ok := strings.CutSuffix(value, "%"); ok {
+		n, err := strconv.ParseFloat(p, 64)
+		if err != nil || n <= 0 || n > 100 {
+			return fmt.Errorf("%w: %q", errInvalidSample, value)
+		}
+		sr.percent = n
+		return nil
+	}
+
+	if n, ok := strings.CutPrefix(value, "1/"); ok {
+		every, err := strconv.ParseUint(n, 10, 64)
+		if err != nil || every == 0 {
+			return fmt.Errorf("%w: %q", errInvalidSample, value)
+		}
+		sr.every = every
+		return nil
+	}
+
+	return fmt.Errorf("%w: %q", errInvalidSample, value)
+}
+
+func (sr sampleRate) enabled() bool {
+	return sr.percent > 0 || sr.every > 0
+}
+
+func (sr sampleRate) String() string {
+	if sr.every > 0 {
+		return "1/" + strconv.FormatUint(sr.every, 10)
+	}
+	return strconv.FormatFloat(sr.percent, 'f', -1, 64) + "%"
+}
+
+// sample accepts a deterministic sample of the channel messages (with their threads):
+// the same seed selects the same messages on every run, including resumed and incremental ones,
+// since every message is selected by the hash of the seed, channel and message timestamp:
+// below the percentage of the hash range, or divisible by N for the 1/N rate.
+// The rate is the probability of every message to be selected, not every Nth message:
+// the channel of 1000 messages has about 10 of them selected with 1/100.
+func sample(rate sampleRate, seed, channelID string) messageFilter {
+	if rate.every > 0 {
+		return func(msg structs.Message) bool {
+			return hash(seed, channelID, msg.Timestamp)%rate.every == 0
+		}
+	}
+
+	threshold := uint64(rate.percent / 100 * math.MaxUint64)
+	if rate.percent >= 100 {
+		threshold = math.MaxUint64
+	}
+
+	return func(msg structs.Message) bool {
+		return hash(seed, channelID, msg.Timestamp) <= threshold
+	}
+}
+
+// hash returns FNV-1a hash of the strings joined with zero bytes.
+func hash(ss ...string) uint64 {
+	h := fnv.New64a()
+	for _, s := range ss {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+
+	return h.Sum64()
+}
+
+// byteSize is a file size flag accepting units, like 512KB or 1.5GB.
+type byteSize int64
+
+var errInvalidSize = fmt.Errorf("invalid size")
+
+// UnmarshalFlag implements flags.Unmarshaler.
+func (b *byteSize) UnmarshalFlag(value string) error {
+	units := []struct {
+		suffix string
+		size   float64
+	}{
+		{"TB", 1 << 40},
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"KB", 1 << 10},
+		{"B", 1},
+	}
+
+	value = strings.ToUpper(strings.TrimSpace(value))
+	multiplier := 1.0
+	for _, unit := range units {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			multiplier = unit.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("%w: %q", errInvalidSize, value)
+	}
+
+	*b = byteSize(n * multiplier)
+	return nil
+}
+
+// String returns the size in the largest unit it has at least one of, like 1.5GB.
+func (b byteSize) String() string {
+	units := []struct {
+		suffix string
+		size   int64
+	}{
+		{"TB", 1 << 40},
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"KB", 1 << 10},
+	}
+
+	for _, unit := range units {
+		if int64(b) >= unit.size {
+			return strconv.FormatFloat(float64(b)/float64(unit.size), 'f', 1, 64) + unit.suffix
+		}
+	}
+
+	return strconv.FormatInt(int64(b), 10) + "B"
+}
+
+// downloadable reports whether the file passes the size and type limits of the config.
+// Files which are not downloaded are still exported with their metadata and URLs.
+func downloadable(file slack.File) bool {
+	if cfg.MaxFileSize > 0 && int64(file.Size) > int64(cfg.MaxFileSize) {
+		return false
+	}
+
+	if len(cfg.IncludeFileTypes) > 0 && !matchFileType(file, cfg.IncludeFileTypes) {
+		return false
+	}
+
+	return !matchFileType(file, cfg.ExcludeFileTypes)
+}
+
+// matchFileType matches the file against Slack file types (pdf, mp4)
+// or MIME types with optional wildcards (image/*).
+func matchFileType(file slack.File, types []string) bool {
+	for _, t := range types {
+		t = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(t), "."))
+		if t == "" {
+			continue
+		}
+
+		if t == strings.ToLower(file.Filetype) {
+			return true
+		}
+
+		if ok, _ := path.Match(t, strings.ToLower(file.Mimetype)); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// withoutContent returns files attached to the message and its replies
+// without previews of the file contents and initial comments, for --no-content.
+func withoutContent(msg structs.Message) []slack.File {
+	var result []slack.File
+
+	strip := func(files []slack.File) {
+		for _, f := range files {
+			f.Preview = ""
+			f.PreviewHighlight = ""
+			f.InitialComment = slack.Comment{}
+			result = append(result, f)
+		}
+	}
+
+	strip(msg.Files)
+	for _, reply := range msg.Replies {
+		strip(reply.Files)
+	}
+
+	return result
+}
+
+// date is a day flag in the local time zone, like 2024-01-31.
+type date struct {
+	time.Time
+}
+
+// UnmarshalFlag implements flags.Unmarshaler.
+func (d *date) UnmarshalFlag(value string) error {
+	t, err := time.ParseInLocation(dateFormat, strings.TrimSpace(value), time.Local)
+	if err != nil {
+		return fmt.Errorf("invalid date, expected %s: %q", dateFormat, value)
+	}
+
+	d.Time = t
+	return nil
+}
+
+// pattern is a regular expression flag.
+type pattern struct {
+	*regexp.Regexp
+}
+
+// UnmarshalFlag implements flags.Unmarshaler.
+func (p *pattern) UnmarshalFlag(value string) error {
+	re, err := regexp.Compile(value)
+	if err != nil {
+		return fmt.Errorf("invalid regular expression %q: %w", value, err)
+	}
+
+	p.Regexp = re
+	return nil
+}
+
+// location is a time zone flag, like Europe/Berlin, UTC or Local.
+type location struct {
+	*time.Location
+}
+
+// UnmarshalFlag implements flags.Unmarshaler.
+func (l *location) UnmarshalFlag(value string) error {
+	loc, err := time.LoadLocation(strings.TrimSpace(value))
+	if err != nil {
+		return fmt.Errorf("invalid time zone: %q", value)
+	}
+
+	l.Location = loc
+	return nil
+}
+
+// humanTimeFormat is ISO 8601 with microseconds, so times are as unique as Slack timestamps.
+const humanTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// localTime returns the time of the Slack timestamp in --timezone.
+func localTime(ts string) time.Time {
+	return inTimezone(parseTimestamp(ts))
+}
+
+// inTimezone returns the time in --timezone.
+func inTimezone(t time.Time) time.Time {
+	if cfg.Timezone.Location == nil {
+		return t.Local()
+	}
+	return t.In(cfg.Timezone.Location)
+}
+
+// humanTime returns the time of the Slack timestamp in ISO 8601 in --timezone, like 2024-01-31T15:04:05.000100+01:00.
+func humanTime(ts string) string {
+	return localTime(ts).Format(humanTimeFormat)
+}
+
+// historyRange returns the oldest and latest timestamps of the channel history to export
+// as expected by conversations.history, the end of the range includes the whole --until day.
+func historyRange() (oldest, latest string) {
+	if !cfg.Since.IsZero() {
+		oldest = strconv.FormatInt(cfg.Since.Unix(), 10)
+	}
+	if !cfg.Until.IsZero() {
+		latest = strconv.FormatInt(cfg.Until.AddDate(0, 0, 1).Unix(), 10)
+	}
+
+	return oldest, latest
+}
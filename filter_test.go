@@ -0,0 +1,70 @@
+package main
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/chuhlomin/slack-exporter/pkg/structs"
+)
+
+// sampled returns timestamps of the messages selected by the sample.
+func sampled(t *testing.T, rate, seed string, msgs []structs.Message) []string {
+	t.Helper()
+
+	var sr sampleRate
+	if err := sr.UnmarshalFlag(rate); err != nil {
+		t.Fatalf("UnmarshalFlag(%q): %v", rate, err)
+	}
+
+	filter := sample(sr, seed, "C1")
+
+	var result []string
+	for _, msg := range msgs {
+		if filter(msg) {
+			result = append(result, msg.Timestamp)
+		}
+	}
+
+	return result
+}
+
+func TestSample(t *testing.T) {
+	msgs := make([]structs.Message, 10_000)
+	for i := range msgs {
+		msgs[i].Timestamp = strconv.Itoa(1700000000+i) + ".000100"
+	}
+
+	for _, rate := range []string{"1/100", "5%"} {
+		t.Run(rate, func(t *testing.T) {
+			got := sampled(t, rate, "seed", msgs)
+
+			// the same seed selects the same messages on every run
+			if again := sampled(t, rate, "seed", msgs); !reflect.DeepEqual(got, again) {
+				t.Errorf("the same seed selected %d and %d different messages", len(got), len(again))
+			}
+
+			if other := sampled(t, rate, "other", msgs); reflect.DeepEqual(got, other) {
+				t.Errorf("another seed selected the same messages")
+			}
+
+			// the rate is the probability, so the size is close to it
+			want := 100
+			if rate == "5%" {
+				want = 500
+			}
+			if len(got) < want*7/10 || len(got) > want*13/10 {
+				t.Errorf("got %d messages, want about %d", len(got), want)
+			}
+		})
+	}
+}
+
+func TestSampleRateUnmarshalFlag(t *testing.T) {
+	for _, value := range []string{"", "0%", "101%", "1/0", "2/100", "every 100"} {
+		var sr sampleRate
+		if err := sr.UnmarshalFlag(value); err == nil {
+			t.Errorf("UnmarshalFlag(%q) succeeded, want an error", value)
+		}
+	}
+}
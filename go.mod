@@ -9,6 +9,7 @@ require (
 	github.com/enescakir/emoji v1.0.0
 	github.com/jessevdk/go-flags v1.6.1
 	github.com/slack-go/slack v0.13.1
+	golang.org/x/sync v0.8.0
 	golang.org/x/time v0.6.0
 )
 
@@ -28,7 +29,6 @@ require (
 	github.com/muesli/cancelreader v0.2.2 // indirect
 	github.com/muesli/termenv v0.15.2 // indirect
 	github.com/rivo/uniseg v0.4.7 // indirect
-	golang.org/x/sync v0.8.0 // indirect
 	golang.org/x/sys v0.24.0 // indirect
 	golang.org/x/text v0.3.8 // indirect
 )
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+var (
+	errCACert  = fmt.Errorf("no certificates found in --ca-cert")
+	errStalled = fmt.Errorf("no data received for --stall-timeout")
+)
+
+var (
+	// httpTransport is the base transport of all requests of the app: Slack API, files,
+	// secrets, the search index and webhooks.
+	httpTransport http.RoundTripper = http.DefaultTransport
+	// sharedClient sends requests which are not paced by rate limiters, like webhooks.
+	sharedClient = http.DefaultClient
+)
+
+// setupHTTP applies --proxy, --ca-cert and --insecure-skip-verify to the shared transport,
+// so the app works behind proxies and firewalls intercepting TLS, and its timeouts and pool size.
+func setupHTTP() error {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: cfg.ConnectTimeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = cfg.ConnectTimeout
+	transport.MaxIdleConns = 0 // no limit, but per host
+	transport.MaxIdleConnsPerHost = cfg.MaxIdleConns
+
+	if cfg.Proxy != "" {
+		proxyURL, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return fmt.Errorf("could not parse --proxy: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if cfg.CACert != "" || cfg.InsecureSkipVerify {
+		transport.TLSClientConfig = &tls.Config{
+			MinVersion:         tls.VersionTLS12,
+			InsecureSkipVerify: cfg.InsecureSkipVerify,
+		}
+	}
+
+	if cfg.CACert != "" {
+		pem, err := os.ReadFile(cfg.CACert)
+		if err != nil {
+			return fmt.Errorf("could not read --ca-cert: %w", err)
+		}
+
+		// the certificates are trusted in addition to the system ones
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return errCACert
+		}
+		transport.TLSClientConfig.RootCAs = pool
+	}
+
+	httpTransport = transport
+	if cfg.StallTimeout > 0 {
+		httpTransport = stallTransport{next: transport, timeout: cfg.StallTimeout}
+	}
+	sharedClient = &http.Client{Transport: httpTransport}
+
+	return nil
+}
+
+// stallTransport cancels requests which receive nothing for the timeout: no response
+// or no data of the response body. Unlike http.Client.Timeout, it doesn't limit
+// how long large files are downloaded while they keep coming.
+type stallTransport struct {
+	next    http.RoundTripper
+	timeout time.Duration
+}
+
+func (t stallTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancelCause(req.Context())
+	timer := time.AfterFunc(t.timeout, func() { cancel(errStalled) })
+
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		timer.Stop()
+		cancel(nil)
+		return nil, stallError(ctx, err)
+	}
+
+	resp.Body = &stallBody{ReadCloser: resp.Body, ctx: ctx, cancel: cancel, timer: timer, timeout: t.timeout}
+
+	return resp, nil
+}
+
+// stallBody postpones the cancellation of the request on every read.
+type stallBody struct {
+	io.ReadCloser
+	ctx     context.Context
+	cancel  context.CancelCauseFunc
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func (b *stallBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.timer.Reset(b.timeout)
+	}
+	if err != nil && err != io.EOF {
+		return n, stallError(b.ctx, err)
+	}
+	return n, err
+}
+
+func (b *stallBody) Close() error {
+	b.timer.Stop()
+	err := b.ReadCloser.Close()
+	b.cancel(nil)
+	return err
+}
+
+// stallError reports the request canceled by stallTransport as stalled.
+func stallError(ctx context.Context, err error) error {
+	if !errors.Is(err, errStalled) && errors.Is(context.Cause(ctx), errStalled) {
+		return fmt.Errorf("%w: %w", errStalled, err)
+	}
+	return err
+}
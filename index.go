@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/slack-go/slack"
+
+	"github.com/chuhlomin/slack-exporter/pkg/elastic"
+	"github.com/chuhlomin/slack-exporter/pkg/exporter"
+	"github.com/chuhlomin/slack-exporter/pkg/render"
+	"github.com/chuhlomin/slack-exporter/pkg/structs"
+)
+
+// searchIndex receives exported messages when --index is set.
+var searchIndex *elastic.Indexer
+
+// indexMappings are the mappings of the messages index:
+// ts is the date of the message, text is analyzed, names and IDs are keywords.
+var indexMappings = map[string]interface{}{
+	"properties": map[string]interface{}{
+		"channel_id":   map[string]string{"type": "keyword"},
+		"channel_name": map[string]string{"type": "keyword"},
+		"ts":           map[string]string{"type": "date", "format": "epoch_second"},
+		"message_ts":   map[string]string{"type": "keyword"},
+		"thread_ts":    map[string]string{"type": "keyword"},
+		"user":         map[string]string{"type": "keyword"},
+		"user_name":    map[string]string{"type": "keyword"},
+		"subtype":      map[string]string{"type": "keyword"},
+		"text":         map[string]string{"type": "text"},
+		"reply_count":  map[string]string{"type": "integer"},
+		"reactions":    map[string]string{"type": "keyword"},
+		"files":        map[string]string{"type": "keyword"},
+	},
+}
+
+// indexDocument is a message or thread reply in the index.
+type indexDocument struct {
+	ChannelID   string   `json:"channel_id"`
+	ChannelName string   `json:"channel_name,omitempty"`
+	Timestamp   string   `json:"ts"`
+	MessageTS   string   `json:"message_ts"`
+	ThreadTS    string   `json:"thread_ts,omitempty"`
+	User        string   `json:"user,omitempty"`
+	UserName    string   `json:"user_name,omitempty"`
+	SubType     string   `json:"subtype,omitempty"`
+	Text        string   `json:"text"`
+	ReplyCount  int      `json:"reply_count,omitempty"`
+	Reactions   []string `json:"reactions,omitempty"`
+	Files       []string `json:"files,omitempty"`
+}
+
+// openSearchIndex connects to the index from the config and creates it with the mappings.
+func openSearchIndex(ctx context.Context) error {
+	var err error
+	searchIndex, err = elastic.New(cfg.Index, httpTransport)
+	if err != nil {
+		return err
+	}
+
+	return searchIndex.EnsureIndex(ctx, indexMappings)
+}
+
+// indexSink is the exporter.Sink adding messages and thread replies to the search index of --index.
+type indexSink struct {
+	ctx     context.Context
+	channel *slack.Channel
+	users   userLookup
+}
+
+var _ exporter.DataSink = (*indexSink)(nil)
+
+func (is *indexSink) WriteChannel(channel *slack.Channel) error {
+	is.channel = channel
+	return nil
+}
+
+func (is *indexSink) WriteMessage(_ string, msg structs.Message) error {
+	if err := is.index(msg.Message); err != nil {
+		return err
+	}
+
+	for _, reply := range msg.Replies {
+		if err := is.index(reply); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (is *indexSink) index(msg slack.Message) error {
+	doc := indexDocument{
+		ChannelID:   is.channel.ID,
+		ChannelName: is.channel.Name,
+		Timestamp:   msg.Timestamp,
+		MessageTS:   msg.Timestamp,
+		ThreadTS:    msg.ThreadTimestamp,
+		User:        msg.User,
+		UserName:    msg.Username,
+		SubType:     msg.SubType,
+		Text:        render.Text(msg),
+		ReplyCount:  msg.ReplyCount,
+	}
+
+	if msg.User != "" {
+		u, err := is.users(msg.User)
+		if err != nil {
+			return fmt.Errorf("could not get user %q: %w", msg.User, err)
+		}
+		doc.UserName = userDisplayName(u)
+	}
+
+	for _, r := range msg.Reactions {
+		doc.Reactions = append(doc.Reactions, r.Name)
+	}
+
+	for _, f := range msg.Files {
+		doc.Files = append(doc.Files, f.Name)
+	}
+
+	if err := searchIndex.Add(is.ctx, is.channel.ID+"-"+msg.Timestamp, doc); err != nil {
+		return fmt.Errorf("could not index message: %w", err)
+	}
+
+	return nil
+}
+
+func (is *indexSink) WriteFile(string, slack.File, io.Reader) error {
+	return nil
+}
+
+func (is *indexSink) WriteUser(string, *slack.User) error {
+	return nil
+}
+
+// WriteData sends the rest of the indexed messages, so the channel is not written
+// to the output when they can't be indexed.
+func (is *indexSink) WriteData(string, structs.Data) error {
+	if err := searchIndex.Flush(is.ctx); err != nil {
+		return fmt.Errorf("could not index messages: %w", err)
+	}
+
+	return nil
+}
+
+func (is *indexSink) Close(error) error {
+	return nil
+}
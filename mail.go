@@ -0,0 +1,256 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/slack-go/slack"
+
+	"github.com/chuhlomin/slack-exporter/pkg/atomicfile"
+	"github.com/chuhlomin/slack-exporter/pkg/mail"
+	"github.com/chuhlomin/slack-exporter/pkg/render"
+	"github.com/chuhlomin/slack-exporter/pkg/structs"
+)
+
+// mailDomain is the domain of Message-IDs and of the addresses of participants without emails.
+const mailDomain = "slack.invalid"
+
+const mailSubjectLength = 78
+
+// mailWriter converts every thread to an e-mail from the author of the parent message
+// to the rest of participants, for e-discovery and mail archiving tools.
+// With mbox format the messages are appended to <channel>.mbox,
+// with eml format every message is a <channel>.eml/<ts>.eml file.
+// The rest of the data is written to <channel>.meta.json.
+type mailWriter struct {
+	mbox *pendingFile
+	eml  *pendingDir
+	meta *pendingFile
+	head channelHead
+
+	users userLookup
+}
+
+func newMailWriter(channel *slack.Channel, members []string, users userLookup, period string) (*mailWriter, error) {
+	messagesFilename, metaFilename := channelFilenames(channel.ID, period)
+
+	mw := &mailWriter{
+		head:  newChannelHead(channel, members),
+		users: users,
+	}
+
+	var err error
+	if cfg.Format == formatMbox {
+		mw.mbox, err = createPending(messagesFilename)
+	} else {
+		mw.eml, err = createPendingDir(messagesFilename)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	mw.meta, err = createPending(metaFilename)
+	if err != nil {
+		mw.Abort()
+		return nil, err
+	}
+
+	return mw, nil
+}
+
+func (mw *mailWriter) WriteMessage(msg structs.Message) error {
+	m := mw.message(msg)
+
+	if mw.mbox != nil {
+		return mail.WriteMbox(mw.mbox, m)
+	}
+
+	file, err := os.Create(filepath.Join(mw.eml.tmp, msg.Timestamp+".eml"))
+	if err != nil {
+		return fmt.Errorf("could not create file: %w", err)
+	}
+	defer file.Close()
+
+	return mail.WriteEML(file, m)
+}
+
+// message returns the thread as a message: the parent message with replies quoted below it.
+func (mw *mailWriter) message(msg structs.Message) mail.Message {
+	channel := mw.head.Channel
+	from := mw.address(msg.Message)
+
+	// everyone who replied to the thread, the channel itself when nobody did
+	var to []mail.Address
+	seen := map[string]bool{from.Email: true}
+	for _, reply := range msg.Replies {
+		a := mw.address(reply)
+		if !seen[a.Email] {
+			seen[a.Email] = true
+			to = append(to, a)
+		}
+	}
+
+	channelAddress := mail.Address{Name: mailChannelName(channel), Email: channel.ID + "@" + mailDomain}
+	if len(to) == 0 {
+		to = []mail.Address{channelAddress}
+	}
+
+	headers := [][2]string{
+		{"X-Slack-Channel", channel.ID},
+		{"X-Slack-Ts", msg.Timestamp},
+	}
+	if msg.Permalink != "" {
+		headers = append(headers, [2]string{"X-Slack-Permalink", msg.Permalink})
+	}
+
+	var body strings.Builder
+	mw.writeBody(&body, msg.Message)
+	for _, reply := range msg.Replies {
+		fmt.Fprintf(&body, "\n-- %s, %s\n", mw.address(reply).Name, localTime(reply.Timestamp).Format(pdfTimeFormat))
+		mw.writeBody(&body, reply)
+	}
+
+	return mail.Message{
+		ID:      msg.Timestamp + "." + channel.ID + "@" + mailDomain,
+		From:    from,
+		To:      to,
+		Subject: mailSubject(channel, plainText(render.Text(msg.Message), mw.users)),
+		Date:    localTime(msg.Timestamp),
+		Body:    body.String(),
+		Headers: headers,
+	}
+}
+
+func (mw *mailWriter) writeBody(b *strings.Builder, msg slack.Message) {
+	b.WriteString(plainText(render.Text(msg), mw.users))
+	b.WriteString("\n")
+
+	for _, f := range msg.Files {
+		b.WriteString("Attachment: " + f.Name + "\n")
+	}
+
+	if reactions := reactionsSummary(msg); reactions != "" {
+		b.WriteString("Reactions: " + reactions + "\n")
+	}
+}
+
+// address returns the mailbox of the message author, users without emails
+// and bots get addresses in mailDomain.
+func (mw *mailWriter) address(msg slack.Message) mail.Address {
+	if msg.User == "" {
+		id := first(msg.BotID, msg.Username, "unknown")
+		return mail.Address{Name: first(msg.Username, msg.BotID), Email: id + "@" + mailDomain}
+	}
+
+	u, err := mw.users(msg.User)
+	if err != nil || u == nil {
+		return mail.Address{Name: msg.User, Email: msg.User + "@" + mailDomain}
+	}
+
+	return mail.Address{
+		Name:  userDisplayName(u),
+		Email: first(u.Profile.Email, u.ID+"@"+mailDomain),
+	}
+}
+
+func mailChannelName(channel *slack.Channel) string {
+	if channel.Name != "" {
+		return "#" + channel.Name
+	}
+	return channel.ID
+}
+
+// mailSubject returns the channel name and the first line of the text, shortened to fit the line.
+func mailSubject(channel *slack.Channel, text string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+	subject := "[" + mailChannelName(channel) + "] " + line
+
+	if r := []rune(subject); len(r) > mailSubjectLength {
+		subject = string(r[:mailSubjectLength-1]) + "…"
+	}
+
+	return subject
+}
+
+func (mw *mailWriter) Close(data structs.Data) error {
+	if err := writeMeta(mw.meta, mw.head, data); err != nil {
+		mw.Abort()
+		return err
+	}
+
+	var err error
+	if mw.mbox != nil {
+		err = mw.mbox.Commit()
+	} else {
+		err = mw.eml.Commit()
+	}
+	if err != nil {
+		mw.meta.Abort()
+		return err
+	}
+
+	return mw.meta.Commit()
+}
+
+// Sync commits the mbox to disk, .eml files are written whole.
+func (mw *mailWriter) Sync() error {
+	if mw.mbox == nil {
+		return nil
+	}
+
+	return mw.mbox.Sync()
+}
+
+func (mw *mailWriter) Abort() {
+	if mw.mbox != nil {
+		mw.mbox.Abort()
+	}
+	if mw.eml != nil {
+		mw.eml.Abort()
+	}
+	if mw.meta != nil {
+		mw.meta.Abort()
+	}
+}
+
+// pendingDir is a directory written next to the destination and moved in place on Commit.
+type pendingDir struct {
+	path string
+	tmp  string
+}
+
+func createPendingDir(path string) (*pendingDir, error) {
+	tmp := path + atomicfile.Suffix
+	if err := os.RemoveAll(tmp); err != nil {
+		return nil, fmt.Errorf("could not remove directory: %w", err)
+	}
+
+	if err := os.MkdirAll(tmp, 0o755); err != nil {
+		return nil, fmt.Errorf("could not create directory: %w", err)
+	}
+
+	return &pendingDir{path: path, tmp: tmp}, nil
+}
+
+// Commit replaces the destination with the directory.
+func (pd *pendingDir) Commit() error {
+	if err := os.RemoveAll(pd.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		pd.Abort()
+		return fmt.Errorf("could not remove directory: %w", err)
+	}
+
+	if err := os.Rename(pd.tmp, pd.path); err != nil {
+		pd.Abort()
+		return fmt.Errorf("could not rename directory: %w", err)
+	}
+
+	return nil
+}
+
+// Abort removes the directory; it's a no-op after Commit.
+func (pd *pendingDir) Abort() {
+	os.RemoveAll(pd.tmp)
+}
@@ -6,30 +6,93 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"maps"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/bubbles/progress"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/chuhlomin/slack-exporter/pkg/atomicfile"
+	"github.com/chuhlomin/slack-exporter/pkg/ics"
+	"github.com/chuhlomin/slack-exporter/pkg/identity"
+	"github.com/chuhlomin/slack-exporter/pkg/redact"
 	"github.com/chuhlomin/slack-exporter/pkg/structs"
 	"github.com/jessevdk/go-flags"
+	"github.com/slack-go/slack"
 )
 
 type config struct {
-	Channels        string `env:"CHANNELS" long:"channels" description:"Slack channel ID; pass \"public\" to export all public channels"`
-	Output          string `env:"OUTPUT" long:"output" description:"Output directory" default:"output"`
-	APIToken        string `env:"API_TOKEN" long:"api-token" description:"Slack API Token"`
-	AppClientID     string `env:"APP_CLIENT_ID" long:"app-client-id" description:"Slack App Client ID"`
-	AppClientSecret string `env:"APP_CLIENT_SECRET" long:"app-client-secret" description:"Slack App Client Secret"`
-	Address         string `env:"ADDRESS" long:"address" description:"Server address" default:"localhost"`
-	Port            string `env:"PORT" long:"port" description:"Server port" default:"8079"`
-	DownloadFiles   bool   `env:"DOWNLOAD_FILES" long:"download-files" description:"Download files"`
-	DownloadAvatars bool   `env:"DOWNLOAD_AVATARS" long:"download-avatars" description:"Download avatars"`
-	IncludeArchived bool   `env:"SKIP_ARCHIVED" long:"include-archived" description:"Include archived channels"`
+	Channels           string        `env:"CHANNELS" long:"channels" description:"Slack channel ID; pass \"public\" to export all public channels"`
+	Output             string        `env:"OUTPUT" long:"output" description:"Output directory" default:"output"`
+	APIToken           string        `env:"API_TOKEN" long:"api-token" description:"Slack API Token"`
+	RefreshToken       string        `env:"REFRESH_TOKEN" long:"refresh-token" description:"Refresh token of --api-token of the app with token rotation enabled, the token is refreshed before it expires"`
+	TokenFile          string        `env:"TOKEN_FILE" long:"token-file" description:"File keeping the token and the refresh token of the app with token rotation enabled: read instead of --api-token and --refresh-token when it exists, written when the app is authorized and when the token is refreshed"`
+	AppClientID        string        `env:"APP_CLIENT_ID" long:"app-client-id" description:"Slack App Client ID"`
+	AppClientSecret    string        `env:"APP_CLIENT_SECRET" long:"app-client-secret" description:"Slack App Client Secret"`
+	Scopes             []string      `env:"SCOPES" env-delim:"," long:"scope" description:"User scope the app asks for when it's authorized in the browser, instead of the scopes needed for --channels and the enabled options; can be repeated"`
+	Proxy              string        `env:"PROXY" long:"proxy" description:"Proxy of all requests, like http://proxy:3128; without it HTTPS_PROXY, HTTP_PROXY and NO_PROXY are used"`
+	CACert             string        `env:"CA_CERT" long:"ca-cert" description:"PEM file with certificates of CAs to trust besides the system ones, like the CA of the firewall intercepting TLS"`
+	InsecureSkipVerify bool          `env:"INSECURE_SKIP_VERIFY" long:"insecure-skip-verify" description:"Do not verify TLS certificates; only to debug, the tokens can be intercepted"`
+	ConnectTimeout     time.Duration `env:"CONNECT_TIMEOUT" long:"connect-timeout" description:"How long to wait for the connection and the TLS handshake" default:"30s"`
+	StallTimeout       time.Duration `env:"STALL_TIMEOUT" long:"stall-timeout" description:"Abort the request when no response or no data of the response (like of the downloaded file) is received for the duration, 0 to wait forever" default:"2m"`
+	MaxIdleConns       int           `env:"MAX_IDLE_CONNS" long:"max-idle-conns" description:"Idle connections kept open per host to reuse (Slack API and files are on a few hosts)" default:"16"`
+	Secrets            string        `env:"SECRETS" long:"secrets" description:"Read app_client_id, app_client_secret, api_token and external_users_token from the secret: vault:<path> (with VAULT_ADDR and VAULT_TOKEN) or aws:<name or ARN> (AWS Secrets Manager)"`
+	SecretsTTL         time.Duration `env:"SECRETS_TTL" long:"secrets-ttl" description:"How long the secret is cached before it's fetched again (Vault leases can make it shorter)" default:"5m"`
+	Address            string        `env:"ADDRESS" long:"address" description:"Server address" default:"localhost"`
+	Port               string        `env:"PORT" long:"port" description:"Server port" default:"8079"`
+	Format             string        `env:"FORMAT" long:"format" description:"Output format: json, ndjson (one message per line), csv or parquet (one message or reply per row), pdf (rendered conversation for records) or mbox and eml (thread per e-mail for e-discovery); other than json formats write the rest of the data to <channel>.meta.json" choice:"json" choice:"ndjson" choice:"csv" choice:"parquet" choice:"pdf" choice:"mbox" choice:"eml" default:"json"`
+	Pretty             bool          `env:"PRETTY" long:"pretty" description:"Indent JSON of channels (and <channel>.meta.json of other formats) to read and diff it as text"`
+	Compress           bool          `env:"COMPRESS" long:"compress" description:"Write channels to gzip-compressed <channel>.json.gz (json format only), the viewers and commands read them as is"`
+	HumanTime          bool          `env:"HUMAN_TIME" long:"human-time" description:"Add ISO 8601 time in --timezone next to Slack ts of messages and replies (time field or column)"`
+	Timezone           location      `env:"TIMEZONE" long:"timezone" description:"Time zone of human-readable times, like Europe/Berlin or UTC" default:"Local"`
+	SplitBy            string        `env:"SPLIT_BY" long:"split-by" description:"Split messages (with threads) into <channel>.<period>.<format> files by day, month or year; the rest of the data goes to <channel>.meta.json" choice:"day" choice:"month" choice:"year"`
+	FlushEvery         int           `env:"FLUSH_EVERY" long:"flush-every" description:"Commit streamed messages to disk every N messages (json, ndjson, csv, parquet and mbox), 0 to write them buffered; with parquet every commit is a row group"`
+	Thumbnails         bool          `env:"THUMBNAILS" long:"thumbnails" description:"Generate thumbnails of downloaded images (and of videos with ffmpeg in PATH) for the HTML viewers"`
+	FileLayout         string        `env:"FILE_LAYOUT" long:"file-layout" description:"Where downloaded files are linked in the output directory: {channel} (ID), {yyyy}, {mm} and {dd} (upload date in --timezone), {thread} (ts of the thread), {id} and {name}, like {channel}/{yyyy}/{mm}/{id}-{name}" default:"{channel}/{id}-{name}"`
+	MaxFileSize        byteSize      `env:"MAX_FILE_SIZE" long:"max-file-size" description:"Do not download files larger than the size, like 100MB (metadata and URLs are still exported)"`
+	MaxTotalSize       byteSize      `env:"MAX_TOTAL_SIZE" long:"max-total-size" description:"Stop the export before it writes more than the size, like 50GB, to the output directory"`
+	IncludeFileTypes   []string      `env:"INCLUDE_FILE_TYPES" env-delim:"," long:"include-file-types" description:"Download only files of the types, like pdf or image/*; can be repeated"`
+	ExcludeFileTypes   []string      `env:"EXCLUDE_FILE_TYPES" env-delim:"," long:"exclude-file-types" description:"Do not download files of the types, like mp4 or video/*; can be repeated"`
+	MaxRate            float64       `env:"MAX_RATE" long:"max-rate" description:"Requests per minute of Tier 3 methods (like conversations.history) the exporter may speed up to while Slack is not rate limiting it, other tiers are scaled" default:"200"`
+	Since              date          `env:"SINCE" long:"since" description:"Export only messages (with threads) posted on or after the day, like 2024-01-31"`
+	Until              date          `env:"UNTIL" long:"until" description:"Export only messages (with threads) posted on or before the day, like 2024-12-31"`
+	ProfileFields      bool          `env:"PROFILE_FIELDS" long:"profile-fields" description:"Include custom profile fields of users (requires users.profile:read scope)"`
+	GoogleDriveToken   string        `env:"GOOGLE_DRIVE_TOKEN" long:"google-drive-token" description:"OAuth token of Google Drive (drive.readonly scope) to download files shared from it with --download-files, Google Docs are exported to PDF"`
+	DropboxToken       string        `env:"DROPBOX_TOKEN" long:"dropbox-token" description:"Token of the Dropbox app (sharing.read scope) to download files shared from Dropbox with --download-files"`
+	CacheDir           string        `env:"CACHE_DIR" long:"cache-dir" description:"Directory to cache users with their profiles, channels and custom emoji between runs (channels for 15 minutes at most, so their names, topics and archived status are current)"`
+	CacheTTL           time.Duration `env:"CACHE_TTL" long:"cache-ttl" description:"How long cached users, profiles and custom emoji are valid" default:"24h"`
+	DebugShowSecrets   bool          `env:"DEBUG_SHOW_SECRETS" long:"debug-show-secrets" description:"Do not redact tokens, the app client secret and signed URLs in the log, errors.json and result.json; only to debug requests"`
+	ThreadConcurrency  int           `env:"THREAD_CONCURRENCY" long:"thread-concurrency" description:"Threads of the history page to fetch replies of at a time, paced by the same rate limiter" default:"4"`
+	PageSize           int           `env:"PAGE_SIZE" long:"page-size" description:"Items per page of history, thread replies and other paginated methods (1 to 999, the largest history page of Slack), capped by the largest page of every method; the history page is halved while Slack fails to return it" default:"999"`
+	Index              string        `env:"INDEX" long:"index" description:"Elasticsearch/OpenSearch index URL to bulk-index messages to, like http://localhost:9200/slack"`
+	Source             string        `env:"SOURCE" long:"source" description:"Where render, analyze and emoji read channels from: the JSON export in the output directory (archive) or the Slack API with --api-token for --channels IDs (slack), --since and --until apply" choice:"archive" choice:"slack" default:"archive"`
+	IdentitiesFile     string        `env:"IDENTITIES" long:"identities" description:"JSON file written by the identities command: users of several workspaces who are the same person are counted once by analyze and in workspaces.json"`
+
+	exportOptions `no-flag:"true"`
+
+	Export     exportCommand     `command:"export" description:"Export messages to the output directory (running the app without a command is the deprecated alias)"`
+	Auth       authCommand       `command:"auth" description:"Authorize the app and print the token, or check --api-token"`
+	Users      usersCommand      `command:"users" description:"Export all users of the workspace to users.json in the output directory"`
+	Files      filesCommand      `command:"files" description:"Manage files of the existing export"`
+	Identities identitiesCommand `command:"identities" description:"Map users of several workspaces to people by email"`
+	Serve      serveCommand      `command:"serve" description:"Browse the export in the output directory in a web browser"`
+	Search     searchCommand     `command:"search" description:"Search messages of the export in the output directory"`
+	Prune      pruneCommand      `command:"prune" description:"Remove old messages or whole channels from the export in the output directory"`
+	Emoji      emojiCommand      `command:"emoji" subcommands-optional:"yes" description:"Count emoji used in messages and reactions of the export in the output directory, or download custom emoji"`
+	Analyze    analyzeCommand    `command:"analyze" description:"Report activity of users and channels of the export in the output directory"`
+	Schema     schemaCommand     `command:"schema" description:"Generate archive layout documentation and JSON Schemas"`
+	Render     renderCommand     `command:"render" description:"Write channels of the export (or --source slack) to the output directory in --format"`
+	Import     importCommand     `command:"import-slack-export" description:"Convert the ZIP file of the official Slack export to the output directory in --format"`
+	FetchFiles fetchFilesCommand `command:"fetch-files" description:"Download files of the messages-only export: the one in the output directory or the official Slack export"`
+	Verify     verifyCommand     `command:"verify" description:"Compare messages and replies of every day of the export in the output directory with Slack and report gaps"`
+	Diff       diffCommand       `command:"diff" description:"Report messages added, edited and deleted between two exports of the same channels"`
+	Migrate    migrateCommand    `command:"migrate" description:"Upgrade channels of the export in the output directory to the latest schema version"`
 }
 
 var (
@@ -40,37 +103,164 @@ var (
 )
 
 func main() {
-	if err := run(); err != nil {
-		log.Fatalf("Error: %v", err)
+	summary.Started = time.Now()
+	err := run()
+	summary.Finished = time.Now()
+
+	if err != nil {
+		summary.Failures = append(summary.Failures, redact.String(err.Error()))
+	}
+
+	code := exitCode(err)
+	// only exports have a summary to report, not --help, parse errors and other commands
+	if exportRun {
+		notifyWebhooks(eventRun, summary)
+
+		if err := writeResult(code, err); err != nil {
+			log.Printf("Could not write %s: %v", resultFilename, err)
+		}
+	}
+
+	if err != nil {
+		log.Printf("Error: %v", err)
+		os.Exit(code)
 	}
 }
 
 func run() error {
-	if _, err := flags.Parse(&cfg); err != nil {
+	cfg.Export.Options = &cfg.exportOptions
+	parser := flags.NewParser(&cfg, flags.Default)
+
+	var (
+		command     flags.Commander
+		commandArgs []string
+	)
+	parser.CommandHandler = func(c flags.Commander, args []string) error {
+		command, commandArgs = c, args
+		return nil
+	}
+
+	if _, err := parser.ParseArgs(exportArgs(os.Args[1:])); err != nil {
 		return fmt.Errorf("could not parse flags: %w", err)
 	}
 
-	if cfg.AppClientID == "" || cfg.AppClientSecret == "" {
-		model := initialModelInputs(cfg.AppClientID, cfg.AppClientSecret)
-		if _, err := tea.NewProgram(model).Run(); err != nil {
-			return fmt.Errorf("could not get inputs: %w", err)
+	// every command paginating Slack methods (like verify) uses the page size
+	if cfg.PageSize < 1 || cfg.PageSize > methodPageSizes["conversations.history"] {
+		return errPageSize
+	}
+
+	if cfg.DebugShowSecrets {
+		redact.Disable()
+	} else {
+		log.SetOutput(redact.Writer(os.Stderr))
+	}
+
+	if err := setupHTTP(); err != nil {
+		return err
+	}
+
+	if cfg.Secrets != "" {
+		if err := loadSecrets(context.Background()); err != nil {
+			return fmt.Errorf("could not load secrets: %w", err)
+		}
+	}
+
+	if cfg.TokenFile != "" {
+		if err := loadTokenFile(); err != nil {
+			return err
 		}
+	}
+
+	if cfg.IdentitiesFile != "" {
+		m, err := identity.Load(cfg.IdentitiesFile)
+		if err != nil {
+			return err
+		}
+		identities = m
+	}
+
+	redactCredentials()
+
+	return command.Execute(commandArgs)
+}
+
+// runExport exports messages of the workspace, workspaces or the org to the output directory.
+func runExport() error {
+	exportRun = true
+
+	if cfg.ExcludeBots && cfg.OnlyBots {
+		return errBotsFilters
+	}
+
+	if err := checkFileLayout(); err != nil {
+		return err
+	}
+
+	if cfg.Compress && cfg.Format != formatJSON {
+		return errCompressFormat
+	}
 
-		if len(model.inputs) != 3 {
-			return errExpectedThreeInputs
+	if cfg.FilesOnly {
+		if cfg.NoContent {
+			return errFilesOnlyNoContent
 		}
+		cfg.DownloadFiles = true
+	}
 
-		cfg.AppClientID = model.inputs[0].Value()
-		cfg.AppClientSecret = model.inputs[1].Value()
-		cfg.APIToken = model.inputs[2].Value()
+	if cfg.SkipFiles && (cfg.DownloadFiles || cfg.FileMetadata || cfg.Calls || cfg.Lists || cfg.FilesOnly) {
+		return errSkipFiles
+	}
 
-		if cfg.AppClientID == "" || cfg.AppClientSecret == "" {
-			return errMissingClientIDAndSecret
+	if cfg.FinalSnapshot {
+		if err := applyFinalSnapshot(); err != nil {
+			return err
 		}
 	}
 
-	c := NewSlackClient(cfg.AppClientID, cfg.AppClientSecret)
+	if cfg.Org {
+		return exportOrg()
+	}
+
+	if cfg.Workspaces != "" {
+		return exportWorkspaces()
+	}
+
+	if err := promptApp(); err != nil {
+		return err
+	}
+
+	return exportWorkspace(NewSlackClient(cfg.AppClientID, cfg.AppClientSecret))
+}
+
+// promptApp asks for the app client ID and secret (and the optional token) when they are not set.
+func promptApp() error {
+	if cfg.AppClientID != "" && cfg.AppClientSecret != "" {
+		return nil
+	}
+
+	model := initialModelInputs(cfg.AppClientID, cfg.AppClientSecret)
+	if _, err := tea.NewProgram(model).Run(); err != nil {
+		return fmt.Errorf("could not get inputs: %w", err)
+	}
+
+	if len(model.inputs) != 3 {
+		return errExpectedThreeInputs
+	}
+
+	cfg.AppClientID = model.inputs[0].Value()
+	cfg.AppClientSecret = model.inputs[1].Value()
+	cfg.APIToken = model.inputs[2].Value()
+	redactCredentials()
+
+	if cfg.AppClientID == "" || cfg.AppClientSecret == "" {
+		return errMissingClientIDAndSecret
+	}
+
+	return nil
+}
 
+// exportWorkspace exports the workspace of the token to the output directory.
+func exportWorkspace(c *SlackClient) error {
 	if cfg.APIToken == "" {
 		err := getToken(c)
 		if err != nil {
@@ -80,11 +270,111 @@ func run() error {
 		c.SetToken(cfg.APIToken)
 	}
 
+	if cfg.ExternalUsersToken != "" {
+		c.SetExternalToken(cfg.ExternalUsersToken)
+	}
+
+	if cfg.CacheDir != "" {
+		if err := c.SetCacheDir(cfg.CacheDir, cfg.CacheTTL); err != nil {
+			return fmt.Errorf("could not set cache: %w", err)
+		}
+
+		defer func() {
+			if err := c.SaveCache(); err != nil {
+				log.Printf("Could not save cache: %v", err)
+			}
+		}()
+	}
+
 	// make sure the output directory exists
 	if err := os.MkdirAll(cfg.Output, 0o755); err != nil {
 		return fmt.Errorf("could not create output directory: %w", err)
 	}
 
+	// unfinished files of the interrupted run (like a partially downloaded file) are written again
+	removed, err := atomicfile.RemoveUnfinished(cfg.Output)
+	if err != nil {
+		return fmt.Errorf("could not remove unfinished files: %w", err)
+	}
+	if removed > 0 {
+		log.Printf("Removed %d unfinished files of the interrupted run", removed)
+	}
+
+	if err := reserveSpace(0); err != nil {
+		return err
+	}
+	if free, ok := freeSpace(cfg.Output); ok {
+		log.Printf("%s of disk space is free in the output directory", byteSize(free))
+	}
+
+	if cfg.Index != "" {
+		if err := openSearchIndex(context.Background()); err != nil {
+			return fmt.Errorf("could not open search index: %w", err)
+		}
+	}
+
+	checkpoint, err = loadProgress(cfg.Output, cfg.Resume)
+	if err != nil {
+		return fmt.Errorf("could not load progress: %w", err)
+	}
+
+	failures = &failureReport{}
+
+	if _, _, err := c.Origin(); err != nil {
+		return fmt.Errorf("could not get workspace: %w", err)
+	}
+
+	err = export(c)
+	if err != nil && isTokenRevoked(err) && secretStore != nil {
+		// the token could be rotated in the secret, exported channels are skipped on retry
+		renewed, renewErr := renewToken(context.Background(), c)
+		if renewErr != nil {
+			log.Printf("Could not renew token: %v", renewErr)
+		}
+		if renewed {
+			err = export(c)
+		}
+	}
+
+	if writeErr := failures.Write(cfg.Output); writeErr != nil {
+		log.Printf("Could not write %s: %v", errorsFilename, writeErr)
+	}
+
+	if err != nil {
+		if isTokenRevoked(err) {
+			return fmt.Errorf(
+				"%w: %d channels are exported, get a new token and re-run with --resume to continue: %v",
+				errTokenRevoked,
+				len(checkpoint.Completed),
+				err,
+			)
+		}
+		return err
+	}
+
+	if err := checkpoint.Remove(); err != nil {
+		return err
+	}
+
+	if cfg.FinalSnapshot {
+		if err := finishSnapshot(c); err != nil {
+			return err
+		}
+	}
+
+	return checkFailures()
+}
+
+// export exports selected channels and downloads avatars.
+func export(c *SlackClient) error {
+	if cfg.Interactive {
+		ids, err := pickChannels(c)
+		if err != nil {
+			return err
+		}
+		cfg.Channels = strings.Join(ids, ",")
+	}
+
 	if cfg.Channels == "" {
 		model := initialModelChoices(
 			cfg.DownloadAvatars,
@@ -103,7 +393,7 @@ func run() error {
 			if i == downloadAvatarsIndex {
 				cfg.DownloadAvatars = true
 			}
-			if i == downloadFilesIndex {
+			if i == downloadFilesIndex && !cfg.SkipFiles {
 				cfg.DownloadFiles = true
 			}
 			if i == includeArchivedIndex {
@@ -127,30 +417,95 @@ func run() error {
 		}
 	}
 
-	channels := strings.Split(cfg.Channels, ",")
+	// filters compare authors of messages with IDs
+	for i, name := range cfg.User {
+		id, err := c.FindUser(name)
+		if err != nil {
+			return fmt.Errorf("could not find user of --user: %w", err)
+		}
+		cfg.User[i] = id
+	}
 
-	var channelTypes []string
-	for _, channel := range channels {
+	var channelIDs, channelTypes []string
+	for _, channel := range strings.Split(cfg.Channels, ",") {
 		switch channel {
 		case "public_channel", "private_channel", "mpim", "im":
 			channelTypes = append(channelTypes, channel)
 		case "":
 			continue
 		default:
-			err := exportChannel(c, channel)
-			if err != nil {
+			channelIDs = append(channelIDs, channel)
+		}
+	}
+
+	var channels []slack.Channel
+	if len(channelTypes) > 0 {
+		var err error
+		channels, err = c.GetChannels(channelTypes)
+		if err != nil {
+			return fmt.Errorf("could not get channels: %w", err)
+		}
+		channels = skipArchived(channels)
+	}
+
+	if err := preflight(c, channelIDs, channels); err != nil {
+		return err
+	}
+
+	for _, channel := range channelIDs {
+		err := exportChannel(c, channel)
+		if err != nil {
+			if isTokenRevoked(err) || isOutOfSpace(err) {
 				return fmt.Errorf("could not export channel %q: %w", channel, err)
 			}
+			log.Printf("Could not export channel %q: %v", channel, err)
+			failures.Add(statusFailed, "channel", channel, err)
 		}
 	}
 
-	if len(channelTypes) > 0 {
-		err := exportChannels(c, channelTypes)
+	if len(channels) > 0 {
+		err := exportChannels(c, channels)
 		if err != nil {
 			return fmt.Errorf("could not export channels: %w", err)
 		}
 	}
 
+	if cfg.Sidebar {
+		if err := exportSidebar(c); err != nil {
+			return fmt.Errorf("could not export sidebar: %w", err)
+		}
+	}
+
+	if cfg.Format == formatParquet {
+		if err := writeUsersParquet(c.UsersCache); err != nil {
+			return fmt.Errorf("could not write users: %w", err)
+		}
+	}
+
+	if cfg.Reminders {
+		if err := exportReminders(c); err != nil {
+			return fmt.Errorf("could not export reminders: %w", err)
+		}
+	}
+
+	if cfg.AuditLogs {
+		if err := exportAuditLogs(c); err != nil {
+			return fmt.Errorf("could not export audit logs: %w", err)
+		}
+	}
+
+	if cfg.Saved {
+		if err := exportSaved(c); err != nil {
+			return fmt.Errorf("could not export saved items: %w", err)
+		}
+	}
+
+	if cfg.Branding {
+		if err := exportBranding(c); err != nil {
+			return fmt.Errorf("could not export branding: %w", err)
+		}
+	}
+
 	if cfg.DownloadAvatars {
 		log.Println("Downloading avatars")
 		if err := downloadAvatars(c); err != nil {
@@ -183,47 +538,219 @@ func getToken(c *SlackClient) error {
 	return nil
 }
 
-func exportChannel(c *SlackClient, channelID string) error {
+func exportChannel(c *SlackClient, channelID string) (err error) {
+	if checkpoint.Done(channelID) {
+		return nil
+	}
+
+	if err := reserveSpace(0); err != nil {
+		return err
+	}
+
 	channelInfo, err := c.GetChannelInfo(channelID)
 	if err != nil {
 		return fmt.Errorf("could not get channel %q info: %w", channelID, err)
 	}
 
 	if channelInfo.IsArchived && !cfg.IncludeArchived {
+		log.Printf("Channel %q is archived, skipping (export it with --include-archived)", channelID)
 		return nil
 	}
 
-	outputFilename := filepath.Join(cfg.Output, channelID+".json")
+	// pull users and messages of the previous export
+	previousUsers, previousMessages, err := readPrevious(channelID)
+	if err != nil {
+		return fmt.Errorf("could not read previous export: %w", err)
+	}
+
+	for id, user := range previousUsers {
+		c.UsersCache[id] = user
+	}
+
+	members, err := c.GetMembers(channelID)
+	if err != nil {
+		return fmt.Errorf("could not get members: %w", err)
+	}
 
-	// check if the file already exists
-	if _, err := os.Stat(outputFilename); err == nil {
-		// read the file to pull users
-		data, err := os.ReadFile(outputFilename)
+	sink := newChannelSink(members, c.GetUser)
+	if err := sink.WriteChannel(channelInfo); err != nil {
+		return err
+	}
+	// the channel is discarded when its export fails, closing the closed sink is a no-op
+	defer func() {
 		if err != nil {
-			return fmt.Errorf("could not read file: %w", err)
+			sink.Close(err)
 		}
+	}()
+
+	filters := messageFilters(channelID)
 
-		var d structs.Data
-		if err = json.Unmarshal(data, &d); err != nil {
-			return fmt.Errorf("could not unmarshal data: %w", err)
+	// file comments are content, so they are skipped with --no-content
+	var fileComments map[string][]slack.Comment
+	if cfg.FileMetadata && !cfg.NoContent {
+		fileComments = map[string][]slack.Comment{}
+	}
+
+	var lists map[string]*structs.List
+	if cfg.Lists && !cfg.NoContent {
+		lists = map[string]*structs.List{}
+	}
+
+	// files are downloaded with their message, so its file entries have the local paths
+	var files, filePaths, missingFiles, thumbnails map[string]string
+	if cfg.DownloadFiles && !cfg.NoContent {
+		files, filePaths, missingFiles = map[string]string{}, map[string]string{}, map[string]string{}
+		if cfg.Thumbnails {
+			thumbnails = map[string]string{}
 		}
+	}
+
+	var (
+		messages, messagesAdded int
+		replies                 int
+		fileMetadata            []slack.File
+	)
 
-		for id, user := range d.Users {
-			c.UsersCache[id] = user
+	// workspaces are exported for shared channels only, other channels have the workspace of the token
+	var teamIDs map[string]struct{}
+	if cfg.SharedTeams && (channelInfo.IsShared || channelInfo.IsExtShared || channelInfo.IsOrgShared) {
+		teamIDs = map[string]struct{}{}
+		for _, id := range slices.Concat(channelInfo.SharedTeamIDs, channelInfo.ConnectedTeamIDs) {
+			teamIDs[id] = struct{}{}
 		}
 	}
 
-	msgs, err := c.GetMessages(channelID)
-	if err != nil {
-		return fmt.Errorf("could not get messages: %w", err)
+	write := func(msg structs.Message) error {
+		msg.Replies = trimReplies(msg.Replies)
+
+		// only users of the exported messages are exported, not of the filtered out ones
+		c.markSeen(msg.Message)
+		for _, reply := range msg.Replies {
+			c.markSeen(reply)
+		}
+
+		if teamIDs != nil {
+			if err := c.AddTeam(&msg); err != nil {
+				return err
+			}
+
+			teamIDs[msg.Team] = struct{}{}
+			for _, reply := range msg.Replies {
+				teamIDs[reply.Team] = struct{}{}
+			}
+		}
+
+		if cfg.Calls {
+			if err := c.AddCall(channelID, &msg); err != nil {
+				return err
+			}
+		}
+
+		msg.SharedMessages = sharedMessages(msg)
+		if cfg.SharedMessages {
+			if err := c.ResolveSharedMessages(&msg); err != nil {
+				return err
+			}
+		}
+
+		if cfg.Permalinks {
+			if err := c.AddPermalinks(channelID, &msg); err != nil {
+				return err
+			}
+		}
+
+		if cfg.FileMetadata {
+			if err := c.EnrichFiles(msg, fileComments); err != nil {
+				return fmt.Errorf("could not get files metadata: %w", err)
+			}
+		}
+
+		messages++
+		replies += len(msg.Replies)
+		if _, ok := previousMessages[msg.Timestamp]; !ok {
+			messagesAdded++
+		}
+
+		if cfg.NoContent {
+			fileMetadata = append(fileMetadata, withoutContent(msg)...)
+			return nil
+		}
+
+		msg.ExternalFiles = externalFiles(msg)
+
+		msg.Unfurls = unfurls(msg)
+		if cfg.UnfurlThumbnails {
+			downloadUnfurlThumbnails(msg.Unfurls)
+		}
+
+		c.CollectFiles(msg)
+
+		if files != nil {
+			downloaded, paths, err := c.DownloadFiles(channelID)
+			if err != nil {
+				return fmt.Errorf("could not download files: %w", err)
+			}
+
+			maps.Copy(files, downloaded)
+			maps.Copy(filePaths, paths)
+
+			var thumbs map[string]string
+			if thumbnails != nil {
+				thumbs = makeThumbnails(downloaded)
+				maps.Copy(thumbnails, thumbs)
+			}
+
+			msg.LocalFiles = localFiles(msg, paths, thumbs, c.missingFiles)
+			for id, file := range msg.LocalFiles {
+				if file.Status != structs.FileDownloaded && file.Status != structs.FileSkipped {
+					missingFiles[id] = file.Status
+				}
+			}
+		}
+
+		if lists != nil {
+			if err := c.AddLists(msg, lists); err != nil {
+				return fmt.Errorf("could not get lists: %w", err)
+			}
+		}
+
+		return sink.WriteMessage(channelID, msg)
 	}
 
-	var files map[string]string
-	if cfg.DownloadFiles {
-		files, err = c.DownloadFiles(channelID)
-		if err != nil {
-			return fmt.Errorf("could not download files: %w", err)
+	grep := newGrepContext()
+
+	// changes of the channel are recorded from all the messages, including filtered out ones
+	var history channelHistory
+	if cfg.ChannelMetadata {
+		history = channelHistory{}
+	}
+
+	handle := func(msg structs.Message) error {
+		if history != nil {
+			history.Add(msg.Message)
+		}
+
+		if !acceptMessage(msg, filters) {
+			return nil
+		}
+
+		if grep == nil {
+			return write(msg)
+		}
+
+		for _, m := range grep.Push(msg) {
+			if err := write(m); err != nil {
+				return err
+			}
 		}
+
+		return nil
+	}
+
+	// messages of pages fetched before the interruption are written again
+	// as the output file of the channel is only moved in place once it's complete
+	if err := c.EachMessage(channelID, handle); err != nil {
+		return fmt.Errorf("could not get messages: %w", err)
 	}
 
 	users, err := c.GetUsers()
@@ -231,32 +758,148 @@ func exportChannel(c *SlackClient, channelID string) error {
 		return fmt.Errorf("could not get users: %w", err)
 	}
 
+	userStatus, err := c.UserStatuses(users)
+	if err != nil {
+		return fmt.Errorf("could not get users status: %w", err)
+	}
+
+	var teamProfile *slack.TeamProfile
+	if cfg.ProfileFields {
+		teamProfile, err = c.GetTeamProfile()
+		if err != nil {
+			return fmt.Errorf("could not get team profile: %w", err)
+		}
+	}
+
+	// pins are content, so they are skipped with --no-content
+	var pins []slack.Item
+	if cfg.Pins && !cfg.NoContent {
+		pins, err = c.GetPins(channelID)
+		if err != nil {
+			return fmt.Errorf("could not get pins: %w", err)
+		}
+	}
+
+	var teams map[string]*structs.Team
+	if teamIDs != nil {
+		for _, u := range users {
+			teamIDs[u.TeamID] = struct{}{}
+		}
+
+		teams, err = c.GetTeams(channelInfo, teamIDs)
+		if err != nil {
+			return fmt.Errorf("could not get teams: %w", err)
+		}
+	}
+
 	data := structs.Data{
-		Channel:  *channelInfo,
-		Messages: msgs,
-		Users:    users,
-		Files:    files,
+		Users:        users,
+		UserStatus:   userStatus,
+		TeamProfile:  teamProfile,
+		Files:        files,
+		FilePaths:    filePaths,
+		MissingFiles: missingFiles,
+		Thumbnails:   thumbnails,
+		FileComments: fileComments,
+		Lists:        lists,
+		Teams:        teams,
+		Pins:         pins,
 	}
 
-	// Save to a file
-	content, err := json.Marshal(data)
-	if err != nil {
-		return fmt.Errorf("could not marshal messages: %w", err)
+	if cfg.NoContent {
+		data.MessageCount = messages
+		data.ReplyCount = replies
+		data.FileMetadata = fileMetadata
+	}
+
+	if err := sink.WriteData(channelID, data); err != nil {
+		return err
 	}
 
-	if err = os.WriteFile(outputFilename, content, 0o600); err != nil {
+	if err := sink.Close(nil); err != nil {
 		return fmt.Errorf("could not write messages to file: %w", err)
 	}
 
+	if history != nil {
+		if err := writeChannelMetadata(channelInfo, history); err != nil {
+			return fmt.Errorf("could not write channel metadata: %w", err)
+		}
+	}
+
+	workspace, exportedBy, err := c.Origin()
+	if err != nil {
+		return fmt.Errorf("could not get workspace: %w", err)
+	}
+
+	err = writeChannelManifest(structs.ChannelManifest{
+		Channel:    channelID,
+		Archived:   channelInfo.IsArchived,
+		Messages:   messages,
+		Replies:    replies,
+		Files:      len(filePaths),
+		Users:      len(users),
+		Scopes:     c.Scopes(),
+		Workspace:  workspace,
+		ExportedBy: exportedBy,
+	})
+	if err != nil {
+		return fmt.Errorf("could not write channel manifest: %w", err)
+	}
+
+	if err := checkpoint.Complete(channelID); err != nil {
+		return fmt.Errorf("could not save progress: %w", err)
+	}
+
+	summary.Channels++
+	summary.Messages += messages
+	summary.MessagesAdded += messagesAdded
+
+	if cfg.WebhookChannels {
+		messagesFilename, metaFilename := channelFilenames(channelID, "")
+		files := []string{filepath.Base(messagesFilename)}
+		switch {
+		case cfg.FilesOnly:
+			files = []string{filepath.Base(filesIndexFilename(channelID))}
+		case metaFilename != messagesFilename:
+			files = append(files, filepath.Base(metaFilename))
+		}
+
+		notifyWebhooks(eventChannel, channelSummary{
+			ID:            channelID,
+			Name:          channelInfo.Name,
+			Archived:      channelInfo.IsArchived,
+			Finished:      time.Now(),
+			Messages:      messages,
+			MessagesAdded: messagesAdded,
+			Files:         files,
+		})
+	}
+
 	return nil
 }
 
-func exportChannels(c *SlackClient, types []string) error {
-	channels, err := c.GetChannels(types)
-	if err != nil {
-		return fmt.Errorf("could not get public channels: %w", err)
+// skipArchived returns the listed channels without archived ones, unless --include-archived is set,
+// and reports how many of them are not exported.
+func skipArchived(channels []slack.Channel) []slack.Channel {
+	if cfg.IncludeArchived {
+		return channels
+	}
+
+	active := channels[:0]
+	for _, channel := range channels {
+		if !channel.IsArchived {
+			active = append(active, channel)
+		}
+	}
+
+	if skipped := len(channels) - len(active); skipped > 0 {
+		log.Printf("%d archived channels are skipped, export them with --include-archived", skipped)
 	}
 
+	return active
+}
+
+func exportChannels(c *SlackClient, channels []slack.Channel) error {
 	prog := progress.New(progress.WithScaledGradient("#FF7CCB", "#FDFF8C"))
 	fmt.Print(prog.ViewAs(0))
 	previousName := ""
@@ -273,7 +916,12 @@ func exportChannels(c *SlackClient, types []string) error {
 		)
 		err := exportChannel(c, channel.ID)
 		if err != nil {
-			return fmt.Errorf("could not export channel %q: %w", channel.Name, err)
+			if isTokenRevoked(err) || isOutOfSpace(err) {
+				return fmt.Errorf("could not export channel %q: %w", channel.Name, err)
+			}
+			// the channel is not marked as exported, so --resume tries it again
+			log.Printf("Could not export channel %q: %v", channel.Name, err)
+			failures.Add(statusFailed, "channel", channel.ID, err)
 		}
 		previousName = channel.Name
 	}
@@ -290,6 +938,163 @@ func exportChannels(c *SlackClient, types []string) error {
 	return nil
 }
 
+// exportSidebar saves the sidebar sections of the authed user.
+// Not all tokens are allowed to read the sidebar, in that case the export continues.
+func exportSidebar(c *SlackClient) error {
+	sections, err := c.GetSidebar()
+	if err != nil {
+		if isTokenRevoked(err) {
+			return err
+		}
+		log.Printf("Could not get sidebar sections, skipping: %v", err)
+		failures.Add(statusSkipped, "sidebar", "", err)
+		return nil
+	}
+
+	content, err := json.Marshal(sections)
+	if err != nil {
+		return fmt.Errorf("could not marshal sidebar: %w", err)
+	}
+
+	if err = writePending(filepath.Join(cfg.Output, "sidebar.json"), content); err != nil {
+		return fmt.Errorf("could not write sidebar to file: %w", err)
+	}
+
+	return nil
+}
+
+// exportReminders writes reminders to reminders.json
+// and the pending ones with due dates to reminders.ics.
+func exportReminders(c *SlackClient) error {
+	reminders, err := c.GetReminders()
+	if err != nil {
+		if isTokenRevoked(err) {
+			return err
+		}
+		log.Printf("Could not get reminders, skipping: %v", err)
+		failures.Add(statusSkipped, "reminders", "", err)
+		return nil
+	}
+
+	content, err := json.Marshal(reminders)
+	if err != nil {
+		return fmt.Errorf("could not marshal reminders: %w", err)
+	}
+
+	if err = writePending(filepath.Join(cfg.Output, "reminders.json"), content); err != nil {
+		return fmt.Errorf("could not write reminders to file: %w", err)
+	}
+
+	var events []ics.Event
+	for _, r := range reminders {
+		// completed reminders and the ones without the date (like recurring) are not follow-ups
+		if r.CompleteTS != 0 || r.Time == 0 {
+			continue
+		}
+
+		events = append(events, ics.Event{
+			UID:     r.ID + "@slack.com",
+			Summary: r.Text,
+			Start:   time.Unix(int64(r.Time), 0),
+			Alarm:   true,
+		})
+	}
+
+	file, err := createPending(filepath.Join(cfg.Output, "reminders.ics"))
+	if err != nil {
+		return fmt.Errorf("could not create calendar file: %w", err)
+	}
+	defer file.Abort()
+
+	if err := ics.Write(file, "Slack reminders", events); err != nil {
+		return err
+	}
+
+	return file.Commit()
+}
+
+// savedDir is the directory of the downloaded files of saved items.
+const savedDir = "saved"
+
+// exportSaved writes the items saved by the authed user to saved.json,
+// resolving the referenced messages with their threads and files.
+func exportSaved(c *SlackClient) error {
+	items, err := c.GetSaved()
+	if err != nil {
+		if isTokenRevoked(err) {
+			return err
+		}
+		log.Printf("Could not get saved items, skipping: %v", err)
+		failures.Add(statusSkipped, "saved", "", err)
+		return nil
+	}
+
+	saved := structs.Saved{Items: make([]structs.SavedItem, 0, len(items))}
+
+	for _, item := range items {
+		si := structs.SavedItem{Type: item.Type, Channel: item.Channel}
+
+		switch item.Type {
+		case slack.TYPE_MESSAGE:
+			if item.Message == nil {
+				continue
+			}
+			si.Message, err = c.GetMessage(item.Channel, item.Message.Timestamp)
+			if err != nil {
+				if isTokenRevoked(err) {
+					return err
+				}
+				log.Printf("Could not get saved message %s of %s, keeping the saved copy: %v", item.Message.Timestamp, item.Channel, err)
+				failures.Add(statusFailed, "message", item.Channel+"/"+item.Message.Timestamp, err)
+			}
+			if si.Message == nil {
+				si.Message = &structs.Message{Message: *item.Message}
+			}
+			c.CollectFiles(*si.Message)
+		case slack.TYPE_FILE, slack.TYPE_FILE_COMMENT:
+			if item.File == nil {
+				continue
+			}
+			si.File = item.File
+			if info, _, err := c.getFileInfo(item.File.ID); err == nil {
+				si.File = info
+			} else if isTokenRevoked(err) {
+				return err
+			}
+			c.CollectFiles(structs.Message{Message: slack.Message{Msg: slack.Msg{Files: []slack.File{*si.File}}}})
+		default:
+			// saved channels have nothing to resolve
+		}
+
+		saved.Items = append(saved.Items, si)
+	}
+
+	if cfg.DownloadFiles {
+		saved.Files, saved.FilePaths, err = c.DownloadFiles(savedDir)
+		if err != nil {
+			return fmt.Errorf("could not download files: %w", err)
+		}
+	}
+
+	saved.Users, err = c.GetUsers()
+	if err != nil {
+		return fmt.Errorf("could not get users: %w", err)
+	}
+
+	content, err := json.Marshal(saved)
+	if err != nil {
+		return fmt.Errorf("could not marshal saved items: %w", err)
+	}
+
+	if err = writePending(filepath.Join(cfg.Output, "saved.json"), content); err != nil {
+		return fmt.Errorf("could not write saved items to file: %w", err)
+	}
+
+	log.Printf("%d saved items are written to saved.json", len(saved.Items))
+
+	return nil
+}
+
 func downloadAvatars(c *SlackClient) error {
 	err := os.MkdirAll(filepath.Join(cfg.Output, "avatars"), 0o755)
 	if err != nil {
@@ -298,7 +1103,7 @@ func downloadAvatars(c *SlackClient) error {
 
 	for _, user := range c.UsersCache {
 		if user.Profile.Image512 != "" {
-			err := downloadFile(user.ID, user.Profile.Image512, cfg.Output)
+			err := downloadURL(user.Profile.Image512, filepath.Join(cfg.Output, "avatars", user.ID+".png"))
 			if err != nil {
 				return fmt.Errorf("could not download avatar: %w", err)
 			}
@@ -308,13 +1113,14 @@ func downloadAvatars(c *SlackClient) error {
 	return nil
 }
 
-func downloadFile(id, fileURL, output string) error {
+// downloadURL downloads the public file, like an avatar, to the path.
+func downloadURL(fileURL, path string) error {
 	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, fileURL, http.NoBody)
 	if err != nil {
 		return fmt.Errorf("could not create request: %w", err)
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := sharedClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("could not send request: %w", err)
 	}
@@ -325,20 +1131,17 @@ func downloadFile(id, fileURL, output string) error {
 		return fmt.Errorf("%w: %d", errBadStatus, resp.StatusCode)
 	}
 
-	filename := filepath.Join(output, "avatars", id+".png")
-	file, err := os.Create(filename)
+	file, err := createPending(path)
 	if err != nil {
-		return fmt.Errorf("could not create file: %w", err)
+		return err
 	}
+	defer file.Abort()
 
-	defer file.Close()
-
-	_, err = io.Copy(file, resp.Body)
-	if err != nil {
+	if _, err := io.Copy(file, resp.Body); err != nil {
 		return fmt.Errorf("could not write file: %w", err)
 	}
 
-	return nil
+	return file.Commit()
 }
 
 func openBrowser(someURL string) error {
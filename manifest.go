@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chuhlomin/slack-exporter/pkg/structs"
+)
+
+// toolName is the name of the exporter in manifests.
+const toolName = "slack-exporter"
+
+// channelManifestFilename returns the path of <channel>.manifest.json.
+func channelManifestFilename(channelID string) string {
+	return filepath.Join(cfg.Output, channelID+".manifest.json")
+}
+
+// writeChannelManifest completes the manifest of the exported channel with the version
+// of the exporter, the schema version and the filters, and writes it next to the channel.
+func writeChannelManifest(manifest structs.ChannelManifest) error {
+	manifest.Tool = toolName
+	manifest.Version = toolVersion()
+	manifest.SchemaVersion = structs.SchemaVersion
+	manifest.Exported = time.Now().UTC()
+	manifest.Format = cfg.Format
+	manifest.Filters = appliedFilters()
+
+	file, err := createPending(channelManifestFilename(manifest.Channel))
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(file)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(manifest); err != nil {
+		file.Abort()
+		return fmt.Errorf("could not encode channel manifest: %w", err)
+	}
+
+	return file.Commit()
+}
+
+// readChannelManifest reads <channel>.manifest.json of the channel export.
+func readChannelManifest(channelID string) (*structs.ChannelManifest, error) {
+	content, err := os.ReadFile(channelManifestFilename(channelID))
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest structs.ChannelManifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return nil, fmt.Errorf("could not decode channel manifest: %w", err)
+	}
+
+	return &manifest, nil
+}
+
+// toolVersion returns the module version of the exporter (like v1.2.3 when installed with go install)
+// or the commit it was built from.
+func toolVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+
+	version := info.Main.Version
+	if version != "" && version != "(devel)" {
+		return version
+	}
+
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" {
+			return s.Value
+		}
+	}
+
+	return first(version, "unknown")
+}
+
+// appliedFilters returns the flags limiting which messages and files are exported, by their names.
+func appliedFilters() map[string]string {
+	filters := map[string]string{}
+	set := func(name, value string) {
+		if value != "" {
+			filters[name] = value
+		}
+	}
+
+	if !cfg.Since.IsZero() {
+		set("since", cfg.Since.Format(dateFormat))
+	}
+	if !cfg.Until.IsZero() {
+		set("until", cfg.Until.Format(dateFormat))
+	}
+	set("user", strings.Join(cfg.User, ","))
+	set("grep", cfg.Grep)
+	if cfg.GrepRegex.Regexp != nil {
+		set("grep-regex", cfg.GrepRegex.String())
+	}
+	if cfg.Context > 0 {
+		set("context", strconv.Itoa(cfg.Context))
+	}
+	if cfg.ExcludeBots {
+		set("exclude-bots", "true")
+	}
+	if cfg.OnlyBots {
+		set("only-bots", "true")
+	}
+	set("has-reaction", strings.Join(cfg.HasReaction, ","))
+	if cfg.Sample.enabled() {
+		set("sample", cfg.Sample.String())
+		set("sample-seed", cfg.SampleSeed)
+	}
+	if cfg.MaxFileSize > 0 {
+		set("max-file-size", cfg.MaxFileSize.String())
+	}
+	set("include-file-types", strings.Join(cfg.IncludeFileTypes, ","))
+	set("exclude-file-types", strings.Join(cfg.ExcludeFileTypes, ","))
+
+	if len(filters) == 0 {
+		return nil
+	}
+	return filters
+}
+
+// grantedScopes are the scopes of the token, Slack reports them in X-OAuth-Scopes of API responses.
+type grantedScopes struct {
+	mu     sync.Mutex
+	scopes []string
+}
+
+// Transport returns the http.RoundTripper which records the scopes of responses
+// to requests made with the token.
+func (gs *grantedScopes) Transport(next http.RoundTripper, token func() string) http.RoundTripper {
+	return scopesTransport{scopes: gs, token: token, next: next}
+}
+
+func (gs *grantedScopes) get() []string {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	return gs.scopes
+}
+
+type scopesTransport struct {
+	scopes *grantedScopes
+	token  func() string
+	next   http.RoundTripper
+}
+
+func (t scopesTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// requests with other tokens, like the external users token, have other scopes
+	isToken := req.Header.Get("Authorization") == "Bearer "+t.token()
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || !isToken {
+		return resp, err
+	}
+
+	if header := resp.Header.Get("X-OAuth-Scopes"); header != "" {
+		var scopes []string
+		for _, s := range strings.Split(header, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				scopes = append(scopes, s)
+			}
+		}
+		sort.Strings(scopes)
+
+		t.scopes.mu.Lock()
+		t.scopes.scopes = scopes
+		t.scopes.mu.Unlock()
+	}
+
+	return resp, nil
+}
+
+// Scopes returns the scopes of the token reported by Slack, empty before the first request.
+func (sc *SlackClient) Scopes() []string {
+	return sc.scopes.get()
+}
+
+// teamIcons are the sizes of the workspace icon returned by team.info, the largest first.
+var teamIcons = []string{"image_original", "image_230", "image_132", "image_102", "image_88", "image_68", "image_44", "image_34"}
+
+// Origin returns the workspace and the identity of the token, recorded in manifests
+// of the exported channels. They are requested once; without team:read scope
+// the workspace has only what auth.test returns.
+func (sc *SlackClient) Origin() (*structs.Workspace, *structs.Exporter, error) {
+	auth, err := sc.AuthTest()
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not get auth info: %w", err)
+	}
+
+	exporter := &structs.Exporter{UserID: auth.UserID, User: auth.User, BotID: auth.BotID}
+
+	if sc.workspace != nil {
+		return sc.workspace, exporter, nil
+	}
+
+	workspace := &structs.Workspace{
+		ID:           first(sc.teamID, auth.TeamID),
+		Name:         auth.Team,
+		URL:          auth.URL,
+		EnterpriseID: auth.EnterpriseID,
+	}
+	if u, err := url.Parse(auth.URL); err == nil {
+		workspace.Domain = strings.TrimSuffix(u.Hostname(), ".slack.com")
+	}
+
+	info, err := sc.teamInfo(workspace.ID)
+	switch {
+	case err == nil:
+		workspace.Name = first(info.Name, workspace.Name)
+		workspace.Domain = first(info.Domain, workspace.Domain)
+		workspace.EmailDomain = info.EmailDomain
+		workspace.Icon = info.Icon
+	case isTokenRevoked(err):
+		return nil, nil, err
+	default:
+		log.Printf("Could not get workspace info, the manifest has the name and the URL only: %v", err)
+	}
+
+	sc.workspace = workspace
+	return workspace, exporter, nil
+}
+
+// teamInfo returns the name, the domain and the largest icon of the workspace
+// (or of the Enterprise Grid org) by ID.
+func (sc *SlackClient) teamInfo(id string) (*structs.Workspace, error) {
+	if err := sc.limiters.forMethod("team.info").Wait(sc.ctx); err != nil {
+		return nil, fmt.Errorf("rate limit error: %w", err)
+	}
+
+	info, err := sc.api.GetOtherTeamInfo(id)
+	if err != nil {
+		return nil, err
+	}
+
+	workspace := &structs.Workspace{
+		ID:          first(info.ID, id),
+		Name:        info.Name,
+		Domain:      info.Domain,
+		EmailDomain: info.EmailDomain,
+	}
+	for _, size := range teamIcons {
+		if icon, ok := info.Icon[size].(string); ok && icon != "" {
+			workspace.Icon = icon
+			break
+		}
+	}
+
+	return workspace, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"path/filepath"
+
+	"github.com/slack-go/slack"
+
+	"github.com/chuhlomin/slack-exporter/pkg/structs"
+)
+
+var (
+	errFilesOnlyNoContent = fmt.Errorf("--files-only can't be used with --no-content")
+	errSkipFiles          = fmt.Errorf("--skip-files can't be used with --download-files, --file-metadata, --calls, --lists and --files-only")
+)
+
+// filesIndexColumns are the columns of <channel>.files.csv.
+var filesIndexColumns = []string{"ts", "file_id", "uploader", "uploader_name", "filename", "path", "status"}
+
+// filesIndexFilename returns the path of <channel>.files.csv.
+func filesIndexFilename(channelID string) string {
+	return filepath.Join(cfg.Output, channelID+".files.csv")
+}
+
+// filesIndexWriter writes a row per file of messages and thread replies to <channel>.files.csv
+// with --files-only, the messages themselves are not written.
+type filesIndexWriter struct {
+	file  *pendingFile
+	csv   *csv.Writer
+	users userLookup
+}
+
+func newFilesIndexWriter(channel *slack.Channel, users userLookup) (*filesIndexWriter, error) {
+	file, err := createPending(filesIndexFilename(channel.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	fw := &filesIndexWriter{
+		file:  file,
+		csv:   csv.NewWriter(file),
+		users: users,
+	}
+
+	if err := fw.csv.Write(filesIndexColumns); err != nil {
+		fw.Abort()
+		return nil, fmt.Errorf("could not write header: %w", err)
+	}
+
+	return fw, nil
+}
+
+func (fw *filesIndexWriter) WriteMessage(msg structs.Message) error {
+	if err := fw.writeRows(msg.Message, msg.LocalFiles); err != nil {
+		return err
+	}
+
+	for _, reply := range msg.Replies {
+		if err := fw.writeRows(reply, msg.LocalFiles); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeRows writes the files of the message or reply, local are the files of its thread by ID.
+func (fw *filesIndexWriter) writeRows(msg slack.Message, local map[string]structs.LocalFile) error {
+	for _, file := range msg.Files {
+		uploader := first(file.User, msg.User)
+
+		name := ""
+		if uploader != "" {
+			u, err := fw.users(uploader)
+			switch {
+			case err == nil:
+				name = userDisplayName(u)
+			case !isUserNotFound(err):
+				return fmt.Errorf("could not get user %q: %w", uploader, err)
+			}
+		}
+
+		record := []string{
+			msg.Timestamp,
+			file.ID,
+			uploader,
+			csvCell(name),
+			csvCell(first(file.Name, file.Title)),
+			csvCell(local[file.ID].Path),
+			local[file.ID].Status,
+		}
+		if err := fw.csv.Write(record); err != nil {
+			return fmt.Errorf("could not write file: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (fw *filesIndexWriter) Close(_ structs.Data) error {
+	fw.csv.Flush()
+	if err := fw.csv.Error(); err != nil {
+		fw.Abort()
+		return fmt.Errorf("could not write csv: %w", err)
+	}
+
+	return fw.file.Commit()
+}
+
+func (fw *filesIndexWriter) Sync() error {
+	fw.csv.Flush()
+	if err := fw.csv.Error(); err != nil {
+		return fmt.Errorf("could not write csv: %w", err)
+	}
+
+	return fw.file.Sync()
+}
+
+func (fw *filesIndexWriter) Abort() {
+	fw.file.Abort()
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chuhlomin/slack-exporter/pkg/redact"
+)
+
+const (
+	eventRun     = "run"
+	eventChannel = "channel"
+
+	// webhookAttempts is the number of attempts to deliver the webhook
+	// before it's written to the dead letter file.
+	webhookAttempts = 5
+	// deadLetterFilename collects webhooks which could not be delivered, one per line.
+	deadLetterFilename = "webhooks.failed.ndjson"
+)
+
+// runSummary describes the outcome of an export run.
+type runSummary struct {
+	Started       time.Time `json:"started"`
+	Finished      time.Time `json:"finished"`
+	Channels      int       `json:"channels"`
+	Messages      int       `json:"messages"`
+	MessagesAdded int       `json:"messages_added"`
+	Failures      []string  `json:"failures,omitempty"`
+}
+
+var summary runSummary
+
+// Text returns a human-readable description of the summary.
+func (s runSummary) Text() string {
+	status := "Slack export finished"
+	if len(s.Failures) > 0 {
+		status = "Slack export failed"
+	}
+
+	text := fmt.Sprintf(
+		"%s in %s: %d channels, %d messages (%d new)",
+		status,
+		s.Finished.Sub(s.Started).Round(time.Second),
+		s.Channels,
+		s.Messages,
+		s.MessagesAdded,
+	)
+
+	for _, failure := range s.Failures {
+		text += "\n• " + failure
+	}
+
+	return text
+}
+
+// channelSummary describes the exported channel.
+type channelSummary struct {
+	ID            string    `json:"id"`
+	Name          string    `json:"name,omitempty"`
+	Archived      bool      `json:"archived,omitempty"`
+	Finished      time.Time `json:"finished"`
+	Messages      int       `json:"messages"`
+	MessagesAdded int       `json:"messages_added"`
+	// Files are paths of the exported files relative to the output directory.
+	Files []string `json:"files"`
+}
+
+// Text returns a human-readable description of the summary.
+func (s channelSummary) Text() string {
+	name := s.ID
+	if s.Name != "" {
+		name = "#" + s.Name
+	}
+
+	return fmt.Sprintf("Slack channel %s exported: %d messages (%d new)", name, s.Messages, s.MessagesAdded)
+}
+
+// notifyWebhooks posts the event to all the webhook URLs from the config.
+// Failures are logged, the run outcome doesn't depend on webhooks.
+func notifyWebhooks(event string, s interface{ Text() string }) {
+	for _, webhookURL := range cfg.WebhookURLs {
+		if err := notifyWebhook(webhookURL, event, s); err != nil {
+			log.Printf("Could not send webhook notification: %v", err)
+		}
+	}
+}
+
+// notifyWebhook posts the summary to the given URL.
+// Slack incoming webhooks receive a plain text message,
+// other endpoints receive the summary as JSON with the event name,
+// signed with HMAC-SHA256 of "<timestamp>.<body>" when the secret is set.
+// Delivery is retried with exponential backoff, webhooks which could not be delivered
+// are appended to the dead letter file in the output directory.
+func notifyWebhook(webhookURL, event string, s interface{ Text() string }) error {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return fmt.Errorf("could not parse webhook URL: %w", err)
+	}
+
+	var payload interface{}
+	if strings.HasSuffix(u.Host, "hooks.slack.com") {
+		payload = struct {
+			Text string `json:"text"`
+		}{
+			Text: s.Text(),
+		}
+	} else {
+		payload = struct {
+			Event   string      `json:"event"`
+			Summary interface{} `json:"summary"`
+			Text    string      `json:"text"`
+		}{
+			Event:   event,
+			Summary: s,
+			Text:    s.Text(),
+		}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("could not marshal payload: %w", err)
+	}
+
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		err = postWebhook(webhookURL, body)
+		if err == nil || attempt == webhookAttempts {
+			break
+		}
+
+		log.Printf("Webhook attempt %d failed, retrying in %s: %v", attempt, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	if err != nil {
+		if dlErr := writeDeadLetter(webhookURL, event, body, err); dlErr != nil {
+			log.Printf("Could not write dead letter: %v", dlErr)
+		}
+		return fmt.Errorf("could not deliver webhook after %d attempts: %w", webhookAttempts, err)
+	}
+
+	return nil
+}
+
+func postWebhook(webhookURL string, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("could not create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if cfg.WebhookSecret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-Signature-Timestamp", timestamp)
+		req.Header.Set("X-Signature", "sha256="+sign(cfg.WebhookSecret, timestamp, body))
+	}
+
+	resp, err := sharedClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not send request: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%w: %d", errBadStatus, resp.StatusCode)
+	}
+
+	return nil
+}
+
+// sign returns hex-encoded HMAC-SHA256 of "<timestamp>.<body>".
+func sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// redactURL keeps only the scheme and the host of the webhook URL,
+// its path and query often are the credential, like with Slack incoming webhooks.
+func redactURL(webhookURL string) string {
+	u, err := url.Parse(webhookURL)
+	if err != nil || u.Host == "" {
+		return redact.Mask
+	}
+
+	return u.Scheme + "://" + u.Host + "/" + redact.Mask
+}
+
+// writeDeadLetter appends the undelivered webhook to the dead letter file with the redacted URL,
+// so it can be inspected or re-sent later.
+func writeDeadLetter(webhookURL, event string, body []byte, deliveryErr error) error {
+	line, err := json.Marshal(struct {
+		Time    time.Time       `json:"time"`
+		URL     string          `json:"url"`
+		Event   string          `json:"event"`
+		Error   string          `json:"error"`
+		Payload json.RawMessage `json:"payload"`
+	}{
+		Time:    time.Now(),
+		URL:     redactURL(webhookURL),
+		Event:   event,
+		Error:   redact.String(deliveryErr.Error()),
+		Payload: body,
+	})
+	if err != nil {
+		return fmt.Errorf("could not marshal dead letter: %w", err)
+	}
+
+	file, err := os.OpenFile(
+		filepath.Join(cfg.Output, deadLetterFilename),
+		os.O_CREATE|os.O_WRONLY|os.O_APPEND,
+		0o600,
+	)
+	if err != nil {
+		return fmt.Errorf("could not open dead letter file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("could not write dead letter: %w", err)
+	}
+
+	return nil
+}
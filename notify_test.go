@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteDeadLetterRedactsURL(t *testing.T) {
+	webhookURL := "https://hooks.slack.com/services/T0123/B0123/webhook-secret-path"
+	setConfig(t, config{Output: t.TempDir()})
+	cfg.WebhookURLs = []string{webhookURL}
+	redactCredentials()
+
+	deliveryErr := fmt.Errorf("could not send request: Post %q: connection refused", webhookURL)
+	if err := writeDeadLetter(webhookURL, eventRun, []byte(`{"text":"done"}`), deliveryErr); err != nil {
+		t.Fatalf("writeDeadLetter: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(cfg.Output, deadLetterFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(content), "webhook-secret-path") {
+		t.Errorf("dead letter has the webhook URL: %s", content)
+	}
+	if !strings.Contains(string(content), `"url":"https://hooks.slack.com/[REDACTED]"`) {
+		t.Errorf("dead letter has no redacted URL: %s", content)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+var errOrgToken = fmt.Errorf("--org requires --api-token of the org admin")
+
+// orgTeam is the workspace of the Enterprise Grid org returned by admin.teams.list.
+type orgTeam struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Domain string `json:"domain"`
+}
+
+// orgChannel is the channel returned by admin.conversations.search.
+type orgChannel struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	IsArchived bool   `json:"is_archived"`
+}
+
+// GetOrgTeams returns all workspaces of the Enterprise Grid org (requires admin.teams:read scope).
+func (sc *SlackClient) GetOrgTeams() ([]orgTeam, error) {
+	var teams []orgTeam
+	cursor := ""
+	for {
+		var resp struct {
+			Teams            []orgTeam `json:"teams"`
+			ResponseMetadata struct {
+				NextCursor string `json:"next_cursor"`
+			} `json:"response_metadata"`
+		}
+
+		err := sc.callAPI("admin.teams.list", url.Values{
+			"limit":  {strconv.Itoa(pageLimit("admin.teams.list", cfg.PageSize))},
+			"cursor": {cursor},
+		}, &resp)
+		if err != nil {
+			return nil, fmt.Errorf("could not list workspaces: %w", err)
+		}
+
+		teams = append(teams, resp.Teams...)
+
+		if resp.ResponseMetadata.NextCursor == "" {
+			return teams, nil
+		}
+		cursor = resp.ResponseMetadata.NextCursor
+	}
+}
+
+// GetOrgChannels returns public and private channels of the workspace of the org
+// (requires admin.conversations:read scope).
+func (sc *SlackClient) GetOrgChannels(teamID string) ([]orgChannel, error) {
+	values := url.Values{
+		"team_ids": {teamID},
+		"limit":    {strconv.Itoa(pageLimit("admin.conversations.search", cfg.PageSize))},
+	}
+	if !cfg.IncludeArchived {
+		values.Set("search_channel_types", "exclude_archived")
+	}
+
+	var channels []orgChannel
+	for {
+		var resp struct {
+			Conversations []orgChannel `json:"conversations"`
+			NextCursor    string       `json:"next_cursor"`
+		}
+
+		if err := sc.callAPI("admin.conversations.search", values, &resp); err != nil {
+			return nil, fmt.Errorf("could not search channels of %s: %w", teamID, err)
+		}
+
+		channels = append(channels, resp.Conversations...)
+
+		if resp.NextCursor == "" {
+			return channels, nil
+		}
+		values.Set("cursor", resp.NextCursor)
+	}
+}
+
+// exportOrg exports channels of every workspace of the Enterprise Grid org to <output>/<domain>,
+// channels shared by several workspaces are exported once, with the first of them.
+func exportOrg() error {
+	if cfg.APIToken == "" {
+		return errOrgToken
+	}
+
+	c := NewSlackClient(cfg.AppClientID, cfg.AppClientSecret)
+	c.SetToken(cfg.APIToken)
+
+	teams, err := c.GetOrgTeams()
+	if err != nil {
+		return err
+	}
+
+	seen := map[string]bool{}
+	var workspaces []workspaceConfig
+
+	for _, team := range teams {
+		channels, err := c.GetOrgChannels(team.ID)
+		if err != nil {
+			return err
+		}
+
+		var ids []string
+		for _, channel := range channels {
+			if seen[channel.ID] {
+				continue
+			}
+			seen[channel.ID] = true
+			ids = append(ids, channel.ID)
+		}
+
+		name := team.Domain
+		if name == "" {
+			name = team.ID
+		}
+
+		log.Printf("Workspace %s has %d channels to export", name, len(ids))
+
+		// without channels the export would ask to choose them
+		if len(ids) == 0 {
+			continue
+		}
+
+		workspaces = append(workspaces, workspaceConfig{
+			Name:     name,
+			APIToken: cfg.APIToken,
+			TeamID:   team.ID,
+			Channels: strings.Join(ids, ","),
+			teamName: team.Name,
+		})
+	}
+
+	return exportWorkspaceList(workspaces)
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+
+	"github.com/chuhlomin/slack-exporter/pkg/parquet"
+	"github.com/chuhlomin/slack-exporter/pkg/structs"
+)
+
+// messagesColumns are the columns of <channel>.parquet, one row per message or thread reply.
+var messagesColumns = []parquet.Column{
+	{Name: "channel_id", Type: parquet.String},
+	{Name: "ts", Type: parquet.String},
+	{Name: "time", Type: parquet.Timestamp},
+	{Name: "thread_ts", Type: parquet.String, Optional: true},
+	{Name: "user", Type: parquet.String, Optional: true},
+	{Name: "bot_id", Type: parquet.String, Optional: true},
+	{Name: "subtype", Type: parquet.String, Optional: true},
+	{Name: "text", Type: parquet.String},
+	{Name: "reply_count", Type: parquet.Int64},
+	{Name: "reactions", Type: parquet.String},
+	{Name: "files", Type: parquet.String, Repeated: true},
+}
+
+// parquetColumns returns the columns of <channel>.parquet,
+// with --human-time the ISO 8601 time in --timezone is added as "time_iso" after the typed "time".
+func parquetColumns() []parquet.Column {
+	if !cfg.HumanTime {
+		return messagesColumns
+	}
+
+	columns := append([]parquet.Column{}, messagesColumns[:3]...)
+	columns = append(columns, parquet.Column{Name: "time_iso", Type: parquet.String})
+	return append(columns, messagesColumns[3:]...)
+}
+
+// usersColumns are the columns of users.parquet.
+var usersColumns = []parquet.Column{
+	{Name: "id", Type: parquet.String},
+	{Name: "team_id", Type: parquet.String, Optional: true},
+	{Name: "name", Type: parquet.String},
+	{Name: "real_name", Type: parquet.String},
+	{Name: "display_name", Type: parquet.String},
+	{Name: "email", Type: parquet.String, Optional: true},
+	{Name: "title", Type: parquet.String, Optional: true},
+	{Name: "tz", Type: parquet.String, Optional: true},
+	{Name: "is_bot", Type: parquet.Bool},
+	{Name: "is_admin", Type: parquet.Bool},
+	{Name: "deleted", Type: parquet.Bool},
+}
+
+// parquetWriter writes messages and thread replies as rows of <channel>.parquet
+// and the rest of the data to <channel>.meta.json.
+type parquetWriter struct {
+	messages *pendingFile
+	meta     *pendingFile
+	parquet  *parquet.Writer
+	head     channelHead
+}
+
+func newParquetWriter(channel *slack.Channel, members []string, period string) (*parquetWriter, error) {
+	messagesFilename, metaFilename := channelFilenames(channel.ID, period)
+
+	messages, err := createPending(messagesFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	meta, err := createPending(metaFilename)
+	if err != nil {
+		messages.Abort()
+		return nil, err
+	}
+
+	pw, err := parquet.NewWriter(messages, parquetColumns())
+	if err != nil {
+		messages.Abort()
+		meta.Abort()
+		return nil, fmt.Errorf("could not create parquet writer: %w", err)
+	}
+
+	return &parquetWriter{
+		messages: messages,
+		meta:     meta,
+		parquet:  pw,
+		head:     newChannelHead(channel, members),
+	}, nil
+}
+
+func (pw *parquetWriter) WriteMessage(msg structs.Message) error {
+	if err := pw.writeRow(msg.Message); err != nil {
+		return err
+	}
+
+	for _, reply := range msg.Replies {
+		if err := pw.writeRow(reply); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (pw *parquetWriter) writeRow(msg slack.Message) error {
+	values := []interface{}{
+		pw.head.Channel.ID,
+		msg.Timestamp,
+		parseTimestamp(msg.Timestamp),
+		optional(msg.ThreadTimestamp),
+		optional(msg.User),
+		optional(msg.BotID),
+		optional(msg.SubType),
+		msg.Text,
+		msg.ReplyCount,
+		reactionsSummary(msg),
+		fileNameList(msg),
+	}
+	if cfg.HumanTime {
+		values = append(values[:3], append([]interface{}{humanTime(msg.Timestamp)}, values[3:]...)...)
+	}
+
+	if err := pw.parquet.Write(values...); err != nil {
+		return fmt.Errorf("could not write message: %w", err)
+	}
+
+	return nil
+}
+
+func (pw *parquetWriter) Close(data structs.Data) error {
+	if err := pw.parquet.Close(); err != nil {
+		pw.Abort()
+		return fmt.Errorf("could not write parquet: %w", err)
+	}
+
+	if err := writeMeta(pw.meta, pw.head, data); err != nil {
+		pw.Abort()
+		return err
+	}
+
+	if err := pw.messages.Commit(); err != nil {
+		pw.meta.Abort()
+		return err
+	}
+
+	return pw.meta.Commit()
+}
+
+// Sync writes the buffered rows as a row group.
+func (pw *parquetWriter) Sync() error {
+	if err := pw.parquet.Flush(); err != nil {
+		return fmt.Errorf("could not write parquet: %w", err)
+	}
+
+	return pw.messages.Sync()
+}
+
+func (pw *parquetWriter) Abort() {
+	pw.messages.Abort()
+	pw.meta.Abort()
+}
+
+// writeUsersParquet writes all the users seen during the export to users.parquet.
+func writeUsersParquet(users map[string]*slack.User) error {
+	file, err := createPending(filepath.Join(cfg.Output, "users.parquet"))
+	if err != nil {
+		return err
+	}
+	defer file.Abort()
+
+	pw, err := parquet.NewWriter(file, usersColumns)
+	if err != nil {
+		return fmt.Errorf("could not create parquet writer: %w", err)
+	}
+
+	ids := make([]string, 0, len(users))
+	for id := range users {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		u := users[id]
+		err := pw.Write(
+			u.ID,
+			optional(u.TeamID),
+			u.Name,
+			u.RealName,
+			u.Profile.DisplayName,
+			optional(u.Profile.Email),
+			optional(u.Profile.Title),
+			optional(u.TZ),
+			u.IsBot,
+			u.IsAdmin,
+			u.Deleted,
+		)
+		if err != nil {
+			return fmt.Errorf("could not write user: %w", err)
+		}
+	}
+
+	if err := pw.Close(); err != nil {
+		return fmt.Errorf("could not write parquet: %w", err)
+	}
+
+	return file.Commit()
+}
+
+// optional returns nil for empty strings, written as nulls.
+func optional(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// parseTimestamp converts Slack message timestamp like "1700000000.123456" to time.
+func parseTimestamp(ts string) time.Time {
+	sec, frac, _ := strings.Cut(ts, ".")
+
+	s, err := strconv.ParseInt(sec, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+
+	var nsec int64
+	if frac != "" {
+		frac = (frac + "000000000")[:9]
+		nsec, _ = strconv.ParseInt(frac, 10, 64)
+	}
+
+	return time.Unix(s, nsec)
+}
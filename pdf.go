@@ -0,0 +1,321 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/slack-go/slack"
+
+	"github.com/chuhlomin/slack-exporter/pkg/pdf"
+	"github.com/chuhlomin/slack-exporter/pkg/render"
+	"github.com/chuhlomin/slack-exporter/pkg/structs"
+)
+
+// layout of the PDF pages, in points
+const (
+	pdfMargin      = 50
+	pdfFontSize    = 10
+	pdfLineHeight  = 13
+	pdfReplyIndent = 24
+	pdfImageHeight = 320
+)
+
+const pdfTimeFormat = "2006-01-02 15:04:05 MST"
+
+// pdfWriter renders the channel as a paginated conversation to <channel>.pdf,
+// for records of specific conversations, and writes the rest of the data to <channel>.meta.json.
+// Messages are kept until Close, when the downloaded images are known and can be shown inline.
+type pdfWriter struct {
+	messages []structs.Message
+	head     channelHead
+	users    userLookup
+	period   string
+}
+
+func newPDFWriter(channel *slack.Channel, members []string, users userLookup, period string) *pdfWriter {
+	return &pdfWriter{
+		head:   newChannelHead(channel, members),
+		users:  users,
+		period: period,
+	}
+}
+
+func (pw *pdfWriter) WriteMessage(msg structs.Message) error {
+	pw.messages = append(pw.messages, msg)
+	return nil
+}
+
+func (pw *pdfWriter) Close(data structs.Data) error {
+	messagesFilename, metaFilename := channelFilenames(pw.head.Channel.ID, pw.period)
+
+	messages, err := createPending(messagesFilename)
+	if err != nil {
+		return err
+	}
+
+	meta, err := createPending(metaFilename)
+	if err != nil {
+		messages.Abort()
+		return err
+	}
+
+	data.Channel = *pw.head.Channel
+	if err := pw.render(data).Write(messages); err != nil {
+		messages.Abort()
+		meta.Abort()
+		return fmt.Errorf("could not write pdf: %w", err)
+	}
+
+	if err := writeMeta(meta, pw.head, data); err != nil {
+		messages.Abort()
+		meta.Abort()
+		return err
+	}
+
+	if err := messages.Commit(); err != nil {
+		meta.Abort()
+		return err
+	}
+
+	return meta.Commit()
+}
+
+func (pw *pdfWriter) Abort() {
+	pw.messages = nil
+}
+
+// pdfPage tracks the position on the current page of the document.
+type pdfPage struct {
+	doc   *pdf.Document
+	title string
+	y     float64
+}
+
+// render lays out the messages in chronological order, thread replies follow their parent indented.
+func (pw *pdfWriter) render(data structs.Data) *pdf.Document {
+	sort.SliceStable(pw.messages, func(i, j int) bool {
+		return parseTimestamp(pw.messages[i].Timestamp).Before(parseTimestamp(pw.messages[j].Timestamp))
+	})
+
+	p := &pdfPage{
+		doc:   pdf.New(pdf.A4Width, pdf.A4Height),
+		title: pdfTitle(&data),
+	}
+	p.newPage()
+
+	if len(pw.messages) == 0 {
+		p.text(0, pdf.Helvetica, pdfFontSize, 0.4, "No messages")
+	}
+
+	// channel copies of replies of exported threads are only referenced, the reply is rendered in its thread
+	threads := map[string]bool{}
+	for _, msg := range pw.messages {
+		if len(msg.Replies) > 0 {
+			threads[msg.Timestamp] = true
+		}
+	}
+
+	for _, msg := range pw.messages {
+		if structs.IsBroadcast(msg.Message) && threads[msg.ThreadTimestamp] {
+			p.ensure(pdfLineHeight + 6)
+			p.y -= 6
+			p.text(0, pdf.Helvetica, pdfFontSize-1, 0.4, fmt.Sprintf(
+				"%s replied to the thread of %s",
+				pw.author(msg.Message),
+				localTime(msg.ThreadTimestamp).Format(pdfTimeFormat),
+			))
+			continue
+		}
+
+		pw.renderMessage(p, msg.Message, 0, &data)
+		for _, reply := range msg.Replies {
+			pw.renderMessage(p, reply, pdfReplyIndent, &data)
+		}
+	}
+
+	return p.doc
+}
+
+// pdfTitle returns the page header: the channel name and the exported date range.
+func pdfTitle(data *structs.Data) string {
+	title := channelTitle(data)
+
+	switch {
+	case !cfg.Since.IsZero() && !cfg.Until.IsZero():
+		title += fmt.Sprintf(", %s – %s", cfg.Since.Format(dateFormat), cfg.Until.Format(dateFormat))
+	case !cfg.Since.IsZero():
+		title += ", since " + cfg.Since.Format(dateFormat)
+	case !cfg.Until.IsZero():
+		title += ", until " + cfg.Until.Format(dateFormat)
+	}
+
+	return title
+}
+
+func (pw *pdfWriter) renderMessage(p *pdfPage, msg slack.Message, indent float64, data *structs.Data) {
+	width := pdf.A4Width - 2*pdfMargin - indent
+
+	// keep the author with at least a line of the text
+	p.ensure(2*pdfLineHeight + 6)
+	p.y -= 6
+
+	author := pw.author(msg)
+	p.text(indent, pdf.HelveticaBold, pdfFontSize, 0, author)
+	p.y += pdfLineHeight // timestamp goes on the same line
+	p.text(
+		indent+pdf.TextWidth(pdf.HelveticaBold, pdfFontSize, author)+8,
+		pdf.Helvetica, pdfFontSize-1, 0.4,
+		localTime(msg.Timestamp).Format(pdfTimeFormat),
+	)
+
+	for _, line := range wrapText(plainText(render.Text(msg), pw.users), pdf.Helvetica, pdfFontSize, width) {
+		p.text(indent, pdf.Helvetica, pdfFontSize, 0, line)
+	}
+
+	for _, f := range msg.Files {
+		if !pw.renderImage(p, f, indent, width, data) {
+			p.text(indent, pdf.Helvetica, pdfFontSize-1, 0.4, "Attachment: "+f.Name)
+		}
+	}
+
+	if reactions := reactionsSummary(msg); reactions != "" {
+		p.text(indent, pdf.Helvetica, pdfFontSize-1, 0.4, reactions)
+	}
+
+	if structs.IsBroadcast(msg) {
+		p.text(indent, pdf.Helvetica, pdfFontSize-1, 0.4, "Also sent to the channel")
+	}
+}
+
+// renderImage draws the downloaded image file scaled to the width of the text,
+// it reports false when the file is not an image or was not downloaded.
+func (pw *pdfWriter) renderImage(p *pdfPage, f slack.File, indent, width float64, data *structs.Data) bool {
+	switch f.Mimetype {
+	case "image/jpeg", "image/png", "image/gif":
+	default:
+		return false
+	}
+
+	path := localFilePath(data, f.ID)
+	if path == "" {
+		return false
+	}
+
+	file, err := os.Open(filepath.Join(cfg.Output, path))
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	img, err := p.doc.AddImage(file)
+	if err != nil {
+		log.Printf("Could not render file %q to pdf: %v", f.ID, err)
+		return false
+	}
+
+	w, h := float64(img.Width), float64(img.Height)
+	if w > width {
+		w, h = width, h*width/w
+	}
+	if h > pdfImageHeight {
+		w, h = w*pdfImageHeight/h, pdfImageHeight
+	}
+
+	p.ensure(h + 4)
+	p.y -= h + 4
+	p.doc.DrawImage(img, pdfMargin+indent, p.y, w, h)
+
+	return true
+}
+
+func (pw *pdfWriter) author(msg slack.Message) string {
+	if msg.User == "" {
+		if msg.Username != "" {
+			return msg.Username
+		}
+		return msg.BotID
+	}
+
+	u, err := pw.users(msg.User)
+	if err != nil || u == nil {
+		return msg.User
+	}
+
+	return userDisplayName(u)
+}
+
+// newPage starts the page with the header and the page number in the footer.
+func (p *pdfPage) newPage() {
+	p.doc.AddPage()
+
+	top := float64(pdf.A4Height - pdfMargin + 20)
+	p.doc.Text(pdfMargin, top, pdf.HelveticaBold, 9, 0.3, p.title)
+	p.doc.Line(pdfMargin, pdf.A4Width-pdfMargin, top-6, 0.7)
+
+	number := fmt.Sprintf("Page %d", p.doc.Pages())
+	p.doc.Text(
+		(pdf.A4Width-pdf.TextWidth(pdf.Helvetica, 8, number))/2, pdfMargin-25,
+		pdf.Helvetica, 8, 0.4, number,
+	)
+
+	p.y = pdf.A4Height - pdfMargin
+}
+
+// ensure starts a new page when there is less than height left on the current one.
+func (p *pdfPage) ensure(height float64) {
+	if p.y-height < pdfMargin {
+		p.newPage()
+	}
+}
+
+// text draws the line below the previous one.
+func (p *pdfPage) text(indent float64, font pdf.Font, size, gray float64, text string) {
+	p.ensure(pdfLineHeight)
+	p.y -= pdfLineHeight
+	p.doc.Text(pdfMargin+indent, p.y, font, size, gray, text)
+}
+
+// wrapText splits the text into lines fitting the width, words longer than the line are broken.
+func wrapText(text string, font pdf.Font, size, width float64) []string {
+	var lines []string
+
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+
+			if pdf.TextWidth(font, size, candidate) <= width {
+				line = candidate
+				continue
+			}
+
+			if line != "" {
+				lines = append(lines, line)
+			}
+
+			line = ""
+			for _, r := range word {
+				if pdf.TextWidth(font, size, line+string(r)) > width && line != "" {
+					lines = append(lines, line)
+					line = ""
+				}
+				line += string(r)
+			}
+		}
+		lines = append(lines, line)
+	}
+
+	// drop trailing empty lines
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
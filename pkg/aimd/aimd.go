@@ -0,0 +1,207 @@
+// Package aimd implements a rate limiter which adjusts request pacing and concurrency
+// to the observed latency and rate limit responses, using additive increase
+// and multiplicative decrease (like TCP congestion control).
+package aimd
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// decrease is applied to the rate and concurrency on rate limit responses.
+	decrease = 0.5
+	// slowdown is applied to the rate when the latency grows.
+	slowdown = 0.9
+	// slowLatency is how many times the latency has to exceed the baseline to slow down.
+	slowLatency = 2
+	// maxConcurrency is the upper bound of requests in flight.
+	maxConcurrency = 8
+)
+
+// Limiter paces requests between min and max rate.
+// It starts at the initial rate and goes up by a small step after every successful request,
+// halves the rate (and the concurrency) after every 429 response
+// and slows down a little when requests become much slower than usual.
+type Limiter struct {
+	mu sync.Mutex
+
+	limiter *rate.Limiter
+	min     rate.Limit
+	max     rate.Limit
+	step    rate.Limit
+
+	// baseline is the moving average of the latency of successful requests.
+	baseline time.Duration
+
+	window   float64 // allowed concurrency
+	inFlight int
+	released chan struct{}
+}
+
+// New creates a Limiter; the rate is fixed if max is not greater than initial.
+func New(initial, lo, hi rate.Limit) *Limiter {
+	if hi < initial {
+		hi = initial
+	}
+	if lo > initial || lo <= 0 {
+		lo = initial / 10
+	}
+
+	return &Limiter{
+		limiter:  rate.NewLimiter(initial, 1),
+		min:      lo,
+		max:      hi,
+		step:     initial / 50,
+		window:   1,
+		released: make(chan struct{}, 1),
+	}
+}
+
+// Wait blocks until the next request is allowed by the current rate.
+func (l *Limiter) Wait(ctx context.Context) error {
+	return l.limiter.Wait(ctx)
+}
+
+// Limit returns the current rate.
+func (l *Limiter) Limit() rate.Limit {
+	return l.limiter.Limit()
+}
+
+// Concurrency returns the current number of requests allowed in flight.
+func (l *Limiter) Concurrency() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return int(l.window)
+}
+
+// Acquire blocks until a request may be sent within the current concurrency.
+func (l *Limiter) Acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		if l.inFlight < int(l.window) {
+			l.inFlight++
+			l.mu.Unlock()
+			return nil
+		}
+		l.mu.Unlock()
+
+		select {
+		case <-l.released:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Release marks the request acquired with Acquire as finished.
+func (l *Limiter) Release() {
+	l.mu.Lock()
+	l.inFlight--
+	l.mu.Unlock()
+
+	select {
+	case l.released <- struct{}{}:
+	default:
+	}
+}
+
+// Observe adjusts the rate and concurrency to the result of the request.
+func (l *Limiter) Observe(latency time.Duration, throttled bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limit := l.limiter.Limit()
+
+	switch {
+	case throttled:
+		limit *= decrease
+		l.window *= decrease
+	case l.baseline > 0 && latency > slowLatency*l.baseline:
+		limit *= slowdown
+	default:
+		limit += l.step
+		l.window += 1 / l.window
+	}
+
+	if !throttled {
+		if l.baseline == 0 {
+			l.baseline = latency
+		} else {
+			l.baseline = (l.baseline*9 + latency) / 10
+		}
+	}
+
+	l.limiter.SetLimit(clamp(limit, l.min, l.max))
+	l.window = min(max(l.window, 1), maxConcurrency)
+}
+
+func clamp(v, lo, hi rate.Limit) rate.Limit {
+	return min(max(v, lo), hi)
+}
+
+// Transport returns the http.RoundTripper which limits concurrency of the requests,
+// reports their latency and status to the Limiter
+// and retries requests rejected with 429 after the Retry-After delay.
+func (l *Limiter) Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	return &transport{limiter: l, next: next}
+}
+
+type transport struct {
+	limiter *Limiter
+	next    http.RoundTripper
+}
+
+// maxRetries limits retries of a request rejected with 429.
+const maxRetries = 5
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if err := t.limiter.Acquire(req.Context()); err != nil {
+			return nil, err
+		}
+
+		started := time.Now()
+		resp, err := t.next.RoundTrip(req)
+		t.limiter.Release()
+
+		if err != nil {
+			return nil, err
+		}
+
+		throttled := resp.StatusCode == http.StatusTooManyRequests
+		t.limiter.Observe(time.Since(started), throttled)
+
+		if !throttled || attempt >= maxRetries || (req.Body != nil && req.GetBody == nil) {
+			return resp, nil
+		}
+
+		retryAfter, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		resp.Body.Close()
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		select {
+		case <-time.After(time.Duration(max(retryAfter, 1)) * time.Second):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+}
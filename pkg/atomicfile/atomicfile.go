@@ -0,0 +1,145 @@
+// Package atomicfile writes files next to their destination with the .slack-exporter.tmp suffix
+// and moves them in place when they are complete and synced to disk, so an interrupted run
+// (or a crash) never leaves a truncated file under the final name; a file with the suffix
+// marks the unfinished one.
+package atomicfile
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Suffix is added to the name of the file while it's written, it's specific to the exporter,
+// so files of users with the .tmp extension are not taken for unfinished ones.
+const Suffix = ".slack-exporter.tmp"
+
+// File is the file written to path+Suffix and moved to path on Commit.
+type File struct {
+	path string
+	file *os.File
+	*bufio.Writer
+}
+
+// Create creates (or truncates) the unfinished file of the path.
+func Create(path string) (*File, error) {
+	file, err := os.OpenFile(path+Suffix, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("could not create file: %w", err)
+	}
+
+	return &File{
+		path:   path,
+		file:   file,
+		Writer: bufio.NewWriter(file),
+	}, nil
+}
+
+// Path returns the destination of the file.
+func (f *File) Path() string {
+	return f.path
+}
+
+// Commit flushes the file, syncs it to disk and moves it in place,
+// then syncs the directory, so the rename survives a crash too.
+func (f *File) Commit() error {
+	if err := f.Sync(); err != nil {
+		f.Abort()
+		return err
+	}
+
+	if err := f.file.Close(); err != nil {
+		os.Remove(f.file.Name())
+		return fmt.Errorf("could not close file: %w", err)
+	}
+
+	if err := os.Rename(f.file.Name(), f.path); err != nil {
+		return fmt.Errorf("could not rename file: %w", err)
+	}
+
+	return syncDir(filepath.Dir(f.path))
+}
+
+// syncDir commits the entries of the directory, like the renamed file, to disk.
+// Windows can't sync directories, renames are durable there once they return.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("could not open directory: %w", err)
+	}
+	defer d.Close()
+
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("could not sync directory: %w", err)
+	}
+
+	return nil
+}
+
+// Sync flushes the buffer and commits the written content to disk.
+func (f *File) Sync() error {
+	if err := f.Flush(); err != nil {
+		return fmt.Errorf("could not write file: %w", err)
+	}
+
+	if err := f.file.Sync(); err != nil {
+		return fmt.Errorf("could not sync file: %w", err)
+	}
+
+	return nil
+}
+
+// Abort removes the file; it's a no-op after Commit.
+func (f *File) Abort() {
+	if err := f.file.Close(); err != nil {
+		return
+	}
+	os.Remove(f.file.Name())
+}
+
+// WriteFile writes the content to the file like os.WriteFile, replacing it only when all is written.
+func WriteFile(path string, content []byte) error {
+	f, err := Create(path)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(content); err != nil {
+		f.Abort()
+		return fmt.Errorf("could not write file: %w", err)
+	}
+
+	return f.Commit()
+}
+
+// RemoveUnfinished removes unfinished files left in the directory (and its subdirectories)
+// by an interrupted run and returns how many were removed.
+func RemoveUnfinished(dir string) (int, error) {
+	removed := 0
+
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || !strings.HasSuffix(d.Name(), Suffix) {
+			return nil
+		}
+
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("could not remove %s: %w", path, err)
+		}
+		removed++
+
+		return nil
+	})
+
+	return removed, err
+}
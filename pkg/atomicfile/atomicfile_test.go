@@ -0,0 +1,53 @@
+package atomicfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRemoveUnfinished(t *testing.T) {
+	dir := t.TempDir()
+
+	// a downloaded file with the .tmp extension is not an unfinished one
+	kept := filepath.Join(dir, "files", "F0123-notes.tmp")
+	if err := os.MkdirAll(filepath.Dir(kept), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(kept, []byte("notes"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteFile(filepath.Join(dir, "C0123.json"), []byte("{}")); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	unfinished, err := Create(filepath.Join(dir, "files", "F0456-report.pdf"))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := unfinished.WriteString("partial"); err != nil {
+		t.Fatal(err)
+	}
+	if err := unfinished.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := RemoveUnfinished(dir)
+	if err != nil {
+		t.Fatalf("RemoveUnfinished: %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("removed %d files, want 1", removed)
+	}
+
+	for _, path := range []string{kept, filepath.Join(dir, "C0123.json")} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s is removed: %v", path, err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "files", "F0456-report.pdf"+Suffix)); !os.IsNotExist(err) {
+		t.Errorf("unfinished file is kept: %v", err)
+	}
+}
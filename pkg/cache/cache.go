@@ -0,0 +1,122 @@
+// Package cache implements a simple on-disk key-value cache with TTL,
+// used to avoid re-fetching unchanged data (users, channels, emoji) across runs.
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/chuhlomin/slack-exporter/pkg/atomicfile"
+)
+
+type entry[T any] struct {
+	Value   T         `json:"value"`
+	Updated time.Time `json:"updated"`
+}
+
+// Cache is a set of values of the same type persisted in a single JSON file.
+// A nil Cache is valid and caches nothing.
+type Cache[T any] struct {
+	mu      sync.Mutex
+	path    string
+	ttl     time.Duration
+	entries map[string]entry[T]
+	dirty   bool
+}
+
+// Open loads the cache from the file, missing file results in an empty cache.
+// Entries older than ttl are ignored.
+func Open[T any](path string, ttl time.Duration) (*Cache[T], error) {
+	c := &Cache[T]{
+		path:    path,
+		ttl:     ttl,
+		entries: map[string]entry[T]{},
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return c, nil
+		}
+		return nil, fmt.Errorf("could not read cache: %w", err)
+	}
+
+	if err := json.Unmarshal(content, &c.entries); err != nil {
+		return nil, fmt.Errorf("could not unmarshal cache %q: %w", path, err)
+	}
+
+	return c, nil
+}
+
+// Get returns the value if it is present and not expired.
+func (c *Cache[T]) Get(key string) (T, bool) {
+	if c == nil {
+		var zero T
+		return zero, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok || time.Since(e.Updated) > c.ttl {
+		var zero T
+		return zero, false
+	}
+
+	return e.Value, true
+}
+
+// Set stores the value.
+func (c *Cache[T]) Set(key string, value T) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key] = entry[T]{Value: value, Updated: time.Now()}
+	c.dirty = true
+}
+
+// Save writes the cache to the file, expired entries are dropped.
+func (c *Cache[T]) Save() error {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.dirty {
+		return nil
+	}
+
+	for key, e := range c.entries {
+		if time.Since(e.Updated) > c.ttl {
+			delete(c.entries, key)
+		}
+	}
+
+	content, err := json.Marshal(c.entries)
+	if err != nil {
+		return fmt.Errorf("could not marshal cache: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return fmt.Errorf("could not create cache directory: %w", err)
+	}
+
+	if err := atomicfile.WriteFile(c.path, content); err != nil {
+		return fmt.Errorf("could not write cache: %w", err)
+	}
+
+	c.dirty = false
+	return nil
+}
@@ -0,0 +1,537 @@
+// Package exporter exports messages of Slack channels with their thread replies,
+// so other Go programs can embed the export and write messages wherever they need
+// by implementing Sink. The slack-exporter app reads channel history with it too.
+package exporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/time/rate"
+
+	"github.com/chuhlomin/slack-exporter/pkg/aimd"
+	"github.com/chuhlomin/slack-exporter/pkg/structs"
+)
+
+const (
+	defaultPageSize          = 999
+	defaultThreadConcurrency = 4
+	// minPageSize is the smallest history page the page is halved to when Slack fails to return it.
+	minPageSize = 50
+	// threadRefetches is how many times the thread missing replies is fetched again.
+	threadRefetches = 2
+)
+
+var (
+	// ErrNoChannels is returned by Export without channels in Options.
+	ErrNoChannels = errors.New("no channels to export")
+	// ErrIncompleteThread is passed to Options.ThreadError for threads with fewer replies than their reply_count.
+	ErrIncompleteThread = errors.New("thread has fewer replies than its reply_count")
+)
+
+// API is the subset of slack.Client methods used by Exporter.
+type API interface {
+	GetConversationInfoContext(ctx context.Context, input *slack.GetConversationInfoInput) (*slack.Channel, error)
+	GetConversationHistoryContext(ctx context.Context, params *slack.GetConversationHistoryParameters) (*slack.GetConversationHistoryResponse, error)
+	GetConversationRepliesContext(ctx context.Context, params *slack.GetConversationRepliesParameters) ([]slack.Message, bool, string, error)
+	GetUserInfoContext(ctx context.Context, user string) (*slack.User, error)
+	GetFileContext(ctx context.Context, downloadURL string, writer io.Writer) error
+}
+
+var _ API = (*slack.Client)(nil)
+
+// Options select what is exported.
+type Options struct {
+	// Channels are IDs of channels, groups and DMs to export.
+	Channels []string
+	// Oldest and Latest limit messages by the time they were posted, zero for no limit.
+	Oldest, Latest time.Time
+	// PageSize is messages per page of history and replies, up to 999 (the default).
+	PageSize int
+	// ThreadConcurrency is the number of threads of the history page fetched at a time, 4 by default.
+	ThreadConcurrency int
+	// Files are passed to Sink.WriteFile with their content.
+	Files bool
+	// Limiter paces calls of Slack API methods, NewAPI paces them on its own.
+	Limiter Limiter
+	// Checkpoint keeps fetched history pages, so the interrupted export of the channel continues from the last one.
+	Checkpoint Checkpoint
+	// ThreadError is called when replies of the thread can't be fetched or the thread is incomplete
+	// (ErrIncompleteThread), the export goes on without the thread if it returns nil.
+	// By default the export fails on errors of the Slack API and keeps incomplete threads.
+	ThreadError func(channelID string, root slack.Message, err error) error
+}
+
+// Limiter paces calls of Slack API methods, like by the rate limit tier of the method.
+type Limiter interface {
+	Wait(ctx context.Context, method string) error
+}
+
+// Checkpoint keeps the progress of the export of the channel history.
+type Checkpoint interface {
+	// Resume calls fn for messages of pages fetched by the interrupted export
+	// and returns the cursor to continue the history from, empty to start from the first page.
+	Resume(channelID string, fn func(msg structs.Message) error) (string, error)
+	// Spool keeps the fetched message until its page is saved.
+	Spool(msg structs.Message) error
+	// SavePage saves the cursor of the next history page once messages of fetched pages are kept.
+	SavePage(channelID, cursor string) error
+}
+
+// Sink receives exported channels, every channel is written in order:
+// WriteChannel, WriteMessage for its messages, WriteFile for their files
+// and WriteUser for their authors.
+type Sink interface {
+	// WriteChannel is called before messages of the channel.
+	WriteChannel(channel *slack.Channel) error
+	// WriteMessage is called for every message of the channel, newest first, with thread replies.
+	WriteMessage(channelID string, msg structs.Message) error
+	// WriteFile is called for every file of messages of the channel with Options.Files,
+	// the content must be read before WriteFile returns.
+	WriteFile(channelID string, file slack.File, content io.Reader) error
+	// WriteUser is called for every author of messages and replies of the channel.
+	WriteUser(channelID string, user *slack.User) error
+	// Close is called when the export is finished, with the error of the export when it failed:
+	// the sink should discard the channel it didn't finish instead of writing it incomplete.
+	Close(exportErr error) error
+}
+
+// DataSink is implemented by sinks which write the data of the channel once its messages are written:
+// the channel with the users and names of files written by Export,
+// or everything the app collects, like workspaces of the shared channel and user statuses.
+type DataSink interface {
+	Sink
+	// WriteData is called after the last WriteUser of the channel.
+	WriteData(channelID string, data structs.Data) error
+}
+
+// Exporter exports channels of Options to the Sink.
+type Exporter struct {
+	api   API
+	opts  Options
+	users map[string]*slack.User
+}
+
+// New creates an Exporter with the Slack API client, like the one returned by NewAPI.
+func New(api API, opts Options) *Exporter {
+	if opts.PageSize <= 0 || opts.PageSize > defaultPageSize {
+		opts.PageSize = defaultPageSize
+	}
+	if opts.ThreadConcurrency <= 0 {
+		opts.ThreadConcurrency = defaultThreadConcurrency
+	}
+
+	return &Exporter{api: api, opts: opts, users: map[string]*slack.User{}}
+}
+
+// NewAPI returns the Slack API client for the token paced like Tier 3 methods,
+// speeding up while Slack is not rate limiting it and retrying 429 responses.
+func NewAPI(token string) *slack.Client {
+	return NewAPIWithTransport(token, http.DefaultTransport)
+}
+
+// NewAPIWithTransport is NewAPI sending requests with the transport, like the one with the proxy.
+func NewAPIWithTransport(token string, transport http.RoundTripper) *slack.Client {
+	limiter := aimd.New(rate.Every(time.Minute/50), rate.Every(time.Minute/5), rate.Every(time.Minute/200))
+	client := &http.Client{Transport: limiter.Transport(transport)}
+
+	return slack.New(token, slack.OptionHTTPClient(client))
+}
+
+// Export writes every channel with its messages to the sink and closes it.
+func (e *Exporter) Export(ctx context.Context, sink Sink) (err error) {
+	defer func() {
+		if closeErr := sink.Close(err); err == nil && closeErr != nil {
+			err = fmt.Errorf("could not close sink: %w", closeErr)
+		}
+	}()
+
+	if len(e.opts.Channels) == 0 {
+		return ErrNoChannels
+	}
+
+	for _, id := range e.opts.Channels {
+		if err := e.exportChannel(ctx, sink, id); err != nil {
+			return fmt.Errorf("could not export channel %q: %w", id, err)
+		}
+	}
+
+	return nil
+}
+
+func (e *Exporter) exportChannel(ctx context.Context, sink Sink, id string) error {
+	channel, err := e.api.GetConversationInfoContext(ctx, &slack.GetConversationInfoInput{ChannelID: id})
+	if err != nil {
+		return fmt.Errorf("could not get channel info: %w", err)
+	}
+
+	if err := sink.WriteChannel(channel); err != nil {
+		return err
+	}
+
+	var (
+		authors = map[string]struct{}{}
+		files   []slack.File
+	)
+
+	err = e.Messages(ctx, id, func(msg structs.Message) error {
+		if err := sink.WriteMessage(id, msg); err != nil {
+			return err
+		}
+
+		for _, m := range append([]slack.Message{msg.Message}, msg.Replies...) {
+			if m.User != "" {
+				authors[m.User] = struct{}{}
+			}
+			files = append(files, m.Files...)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	data := structs.Data{
+		Channel: *channel,
+		Users:   map[string]*slack.User{},
+		Files:   map[string]string{},
+	}
+
+	if e.opts.Files {
+		for _, file := range files {
+			if file.URLPrivateDownload == "" {
+				continue
+			}
+
+			if err := e.writeFile(ctx, sink, id, file); err != nil {
+				return fmt.Errorf("could not write file %s: %w", file.ID, err)
+			}
+			data.Files[file.ID] = file.Name
+		}
+	}
+
+	ids := make([]string, 0, len(authors))
+	for userID := range authors {
+		ids = append(ids, userID)
+	}
+	sort.Strings(ids)
+
+	for _, userID := range ids {
+		user, err := e.user(ctx, userID)
+		if err != nil {
+			return fmt.Errorf("could not get user %s: %w", userID, err)
+		}
+
+		if err := sink.WriteUser(id, user); err != nil {
+			return err
+		}
+		data.Users[userID] = user
+	}
+
+	if ds, ok := sink.(DataSink); ok {
+		return ds.WriteData(id, data)
+	}
+
+	return nil
+}
+
+// Messages calls fn for every message of the channel newest first, with thread replies oldest first.
+// History is fetched page by page, so the messages are never held in memory all at once;
+// with Options.Checkpoint messages of pages fetched by the interrupted export are passed to fn first
+// and the history continues from the next page.
+func (e *Exporter) Messages(ctx context.Context, channelID string, fn func(msg structs.Message) error) error {
+	var (
+		cursor string
+		err    error
+	)
+
+	if e.opts.Checkpoint != nil {
+		cursor, err = e.opts.Checkpoint.Resume(channelID, fn)
+		if err != nil {
+			return fmt.Errorf("could not resume channel: %w", err)
+		}
+	}
+
+	params := &slack.GetConversationHistoryParameters{
+		ChannelID: channelID,
+		Cursor:    cursor,
+		Limit:     e.opts.PageSize,
+		Oldest:    timestamp(e.opts.Oldest),
+		Latest:    timestamp(e.opts.Latest),
+	}
+
+	for {
+		if err := e.wait(ctx, "conversations.history"); err != nil {
+			return err
+		}
+
+		resp, err := e.api.GetConversationHistoryContext(ctx, params)
+		if err != nil {
+			if smaller, ok := SmallerPage(params.Limit, err); ok {
+				log.Printf("Could not get history page of %d messages, retrying with %d: %v", params.Limit, smaller, err)
+				params.Limit = smaller
+				continue
+			}
+			return fmt.Errorf("could not get history: %w", err)
+		}
+
+		threads, err := e.threads(ctx, channelID, resp.Messages)
+		if err != nil {
+			return err
+		}
+
+		// pages are the newest first, messages of the page are sorted the same way,
+		// so the output is the same in every export of the same messages
+		sort.SliceStable(resp.Messages, func(i, j int) bool {
+			return parseTimestamp(resp.Messages[i].Timestamp).After(parseTimestamp(resp.Messages[j].Timestamp))
+		})
+
+		for _, msg := range resp.Messages {
+			m := structs.Message{Message: msg, Replies: threads[msg.Timestamp]}
+
+			if e.opts.Checkpoint != nil {
+				if err := e.opts.Checkpoint.Spool(m); err != nil {
+					return err
+				}
+			}
+
+			if err := fn(m); err != nil {
+				return err
+			}
+		}
+
+		if resp.ResponseMetaData.NextCursor == "" {
+			return nil
+		}
+		params.Cursor = resp.ResponseMetaData.NextCursor
+
+		if e.opts.Checkpoint != nil {
+			if err := e.opts.Checkpoint.SavePage(channelID, params.Cursor); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// writeFile streams the content of the file to the sink.
+func (e *Exporter) writeFile(ctx context.Context, sink Sink, channelID string, file slack.File) error {
+	r, w := io.Pipe()
+	go func() {
+		w.CloseWithError(e.api.GetFileContext(ctx, file.URLPrivateDownload, w))
+	}()
+	defer r.Close()
+
+	return sink.WriteFile(channelID, file, r)
+}
+
+// user returns the user, users are requested once per export.
+func (e *Exporter) user(ctx context.Context, id string) (*slack.User, error) {
+	if u, ok := e.users[id]; ok {
+		return u, nil
+	}
+
+	if err := e.wait(ctx, "users.info"); err != nil {
+		return nil, err
+	}
+
+	u, err := e.api.GetUserInfoContext(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	e.users[id] = u
+	return u, nil
+}
+
+// threads returns replies of thread roots of the history page by the root timestamp,
+// up to Options.ThreadConcurrency threads are fetched at a time.
+func (e *Exporter) threads(ctx context.Context, channelID string, msgs []slack.Message) (map[string][]slack.Message, error) {
+	var (
+		mu      sync.Mutex
+		threads = map[string][]slack.Message{}
+	)
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(e.opts.ThreadConcurrency)
+
+	for _, msg := range msgs {
+		if msg.ReplyCount == 0 {
+			continue
+		}
+
+		g.Go(func() error {
+			replies, err := e.Thread(ctx, channelID, msg)
+			if err != nil {
+				return fmt.Errorf("could not get replies of %s: %w", msg.Timestamp, err)
+			}
+
+			mu.Lock()
+			threads[msg.Timestamp] = replies
+			mu.Unlock()
+
+			return nil
+		})
+	}
+
+	return threads, g.Wait()
+}
+
+// Thread returns replies of the thread root oldest first. While the thread has fewer replies than its reply_count,
+// like when replies are missed on a page boundary, it's fetched again up to threadRefetches times
+// and replies of all the fetches are merged. Errors of the thread are passed to Options.ThreadError,
+// the thread keeps the replies fetched before the error when it returns nil.
+func (e *Exporter) Thread(ctx context.Context, channelID string, root slack.Message) ([]slack.Message, error) {
+	replies, err := e.thread(ctx, channelID, root)
+	if err == nil {
+		return replies, nil
+	}
+
+	if e.opts.ThreadError != nil {
+		err = e.opts.ThreadError(channelID, root, err)
+	} else if errors.Is(err, ErrIncompleteThread) {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return replies, nil
+}
+
+func (e *Exporter) thread(ctx context.Context, channelID string, root slack.Message) ([]slack.Message, error) {
+	replies, err := e.replies(ctx, channelID, root.Timestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; len(replies) < root.ReplyCount && attempt < threadRefetches; attempt++ {
+		again, err := e.replies(ctx, channelID, root.Timestamp)
+		if err != nil {
+			return replies, err
+		}
+
+		replies = SortReplies(append(replies, again...))
+	}
+
+	if len(replies) < root.ReplyCount {
+		return replies, fmt.Errorf("%w: %d of %d replies", ErrIncompleteThread, len(replies), root.ReplyCount)
+	}
+
+	return replies, nil
+}
+
+// replies returns replies of the thread without the root message, oldest first.
+func (e *Exporter) replies(ctx context.Context, channelID, ts string) ([]slack.Message, error) {
+	var replies []slack.Message
+
+	params := &slack.GetConversationRepliesParameters{
+		ChannelID: channelID,
+		Timestamp: ts,
+		Limit:     e.opts.PageSize,
+	}
+
+	for {
+		if err := e.wait(ctx, "conversations.replies"); err != nil {
+			return nil, err
+		}
+
+		msgs, _, next, err := e.api.GetConversationRepliesContext(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, msg := range msgs {
+			if msg.Timestamp != ts {
+				replies = append(replies, msg)
+			}
+		}
+
+		if next == "" {
+			return SortReplies(replies), nil
+		}
+		params.Cursor = next
+	}
+}
+
+// wait waits for Options.Limiter before the call of the Slack API method.
+func (e *Exporter) wait(ctx context.Context, method string) error {
+	if e.opts.Limiter == nil {
+		return nil
+	}
+
+	if err := e.opts.Limiter.Wait(ctx, method); err != nil {
+		return fmt.Errorf("rate limit error: %w", err)
+	}
+
+	return nil
+}
+
+// SortReplies sorts replies oldest first, the reply fetched more than once is kept in its latest version.
+func SortReplies(replies []slack.Message) []slack.Message {
+	index := make(map[string]int, len(replies))
+	unique := make([]slack.Message, 0, len(replies))
+	for _, r := range replies {
+		if i, ok := index[r.Timestamp]; ok {
+			unique[i] = r
+			continue
+		}
+		index[r.Timestamp] = len(unique)
+		unique = append(unique, r)
+	}
+
+	sort.SliceStable(unique, func(i, j int) bool {
+		return parseTimestamp(unique[i].Timestamp).Before(parseTimestamp(unique[j].Timestamp))
+	})
+
+	return unique
+}
+
+// SmallerPage returns the halved page size when Slack failed to return the page
+// with the server error, large pages of heavy messages are known to time out.
+func SmallerPage(size int, err error) (int, bool) {
+	var statusErr slack.StatusCodeError
+	if size <= minPageSize || !errors.As(err, &statusErr) || statusErr.Code < http.StatusInternalServerError {
+		return size, false
+	}
+
+	return max(size/2, minPageSize), true
+}
+
+// parseTimestamp returns the time of the Slack timestamp, like 1700000000.000100.
+func parseTimestamp(ts string) time.Time {
+	sec, frac, _ := strings.Cut(ts, ".")
+
+	s, err := strconv.ParseInt(sec, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+
+	var nsec int64
+	if frac != "" {
+		frac = (frac + "000000000")[:9]
+		nsec, _ = strconv.ParseInt(frac, 10, 64)
+	}
+
+	return time.Unix(s, nsec)
+}
+
+// timestamp returns the Slack timestamp of the time, empty for zero time.
+func timestamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return strconv.FormatInt(t.Unix(), 10) + ".000000"
+}
@@ -0,0 +1,158 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/slack-go/slack"
+
+	"github.com/chuhlomin/slack-exporter/pkg/atomicfile"
+	"github.com/chuhlomin/slack-exporter/pkg/structs"
+)
+
+// JSONSink writes every channel to <dir>/<channel>.json with the structs.Data layout
+// of the slack-exporter output, files are written to <dir>/<channel>/<file ID>-<name>.
+type JSONSink struct {
+	dir   string
+	file  *atomicfile.File
+	count int
+	users map[string]*slack.User
+	files map[string]string
+}
+
+var _ Sink = (*JSONSink)(nil)
+
+// NewJSONSink creates the sink writing to the directory, it's created when missing.
+func NewJSONSink(dir string) (*JSONSink, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("could not create directory: %w", err)
+	}
+
+	return &JSONSink{dir: dir}, nil
+}
+
+// WriteChannel finishes the previous channel and starts the file of the channel,
+// messages are streamed to it as they are written.
+func (s *JSONSink) WriteChannel(channel *slack.Channel) error {
+	if err := s.finish(); err != nil {
+		return err
+	}
+
+	head, err := json.Marshal(struct {
+		Channel *slack.Channel `json:"channel"`
+	}{channel})
+	if err != nil {
+		return fmt.Errorf("could not marshal channel: %w", err)
+	}
+
+	file, err := atomicfile.Create(filepath.Join(s.dir, channel.ID+".json"))
+	if err != nil {
+		return err
+	}
+
+	// leave the object open for the messages
+	head = append(bytes.TrimSuffix(head, []byte("}")), `,"messages":[`...)
+	if _, err := file.Write(head); err != nil {
+		file.Abort()
+		return fmt.Errorf("could not write channel: %w", err)
+	}
+
+	s.file = file
+	s.count = 0
+	s.users = map[string]*slack.User{}
+	s.files = map[string]string{}
+
+	return nil
+}
+
+func (s *JSONSink) WriteMessage(_ string, msg structs.Message) error {
+	content, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("could not marshal message: %w", err)
+	}
+
+	if s.count > 0 {
+		content = append([]byte{','}, content...)
+	}
+	s.count++
+
+	if _, err := s.file.Write(content); err != nil {
+		return fmt.Errorf("could not write message: %w", err)
+	}
+
+	return nil
+}
+
+func (s *JSONSink) WriteFile(channelID string, file slack.File, content io.Reader) error {
+	if err := os.MkdirAll(filepath.Join(s.dir, channelID), 0o755); err != nil {
+		return fmt.Errorf("could not create directory: %w", err)
+	}
+
+	// adding id prefix to filename to avoid collisions (like a few files named image.png)
+	f, err := atomicfile.Create(filepath.Join(s.dir, channelID, file.ID+"-"+filepath.Base(file.Name)))
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, content); err != nil {
+		f.Abort()
+		return fmt.Errorf("could not download file: %w", err)
+	}
+
+	if err := f.Commit(); err != nil {
+		return err
+	}
+
+	s.files[file.ID] = filepath.Base(file.Name)
+	return nil
+}
+
+func (s *JSONSink) WriteUser(_ string, user *slack.User) error {
+	s.users[user.ID] = user
+	return nil
+}
+
+// Close finishes the last channel, its file is removed when the export failed,
+// so the previous export of the channel is kept.
+func (s *JSONSink) Close(exportErr error) error {
+	if exportErr != nil {
+		if s.file != nil {
+			s.file.Abort()
+			s.file = nil
+		}
+		return nil
+	}
+
+	return s.finish()
+}
+
+// finish writes users and files of the channel and moves its file in place.
+func (s *JSONSink) finish() error {
+	if s.file == nil {
+		return nil
+	}
+
+	file := s.file
+	s.file = nil
+
+	tail, err := json.Marshal(struct {
+		Users map[string]*slack.User `json:"users"`
+		Files map[string]string      `json:"files"`
+	}{s.users, s.files})
+	if err != nil {
+		file.Abort()
+		return fmt.Errorf("could not marshal users: %w", err)
+	}
+
+	tail = append([]byte("],"), bytes.TrimPrefix(tail, []byte("{"))...)
+	if _, err := file.Write(tail); err != nil {
+		file.Abort()
+		return fmt.Errorf("could not write users: %w", err)
+	}
+
+	return file.Commit()
+}
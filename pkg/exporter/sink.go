@@ -0,0 +1,89 @@
+package exporter
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/slack-go/slack"
+
+	"github.com/chuhlomin/slack-exporter/pkg/structs"
+)
+
+// multiSink writes the export to several sinks at once.
+type multiSink []Sink
+
+// MultiSink returns the sink writing to every sink in order, like io.MultiWriter;
+// file content is read once and copied to all of them. The sink is a DataSink
+// passing the data to the sinks implementing it.
+func MultiSink(sinks ...Sink) DataSink {
+	return multiSink(sinks)
+}
+
+func (m multiSink) WriteChannel(channel *slack.Channel) error {
+	for _, s := range m {
+		if err := s.WriteChannel(channel); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m multiSink) WriteMessage(channelID string, msg structs.Message) error {
+	for _, s := range m {
+		if err := s.WriteMessage(channelID, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m multiSink) WriteFile(channelID string, file slack.File, content io.Reader) error {
+	if len(m) == 1 {
+		return m[0].WriteFile(channelID, file, content)
+	}
+
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range m {
+		if err := s.WriteFile(channelID, file, bytes.NewReader(data)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m multiSink) WriteUser(channelID string, user *slack.User) error {
+	for _, s := range m {
+		if err := s.WriteUser(channelID, user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteData writes the data to the sinks implementing DataSink.
+func (m multiSink) WriteData(channelID string, data structs.Data) error {
+	for _, s := range m {
+		ds, ok := s.(DataSink)
+		if !ok {
+			continue
+		}
+		if err := ds.WriteData(channelID, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes every sink, even when some of them fail.
+func (m multiSink) Close(exportErr error) error {
+	var errs []error
+	for _, s := range m {
+		errs = append(errs, s.Close(exportErr))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,109 @@
+// Package ics writes events in the iCalendar format (RFC 5545),
+// so follow-ups exported from Slack can be imported into any calendar application.
+package ics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Event is a single calendar event.
+type Event struct {
+	// UID is the globally unique ID of the event, like "Rm0123@slack.com".
+	UID         string
+	Summary     string
+	Description string
+	URL         string
+	Start       time.Time
+	Duration    time.Duration
+	// Alarm adds a reminder notification at the start of the event.
+	Alarm bool
+}
+
+const timeFormat = "20060102T150405Z"
+
+// Write writes the calendar with the events.
+func Write(w io.Writer, name string, events []Event) error {
+	bw := bufio.NewWriter(w)
+
+	line := func(name, value string) {
+		writeFolded(bw, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//chuhlomin//slack-exporter//EN")
+	line("CALSCALE", "GREGORIAN")
+	if name != "" {
+		line("X-WR-CALNAME", escape(name))
+	}
+
+	stamp := time.Now().UTC().Format(timeFormat)
+
+	for _, e := range events {
+		duration := e.Duration
+		if duration <= 0 {
+			duration = 15 * time.Minute
+		}
+
+		line("BEGIN", "VEVENT")
+		line("UID", escape(e.UID))
+		line("DTSTAMP", stamp)
+		line("DTSTART", e.Start.UTC().Format(timeFormat))
+		line("DTEND", e.Start.Add(duration).UTC().Format(timeFormat))
+		line("SUMMARY", escape(e.Summary))
+		if e.Description != "" {
+			line("DESCRIPTION", escape(e.Description))
+		}
+		if e.URL != "" {
+			line("URL", e.URL)
+		}
+		if e.Alarm {
+			line("BEGIN", "VALARM")
+			line("ACTION", "DISPLAY")
+			line("DESCRIPTION", escape(e.Summary))
+			line("TRIGGER", "PT0S")
+			line("END", "VALARM")
+		}
+		line("END", "VEVENT")
+	}
+
+	line("END", "VCALENDAR")
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("could not write calendar: %w", err)
+	}
+
+	return nil
+}
+
+// escape escapes the TEXT value.
+func escape(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(s)
+}
+
+// writeFolded writes the content line folded at 75 octets, without splitting UTF-8 characters.
+func writeFolded(w *bufio.Writer, s string) {
+	const limit = 75
+
+	n := 0
+	for _, r := range s {
+		size := len(string(r))
+		if n+size > limit {
+			w.WriteString("\r\n ")
+			n = 1
+		}
+		w.WriteRune(r)
+		n += size
+	}
+	w.WriteString("\r\n")
+}
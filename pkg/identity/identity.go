@@ -0,0 +1,193 @@
+// Package identity maps user IDs which belong to the same person
+// across several workspaces (or Enterprise Grid teams),
+// so people are not counted twice in merged outputs and stats.
+package identity
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/slack-go/slack"
+
+	"github.com/chuhlomin/slack-exporter/pkg/atomicfile"
+)
+
+// Person is a human with one or more user IDs.
+type Person struct {
+	// ID is the canonical ID of the person, the smallest of the user IDs.
+	ID string `json:"id"`
+	// Email and Name are of the canonical user, or of the next user by ID having them.
+	Email   string   `json:"email,omitempty"`
+	Name    string   `json:"name,omitempty"`
+	UserIDs []string `json:"user_ids"`
+}
+
+// Map resolves user IDs to people.
+// A nil Map is valid and maps every user ID to itself.
+type Map struct {
+	People []Person `json:"people"`
+
+	byUser map[string]string // user ID -> person ID
+}
+
+// Build groups users by Enterprise Grid user ID and by email.
+// Users without email (bots, external users with hidden profiles)
+// are kept as separate people.
+func Build(users []*slack.User) *Map {
+	// union-find over user IDs
+	parent := map[string]string{}
+	var find func(id string) string
+	find = func(id string) string {
+		if parent[id] != id {
+			parent[id] = find(parent[id])
+		}
+		return parent[id]
+	}
+	union := func(a, b string) {
+		ra, rb := find(a), find(b)
+		if ra == rb {
+			return
+		}
+		// the smallest ID becomes the canonical one
+		if rb < ra {
+			ra, rb = rb, ra
+		}
+		parent[rb] = ra
+	}
+
+	byKey := map[string]string{}
+	usersByID := map[string]*slack.User{}
+
+	for _, u := range users {
+		if u == nil || u.ID == "" {
+			continue
+		}
+		if _, ok := parent[u.ID]; !ok {
+			parent[u.ID] = u.ID
+		}
+		// the user listed several times is taken with the email, then the first one
+		if prev, ok := usersByID[u.ID]; !ok || prev.Profile.Email == "" && u.Profile.Email != "" {
+			usersByID[u.ID] = u
+		}
+
+		var keys []string
+		if u.Enterprise.ID != "" {
+			keys = append(keys, "enterprise:"+u.Enterprise.ID)
+		}
+		if email := strings.ToLower(strings.TrimSpace(u.Profile.Email)); email != "" {
+			keys = append(keys, "email:"+email)
+		}
+
+		for _, key := range keys {
+			if other, ok := byKey[key]; ok {
+				union(u.ID, other)
+			} else {
+				byKey[key] = u.ID
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(parent))
+	for id := range parent {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	people := map[string]*Person{}
+	for _, id := range ids {
+		root := find(id)
+		p, ok := people[root]
+		if !ok {
+			p = &Person{ID: root}
+			people[root] = p
+		}
+		p.UserIDs = append(p.UserIDs, id)
+	}
+
+	m := &Map{}
+	for _, p := range people {
+		// the email and the name are of the canonical user, the first of the sorted IDs,
+		// or of the next user having them, so they are the same in every build
+		for _, id := range p.UserIDs {
+			u := usersByID[id]
+			if p.Email == "" {
+				p.Email = u.Profile.Email
+			}
+			if p.Name == "" {
+				p.Name = first(u.Profile.RealNameNormalized, u.RealName, u.Name)
+			}
+		}
+		m.People = append(m.People, *p)
+	}
+	sort.Slice(m.People, func(i, j int) bool {
+		return m.People[i].ID < m.People[j].ID
+	})
+	m.index()
+
+	return m
+}
+
+// Load reads the map from the JSON file.
+func Load(path string) (*Map, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read identities: %w", err)
+	}
+
+	var m Map
+	if err := json.Unmarshal(content, &m); err != nil {
+		return nil, fmt.Errorf("could not unmarshal identities: %w", err)
+	}
+	m.index()
+
+	return &m, nil
+}
+
+// Save writes the map to the JSON file.
+func (m *Map) Save(path string) error {
+	content, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal identities: %w", err)
+	}
+
+	if err := atomicfile.WriteFile(path, content); err != nil {
+		return fmt.Errorf("could not write identities: %w", err)
+	}
+
+	return nil
+}
+
+// Canonical returns the ID of the person the user belongs to.
+func (m *Map) Canonical(userID string) string {
+	if m == nil {
+		return userID
+	}
+
+	if id, ok := m.byUser[userID]; ok {
+		return id
+	}
+
+	return userID
+}
+
+func (m *Map) index() {
+	m.byUser = map[string]string{}
+	for _, p := range m.People {
+		for _, id := range p.UserIDs {
+			m.byUser[id] = p.ID
+		}
+	}
+}
+
+func first(ss ...string) string {
+	for _, s := range ss {
+		if s != "" {
+			return s
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,58 @@
+package identity
+
+import (
+	"encoding/json"
+	"math/rand"
+	"testing"
+
+	"github.com/slack-go/slack"
+)
+
+func user(id, email, name string) *slack.User {
+	u := &slack.User{ID: id, Name: name}
+	u.Profile.Email = email
+	return u
+}
+
+func TestBuildIsDeterministic(t *testing.T) {
+	users := []*slack.User{
+		user("U3", "Alice@example.com", "alice-ws2"),
+		user("U1", "alice@example.com", "alice"),
+		user("U2", "bob@example.com", ""),
+		user("U5", "bob@example.com", "bob"),
+		user("U4", "", "helper-bot"),
+		// the canonical user without the email has it from the next user
+		user("U0", "", "carol"),
+		user("U6", "", "carol-ws2"),
+	}
+	users[5].Enterprise.ID, users[6].Enterprise.ID = "W1", "W1"
+	users[6].Profile.Email = "carol@example.com"
+
+	want, err := json.Marshal(Build(users))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		shuffled := append([]*slack.User{}, users...)
+		r.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+
+		got, err := json.Marshal(Build(shuffled))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(want) {
+			t.Fatalf("got %s, want %s", got, want)
+		}
+	}
+
+	const wantPeople = `{"people":[` +
+		`{"id":"U0","email":"carol@example.com","name":"carol","user_ids":["U0","U6"]},` +
+		`{"id":"U1","email":"alice@example.com","name":"alice","user_ids":["U1","U3"]},` +
+		`{"id":"U2","email":"bob@example.com","name":"bob","user_ids":["U2","U5"]},` +
+		`{"id":"U4","name":"helper-bot","user_ids":["U4"]}]}`
+	if string(want) != wantPeople {
+		t.Errorf("got %s, want %s", want, wantPeople)
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package json2html
 
 import (
 	"encoding/json"
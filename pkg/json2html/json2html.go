@@ -0,0 +1,733 @@
+// Package json2html renders channels of the JSON export as HTML pages
+// with the index of the channels, for reading the archive without the exporter.
+package json2html
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "embed"
+
+	"github.com/enescakir/emoji"
+	"github.com/slack-go/slack"
+
+	"github.com/chuhlomin/slack-exporter/pkg/atomicfile"
+	"github.com/chuhlomin/slack-exporter/pkg/mrkdwn"
+	"github.com/chuhlomin/slack-exporter/pkg/render"
+	"github.com/chuhlomin/slack-exporter/pkg/structs"
+)
+
+// Options of the conversion.
+type Options struct {
+	// EmojiDir is the directory of custom emoji downloaded by the exporter, with emoji.json.
+	EmojiDir string
+	// SkipArchived skips archived channels.
+	SkipArchived bool
+}
+
+var errChannelIsArchived = fmt.Errorf("channel is archived")
+
+//go:embed template.html
+var tmpl string
+
+//go:embed index.html
+var index string
+
+var (
+	opts Options
+	fm   = template.FuncMap{
+		"lookupUser": lookupUser,
+		"username":   username,
+		"avatar": func(user *slack.User) string {
+			if user == nil || user.Profile.Image512 == "" && user.Name == "" {
+				return ""
+			}
+			return filepath.Join("avatars", user.ID+".png")
+			// return user.Profile.Image512
+		},
+		"title": title,
+		"sameMessage": func(a, b structs.Message) bool {
+			return a.SameContext(b)
+		},
+		"usersList": func(ids []string, users map[string]*slack.User) string {
+			names := make([]string, 0, len(ids))
+
+			for _, id := range ids {
+				names = append(names, username((lookupUser(id, users))))
+			}
+
+			return strings.Join(names, ", ")
+		},
+		"broadcast": structs.IsBroadcast,
+		"sameSlackMessage": func(a, b slack.Message) bool {
+			ma := structs.Message{Message: a}
+			return ma.SameContext(structs.Message{Message: b})
+		},
+		"formatTime": func(t string) string {
+			dotIndex := strings.Index(t, ".")
+			if dotIndex == -1 {
+				return t
+			}
+			unixPart := t[:dotIndex]
+			sec, err := strconv.ParseInt(unixPart, 10, 64)
+			if err != nil {
+				log.Printf("could not parse time: %v", err)
+				return t
+			}
+
+			return time.Unix(sec, 0).Format(time.ANSIC)
+		},
+		"emoji":   emojiParse,
+		"replace": strings.ReplaceAll,
+		"format": func(blocks slack.Blocks, users map[string]*slack.User) template.HTML {
+			sb := &strings.Builder{}
+			for _, block := range blocks.BlockSet {
+				switch block.BlockType() {
+				case slack.MBTRichText:
+					sb.WriteString(
+						processRichTextElements(block.(*slack.RichTextBlock).Elements, users),
+					)
+				case slack.MBTSection, slack.MBTHeader, slack.MBTContext, slack.MBTImage, slack.MBTAction:
+					sb.WriteString(renderedHTML(render.Block(block), users))
+				}
+			}
+
+			return template.HTML(sb.String()) // #nosec G203
+		},
+		"workflow": func(msg structs.Message) template.HTML {
+			// fields are already shown with the text or the blocks
+			if msg.Workflow == nil || msg.Text != "" || len(msg.Blocks.BlockSet) > 0 {
+				return ""
+			}
+
+			sb := &strings.Builder{}
+			sb.WriteString("<dl class=\"workflow\">")
+			for _, f := range msg.Workflow.Fields {
+				sb.WriteString("<dt>" + html.EscapeString(f.Name) + "</dt><dd>" + html.EscapeString(f.Value) + "</dd>")
+			}
+			sb.WriteString("</dl>")
+
+			return template.HTML(sb.String()) // #nosec G203
+		},
+		"list": func(file slack.File, lists map[string]*structs.List) template.HTML {
+			list, ok := lists[file.ID]
+			if !ok {
+				return ""
+			}
+
+			sb := &strings.Builder{}
+			sb.WriteString("<table class=\"list\"><tr>")
+			for _, c := range list.Columns {
+				sb.WriteString("<th>" + html.EscapeString(c.Name) + "</th>")
+			}
+			sb.WriteString("</tr>")
+			for _, item := range list.Items {
+				sb.WriteString("<tr>")
+				for _, v := range item.Values {
+					sb.WriteString("<td>" + html.EscapeString(v) + "</td>")
+				}
+				sb.WriteString("</tr>")
+			}
+			sb.WriteString("</table>")
+
+			return template.HTML(sb.String()) // #nosec G203
+		},
+		"mrkdwn": func(text string, users map[string]*slack.User) template.HTML {
+			return template.HTML(renderedHTML(text, users)) // #nosec G203
+		},
+		"attachments": func(attachments []slack.Attachment, users map[string]*slack.User) template.HTML {
+			sb := &strings.Builder{}
+			for _, a := range attachments {
+				sb.WriteString("<div class=\"legacy-attachment\">" + renderedHTML(render.Attachment(a), users) + "</div>")
+			}
+
+			return template.HTML(sb.String()) // #nosec G203
+		},
+		"attachment": func(file slack.File, files, paths, thumbnails map[string]string, channel slack.Channel) template.HTML {
+			filename, ok := files[file.ID]
+			if !ok {
+				url := file.URLPrivateDownload
+				if url == "" {
+					url = file.URLPrivate
+				}
+				return template.HTML(fmt.Sprintf("<a href=%q>%s</a>", url, file.Title)) // #nosec G203
+			}
+
+			// url-encode filename (account for \u202f symbol)
+			src := filepath.Join(channel.ID, file.ID+"-"+url.PathEscape(filename))
+
+			// exports with --file-layout have paths of files
+			if path, ok := paths[file.ID]; ok {
+				src = escapePath(path)
+			}
+
+			// exports with --thumbnails have thumbnails of images and videos
+			thumbnail, hasThumbnail := thumbnails[file.ID]
+
+			switch file.Filetype {
+			case "png", "jpg", "gif":
+				w, h := maxLength(file.OriginalW, file.OriginalH, 550, 550)
+				if hasThumbnail {
+					return template.HTML( // #nosec G203
+						fmt.Sprintf(
+							"<a href=%q target=\"_blank\"><img loading=\"lazy\" src=%q alt=%q class=\"attachment\" width=\"%d\" height=\"%d\"/></a>",
+							src,
+							escapePath(thumbnail),
+							file.Title,
+							w, h,
+						),
+					)
+				}
+				return template.HTML( // #nosec G203
+					fmt.Sprintf(
+						"<img loading=\"lazy\" src=%q alt=%q class=\"attachment\" width=\"%d\" height=\"%d\"/>",
+						src,
+						file.Title,
+						w, h,
+					),
+				)
+			case "mov", "mp4":
+				poster := ""
+				if hasThumbnail {
+					poster = fmt.Sprintf(" poster=%q", escapePath(thumbnail))
+				}
+				return template.HTML( // #nosec G203
+					fmt.Sprintf(
+						"<video controls preload=\"none\" src=%q%s alt=%q class=\"attachment\"/>",
+						src,
+						poster,
+						file.Title,
+					),
+				)
+
+			default:
+				return template.HTML( // #nosec G203
+					fmt.Sprintf(
+						"<a href=%q download=%q>%s</a>",
+						src,
+						file.Name,
+						file.Title,
+					),
+				)
+			}
+		},
+	}
+)
+
+var slackEmoji emojiMap
+
+// Convert writes the HTML page of the JSON channel file, or pages of channels of the export directory
+// with index.html, to output (the input when empty). Users which could not be resolved are listed
+// in unresolved_users.txt. Convert is not safe for concurrent use.
+func Convert(input, output string, options Options) error {
+	if output == "" {
+		output = input
+	}
+
+	opts = options
+	slackEmoji = nil
+	unresolvedUsers = map[string]struct{}{}
+
+	if opts.EmojiDir != "" {
+		var err error
+		slackEmoji, err = loadSlackEmoji(filepath.Join(opts.EmojiDir, "emoji.json"))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				log.Printf("Emoji file not found, skipping")
+			} else {
+				return fmt.Errorf("could not load emoji: %w", err)
+			}
+		}
+	}
+
+	t, err := template.New("template").Funcs(fm).Parse(tmpl)
+	if err != nil {
+		return fmt.Errorf("could not parse template: %w", err)
+	}
+
+	// check if input is a file or a directory
+	info, err := os.Stat(input)
+	if err != nil {
+		return fmt.Errorf("could not get file info: %w", err)
+	}
+
+	if !info.IsDir() {
+		_, err := processFile(input, output, t)
+		if err != nil {
+			return fmt.Errorf("could not process file %q: %w", input, err)
+		}
+		return reportUnresolvedUsers(filepath.Dir(output))
+	}
+
+	if err := processDirectory(input, output, t); err != nil {
+		return err
+	}
+
+	return reportUnresolvedUsers(output)
+}
+
+func processDirectory(input, output string, t *template.Template) error {
+	it, err := template.New("index").Funcs(fm).Parse(index)
+	if err != nil {
+		return fmt.Errorf("could not parse index template: %w", err)
+	}
+
+	if err := os.MkdirAll(output, 0o755); err != nil {
+		return fmt.Errorf("could not create output directory: %w", err)
+	}
+
+	files, err := os.ReadDir(input)
+	if err != nil {
+		return fmt.Errorf("could not read directory: %w", err)
+	}
+
+	var allFiles []*structs.Data
+
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+
+		if !structs.IsChannelFile(file.Name()) {
+			continue
+		}
+
+		outputFilename := strings.TrimSuffix(strings.TrimSuffix(file.Name(), ".gz"), ".json") + ".html"
+
+		log.Printf("Processing file %q", file.Name())
+		data, err := processFile(
+			filepath.Join(input, file.Name()),
+			filepath.Join(output, outputFilename),
+			t,
+		)
+		if err != nil {
+			if errors.Is(err, errChannelIsArchived) {
+				log.Printf("Channel is archived, skipping")
+				continue
+			}
+
+			return fmt.Errorf("could not process file %q: %w", file.Name(), err)
+		}
+
+		allFiles = append(allFiles, data)
+	}
+
+	branding, err := readBranding(input)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Generating index")
+	return generateIndex(output, allFiles, branding, it)
+}
+
+// readBranding reads branding.json of the export made with --branding, nil without it.
+func readBranding(input string) (*structs.Branding, error) {
+	content, err := os.ReadFile(filepath.Join(input, "branding.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read branding: %w", err)
+	}
+
+	var branding structs.Branding
+	if err := json.Unmarshal(content, &branding); err != nil {
+		return nil, fmt.Errorf("could not unmarshal branding: %w", err)
+	}
+
+	return &branding, nil
+}
+
+func processFile(input, output string, t *template.Template) (*structs.Data, error) {
+	var data structs.Data
+	content, err := structs.ReadChannelFile(input)
+	if err != nil {
+		return nil, fmt.Errorf("could not read file: %w", err)
+	}
+
+	if err := json.Unmarshal(content, &data); err != nil {
+		return nil, fmt.Errorf("could not unmarshal messages: %w", err)
+	}
+
+	if data.Channel.IsArchived && opts.SkipArchived {
+		return nil, errChannelIsArchived
+	}
+
+	// channels without messages get the page too, so they are listed in the index
+	o, err := atomicfile.Create(output)
+	if err != nil {
+		return nil, err
+	}
+	defer o.Abort()
+
+	slices.Reverse(data.Messages)
+
+	if err := t.Execute(o, data); err != nil {
+		return nil, fmt.Errorf("could not execute template: %w", err)
+	}
+
+	return &data, o.Commit()
+}
+
+func generateIndex(output string, data []*structs.Data, branding *structs.Branding, t *template.Template) error {
+	o, err := atomicfile.Create(filepath.Join(output, "index.html"))
+	if err != nil {
+		return fmt.Errorf("could not create index file: %w", err)
+	}
+	defer o.Abort()
+
+	// sort alphabetically
+	sort.Slice(data, func(i, j int) bool {
+		return title(data[i].Channel, data[i].Users) < title(data[j].Channel, data[j].Users)
+	})
+
+	if err := t.Execute(o, struct {
+		Data     []*structs.Data
+		Branding *structs.Branding
+	}{
+		Data:     data,
+		Branding: branding,
+	}); err != nil {
+		return fmt.Errorf("could not execute index template: %w", err)
+	}
+
+	return o.Commit()
+}
+
+// unresolvedUsers collects IDs of users missing in the export or exported without profile data,
+// they are rendered as IDs and listed at the end for a follow-up export.
+var unresolvedUsers = map[string]struct{}{}
+
+// unresolvedMarker is shown next to IDs of unresolved users.
+const unresolvedMarker = "⚠ "
+
+func lookupUser(id string, users map[string]*slack.User) *slack.User {
+	if id == "" {
+		return nil
+	}
+
+	if user, ok := users[id]; ok && user != nil {
+		return user
+	}
+
+	// placeholder is rendered as the user ID
+	return &slack.User{ID: id}
+}
+
+func username(user *slack.User) string {
+	if user == nil {
+		return "unknown"
+	}
+
+	name := first(
+		user.Profile.RealNameNormalized,
+		user.RealName,
+		user.Profile.DisplayNameNormalized,
+		user.Name,
+	)
+	if name == "" {
+		unresolvedUsers[user.ID] = struct{}{}
+		return unresolvedMarker + user.ID
+	}
+
+	return name
+}
+
+// reportUnresolvedUsers logs unresolved users and writes their IDs
+// to unresolved_users.txt in the output directory, one per line.
+func reportUnresolvedUsers(output string) error {
+	if len(unresolvedUsers) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(unresolvedUsers))
+	for id := range unresolvedUsers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	log.Printf("%d users could not be resolved: %s", len(ids), strings.Join(ids, ", "))
+
+	filename := filepath.Join(output, "unresolved_users.txt")
+	if err := atomicfile.WriteFile(filename, []byte(strings.Join(ids, "\n")+"\n")); err != nil {
+		return fmt.Errorf("could not write unresolved users: %w", err)
+	}
+
+	return nil
+}
+
+var emojiSkinTone = regexp.MustCompile(`:skin-tone-(\d)`)
+
+// renderedHTML converts mrkdwn of the text (like rendered from blocks or attachments) to HTML.
+func renderedHTML(text string, users map[string]*slack.User) string {
+	return mrkdwn.HTML(text, mrkdwn.Options{
+		User: func(id string) string {
+			return username(lookupUser(id, users))
+		},
+		Date: func(t time.Time, format string) string {
+			return render.Date(t, format)
+		},
+	})
+}
+
+func emojiParse(s string) template.HTML {
+	if emojiSkinTone.MatchString(s) {
+		matches := emojiSkinTone.FindStringSubmatch(s)
+		tone := matches[1]
+		suffix := ""
+
+		switch tone {
+		case "2":
+			suffix = emoji.Light.String()
+		case "3":
+			suffix = emoji.MediumLight.String()
+		case "4":
+			suffix = emoji.Medium.String()
+		case "5":
+			suffix = emoji.MediumDark.String()
+		case "6":
+			suffix = emoji.Dark.String()
+		}
+
+		// remove skin tone suffix
+		s = strings.Split(s, "::skin-tone-")[0]
+		return template.HTML(emoji.Parse(":"+s+":") + suffix) // #nosec G203
+	}
+
+	alias, filename := slackEmoji.Get(s)
+	if alias != "" {
+		return template.HTML(emoji.Parse(":" + alias + ":")) // #nosec G203
+	}
+
+	if filename != "" {
+		return template.HTML( // #nosec G203
+			fmt.Sprintf("<img class=\"emoji\" src=\"emoji/%s\" alt=\":%s:\" />", filename, s),
+		)
+	}
+
+	return template.HTML(emoji.Parse(":" + s + ":")) // #nosec G203
+}
+
+func first(ss ...string) string {
+	for _, s := range ss {
+		if s != "" {
+			return s
+		}
+	}
+
+	return ""
+}
+
+func processRichTextElements(
+	elements []slack.RichTextElement,
+	users map[string]*slack.User,
+	transforms ...func(string) string,
+) string {
+	result := strings.Builder{}
+
+	for _, element := range elements {
+		sb := strings.Builder{}
+		switch element.RichTextElementType() {
+		case slack.RTESection:
+			sb.WriteString(
+				processRichTextSectionElements(element.(*slack.RichTextSection).Elements, users),
+			)
+		case slack.RTEQuote:
+			sb.WriteString(
+				fmt.Sprintf(
+					"<blockquote>%s</blockquote>",
+					processRichTextSectionElements(element.(*slack.RichTextQuote).Elements, users),
+				),
+			)
+		case slack.RTEPreformatted:
+			sb.WriteString("<pre>")
+			for _, rtEelement := range element.(*slack.RichTextPreformatted).Elements {
+				switch rtEelement.RichTextSectionElementType() {
+				case slack.RTSEText:
+					te, ok := rtEelement.(*slack.RichTextSectionTextElement)
+					if !ok {
+						log.Printf("could not cast to RichTextSectionTextElement")
+						continue
+					}
+					text := html.EscapeString(te.Text)
+					sb.WriteString(text)
+				case slack.RTSELink:
+					if rtEelement.(*slack.RichTextSectionLinkElement).Text != "" {
+						sb.WriteString(fmt.Sprintf("<a href=%q>%s</a>", rtEelement.(*slack.RichTextSectionLinkElement).URL, rtEelement.(*slack.RichTextSectionLinkElement).Text))
+					} else {
+						sb.WriteString(fmt.Sprintf("<a href=%q>%s</a>", rtEelement.(*slack.RichTextSectionLinkElement).URL, rtEelement.(*slack.RichTextSectionLinkElement).URL))
+					}
+				}
+			}
+			sb.WriteString("</pre>")
+		case slack.RTEList:
+			var tag string
+			switch element.(*slack.RichTextList).Style {
+			case slack.RTEListBullet:
+				tag = "ul"
+			case slack.RTEListOrdered:
+				tag = "ol"
+			}
+
+			sb.WriteString(fmt.Sprintf("<%s>", tag))
+
+			sb.WriteString(
+				processRichTextElements(
+					element.(*slack.RichTextList).Elements,
+					users,
+					func(s string) string {
+						return fmt.Sprintf("<li>%s</li>", s)
+					},
+				),
+			)
+
+			sb.WriteString(fmt.Sprintf("</%s>", tag))
+		}
+
+		if len(transforms) > 0 {
+			for _, transform := range transforms {
+				result.WriteString(transform(sb.String()))
+			}
+		} else {
+			result.WriteString(sb.String())
+		}
+	}
+
+	return result.String()
+}
+
+func processRichTextSectionElements(elements []slack.RichTextSectionElement, users map[string]*slack.User) string {
+	sb := strings.Builder{}
+	var code bool
+
+	for _, rtEelement := range elements {
+		switch rtEelement.RichTextSectionElementType() {
+		case slack.RTSEText:
+			te, ok := rtEelement.(*slack.RichTextSectionTextElement)
+			if !ok {
+				log.Printf("could not cast to RichTextSectionTextElement")
+				continue
+			}
+			text := html.EscapeString(te.Text)
+			text = strings.ReplaceAll(text, "\n", "<br>")
+
+			if code && (te.Style == nil || !te.Style.Code) {
+				code = false
+				sb.WriteString("</code>")
+			}
+
+			if te.Style != nil {
+				if te.Style.Bold {
+					text = fmt.Sprintf("<b>%s</b>", text)
+				}
+				if te.Style.Italic {
+					text = fmt.Sprintf("<i>%s</i>", text)
+				}
+				if te.Style.Strike {
+					text = fmt.Sprintf("<s>%s</s>", text)
+				}
+				if te.Style.Code {
+					if !code {
+						code = true
+						text = fmt.Sprintf("<code>%s", text)
+					}
+				}
+			}
+
+			sb.WriteString(text)
+		case slack.RTSEUser:
+			sb.WriteString(
+				"<span class=\"user\">" +
+					username(lookupUser(rtEelement.(*slack.RichTextSectionUserElement).UserID, users)) +
+					"</span>",
+			)
+		case slack.RTSEEmoji:
+			sb.WriteString(
+				string(emojiParse(rtEelement.(*slack.RichTextSectionEmojiElement).Name)),
+			)
+		case slack.RTSEBroadcast:
+			sb.WriteString(
+				"<span class=\"user\">@" + html.EscapeString(rtEelement.(*slack.RichTextSectionBroadcastElement).Range) + "</span>",
+			)
+		case slack.RTSEUserGroup:
+			sb.WriteString(
+				"<span class=\"user\">@" + html.EscapeString(rtEelement.(*slack.RichTextSectionUserGroupElement).UsergroupID) + "</span>",
+			)
+		case slack.RTSEChannel:
+			sb.WriteString("#" + html.EscapeString(rtEelement.(*slack.RichTextSectionChannelElement).ChannelID))
+		case slack.RTSEDate:
+			t := rtEelement.(*slack.RichTextSectionDateElement).Timestamp.Time()
+			sb.WriteString(
+				fmt.Sprintf("<time datetime=%q>%s</time>", t.Format(time.RFC3339), render.Date(t, "{date_short} {time}")),
+			)
+		case slack.RTSELink:
+			if rtEelement.(*slack.RichTextSectionLinkElement).Text != "" {
+				sb.WriteString(fmt.Sprintf("<a href=%q>%s</a>", rtEelement.(*slack.RichTextSectionLinkElement).URL, rtEelement.(*slack.RichTextSectionLinkElement).Text))
+			} else {
+				sb.WriteString(fmt.Sprintf("<a href=%q>%s</a>", rtEelement.(*slack.RichTextSectionLinkElement).URL, rtEelement.(*slack.RichTextSectionLinkElement).URL))
+			}
+		}
+	}
+
+	if code {
+		sb.WriteString("</code>")
+	}
+
+	return sb.String()
+}
+
+// escapePath url-encodes every element of the path relative to the output directory.
+func escapePath(path string) string {
+	parts := strings.Split(filepath.ToSlash(path), "/")
+	for i := range parts {
+		parts[i] = url.PathEscape(parts[i])
+	}
+	return strings.Join(parts, "/")
+}
+
+func maxLength(w, h, maxW, maxH int) (width, height int) {
+	if w > maxW {
+		h = h * maxW / w
+		w = maxW
+	}
+
+	if h > maxH {
+		w = w * maxH / h
+		h = maxH
+	}
+
+	return w, h
+}
+
+func title(channel slack.Channel, users map[string]*slack.User) string {
+	switch {
+	case channel.IsIM:
+		return "👤 " + username(lookupUser(channel.User, users))
+	case channel.IsGroup, channel.IsMpIM:
+		return strings.Replace(
+			channel.Purpose.Value,
+			"Group messaging with: ",
+			"👥 ",
+			1,
+		)
+	default:
+		if channel.IsPrivate {
+			return "🔒 " + channel.Name
+		}
+		return "# " + channel.Name
+	}
+}
@@ -0,0 +1,136 @@
+// Package mail writes conversations as Internet Message Format messages (RFC 5322),
+// as standalone .eml files or appended to an mbox (mboxrd flavor),
+// so exports can be ingested by e-discovery and mail archiving tools.
+package mail
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	netmail "net/mail"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Address is a mailbox of the participant, like "Jane Doe <jane@example.com>".
+type Address struct {
+	Name  string
+	Email string
+}
+
+func (a Address) String() string {
+	return (&netmail.Address{Name: a.Name, Address: a.Email}).String()
+}
+
+// Message is a single message with plain text body.
+type Message struct {
+	// ID is the globally unique Message-ID without angle brackets, like "1700000000.000100.C0123@slack.invalid".
+	ID      string
+	From    Address
+	To      []Address
+	Cc      []Address
+	Subject string
+	Date    time.Time
+	Body    string
+	// Headers are extra name-value headers, like "X-Slack-Channel", written in order.
+	Headers [][2]string
+}
+
+// WriteEML writes the message with CRLF line endings as in .eml files.
+func WriteEML(w io.Writer, m Message) error {
+	content, err := m.encode()
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(content); err != nil {
+		return fmt.Errorf("could not write message: %w", err)
+	}
+
+	return nil
+}
+
+var fromLine = regexp.MustCompile(`(?m)^(>*From )`)
+
+// WriteMbox appends the message to the mbox: it starts with the "From " separator line,
+// lines of the message starting with (quoted) "From " are quoted with ">" and line endings are LF.
+func WriteMbox(w io.Writer, m Message) error {
+	content, err := m.encode()
+	if err != nil {
+		return err
+	}
+
+	content = bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+	content = fromLine.ReplaceAll(content, []byte(">$1"))
+
+	sender := m.From.Email
+	if sender == "" {
+		sender = "MAILER-DAEMON"
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "From %s %s\n", sender, m.Date.UTC().Format(time.ANSIC))
+	bw.Write(content)
+	bw.WriteString("\n")
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("could not write message: %w", err)
+	}
+
+	return nil
+}
+
+// encode returns the message with headers and quoted-printable UTF-8 body.
+func (m Message) encode() ([]byte, error) {
+	var buf bytes.Buffer
+
+	header := func(name, value string) {
+		buf.WriteString(name + ": " + value + "\r\n")
+	}
+
+	header("Message-ID", "<"+m.ID+">")
+	header("Date", m.Date.Format(time.RFC1123Z))
+	header("From", m.From.String())
+	if len(m.To) > 0 {
+		header("To", addressList(m.To))
+	}
+	if len(m.Cc) > 0 {
+		header("Cc", addressList(m.Cc))
+	}
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	for _, h := range m.Headers {
+		header(h[0], mime.QEncoding.Encode("utf-8", h[1]))
+	}
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	buf.WriteString("\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	if _, err := qp.Write([]byte(m.Body)); err != nil {
+		return nil, fmt.Errorf("could not encode body: %w", err)
+	}
+	if err := qp.Close(); err != nil {
+		return nil, fmt.Errorf("could not encode body: %w", err)
+	}
+
+	if !bytes.HasSuffix(buf.Bytes(), []byte("\r\n")) {
+		buf.WriteString("\r\n")
+	}
+
+	return buf.Bytes(), nil
+}
+
+// addressList returns the addresses folded one per line, so long lists fit the line length limit.
+func addressList(addresses []Address) string {
+	list := make([]string, 0, len(addresses))
+	for _, a := range addresses {
+		list = append(list, a.String())
+	}
+
+	return strings.Join(list, ",\r\n ")
+}
@@ -0,0 +1,85 @@
+package mrkdwn
+
+import (
+	"html"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// safeSchemes are the schemes of links kept as links, others (like javascript:) are shown as text.
+var safeSchemes = map[string]bool{"http": true, "https": true, "mailto": true, "tel": true}
+
+// HTML converts the text to HTML which is safe to embed: everything but the formatting is escaped.
+// Paragraphs are <p>, mentions are <span class="mention"> and dates are <time>.
+func HTML(s string, opts Options) string {
+	sb := &strings.Builder{}
+	opts.writeHTML(sb, parse(s))
+
+	return sb.String()
+}
+
+func (o Options) writeHTML(sb *strings.Builder, blocks []block) {
+	for _, b := range blocks {
+		switch b.kind {
+		case paragraph:
+			sb.WriteString("<p>")
+			o.writeInlineHTML(sb, parseInline(b.text))
+			sb.WriteString("</p>")
+		case codeBlock:
+			sb.WriteString("<pre><code>" + html.EscapeString(unescape(b.text)) + "</code></pre>")
+		case quote:
+			sb.WriteString("<blockquote>")
+			o.writeHTML(sb, b.blocks)
+			sb.WriteString("</blockquote>")
+		case list:
+			tag := "ul"
+			if b.ordered {
+				tag = "ol"
+			}
+			sb.WriteString("<" + tag + ">")
+			for _, item := range b.items {
+				sb.WriteString("<li>")
+				o.writeInlineHTML(sb, parseInline(item))
+				sb.WriteString("</li>")
+			}
+			sb.WriteString("</" + tag + ">")
+		}
+	}
+}
+
+var htmlTags = map[inlineKind]string{bold: "strong", italic: "em", strike: "del"}
+
+func (o Options) writeInlineHTML(sb *strings.Builder, nodes []inline) {
+	for _, n := range nodes {
+		switch n.kind {
+		case text:
+			sb.WriteString(html.EscapeString(n.text))
+		case lineBreak:
+			sb.WriteString("<br>")
+		case bold, italic, strike:
+			sb.WriteString("<" + htmlTags[n.kind] + ">")
+			o.writeInlineHTML(sb, n.children)
+			sb.WriteString("</" + htmlTags[n.kind] + ">")
+		case code:
+			sb.WriteString("<code>" + html.EscapeString(n.text) + "</code>")
+		case link:
+			label := html.EscapeString(first(n.text, n.target))
+			if !isSafeURL(n.target) {
+				sb.WriteString(label)
+				continue
+			}
+			sb.WriteString(`<a href="` + html.EscapeString(n.target) + `">` + label + "</a>")
+		case date:
+			sb.WriteString(`<time datetime="` + n.time.UTC().Format(time.RFC3339) + `">` +
+				html.EscapeString(o.mentionText(n)) + "</time>")
+		default:
+			sb.WriteString(`<span class="mention">` + html.EscapeString(o.mentionText(n)) + "</span>")
+		}
+	}
+}
+
+func isSafeURL(link string) bool {
+	u, err := url.Parse(link)
+	return err == nil && safeSchemes[strings.ToLower(u.Scheme)]
+}
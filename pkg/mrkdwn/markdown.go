@@ -0,0 +1,109 @@
+package mrkdwn
+
+import (
+	"strconv"
+	"strings"
+)
+
+var (
+	// markdownEscaper escapes text characters which are formatting in CommonMark.
+	markdownEscaper = strings.NewReplacer(
+		`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "~", `\~`,
+		"[", `\[`, "]", `\]`, "<", `\<`, ">", `\>`, "#", `\#`,
+	)
+	// destinationEscaper escapes link destinations, so they don't end the link.
+	destinationEscaper = strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29", "<", "%3C", ">", "%3E")
+
+	markdownMarkers = map[inlineKind]string{bold: "**", italic: "_", strike: "~~"}
+)
+
+// Markdown converts the text to CommonMark, line breaks within paragraphs are hard breaks
+// and strikethrough is ~~text~~ of GitHub Flavored Markdown.
+func Markdown(s string, opts Options) string {
+	return opts.markdown(parse(s))
+}
+
+func (o Options) markdown(blocks []block) string {
+	parts := make([]string, 0, len(blocks))
+
+	for _, b := range blocks {
+		switch b.kind {
+		case paragraph:
+			parts = append(parts, o.inlineMarkdown(parseInline(b.text)))
+		case codeBlock:
+			text := unescape(b.text)
+			f := strings.Repeat("`", max(3, longestRun(text, '`')+1))
+			parts = append(parts, f+"\n"+text+"\n"+f)
+		case quote:
+			lines := strings.Split(o.markdown(b.blocks), "\n")
+			for i, line := range lines {
+				lines[i] = strings.TrimRight("> "+line, " ")
+			}
+			parts = append(parts, strings.Join(lines, "\n"))
+		case list:
+			items := make([]string, 0, len(b.items))
+			for i, item := range b.items {
+				marker := "- "
+				if b.ordered {
+					marker = strconv.Itoa(i+1) + ". "
+				}
+				items = append(items, marker+o.inlineMarkdown(parseInline(item)))
+			}
+			parts = append(parts, strings.Join(items, "\n"))
+		}
+	}
+
+	return strings.Join(parts, "\n\n")
+}
+
+func (o Options) inlineMarkdown(nodes []inline) string {
+	sb := &strings.Builder{}
+
+	for _, n := range nodes {
+		switch n.kind {
+		case text:
+			sb.WriteString(markdownEscaper.Replace(n.text))
+		case lineBreak:
+			sb.WriteString("\\\n")
+		case bold, italic, strike:
+			marker := markdownMarkers[n.kind]
+			sb.WriteString(marker + o.inlineMarkdown(n.children) + marker)
+		case code:
+			ticks := strings.Repeat("`", longestRun(n.text, '`')+1)
+			if strings.HasPrefix(n.text, "`") || strings.HasSuffix(n.text, "`") {
+				sb.WriteString(ticks + " " + n.text + " " + ticks)
+				continue
+			}
+			sb.WriteString(ticks + n.text + ticks)
+		case link:
+			if !isSafeURL(n.target) {
+				sb.WriteString(markdownEscaper.Replace(first(n.text, n.target)))
+				continue
+			}
+			if n.text == "" || n.text == n.target {
+				sb.WriteString("<" + destinationEscaper.Replace(n.target) + ">")
+				continue
+			}
+			sb.WriteString("[" + markdownEscaper.Replace(n.text) + "](" + destinationEscaper.Replace(n.target) + ")")
+		default:
+			sb.WriteString(markdownEscaper.Replace(o.mentionText(n)))
+		}
+	}
+
+	return sb.String()
+}
+
+// longestRun returns the length of the longest run of the character in the text.
+func longestRun(s string, c byte) int {
+	longest, run := 0, 0
+	for i := 0; i < len(s); i++ {
+		if s[i] != c {
+			run = 0
+			continue
+		}
+		run++
+		longest = max(longest, run)
+	}
+
+	return longest
+}
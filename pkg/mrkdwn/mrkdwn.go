@@ -0,0 +1,366 @@
+// Package mrkdwn converts Slack mrkdwn, the formatting of message text, to HTML and CommonMark:
+// *bold*, _italic_, ~strike~, `code`, ```code blocks```, > quotes (and >>> for the rest of the text),
+// lists, links like <https://example.com|label>, mentions and dates.
+package mrkdwn
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Options resolve mentions and dates of the text,
+// without them mentions are shown by their labels or IDs and dates by their fallback text.
+type Options struct {
+	// User returns the name of the user by ID, for <@U0123>.
+	User func(id string) string
+	// Channel returns the name of the channel by ID, for <#C0123> without the name.
+	Channel func(id string) string
+	// Date formats the time of <!date^1700000000^{date_short} at {time}|fallback> with the format.
+	Date func(t time.Time, format string) string
+}
+
+type blockKind int
+
+const (
+	paragraph blockKind = iota
+	codeBlock
+	quote
+	list
+)
+
+// block is a paragraph (lines of inline text), a code block, a quote of blocks or a list of items.
+type block struct {
+	kind    blockKind
+	text    string
+	items   []string
+	ordered bool
+	blocks  []block
+}
+
+type inlineKind int
+
+const (
+	text inlineKind = iota
+	lineBreak
+	bold
+	italic
+	strike
+	code
+	link
+	userMention
+	channelMention
+	mention
+	date
+)
+
+// inline is the piece of the paragraph: unescaped text, formatting of its children, a link, a mention or a date.
+type inline struct {
+	kind     inlineKind
+	text     string
+	target   string
+	time     time.Time
+	children []inline
+}
+
+const fence = "```"
+
+var (
+	unescaper = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&")
+
+	formatting = map[byte]inlineKind{'*': bold, '_': italic, '~': strike}
+)
+
+// unescape decodes the entities Slack escapes in message text.
+func unescape(s string) string {
+	return unescaper.Replace(s)
+}
+
+// parse splits the text into blocks, code blocks first since nothing is formatted inside them.
+func parse(s string) []block {
+	var blocks []block
+
+	for {
+		start := strings.Index(s, fence)
+		if start < 0 {
+			break
+		}
+		end := strings.Index(s[start+len(fence):], fence)
+		if end < 0 {
+			break
+		}
+		end += start + len(fence)
+
+		blocks = append(blocks, parseLines(s[:start])...)
+		blocks = append(blocks, block{kind: codeBlock, text: strings.Trim(s[start+len(fence):end], "\n")})
+		s = s[end+len(fence):]
+	}
+
+	return append(blocks, parseLines(s)...)
+}
+
+// parseLines groups lines into quotes, lists and paragraphs separated by empty lines.
+func parseLines(s string) []block {
+	var (
+		blocks []block
+		lines  = strings.Split(s, "\n")
+		para   []string
+	)
+	flush := func() {
+		if len(para) > 0 {
+			blocks = append(blocks, block{kind: paragraph, text: strings.TrimSpace(strings.Join(para, "\n"))})
+			para = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		if rest, ok := cutQuote(lines[i], 3); ok {
+			flush()
+			rest = strings.Join(append([]string{rest}, lines[i+1:]...), "\n")
+			return append(blocks, block{kind: quote, blocks: parseLines(rest)})
+		}
+
+		if _, ok := cutQuote(lines[i], 1); ok {
+			flush()
+			var quoted []string
+			for ; i < len(lines); i++ {
+				rest, ok := cutQuote(lines[i], 1)
+				if !ok {
+					break
+				}
+				quoted = append(quoted, rest)
+			}
+			i--
+			blocks = append(blocks, block{kind: quote, blocks: parseLines(strings.Join(quoted, "\n"))})
+			continue
+		}
+
+		if _, ordered, ok := cutListItem(lines[i]); ok {
+			flush()
+			b := block{kind: list, ordered: ordered}
+			for ; i < len(lines); i++ {
+				item, o, ok := cutListItem(lines[i])
+				if !ok || o != ordered {
+					break
+				}
+				b.items = append(b.items, item)
+			}
+			i--
+			blocks = append(blocks, b)
+			continue
+		}
+
+		if strings.TrimSpace(lines[i]) == "" {
+			flush()
+			continue
+		}
+
+		para = append(para, lines[i])
+	}
+	flush()
+
+	return blocks
+}
+
+// cutQuote returns the line without the quote marker of n > (escaped as &gt; by Slack) and the space after it.
+func cutQuote(line string, n int) (string, bool) {
+	for _, marker := range []string{strings.Repeat("&gt;", n), strings.Repeat(">", n)} {
+		if rest, ok := strings.CutPrefix(line, marker); ok {
+			return strings.TrimPrefix(rest, " "), true
+		}
+	}
+
+	return "", false
+}
+
+// cutListItem returns the text of the list item line, like "• item", "- item" or "1. item".
+func cutListItem(line string) (item string, ordered, ok bool) {
+	line = strings.TrimLeft(line, " \t")
+
+	for _, bullet := range []string{"•", "◦", "▪", "-"} {
+		if rest, found := strings.CutPrefix(line, bullet+" "); found {
+			return strings.TrimSpace(rest), false, true
+		}
+	}
+
+	digits := strings.IndexFunc(line, func(r rune) bool { return r < '0' || r > '9' })
+	if digits <= 0 || !strings.HasPrefix(line[digits:], ". ") && !strings.HasPrefix(line[digits:], ") ") {
+		return "", false, false
+	}
+
+	return strings.TrimSpace(line[digits+2:]), true, true
+}
+
+// parseInline splits the line into text, formatting, code, tokens like <...> and line breaks.
+func parseInline(s string) []inline {
+	var (
+		nodes []inline
+		sb    strings.Builder
+	)
+	flush := func() {
+		if sb.Len() > 0 {
+			nodes = append(nodes, inline{kind: text, text: unescape(sb.String())})
+			sb.Reset()
+		}
+	}
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\n':
+			flush()
+			nodes = append(nodes, inline{kind: lineBreak})
+			continue
+		case '<':
+			if end := strings.IndexAny(s[i+1:], "<>\n"); end > 0 && s[i+1+end] == '>' && isToken(s[i+1:i+1+end]) {
+				flush()
+				nodes = append(nodes, token(s[i+1:i+1+end]))
+				i += end + 1
+				continue
+			}
+		case '`':
+			if end := strings.IndexAny(s[i+1:], "`\n"); end > 0 && s[i+1+end] == '`' {
+				flush()
+				nodes = append(nodes, inline{kind: code, text: unescape(s[i+1 : i+1+end])})
+				i += end + 1
+				continue
+			}
+		case '*', '_', '~':
+			if end, ok := closing(s, i); ok {
+				flush()
+				nodes = append(nodes, inline{kind: formatting[c], children: parseInline(s[i+1 : end])})
+				i = end
+				continue
+			}
+		}
+
+		sb.WriteByte(s[i])
+	}
+	flush()
+
+	return nodes
+}
+
+// closing returns the index of the marker closing the one at i: markers are formatting
+// only outside of words and around text which doesn't start or end with a space.
+func closing(s string, i int) (int, bool) {
+	marker := s[i]
+
+	if prev, _ := utf8.DecodeLastRuneInString(s[:i]); i > 0 && isWord(prev) {
+		return 0, false
+	}
+	if i+1 >= len(s) || s[i+1] == marker || isSpace(s[i+1]) {
+		return 0, false
+	}
+
+	for j := i + 2; j < len(s); j++ {
+		if s[j] == '\n' {
+			return 0, false
+		}
+		if s[j] != marker || isSpace(s[j-1]) {
+			continue
+		}
+		if next, _ := utf8.DecodeRuneInString(s[j+1:]); j+1 < len(s) && isWord(next) {
+			continue
+		}
+		return j, true
+	}
+
+	return 0, false
+}
+
+func isWord(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t'
+}
+
+// isToken reports whether the text between < and > is a token: Slack escapes other angle brackets,
+// so this only matters for text which isn't from Slack, like "a < b > c".
+func isToken(s string) bool {
+	target, _, _ := strings.Cut(s, "|")
+	return target != "" && !strings.ContainsAny(target, " \t")
+}
+
+// token converts the <...> token: a link with the optional label, a mention of the user or the channel,
+// an announcement like <!here>, a user group like <!subteam^S0123|@team> or a date.
+func token(s string) inline {
+	target, label, _ := strings.Cut(s, "|")
+	label = unescape(label)
+
+	switch {
+	case strings.HasPrefix(target, "@"):
+		return inline{kind: userMention, target: target[1:], text: label}
+	case strings.HasPrefix(target, "#"):
+		return inline{kind: channelMention, target: target[1:], text: label}
+	case strings.HasPrefix(target, "!"):
+		return special(target[1:], label)
+	}
+
+	return inline{kind: link, target: unescape(target), text: label}
+}
+
+func special(target, label string) inline {
+	name, args, _ := strings.Cut(target, "^")
+
+	switch name {
+	case "channel", "here", "everyone":
+		return inline{kind: mention, text: "@" + name}
+	case "date":
+		ts, format, _ := strings.Cut(args, "^")
+		// the optional link follows the format
+		format, _, _ = strings.Cut(format, "^")
+		if sec, err := strconv.ParseInt(ts, 10, 64); err == nil {
+			return inline{kind: date, time: time.Unix(sec, 0), target: unescape(format), text: label}
+		}
+		return inline{kind: text, text: label}
+	}
+
+	if label != "" {
+		return inline{kind: mention, text: label}
+	}
+	if args != "" {
+		return inline{kind: mention, text: "@" + args}
+	}
+	return inline{kind: mention, text: "@" + name}
+}
+
+// mentionText returns the text of the mention or the date resolved with the options.
+func (o Options) mentionText(n inline) string {
+	switch n.kind {
+	case userMention:
+		if o.User != nil {
+			if name := o.User(n.target); name != "" {
+				return "@" + name
+			}
+		}
+		return "@" + first(n.text, n.target)
+	case channelMention:
+		if n.text == "" && o.Channel != nil {
+			if name := o.Channel(n.target); name != "" {
+				return "#" + name
+			}
+		}
+		return "#" + first(n.text, n.target)
+	case date:
+		if o.Date != nil {
+			return o.Date(n.time, n.target)
+		}
+		return first(n.text, n.time.UTC().Format(time.RFC3339))
+	}
+
+	return n.text
+}
+
+func first(ss ...string) string {
+	for _, s := range ss {
+		if s != "" {
+			return s
+		}
+	}
+
+	return ""
+}
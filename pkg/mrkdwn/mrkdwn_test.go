@@ -0,0 +1,272 @@
+package mrkdwn
+
+import (
+	"testing"
+	"time"
+)
+
+var testOptions = Options{
+	User: func(id string) string {
+		if id == "U0123" {
+			return "alice"
+		}
+		return ""
+	},
+	Channel: func(id string) string {
+		if id == "C0123" {
+			return "general"
+		}
+		return ""
+	},
+}
+
+func TestHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "plain text",
+			in:   "hello",
+			want: "<p>hello</p>",
+		},
+		{
+			name: "entities are decoded and escaped again",
+			in:   "a &lt; b &amp;&amp; c &gt; d \"quoted\"",
+			want: "<p>a &lt; b &amp;&amp; c &gt; d &#34;quoted&#34;</p>",
+		},
+		{
+			name: "html in text is escaped",
+			in:   "&lt;script&gt;alert(1)&lt;/script&gt;",
+			want: "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>",
+		},
+		{
+			name: "unescaped tags are tokens, not links",
+			in:   "<script>alert(1)</script>",
+			want: "<p>scriptalert(1)/script</p>",
+		},
+		{
+			name: "angle brackets around spaces are text",
+			in:   "a < b > c",
+			want: "<p>a &lt; b &gt; c</p>",
+		},
+		{
+			name: "styles",
+			in:   "*bold* _italic_ ~strike~",
+			want: "<p><strong>bold</strong> <em>italic</em> <del>strike</del></p>",
+		},
+		{
+			name: "nested styles",
+			in:   "*bold _and italic_*",
+			want: "<p><strong>bold <em>and italic</em></strong></p>",
+		},
+		{
+			name: "markers inside words are text",
+			in:   "snake_case_name 2*3*4",
+			want: "<p>snake_case_name 2*3*4</p>",
+		},
+		{
+			name: "markers around spaces are text",
+			in:   "* not bold *",
+			want: "<p>* not bold *</p>",
+		},
+		{
+			name: "inline code is not formatted",
+			in:   "run `*x* <y>`",
+			want: "<p>run <code>*x* &lt;y&gt;</code></p>",
+		},
+		{
+			name: "code block",
+			in:   "before\n```\nif a &lt; b {\n  *x*\n}\n```\nafter",
+			want: "<p>before</p><pre><code>if a &lt; b {\n  *x*\n}</code></pre><p>after</p>",
+		},
+		{
+			name: "link",
+			in:   "<https://example.com/?a=1&amp;b=2>",
+			want: `<p><a href="https://example.com/?a=1&amp;b=2">https://example.com/?a=1&amp;b=2</a></p>`,
+		},
+		{
+			name: "link with label",
+			in:   "see <https://example.com|the *site*>",
+			want: `<p>see <a href="https://example.com">the *site*</a></p>`,
+		},
+		{
+			name: "mailto link",
+			in:   "<mailto:a@example.com|mail>",
+			want: `<p><a href="mailto:a@example.com">mail</a></p>`,
+		},
+		{
+			name: "javascript scheme is text",
+			in:   "<javascript:alert(1)|click>",
+			want: "<p>click</p>",
+		},
+		{
+			name: "javascript scheme in upper case is text",
+			in:   "<JavaScript:alert(1)>",
+			want: "<p>JavaScript:alert(1)</p>",
+		},
+		{
+			name: "data scheme is text",
+			in:   "<data:text/html,x|x>",
+			want: "<p>x</p>",
+		},
+		{
+			name: "user mention resolved",
+			in:   "hi <@U0123>",
+			want: `<p>hi <span class="mention">@alice</span></p>`,
+		},
+		{
+			name: "unknown user mention",
+			in:   "<@U9999>",
+			want: `<p><span class="mention">@U9999</span></p>`,
+		},
+		{
+			name: "channel mention with name",
+			in:   "<#C9999|random>",
+			want: `<p><span class="mention">#random</span></p>`,
+		},
+		{
+			name: "channel mention resolved",
+			in:   "<#C0123>",
+			want: `<p><span class="mention">#general</span></p>`,
+		},
+		{
+			name: "special mentions",
+			in:   "<!here> <!channel> <!subteam^S0123|@team>",
+			want: `<p><span class="mention">@here</span> <span class="mention">@channel</span> <span class="mention">@team</span></p>`,
+		},
+		{
+			name: "date",
+			in:   "<!date^1700000000^{date_short}|Nov 14>",
+			want: `<p><time datetime="2023-11-14T22:13:20Z">Nov 14</time></p>`,
+		},
+		{
+			name: "quote",
+			in:   "&gt; quoted *text*\nnot quoted",
+			want: "<blockquote><p>quoted <strong>text</strong></p></blockquote><p>not quoted</p>",
+		},
+		{
+			name: "quote of the rest",
+			in:   "&gt;&gt;&gt; first\n\nsecond",
+			want: "<blockquote><p>first</p><p>second</p></blockquote>",
+		},
+		{
+			name: "lists",
+			in:   "• one\n• _two_\n\n1. first\n2. second",
+			want: "<ul><li>one</li><li><em>two</em></li></ul><ol><li>first</li><li>second</li></ol>",
+		},
+		{
+			name: "line breaks and paragraphs",
+			in:   "one\ntwo\n\nthree",
+			want: "<p>one<br>two</p><p>three</p>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HTML(tt.in, testOptions); got != tt.want {
+				t.Errorf("HTML(%q)\n got: %s\nwant: %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "entities are decoded",
+			in:   "a &lt; b &amp; c",
+			want: `a \< b & c`,
+		},
+		{
+			name: "formatting characters in text are escaped",
+			in:   "2*3*4 [x] # snake_case",
+			want: `2\*3\*4 \[x\] \# snake\_case`,
+		},
+		{
+			name: "styles",
+			in:   "*bold* _italic_ ~strike~",
+			want: "**bold** _italic_ ~~strike~~",
+		},
+		{
+			name: "nested styles",
+			in:   "_italic *and bold*_",
+			want: "_italic **and bold**_",
+		},
+		{
+			name: "inline code",
+			in:   "run `*x*`",
+			want: "run `*x*`",
+		},
+		{
+			name: "unclosed backtick is text",
+			in:   "a `b",
+			want: "a \\`b",
+		},
+		{
+			name: "code block",
+			in:   "```\nfunc f() {}\n```",
+			want: "```\nfunc f() {}\n```",
+		},
+		{
+			name: "code block is not formatted",
+			in:   "```\n*x* &lt;y&gt; `z`\n```",
+			want: "```\n*x* <y> `z`\n```",
+		},
+		{
+			name: "link",
+			in:   "<https://example.com>",
+			want: "<https://example.com>",
+		},
+		{
+			name: "link with label",
+			in:   "<https://example.com/a_(b)|the [site]>",
+			want: `[the \[site\]](https://example.com/a_%28b%29)`,
+		},
+		{
+			name: "javascript scheme is text",
+			in:   "<javascript:alert(1)|click>",
+			want: "click",
+		},
+		{
+			name: "mentions",
+			in:   "<@U0123> <#C0123> <!everyone>",
+			want: `@alice \#general @everyone`,
+		},
+		{
+			name: "quote and list",
+			in:   "&gt; quoted\n- one\n- two",
+			want: "> quoted\n\n- one\n- two",
+		},
+		{
+			name: "line break",
+			in:   "one\ntwo",
+			want: "one\\\ntwo",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Markdown(tt.in, testOptions); got != tt.want {
+				t.Errorf("Markdown(%q)\n got: %q\nwant: %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDateOption(t *testing.T) {
+	opts := Options{Date: func(t time.Time, format string) string {
+		return t.UTC().Format(time.DateOnly) + " " + format
+	}}
+
+	got := HTML("<!date^1700000000^{date_short}|fallback>", opts)
+	want := `<p><time datetime="2023-11-14T22:13:20Z">2023-11-14 {date_short}</time></p>`
+	if got != want {
+		t.Errorf("HTML with Date\n got: %s\nwant: %s", got, want)
+	}
+}
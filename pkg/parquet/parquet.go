@@ -0,0 +1,425 @@
+// Package parquet implements a minimal Apache Parquet writer for flat tables:
+// required, optional and repeated (list) columns of strings, integers, booleans and timestamps,
+// PLAIN encoded and uncompressed, which DuckDB, Spark and pandas read directly.
+// Rows are buffered and written in row groups, so memory usage doesn't grow with the table.
+package parquet
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+)
+
+// Type is the type of the column values.
+type Type int
+
+const (
+	// String is a UTF-8 string, written as BYTE_ARRAY.
+	String Type = iota
+	// Int64 is a signed 64-bit integer.
+	Int64
+	// Bool is a boolean.
+	Bool
+	// Timestamp is a time.Time, written as INT64 milliseconds since the epoch in UTC.
+	Timestamp
+)
+
+// physical types, repetition and converted types from parquet.thrift
+const (
+	physicalBoolean   = 0
+	physicalInt64     = 2
+	physicalByteArray = 6
+
+	repetitionRequired = 0
+	repetitionOptional = 1
+	repetitionRepeated = 2
+
+	convertedUTF8            = 0
+	convertedTimestampMillis = 9
+
+	encodingPlain = 0
+	encodingRLE   = 3
+
+	pageData = 0
+)
+
+// Column describes the column of the table.
+type Column struct {
+	Name     string
+	Type     Type
+	Optional bool
+	// Repeated columns have lists of values, like []string, nil or empty lists are written as empty.
+	Repeated bool
+}
+
+var (
+	errColumnsMismatch = fmt.Errorf("number of values does not match number of columns")
+	errRequiredValue   = fmt.Errorf("value of required column is missing")
+	errValueType       = fmt.Errorf("unexpected value type")
+)
+
+// defaultRowGroupSize is the number of rows buffered before writing the row group.
+const defaultRowGroupSize = 50_000
+
+type columnChunk struct {
+	values      []byte // PLAIN encoded non-null values
+	levels      []bool // definition levels of the optional or repeated column: false for nulls and empty lists
+	repetitions []bool // repetition levels of the repeated column: false for the first value of the row
+	bits        int    // number of booleans packed into values
+	count       int    // number of non-null values
+}
+
+type columnMeta struct {
+	offset           int64
+	size             int64
+	numValues        int64
+	uncompressedSize int64
+}
+
+type rowGroupMeta struct {
+	columns []columnMeta
+	rows    int64
+	size    int64
+}
+
+// Writer writes rows to the Parquet file.
+type Writer struct {
+	w       io.Writer
+	offset  int64
+	columns []Column
+	chunks  []columnChunk
+	rows    int
+	groups  []rowGroupMeta
+	total   int64
+	err     error
+
+	// RowGroupSize is the number of rows per row group.
+	RowGroupSize int
+}
+
+// NewWriter writes the file header and returns the Writer for the table with the columns.
+func NewWriter(w io.Writer, columns []Column) (*Writer, error) {
+	pw := &Writer{
+		w:            w,
+		columns:      columns,
+		chunks:       make([]columnChunk, len(columns)),
+		RowGroupSize: defaultRowGroupSize,
+	}
+
+	if err := pw.write([]byte("PAR1")); err != nil {
+		return nil, err
+	}
+
+	return pw, nil
+}
+
+func (pw *Writer) write(b []byte) error {
+	if pw.err != nil {
+		return pw.err
+	}
+
+	n, err := pw.w.Write(b)
+	pw.offset += int64(n)
+	if err != nil {
+		pw.err = fmt.Errorf("could not write: %w", err)
+	}
+
+	return pw.err
+}
+
+// Write appends a row: one value per column, nil for nulls of optional columns.
+// Values are string, int64 (or int), bool and time.Time, and slices of them for repeated columns.
+func (pw *Writer) Write(row ...interface{}) error {
+	if len(row) != len(pw.columns) {
+		return fmt.Errorf("%w: %d != %d", errColumnsMismatch, len(row), len(pw.columns))
+	}
+
+	for i, v := range row {
+		col := pw.columns[i]
+		chunk := &pw.chunks[i]
+
+		if col.Repeated {
+			if err := chunk.appendList(col, v); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if v == nil {
+			if !col.Optional {
+				return fmt.Errorf("%w: %s", errRequiredValue, col.Name)
+			}
+			chunk.levels = append(chunk.levels, false)
+			continue
+		}
+
+		if col.Optional {
+			chunk.levels = append(chunk.levels, true)
+		}
+
+		if err := chunk.append(col, v); err != nil {
+			return err
+		}
+	}
+
+	pw.rows++
+	if pw.rows >= pw.RowGroupSize {
+		return pw.flush()
+	}
+
+	return nil
+}
+
+// Flush writes the buffered rows as a row group before it's full,
+// the file is still unreadable until Close writes the footer.
+func (pw *Writer) Flush() error {
+	return pw.flush()
+}
+
+// appendList appends values of the list, the empty list is a single entry without a value.
+func (c *columnChunk) appendList(col Column, v interface{}) error {
+	list := reflect.ValueOf(v)
+	if v == nil || list.Kind() == reflect.Slice && list.Len() == 0 {
+		c.levels = append(c.levels, false)
+		c.repetitions = append(c.repetitions, false)
+		return nil
+	}
+	if list.Kind() != reflect.Slice {
+		return fmt.Errorf("%w: %s is %T, expected slice", errValueType, col.Name, v)
+	}
+
+	for i := 0; i < list.Len(); i++ {
+		if err := c.append(col, list.Index(i).Interface()); err != nil {
+			return err
+		}
+		c.levels = append(c.levels, true)
+		c.repetitions = append(c.repetitions, i > 0)
+	}
+
+	return nil
+}
+
+func (c *columnChunk) append(col Column, v interface{}) error {
+	switch col.Type {
+	case String:
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%w: %s is %T, expected string", errValueType, col.Name, v)
+		}
+		c.values = binary.LittleEndian.AppendUint32(c.values, uint32(len(s)))
+		c.values = append(c.values, s...)
+	case Int64:
+		var n int64
+		switch i := v.(type) {
+		case int64:
+			n = i
+		case int:
+			n = int64(i)
+		default:
+			return fmt.Errorf("%w: %s is %T, expected int64", errValueType, col.Name, v)
+		}
+		c.values = binary.LittleEndian.AppendUint64(c.values, uint64(n))
+	case Bool:
+		b, ok := v.(bool)
+		if !ok {
+			return fmt.Errorf("%w: %s is %T, expected bool", errValueType, col.Name, v)
+		}
+		// booleans are bit-packed, least significant bit first
+		if c.bits%8 == 0 {
+			c.values = append(c.values, 0)
+		}
+		if b {
+			c.values[len(c.values)-1] |= 1 << (c.bits % 8)
+		}
+		c.bits++
+	case Timestamp:
+		t, ok := v.(time.Time)
+		if !ok {
+			return fmt.Errorf("%w: %s is %T, expected time.Time", errValueType, col.Name, v)
+		}
+		c.values = binary.LittleEndian.AppendUint64(c.values, uint64(t.UnixMilli()))
+	}
+
+	c.count++
+	return nil
+}
+
+// flush writes the buffered rows as a row group, one data page per column.
+func (pw *Writer) flush() error {
+	if pw.rows == 0 {
+		return nil
+	}
+
+	group := rowGroupMeta{rows: int64(pw.rows)}
+
+	for i, col := range pw.columns {
+		chunk := &pw.chunks[i]
+
+		// values of required and optional columns are one per row, of repeated ones one per level
+		numValues := pw.rows
+
+		var page []byte
+		if col.Repeated {
+			numValues = len(chunk.levels)
+			levels := encodeLevels(chunk.repetitions)
+			page = binary.LittleEndian.AppendUint32(page, uint32(len(levels)))
+			page = append(page, levels...)
+		}
+		if col.Optional || col.Repeated {
+			levels := encodeLevels(chunk.levels)
+			page = binary.LittleEndian.AppendUint32(page, uint32(len(levels)))
+			page = append(page, levels...)
+		}
+		page = append(page, chunk.values...)
+
+		t := &thriftWriter{}
+		t.i32(1, pageData)
+		t.i32(2, int32(len(page)))
+		t.i32(3, int32(len(page)))
+		t.beginStruct(5)
+		t.i32(1, int32(numValues))
+		t.i32(2, encodingPlain)
+		t.i32(3, encodingRLE)
+		t.i32(4, encodingRLE)
+		t.endStruct()
+		t.buf = append(t.buf, 0) // stop of the page header
+
+		offset := pw.offset
+		if err := pw.write(t.buf); err != nil {
+			return err
+		}
+		if err := pw.write(page); err != nil {
+			return err
+		}
+
+		size := int64(len(t.buf) + len(page))
+		group.columns = append(group.columns, columnMeta{
+			offset:           offset,
+			size:             size,
+			numValues:        int64(numValues),
+			uncompressedSize: size,
+		})
+		group.size += size
+
+		pw.chunks[i] = columnChunk{}
+	}
+
+	pw.groups = append(pw.groups, group)
+	pw.total += int64(pw.rows)
+	pw.rows = 0
+
+	return nil
+}
+
+// encodeLevels encodes repetition or definition levels (bit width 1) with the RLE hybrid encoding,
+// using RLE runs only.
+func encodeLevels(levels []bool) []byte {
+	var result []byte
+
+	for i := 0; i < len(levels); {
+		j := i
+		for j < len(levels) && levels[j] == levels[i] {
+			j++
+		}
+
+		result = binary.AppendUvarint(result, uint64(j-i)<<1)
+		if levels[i] {
+			result = append(result, 1)
+		} else {
+			result = append(result, 0)
+		}
+
+		i = j
+	}
+
+	return result
+}
+
+// Close writes the remaining rows and the file footer, it doesn't close the underlying writer.
+func (pw *Writer) Close() error {
+	if err := pw.flush(); err != nil {
+		return err
+	}
+
+	t := &thriftWriter{}
+	t.i32(1, 1) // version
+
+	// schema: the root element followed by the columns
+	t.listHeader(2, thriftStruct, len(pw.columns)+1)
+	t.beginStruct(0)
+	t.binary(4, "schema")
+	t.i32(5, int32(len(pw.columns)))
+	t.endStruct()
+	for _, col := range pw.columns {
+		physical, converted := col.types()
+
+		repetition := int32(repetitionRequired)
+		switch {
+		case col.Repeated:
+			repetition = repetitionRepeated
+		case col.Optional:
+			repetition = repetitionOptional
+		}
+
+		t.beginStruct(0)
+		t.i32(1, physical)
+		t.i32(3, repetition)
+		t.binary(4, col.Name)
+		if converted >= 0 {
+			t.i32(6, converted)
+		}
+		t.endStruct()
+	}
+
+	t.i64(3, pw.total)
+
+	t.listHeader(4, thriftStruct, len(pw.groups))
+	for _, group := range pw.groups {
+		t.beginStruct(0)
+		t.listHeader(1, thriftStruct, len(group.columns))
+		for i, col := range group.columns {
+			physical, _ := pw.columns[i].types()
+
+			t.beginStruct(0)
+			t.i64(2, col.offset)
+			t.beginStruct(3)
+			t.i32(1, physical)
+			t.i32List(2, []int32{encodingPlain, encodingRLE})
+			t.binaryList(3, []string{pw.columns[i].Name})
+			t.i32(4, 0) // uncompressed
+			t.i64(5, col.numValues)
+			t.i64(6, col.uncompressedSize)
+			t.i64(7, col.size)
+			t.i64(9, col.offset)
+			t.endStruct()
+			t.endStruct()
+		}
+		t.i64(2, group.size)
+		t.i64(3, group.rows)
+		t.endStruct()
+	}
+
+	t.binary(6, "slack-exporter")
+	t.buf = append(t.buf, 0) // stop of the file metadata
+
+	footer := binary.LittleEndian.AppendUint32(t.buf, uint32(len(t.buf)))
+	footer = append(footer, "PAR1"...)
+
+	return pw.write(footer)
+}
+
+// types returns physical and converted types of the column, -1 for no converted type.
+func (c Column) types() (physical, converted int32) {
+	switch c.Type {
+	case Int64:
+		return physicalInt64, -1
+	case Bool:
+		return physicalBoolean, -1
+	case Timestamp:
+		return physicalInt64, convertedTimestampMillis
+	default:
+		return physicalByteArray, convertedUTF8
+	}
+}
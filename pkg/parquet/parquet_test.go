@@ -0,0 +1,177 @@
+package parquet
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testColumns = []Column{
+	{Name: "id", Type: String},
+	{Name: "count", Type: Int64},
+	{Name: "bot", Type: Bool},
+	{Name: "time", Type: Timestamp},
+	{Name: "user", Type: String, Optional: true},
+	{Name: "replies", Type: Int64, Optional: true},
+	{Name: "files", Type: String, Repeated: true},
+	{Name: "counts", Type: Int64, Repeated: true},
+}
+
+var testTime = time.Date(2024, 5, 1, 12, 30, 15, 123_000_000, time.UTC)
+
+// testRows are written by the tests, nil lists are written as empty ones.
+var testRows = [][]interface{}{
+	{"1", int64(1), true, testTime, "U0123", int64(3), []string{"a.txt", "b.png"}, []int64{1}},
+	{"2", int64(-2), false, testTime.Add(time.Second), nil, nil, nil, []int64{}},
+	{"3", 3, true, testTime.Add(time.Minute), "U0123", nil, []string{"c.pdf"}, []int64{4, 5, 6}},
+	{"4", int64(4), false, testTime.Add(time.Hour), nil, int64(3), []string{}, nil},
+}
+
+// wantRows are testRows as read by readFile.
+var wantRows = [][]interface{}{
+	{"1", int64(1), true, testTime, "U0123", int64(3), []interface{}{"a.txt", "b.png"}, []interface{}{int64(1)}},
+	{"2", int64(-2), false, testTime.Add(time.Second), nil, nil, []interface{}{}, []interface{}{}},
+	{"3", int64(3), true, testTime.Add(time.Minute), "U0123", nil, []interface{}{"c.pdf"}, []interface{}{int64(4), int64(5), int64(6)}},
+	{"4", int64(4), false, testTime.Add(time.Hour), nil, int64(3), []interface{}{}, []interface{}{}},
+}
+
+func writeTestRows(t *testing.T, rowGroupSize, flushAfter int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	pw, err := NewWriter(&buf, testColumns)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	pw.RowGroupSize = rowGroupSize
+
+	for i, row := range testRows {
+		if err := pw.Write(row...); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+
+		if flushAfter > 0 && i+1 == flushAfter {
+			if err := pw.Flush(); err != nil {
+				t.Fatalf("Flush: %v", err)
+			}
+		}
+	}
+
+	if err := pw.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name         string
+		rowGroupSize int
+		flushAfter   int
+	}{
+		{name: "one row group", rowGroupSize: 100},
+		{name: "row group per row", rowGroupSize: 1},
+		{name: "flushed row group", rowGroupSize: 100, flushAfter: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			columns, rows, err := readFile(writeTestRows(t, tt.rowGroupSize, tt.flushAfter))
+			if err != nil {
+				t.Fatalf("could not read the file: %v", err)
+			}
+
+			assertColumns(t, columns)
+			assertRows(t, rows)
+		})
+	}
+}
+
+// TestFixture checks the output against testdata/table.parquet,
+// the file written with two rows per row group and checked with parquet-go.
+func TestFixture(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/table.parquet")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	columns, rows, err := readFile(fixture)
+	if err != nil {
+		t.Fatalf("could not read the fixture: %v", err)
+	}
+	assertColumns(t, columns)
+	assertRows(t, rows)
+
+	if got := writeTestRows(t, 2, 0); !bytes.Equal(got, fixture) {
+		t.Errorf("written file differs from the fixture:\ngot  %x\nwant %x", got, fixture)
+	}
+}
+
+func assertColumns(t *testing.T, columns []readColumn) {
+	t.Helper()
+
+	if len(columns) != len(testColumns) {
+		t.Fatalf("got %d columns, want %d", len(columns), len(testColumns))
+	}
+
+	for i, col := range testColumns {
+		physical, converted := col.types()
+
+		repetition := int64(repetitionRequired)
+		switch {
+		case col.Repeated:
+			repetition = repetitionRepeated
+		case col.Optional:
+			repetition = repetitionOptional
+		}
+
+		want := readColumn{name: col.Name, physical: int64(physical), converted: int64(converted), repetition: repetition}
+		if columns[i] != want {
+			t.Errorf("column %d: got %+v, want %+v", i, columns[i], want)
+		}
+	}
+}
+
+func assertRows(t *testing.T, rows [][]interface{}) {
+	t.Helper()
+
+	if len(rows) != len(wantRows) {
+		t.Fatalf("got %d rows, want %d", len(rows), len(wantRows))
+	}
+
+	for i := range wantRows {
+		if !reflect.DeepEqual(rows[i], wantRows[i]) {
+			t.Errorf("row %d: got %v, want %v", i, rows[i], wantRows[i])
+		}
+	}
+}
+
+func TestWriteErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		row  []interface{}
+	}{
+		{name: "too few values", row: []interface{}{"1"}},
+		{name: "missing required value", row: []interface{}{nil, int64(1), true, time.Now(), nil, nil, nil, nil}},
+		{name: "wrong type", row: []interface{}{1, int64(1), true, time.Now(), nil, nil, nil, nil}},
+		{name: "list of wrong type", row: []interface{}{"1", int64(1), true, time.Now(), nil, nil, []int64{1}, nil}},
+		{name: "not a list", row: []interface{}{"1", int64(1), true, time.Now(), nil, nil, "a.txt", nil}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pw, err := NewWriter(&bytes.Buffer{}, testColumns)
+			if err != nil {
+				t.Fatalf("NewWriter: %v", err)
+			}
+
+			if err := pw.Write(tt.row...); err == nil {
+				t.Errorf("Write(%v) succeeded, want an error", tt.row)
+			}
+		})
+	}
+}
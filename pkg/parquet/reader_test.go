@@ -0,0 +1,348 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// The reader below decodes just enough of the format to check the files written by this package:
+// PLAIN encoded uncompressed data pages with RLE hybrid levels of bit width 1.
+
+// thriftReader decodes the Thrift compact protocol into generic values:
+// structs are map[int16]interface{}, lists are []interface{}, integers are int64 and binaries are strings.
+type thriftReader struct {
+	buf []byte
+	pos int
+}
+
+func (t *thriftReader) byte() (byte, error) {
+	if t.pos >= len(t.buf) {
+		return 0, fmt.Errorf("unexpected end of thrift data at %d", t.pos)
+	}
+	b := t.buf[t.pos]
+	t.pos++
+	return b, nil
+}
+
+func (t *thriftReader) varint() (uint64, error) {
+	v, n := binary.Uvarint(t.buf[t.pos:])
+	if n <= 0 {
+		return 0, fmt.Errorf("invalid varint at %d", t.pos)
+	}
+	t.pos += n
+	return v, nil
+}
+
+func (t *thriftReader) zigzag() (int64, error) {
+	v, err := t.varint()
+	return int64(v>>1) ^ -int64(v&1), err
+}
+
+func (t *thriftReader) readStruct() (map[int16]interface{}, error) {
+	fields := map[int16]interface{}{}
+
+	var id int16
+	for {
+		b, err := t.byte()
+		if err != nil {
+			return nil, err
+		}
+		if b == 0 {
+			return fields, nil
+		}
+
+		if delta := int16(b >> 4); delta != 0 {
+			id += delta
+		} else {
+			v, err := t.zigzag()
+			if err != nil {
+				return nil, err
+			}
+			id = int16(v)
+		}
+
+		typ := b & 0x0f
+		switch typ {
+		case 1, 2: // booleans are stored in the field type
+			fields[id] = typ == 1
+		default:
+			if fields[id], err = t.readValue(typ); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (t *thriftReader) readValue(typ byte) (interface{}, error) {
+	switch typ {
+	case 3: // i8
+		b, err := t.byte()
+		return int64(int8(b)), err
+	case 4, thriftI32, thriftI64:
+		return t.zigzag()
+	case thriftBinary:
+		n, err := t.varint()
+		if err != nil {
+			return nil, err
+		}
+		if t.pos+int(n) > len(t.buf) {
+			return nil, fmt.Errorf("binary of %d bytes at %d is out of bounds", n, t.pos)
+		}
+		s := string(t.buf[t.pos : t.pos+int(n)])
+		t.pos += int(n)
+		return s, nil
+	case thriftList:
+		b, err := t.byte()
+		if err != nil {
+			return nil, err
+		}
+		size := uint64(b >> 4)
+		if size == 15 {
+			if size, err = t.varint(); err != nil {
+				return nil, err
+			}
+		}
+		list := make([]interface{}, 0, size)
+		for i := uint64(0); i < size; i++ {
+			v, err := t.readValue(b & 0x0f)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	case thriftStruct:
+		return t.readStruct()
+	}
+
+	return nil, fmt.Errorf("unsupported thrift type %d at %d", typ, t.pos)
+}
+
+// readColumn is the schema element of the column read from the footer.
+type readColumn struct {
+	name       string
+	physical   int64
+	converted  int64
+	repetition int64
+}
+
+// readFile reads the Parquet file into rows of values: strings, int64, bools, time.Time in UTC
+// and nils for nulls; the values of repeated columns are []interface{}.
+func readFile(data []byte) ([]readColumn, [][]interface{}, error) {
+	if len(data) < 12 || !bytes.Equal(data[:4], []byte("PAR1")) || !bytes.Equal(data[len(data)-4:], []byte("PAR1")) {
+		return nil, nil, fmt.Errorf("missing magic bytes")
+	}
+
+	size := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	if size > len(data)-12 {
+		return nil, nil, fmt.Errorf("footer size %d is out of bounds", size)
+	}
+
+	meta, err := (&thriftReader{buf: data[len(data)-8-size : len(data)-8]}).readStruct()
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read footer: %w", err)
+	}
+
+	schema, _ := meta[2].([]interface{})
+	if len(schema) == 0 {
+		return nil, nil, fmt.Errorf("missing schema")
+	}
+
+	var columns []readColumn
+	for _, e := range schema[1:] {
+		element := e.(map[int16]interface{})
+		col := readColumn{converted: -1}
+		col.name, _ = element[4].(string)
+		col.physical, _ = element[1].(int64)
+		col.repetition, _ = element[3].(int64)
+		if converted, ok := element[6].(int64); ok {
+			col.converted = converted
+		}
+		columns = append(columns, col)
+	}
+
+	var rows [][]interface{}
+	groups, _ := meta[4].([]interface{})
+	for _, g := range groups {
+		group := g.(map[int16]interface{})
+		numRows := int(group[3].(int64))
+		chunks := group[1].([]interface{})
+		if len(chunks) != len(columns) {
+			return nil, nil, fmt.Errorf("row group has %d columns, schema has %d", len(chunks), len(columns))
+		}
+
+		groupRows := make([][]interface{}, numRows)
+		for i := range groupRows {
+			groupRows[i] = make([]interface{}, len(columns))
+		}
+
+		for i, c := range chunks {
+			chunkMeta := c.(map[int16]interface{})[3].(map[int16]interface{})
+			offset := int(chunkMeta[9].(int64))
+
+			values, err := readPage(data, offset, columns[i], numRows)
+			if err != nil {
+				return nil, nil, fmt.Errorf("column %s: %w", columns[i].name, err)
+			}
+			for row, v := range values {
+				groupRows[row][i] = v
+			}
+		}
+
+		rows = append(rows, groupRows...)
+	}
+
+	if total := meta[3].(int64); int(total) != len(rows) {
+		return nil, nil, fmt.Errorf("footer has %d rows, row groups have %d", total, len(rows))
+	}
+
+	return columns, rows, nil
+}
+
+// readPage reads the data page of the column chunk at the offset and returns the value of every row.
+func readPage(data []byte, offset int, col readColumn, numRows int) ([]interface{}, error) {
+	t := &thriftReader{buf: data, pos: offset}
+	header, err := t.readStruct()
+	if err != nil {
+		return nil, fmt.Errorf("could not read page header: %w", err)
+	}
+	if typ := header[1].(int64); typ != pageData {
+		return nil, fmt.Errorf("unexpected page type %d", typ)
+	}
+
+	size := int(header[3].(int64))
+	if t.pos+size > len(data) {
+		return nil, fmt.Errorf("page of %d bytes at %d is out of bounds", size, t.pos)
+	}
+	page := data[t.pos : t.pos+size]
+	numValues := int(header[5].(map[int16]interface{})[1].(int64))
+
+	var repetitions, definitions []bool
+	if col.repetition == repetitionRepeated {
+		if repetitions, page, err = readLevels(page, numValues); err != nil {
+			return nil, fmt.Errorf("could not read repetition levels: %w", err)
+		}
+	}
+	if col.repetition != repetitionRequired {
+		if definitions, page, err = readLevels(page, numValues); err != nil {
+			return nil, fmt.Errorf("could not read definition levels: %w", err)
+		}
+	}
+
+	var (
+		values []interface{}
+		bit    int
+	)
+	for i := 0; i < numValues; i++ {
+		var v interface{}
+		if definitions == nil || definitions[i] {
+			switch col.physical {
+			case physicalByteArray:
+				if len(page) < 4 {
+					return nil, fmt.Errorf("missing length of value %d", i)
+				}
+				n := int(binary.LittleEndian.Uint32(page))
+				if len(page) < 4+n {
+					return nil, fmt.Errorf("value %d of %d bytes is out of bounds", i, n)
+				}
+				v, page = string(page[4:4+n]), page[4+n:]
+			case physicalInt64:
+				if len(page) < 8 {
+					return nil, fmt.Errorf("missing value %d", i)
+				}
+				n := int64(binary.LittleEndian.Uint64(page))
+				page = page[8:]
+				v = n
+				if col.converted == convertedTimestampMillis {
+					v = time.UnixMilli(n).UTC()
+				}
+			case physicalBoolean:
+				if bit/8 >= len(page) {
+					return nil, fmt.Errorf("missing value %d", i)
+				}
+				v = page[bit/8]&(1<<(bit%8)) != 0
+				bit++
+			default:
+				return nil, fmt.Errorf("unsupported physical type %d", col.physical)
+			}
+		}
+
+		if col.repetition != repetitionRepeated {
+			values = append(values, v)
+			continue
+		}
+
+		// a new row starts at repetition level 0, an undefined value is the empty list
+		if !repetitions[i] {
+			values = append(values, []interface{}{})
+		}
+		if v != nil {
+			values[len(values)-1] = append(values[len(values)-1].([]interface{}), v)
+		}
+	}
+
+	if col.physical == physicalBoolean {
+		page = page[(bit+7)/8:]
+	}
+	if len(page) != 0 {
+		return nil, fmt.Errorf("%d bytes left after the values", len(page))
+	}
+	if len(values) != numRows {
+		return nil, fmt.Errorf("got %d rows, want %d", len(values), numRows)
+	}
+
+	return values, nil
+}
+
+// readLevels reads the length-prefixed RLE hybrid encoded levels of bit width 1
+// and returns them with the rest of the page.
+func readLevels(page []byte, n int) ([]bool, []byte, error) {
+	if len(page) < 4 {
+		return nil, nil, fmt.Errorf("missing length")
+	}
+	size := int(binary.LittleEndian.Uint32(page))
+	if len(page) < 4+size {
+		return nil, nil, fmt.Errorf("levels of %d bytes are out of bounds", size)
+	}
+	encoded, rest := page[4:4+size], page[4+size:]
+
+	var levels []bool
+	for len(encoded) > 0 {
+		header, k := binary.Uvarint(encoded)
+		if k <= 0 {
+			return nil, nil, fmt.Errorf("invalid run header")
+		}
+		encoded = encoded[k:]
+
+		if header&1 == 0 {
+			// RLE run: the count and the value in a byte
+			if len(encoded) < 1 {
+				return nil, nil, fmt.Errorf("missing run value")
+			}
+			for i := uint64(0); i < header>>1; i++ {
+				levels = append(levels, encoded[0] != 0)
+			}
+			encoded = encoded[1:]
+			continue
+		}
+
+		// bit-packed run: groups of 8 values in a byte
+		groups := int(header >> 1)
+		if len(encoded) < groups {
+			return nil, nil, fmt.Errorf("bit-packed run is out of bounds")
+		}
+		for i := 0; i < groups*8; i++ {
+			levels = append(levels, encoded[i/8]&(1<<(i%8)) != 0)
+		}
+		encoded = encoded[groups:]
+	}
+
+	// bit-packed runs are padded to multiples of 8
+	if len(levels) < n || len(levels) > n && len(levels)-n >= 8 {
+		return nil, nil, fmt.Errorf("got %d levels, want %d", len(levels), n)
+	}
+
+	return levels[:n], rest, nil
+}
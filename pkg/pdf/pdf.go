@@ -0,0 +1,270 @@
+// Package pdf implements a minimal PDF writer: pages with text in the standard
+// Helvetica fonts and raster images, enough to render conversations for records.
+// Text is encoded with WinAnsiEncoding, characters outside of it are replaced with "?".
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"strings"
+
+	// image formats of the attachments
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// Font is one of the standard fonts.
+type Font int
+
+const (
+	Helvetica Font = iota
+	HelveticaBold
+)
+
+// A4 page size in points.
+const (
+	A4Width  = 595
+	A4Height = 842
+)
+
+// Document is a PDF document built page by page.
+type Document struct {
+	Width, Height float64
+
+	pages  []*bytes.Buffer
+	images []*pdfImage
+}
+
+// Image is an image added to the document, it can be drawn on several pages.
+type Image struct {
+	id            int
+	Width, Height int
+}
+
+type pdfImage struct {
+	width, height int
+	data          []byte // zlib compressed RGB
+}
+
+// New creates an empty document with the page size.
+func New(width, height float64) *Document {
+	return &Document{Width: width, Height: height}
+}
+
+// AddPage starts a new page, the following drawing goes to it.
+func (d *Document) AddPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+}
+
+// Pages returns the number of pages.
+func (d *Document) Pages() int {
+	return len(d.pages)
+}
+
+func (d *Document) page() *bytes.Buffer {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+	return d.pages[len(d.pages)-1]
+}
+
+// Text draws the text with its baseline at y (from the bottom of the page) in the gray level
+// from 0 (black) to 1 (white).
+func (d *Document) Text(x, y float64, font Font, size, gray float64, text string) {
+	fmt.Fprintf(
+		d.page(),
+		"BT %.3f g /F%d %.1f Tf %.2f %.2f Td (%s) Tj ET\n",
+		gray, font+1, size, x, y, escape(encode(text)),
+	)
+}
+
+// Line draws the horizontal line.
+func (d *Document) Line(x1, x2, y, gray float64) {
+	fmt.Fprintf(d.page(), "%.3f G 0.5 w %.2f %.2f m %.2f %.2f l S\n", gray, x1, y, x2, y)
+}
+
+// AddImage decodes the image (JPEG, PNG or GIF) to embed into the document.
+func (d *Document) AddImage(r io.Reader) (*Image, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode image: %w", err)
+	}
+
+	bounds := img.Bounds()
+	raw := make([]byte, 0, bounds.Dx()*bounds.Dy()*3)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			// transparent pixels are blended with the white page
+			blend := func(v uint8) byte {
+				return byte((int(v)*int(c.A) + 255*(255-int(c.A))) / 255)
+			}
+			raw = append(raw, blend(c.R), blend(c.G), blend(c.B))
+		}
+	}
+
+	compressed := &bytes.Buffer{}
+	zw := zlib.NewWriter(compressed)
+	if _, err := zw.Write(raw); err != nil {
+		return nil, fmt.Errorf("could not compress image: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("could not compress image: %w", err)
+	}
+
+	d.images = append(d.images, &pdfImage{
+		width:  bounds.Dx(),
+		height: bounds.Dy(),
+		data:   compressed.Bytes(),
+	})
+
+	return &Image{
+		id:     len(d.images),
+		Width:  bounds.Dx(),
+		Height: bounds.Dy(),
+	}, nil
+}
+
+// DrawImage draws the image with the bottom left corner at x, y.
+func (d *Document) DrawImage(img *Image, x, y, width, height float64) {
+	fmt.Fprintf(d.page(), "q %.2f 0 0 %.2f %.2f %.2f cm /Im%d Do Q\n", width, height, x, y, img.id)
+}
+
+// TextWidth returns the width of the text in points.
+func TextWidth(font Font, size float64, text string) float64 {
+	widths := &helveticaWidths
+	if font == HelveticaBold {
+		widths = &helveticaBoldWidths
+	}
+
+	total := 0
+	for _, b := range []byte(encode(text)) {
+		if b >= 32 && b <= 126 {
+			total += widths[b-32]
+		} else {
+			total += 556
+		}
+	}
+
+	return float64(total) * size / 1000
+}
+
+// Write writes the document.
+func (d *Document) Write(w io.Writer) error {
+	buf := &bytes.Buffer{}
+	var offsets []int
+
+	object := func(content string, stream []byte) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(buf, "%d 0 obj\n%s\n", len(offsets), content)
+		if stream != nil {
+			buf.WriteString("stream\n")
+			buf.Write(stream)
+			buf.WriteString("\nendstream\n")
+		}
+		buf.WriteString("endobj\n")
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+
+	// objects: 1 catalog, 2 pages, 3-4 fonts, images, then page and content of every page
+	firstImage := 5
+	firstPage := firstImage + len(d.images)
+
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+i*2)
+	}
+
+	object("<< /Type /Catalog /Pages 2 0 R >>", nil)
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)), nil)
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>", nil)
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>", nil)
+
+	xobjects := make([]string, len(d.images))
+	for i, img := range d.images {
+		object(fmt.Sprintf(
+			"<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode /Length %d >>",
+			img.width, img.height, len(img.data),
+		), img.data)
+		xobjects[i] = fmt.Sprintf("/Im%d %d 0 R", i+1, firstImage+i)
+	}
+
+	for i, content := range d.pages {
+		object(fmt.Sprintf(
+			"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> /XObject << %s >> >> /Contents %d 0 R >>",
+			d.Width, d.Height, strings.Join(xobjects, " "), firstPage+i*2+1,
+		), nil)
+		object(fmt.Sprintf("<< /Length %d >>", content.Len()), content.Bytes())
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// winAnsi maps characters outside of Latin-1 to WinAnsiEncoding.
+var winAnsi = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87,
+	'ˆ': 0x88, '‰': 0x89, 'Š': 0x8a, '‹': 0x8b, 'Œ': 0x8c, 'Ž': 0x8e,
+	'‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97,
+	'˜': 0x98, '™': 0x99, 'š': 0x9a, '›': 0x9b, 'œ': 0x9c, 'ž': 0x9e, 'Ÿ': 0x9f,
+}
+
+// encode converts the text to WinAnsiEncoding.
+func encode(text string) string {
+	b := make([]byte, 0, len(text))
+	for _, r := range text {
+		switch {
+		case r == '\t':
+			b = append(b, ' ')
+		case r >= 32 && r <= 126, r >= 0xa0 && r <= 0xff:
+			b = append(b, byte(r))
+		case winAnsi[r] != 0:
+			b = append(b, winAnsi[r])
+		case r < 32:
+			// control characters are dropped
+		default:
+			b = append(b, '?')
+		}
+	}
+	return string(b)
+}
+
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`).Replace(s)
+}
+
+// character widths of the printable ASCII characters (32-126) from the standard AFM files
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+var helveticaBoldWidths = [95]int{
+	278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+	975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+	333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+	611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+}
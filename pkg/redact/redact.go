@@ -0,0 +1,83 @@
+// Package redact removes secrets from text before it's logged or written to reports:
+// Slack tokens, signatures and tokens in query strings of signed URLs
+// and the values added with Secret, like the app client secret.
+package redact
+
+import (
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Mask replaces the secrets.
+const Mask = "[REDACTED]"
+
+var (
+	// tokens are Slack tokens, like xoxp-, xoxb-, xoxe.xoxp- (rotating) and xapp- (app-level) ones
+	tokens = regexp.MustCompile(`\b(?:xox[a-z](?:\.xox[a-z])?|xapp)-[A-Za-z0-9-]+`)
+	// params are the query parameters of signed URLs and OAuth requests with secret values
+	params = regexp.MustCompile(`(?i)([?&](?:t|token|pub_secret|code|client_secret|refresh_token|signature|x-amz-signature|x-amz-credential|x-amz-security-token)=)[^&\s"'<>]+`)
+)
+
+var (
+	mu       sync.RWMutex
+	secrets  []string
+	disabled bool
+)
+
+// Secret adds values which don't look like secrets to be redacted, empty ones are skipped.
+func Secret(values ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, v := range values {
+		if v != "" {
+			secrets = append(secrets, v)
+		}
+	}
+}
+
+// Disable turns redaction off, to debug requests with the real tokens.
+func Disable() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	disabled = true
+}
+
+// String returns s with the secrets replaced by Mask.
+func String(s string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if disabled {
+		return s
+	}
+
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, Mask)
+	}
+
+	s = params.ReplaceAllString(s, "${1}"+Mask)
+
+	return tokens.ReplaceAllString(s, Mask)
+}
+
+// Writer returns the writer redacting secrets before they are written to w,
+// every write is redacted on its own, like log entries.
+func Writer(w io.Writer) io.Writer {
+	return writer{w: w}
+}
+
+type writer struct {
+	w io.Writer
+}
+
+func (rw writer) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(rw.w, String(string(p))); err != nil {
+		return 0, err
+	}
+	// the caller wrote all of p, even when the redacted text is shorter
+	return len(p), nil
+}
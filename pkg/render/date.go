@@ -0,0 +1,58 @@
+package render
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dateLayouts are Go layouts of the tokens of <!date^...> formats,
+// "2nd" is replaced with the day of month with the ordinal suffix, like 1st or 22nd.
+// Pretty variants say "today" or "yesterday" in Slack, in the archive they are dates.
+var dateLayouts = map[string]string{
+	"{date_num}":          "2006-01-02",
+	"{date}":              "January 2nd, 2006",
+	"{date_pretty}":       "January 2nd, 2006",
+	"{date_short}":        "Jan 2, 2006",
+	"{date_short_pretty}": "Jan 2, 2006",
+	"{date_long}":         "Monday, January 2nd, 2006",
+	"{date_long_pretty}":  "Monday, January 2nd, 2006",
+	"{time}":              "3:04 PM",
+	"{time_secs}":         "3:04:05 PM",
+	"{ago}":               "Jan 2, 2006 3:04 PM",
+}
+
+// Date formats the time with the format of the <!date^...> token, like "{date_short} at {time}".
+func Date(t time.Time, format string) string {
+	for token, layout := range dateLayouts {
+		if !strings.Contains(format, token) {
+			continue
+		}
+
+		value := t.Format(layout)
+		value = strings.Replace(value, strconv.Itoa(t.Day())+"nd", ordinal(t.Day()), 1)
+		format = strings.ReplaceAll(format, token, value)
+	}
+
+	return format
+}
+
+// DateToken returns the <!date^...> token of the time, so it's converted the same way as in message text.
+func DateToken(t time.Time) string {
+	return "<!date^" + strconv.FormatInt(t.Unix(), 10) + "^{date_short} {time}|" + t.UTC().Format(time.RFC3339) + ">"
+}
+
+func ordinal(day int) string {
+	suffix := "th"
+	switch {
+	case day%100 >= 11 && day%100 <= 13:
+	case day%10 == 1:
+		suffix = "st"
+	case day%10 == 2:
+		suffix = "nd"
+	case day%10 == 3:
+		suffix = "rd"
+	}
+
+	return strconv.Itoa(day) + suffix
+}
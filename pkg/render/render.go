@@ -0,0 +1,253 @@
+// Package render converts Block Kit blocks and legacy attachments of Slack messages
+// into mrkdwn text, so messages posted by apps, which often have empty text,
+// are readable in formats meant for people.
+package render
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+// Text returns the text of the message: the rendered blocks when the text is empty
+// or the blocks have more than the text (rich_text blocks only repeat it),
+// followed by legacy attachments.
+func Text(msg slack.Message) string {
+	text := msg.Text
+	if text == "" || hasLayout(msg.Blocks) {
+		if blocks := Blocks(msg.Blocks); blocks != "" {
+			text = blocks
+		}
+	}
+
+	if text == "" {
+		text = Metadata(msg.Metadata)
+	}
+
+	return join("\n\n", text, Attachments(msg.Attachments))
+}
+
+// Metadata renders the event payload of the message metadata (like posted by workflows)
+// as "*key*: value" lines sorted by key.
+func Metadata(m slack.SlackMetadata) string {
+	keys := make([]string, 0, len(m.EventPayload))
+	for key := range m.EventPayload {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	lines := make([]string, 0, len(keys))
+	for _, key := range keys {
+		lines = append(lines, fmt.Sprintf("*%s*: %v", key, m.EventPayload[key]))
+	}
+
+	return join("\n", lines...)
+}
+
+// hasLayout reports whether any block is not rich_text.
+func hasLayout(blocks slack.Blocks) bool {
+	for _, block := range blocks.BlockSet {
+		if block.BlockType() != slack.MBTRichText {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Blocks renders the blocks one per paragraph.
+func Blocks(blocks slack.Blocks) string {
+	parts := make([]string, 0, len(blocks.BlockSet))
+	for _, block := range blocks.BlockSet {
+		parts = append(parts, Block(block))
+	}
+
+	return join("\n\n", parts...)
+}
+
+// Block renders the single block, empty for blocks without text, like dividers and inputs.
+func Block(block slack.Block) string {
+	switch b := block.(type) {
+	case *slack.SectionBlock:
+		parts := []string{textObject(b.Text)}
+		for _, field := range b.Fields {
+			parts = append(parts, textObject(field))
+		}
+		if b.Accessory != nil && b.Accessory.ButtonElement != nil {
+			parts = append(parts, button(b.Accessory.ButtonElement))
+		}
+		return join("\n", parts...)
+	case *slack.HeaderBlock:
+		if text := textObject(b.Text); text != "" {
+			return "*" + text + "*"
+		}
+	case *slack.ContextBlock:
+		parts := make([]string, 0, len(b.ContextElements.Elements))
+		for _, element := range b.ContextElements.Elements {
+			switch e := element.(type) {
+			case *slack.TextBlockObject:
+				parts = append(parts, textObject(e))
+			case *slack.ImageBlockElement:
+				parts = append(parts, e.AltText)
+			}
+		}
+		return join(" | ", parts...)
+	case *slack.ImageBlock:
+		if title := textObject(b.Title); title != "" {
+			return "<" + b.ImageURL + "|" + title + ">"
+		}
+		if b.AltText != "" {
+			return "<" + b.ImageURL + "|" + b.AltText + ">"
+		}
+		return b.ImageURL
+	case *slack.ActionBlock:
+		if b.Elements == nil {
+			return ""
+		}
+		parts := []string{}
+		for _, element := range b.Elements.ElementSet {
+			if e, ok := element.(*slack.ButtonBlockElement); ok {
+				parts = append(parts, button(e))
+			}
+		}
+		return join(" ", parts...)
+	case *slack.RichTextBlock:
+		return richText(b.Elements)
+	}
+
+	return ""
+}
+
+// Attachments renders legacy attachments one per paragraph.
+func Attachments(attachments []slack.Attachment) string {
+	parts := make([]string, 0, len(attachments))
+	for _, a := range attachments {
+		parts = append(parts, Attachment(a))
+	}
+
+	return join("\n\n", parts...)
+}
+
+// Attachment renders the legacy attachment: pretext, author, title, text, fields and footer,
+// the fallback when it has none of them.
+func Attachment(a slack.Attachment) string {
+	title := a.Title
+	if title != "" && a.TitleLink != "" {
+		title = "<" + a.TitleLink + "|" + title + ">"
+	}
+
+	fields := make([]string, 0, len(a.Fields))
+	for _, f := range a.Fields {
+		if f.Title == "" {
+			fields = append(fields, f.Value)
+			continue
+		}
+		fields = append(fields, join(": ", "*"+f.Title+"*", f.Value))
+	}
+
+	text := join("\n",
+		a.Pretext,
+		a.AuthorName,
+		title,
+		a.Text,
+		Blocks(a.Blocks),
+		join("\n", fields...),
+		a.Footer,
+	)
+	if text == "" {
+		return a.Fallback
+	}
+
+	return text
+}
+
+func textObject(t *slack.TextBlockObject) string {
+	if t == nil {
+		return ""
+	}
+
+	return t.Text
+}
+
+func button(b *slack.ButtonBlockElement) string {
+	label := textObject(b.Text)
+	if b.URL != "" {
+		return "<" + b.URL + "|" + label + ">"
+	}
+
+	return "[" + label + "]"
+}
+
+// richText renders the rich_text elements with the same tokens as message text,
+// like <@U0123> for mentions, so they are converted the same way.
+func richText(elements []slack.RichTextElement) string {
+	sb := &strings.Builder{}
+
+	for _, element := range elements {
+		switch e := element.(type) {
+		case *slack.RichTextSection:
+			richTextSection(sb, e.Elements)
+		case *slack.RichTextQuote:
+			section := &strings.Builder{}
+			richTextSection(section, e.Elements)
+			sb.WriteString("> " + strings.ReplaceAll(section.String(), "\n", "\n> ") + "\n")
+		case *slack.RichTextPreformatted:
+			sb.WriteString("```")
+			richTextSection(sb, e.Elements)
+			sb.WriteString("```\n")
+		case *slack.RichTextList:
+			indent := strings.Repeat("    ", e.Indent)
+			for i, item := range e.Elements {
+				marker := "• "
+				if e.Style == slack.RTEListOrdered {
+					marker = strconv.Itoa(i+1) + ". "
+				}
+				sb.WriteString(indent + marker + strings.TrimSuffix(richText([]slack.RichTextElement{item}), "\n") + "\n")
+			}
+		}
+	}
+
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+func richTextSection(sb *strings.Builder, elements []slack.RichTextSectionElement) {
+	for _, element := range elements {
+		switch e := element.(type) {
+		case *slack.RichTextSectionTextElement:
+			sb.WriteString(e.Text)
+		case *slack.RichTextSectionLinkElement:
+			if e.Text != "" {
+				sb.WriteString("<" + e.URL + "|" + e.Text + ">")
+			} else {
+				sb.WriteString("<" + e.URL + ">")
+			}
+		case *slack.RichTextSectionUserElement:
+			sb.WriteString("<@" + e.UserID + ">")
+		case *slack.RichTextSectionChannelElement:
+			sb.WriteString("<#" + e.ChannelID + ">")
+		case *slack.RichTextSectionUserGroupElement:
+			sb.WriteString("<!subteam^" + e.UsergroupID + ">")
+		case *slack.RichTextSectionBroadcastElement:
+			sb.WriteString("<!" + e.Range + ">")
+		case *slack.RichTextSectionEmojiElement:
+			sb.WriteString(":" + e.Name + ":")
+		case *slack.RichTextSectionDateElement:
+			sb.WriteString(DateToken(e.Timestamp.Time()))
+		}
+	}
+}
+
+// join joins non-empty parts with the separator.
+func join(sep string, parts ...string) string {
+	nonEmpty := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			nonEmpty = append(nonEmpty, p)
+		}
+	}
+
+	return strings.Join(nonEmpty, sep)
+}
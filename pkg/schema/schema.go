@@ -0,0 +1,206 @@
+// Package schema generates JSON Schemas from Go types using reflection,
+// so the documented archive format is always derived from the code.
+package schema
+
+import (
+	"encoding/json"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Draft is the JSON Schema dialect of the generated schemas.
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema is a subset of JSON Schema sufficient to describe Go types.
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+	Defs                 map[string]*Schema `json:"$defs,omitempty"`
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+type generator struct {
+	defs map[string]*Schema
+}
+
+// Generate returns the JSON Schema of the value's type.
+// Named struct types are placed into $defs and referenced,
+// which also takes care of recursive types.
+func Generate(v interface{}, title, description string) *Schema {
+	g := &generator{defs: map[string]*Schema{}}
+
+	s := g.schemaFor(reflect.TypeOf(v))
+	if s.Ref != "" {
+		// inline the root type instead of referencing it
+		name := strings.TrimPrefix(s.Ref, "#/$defs/")
+		s = g.defs[name]
+		delete(g.defs, name)
+	}
+
+	s.Schema = Draft
+	s.Title = title
+	s.Description = description
+	if len(g.defs) > 0 {
+		s.Defs = g.defs
+	}
+
+	return s
+}
+
+func (g *generator) schemaFor(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+
+	// types with custom marshalers may produce any JSON shape
+	if t.Implements(marshalerType) || reflect.PointerTo(t).Implements(marshalerType) {
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// []byte is encoded as base64 string
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: g.schemaFor(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schemaFor(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+
+		name := path.Base(t.PkgPath()) + "." + t.Name()
+		if _, ok := g.defs[name]; !ok {
+			// placeholder breaks cycles for recursive types
+			g.defs[name] = &Schema{}
+			*g.defs[name] = *g.structSchema(t)
+		}
+		return &Schema{Ref: "#/$defs/" + name}
+	default:
+		// interfaces, funcs, channels
+		return &Schema{}
+	}
+}
+
+func (g *generator) structSchema(t reflect.Type) *Schema {
+	s := &Schema{
+		Type:       "object",
+		Properties: map[string]*Schema{},
+	}
+	g.addFields(s, t)
+
+	if len(s.Properties) == 0 {
+		s.Properties = nil
+	}
+
+	return s
+}
+
+// addFields adds the fields of the struct to the schema,
+// following the encoding/json rules for embedded structs:
+// fields of the outer struct take precedence over promoted ones.
+func (g *generator) addFields(s *Schema, t reflect.Type) {
+	var embedded []reflect.Type
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded = append(embedded, ft)
+				continue
+			}
+		}
+
+		if !f.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		if _, ok := s.Properties[name]; ok {
+			continue
+		}
+
+		fs := g.schemaFor(f.Type)
+		if strings.Contains(opts, "string") {
+			fs = &Schema{Type: "string"}
+		}
+
+		if isNilable(f.Type) {
+			// nil pointers, slices and maps are encoded as null
+			fs = nullable(fs)
+		}
+
+		s.Properties[name] = fs
+		if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Pointer {
+			s.Required = append(s.Required, name)
+		}
+	}
+
+	for _, et := range embedded {
+		g.addFields(s, et)
+	}
+}
+
+func isNilable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Map, reflect.Interface:
+		return true
+	}
+
+	return false
+}
+
+// nullable returns the schema which also allows null.
+func nullable(s *Schema) *Schema {
+	if s.Type == "" && s.Ref == "" && s.AnyOf == nil {
+		// the empty schema allows anything
+		return s
+	}
+
+	return &Schema{AnyOf: []*Schema{s, {Type: "null"}}}
+}
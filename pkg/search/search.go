@@ -0,0 +1,200 @@
+// Package search implements a small inverted index over exported messages,
+// stored next to the export, to query the archive by text, user, channel and date.
+package search
+
+import (
+	"encoding/gob"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/chuhlomin/slack-exporter/pkg/atomicfile"
+)
+
+// Doc is an indexed message or thread reply.
+type Doc struct {
+	Channel     string
+	ChannelName string
+	Timestamp   string
+	ThreadTS    string
+	User        string
+	UserName    string
+	Text        string
+	Time        time.Time
+	// Permalink is set when the export includes permalinks.
+	Permalink string
+}
+
+// Index maps terms to the documents containing them.
+// Documents are kept in the order they were added, so neighbors of a document
+// in the same channel are its context.
+type Index struct {
+	Docs     []Doc
+	Postings map[string][]int
+	Built    time.Time
+}
+
+// Query selects documents containing all the terms, sent from From up to (but not including) To,
+// empty fields don't restrict the results.
+type Query struct {
+	Terms   []string
+	Channel string // channel ID or name
+	User    string // user ID or name
+	From    time.Time
+	To      time.Time
+}
+
+// New creates an empty index.
+func New() *Index {
+	return &Index{
+		Postings: map[string][]int{},
+		Built:    time.Now(),
+	}
+}
+
+// Add indexes the document.
+func (ix *Index) Add(doc Doc) {
+	id := len(ix.Docs)
+	ix.Docs = append(ix.Docs, doc)
+
+	seen := map[string]struct{}{}
+	for _, term := range Tokenize(doc.Text) {
+		if _, ok := seen[term]; ok {
+			continue
+		}
+		seen[term] = struct{}{}
+		ix.Postings[term] = append(ix.Postings[term], id)
+	}
+}
+
+// Tokenize splits the text into lowercase terms.
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Search returns IDs of the matching documents ordered by time.
+func (ix *Index) Search(q Query) []int {
+	var ids []int
+
+	if len(q.Terms) == 0 {
+		ids = make([]int, len(ix.Docs))
+		for i := range ids {
+			ids[i] = i
+		}
+	} else {
+		for i, term := range q.Terms {
+			postings := ix.Postings[strings.ToLower(term)]
+			if i == 0 {
+				ids = append([]int(nil), postings...)
+				continue
+			}
+			ids = intersect(ids, postings)
+		}
+	}
+
+	result := ids[:0]
+	for _, id := range ids {
+		if ix.match(ix.Docs[id], q) {
+			result = append(result, id)
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return ix.Docs[result[i]].Time.Before(ix.Docs[result[j]].Time)
+	})
+
+	return result
+}
+
+func (ix *Index) match(doc Doc, q Query) bool {
+	if q.Channel != "" && !strings.EqualFold(q.Channel, doc.Channel) &&
+		!strings.EqualFold(strings.TrimPrefix(q.Channel, "#"), doc.ChannelName) {
+		return false
+	}
+
+	if q.User != "" && !strings.EqualFold(q.User, doc.User) &&
+		!strings.EqualFold(strings.TrimPrefix(q.User, "@"), doc.UserName) {
+		return false
+	}
+
+	if !q.From.IsZero() && doc.Time.Before(q.From) {
+		return false
+	}
+
+	if !q.To.IsZero() && !doc.Time.Before(q.To) {
+		return false
+	}
+
+	return true
+}
+
+// Context returns IDs of up to n documents before and after the document in the same channel.
+func (ix *Index) Context(id, n int) (before, after []int) {
+	channel := ix.Docs[id].Channel
+
+	for i := id - 1; i >= 0 && i >= id-n && ix.Docs[i].Channel == channel; i-- {
+		before = append([]int{i}, before...)
+	}
+
+	for i := id + 1; i < len(ix.Docs) && i <= id+n && ix.Docs[i].Channel == channel; i++ {
+		after = append(after, i)
+	}
+
+	return before, after
+}
+
+// intersect returns IDs present in both sorted slices.
+func intersect(a, b []int) []int {
+	var result []int
+
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+
+	return result
+}
+
+// Load reads the index from the file.
+func Load(path string) (*Index, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open index: %w", err)
+	}
+	defer file.Close()
+
+	var ix Index
+	if err := gob.NewDecoder(file).Decode(&ix); err != nil {
+		return nil, fmt.Errorf("could not decode index: %w", err)
+	}
+
+	return &ix, nil
+}
+
+// Save writes the index to the file.
+func (ix *Index) Save(path string) error {
+	file, err := atomicfile.Create(path)
+	if err != nil {
+		return fmt.Errorf("could not create index: %w", err)
+	}
+	defer file.Abort()
+
+	if err := gob.NewEncoder(file).Encode(ix); err != nil {
+		return fmt.Errorf("could not encode index: %w", err)
+	}
+
+	return file.Commit()
+}
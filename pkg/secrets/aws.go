@@ -0,0 +1,236 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// imdsURL is the EC2 instance metadata service, credentials of the instance role are read from it.
+const imdsURL = "http://169.254.169.254"
+
+// aws reads the secret string (a JSON object) from AWS Secrets Manager.
+// Credentials are taken from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+// or from the instance role; the region from the ARN, AWS_REGION or AWS_DEFAULT_REGION.
+type aws struct {
+	client *http.Client
+	secret string
+	region string
+}
+
+type awsCredentials struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	Token           string `json:"Token"`
+}
+
+func newAWS(client *http.Client, secret string) (*aws, error) {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+
+	// arn:aws:secretsmanager:<region>:<account>:secret:<name>
+	if parts := strings.Split(secret, ":"); len(parts) > 3 && parts[0] == "arn" {
+		region = parts[3]
+	}
+
+	if region == "" {
+		return nil, fmt.Errorf("%w: AWS_REGION is required", errMissingConfig)
+	}
+
+	return &aws{client: client, secret: secret, region: region}, nil
+}
+
+func (a *aws) fetch(ctx context.Context) (map[string]string, time.Duration, error) {
+	creds, err := a.credentials(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	body, err := json.Marshal(map[string]string{"SecretId": a.secret})
+	if err != nil {
+		return nil, 0, fmt.Errorf("could not marshal request: %w", err)
+	}
+
+	host := "secretsmanager." + a.region + ".amazonaws.com"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://"+host+"/", bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, fmt.Errorf("could not create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	signV4(req, body, creds, a.region, "secretsmanager", time.Now().UTC())
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("could not send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("could not read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("%w: %d %s", errBadStatus, resp.StatusCode, b)
+	}
+
+	var result struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := json.Unmarshal(b, &result); err != nil {
+		return nil, 0, fmt.Errorf("could not decode response: %w", err)
+	}
+
+	var values map[string]string
+	if err := json.Unmarshal([]byte(result.SecretString), &values); err != nil {
+		return nil, 0, fmt.Errorf("could not decode secret, expected JSON object with string values: %w", err)
+	}
+
+	return values, 0, nil
+}
+
+// credentials returns the credentials from the environment or of the instance role (IMDSv2).
+func (a *aws) credentials(ctx context.Context) (awsCredentials, error) {
+	if id := os.Getenv("AWS_ACCESS_KEY_ID"); id != "" {
+		return awsCredentials{
+			AccessKeyID:     id,
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			Token:           os.Getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+
+	var creds awsCredentials
+
+	token, err := a.imds(ctx, http.MethodPut, "/latest/api/token", "")
+	if err != nil {
+		return creds, fmt.Errorf("could not get AWS credentials from the environment or instance metadata: %w", err)
+	}
+
+	role, err := a.imds(ctx, http.MethodGet, "/latest/meta-data/iam/security-credentials/", token)
+	if err != nil {
+		return creds, fmt.Errorf("could not get instance role: %w", err)
+	}
+
+	content, err := a.imds(ctx, http.MethodGet, "/latest/meta-data/iam/security-credentials/"+strings.TrimSpace(role), token)
+	if err != nil {
+		return creds, fmt.Errorf("could not get instance role credentials: %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(content), &creds); err != nil {
+		return creds, fmt.Errorf("could not decode instance role credentials: %w", err)
+	}
+
+	return creds, nil
+}
+
+func (a *aws) imds(ctx context.Context, method, path, token string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, imdsURL+path, http.NoBody)
+	if err != nil {
+		return "", fmt.Errorf("could not create request: %w", err)
+	}
+
+	if token == "" {
+		req.Header.Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", "300")
+	} else {
+		req.Header.Set("X-Aws-Ec2-Metadata-Token", token)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("could not send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("could not read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: %d", errBadStatus, resp.StatusCode)
+	}
+
+	return string(b), nil
+}
+
+// signV4 signs the request with AWS Signature Version 4.
+func signV4(req *http.Request, body []byte, creds awsCredentials, region, service string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.Token != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.Token)
+	}
+
+	payloadHash := sha256Hex(body)
+
+	signedHeaders := []string{"content-type", "host", "x-amz-date"}
+	if creds.Token != "" {
+		signedHeaders = append(signedHeaders, "x-amz-security-token")
+	}
+	signedHeaders = append(signedHeaders, "x-amz-target")
+
+	var canonicalHeaders strings.Builder
+	for _, h := range signedHeaders {
+		value := req.Header.Get(h)
+		if h == "host" {
+			value = req.URL.Host
+		}
+		canonicalHeaders.WriteString(h + ":" + strings.TrimSpace(value) + "\n")
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		"/",
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, strings.Join(signedHeaders, ";"), signature,
+	))
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
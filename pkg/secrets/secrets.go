@@ -0,0 +1,104 @@
+// Package secrets fetches credentials from HashiCorp Vault or AWS Secrets Manager
+// using their HTTP APIs, without official clients, so no credentials have to be stored
+// in environment variables or files on the host running the export.
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	errUnknownProvider = fmt.Errorf("unknown secrets provider, expected vault:<path> or aws:<secret>")
+	errBadStatus       = fmt.Errorf("bad status code")
+	errMissingConfig   = fmt.Errorf("missing configuration")
+)
+
+// source fetches the key-value pairs of the secret and reports how long they are valid,
+// zero if the source doesn't know.
+type source interface {
+	fetch(ctx context.Context) (map[string]string, time.Duration, error)
+}
+
+// Store caches the secret in memory and fetches it again when it expires,
+// so rotated credentials are picked up by long-running exports.
+type Store struct {
+	mu      sync.Mutex
+	src     source
+	ttl     time.Duration
+	values  map[string]string
+	expires time.Time
+}
+
+// Open creates the Store for the secret reference: vault:<path> (like vault:secret/data/slack)
+// or aws:<secret name or ARN>. Values are cached for ttl unless the provider sets a shorter lease.
+// Requests are sent with the transport, like the one with the proxy.
+func Open(ref string, ttl time.Duration, transport http.RoundTripper) (*Store, error) {
+	provider, name, _ := strings.Cut(ref, ":")
+	if name == "" {
+		return nil, errUnknownProvider
+	}
+
+	client := &http.Client{Transport: transport, Timeout: 30 * time.Second}
+
+	var (
+		src source
+		err error
+	)
+	switch provider {
+	case "vault":
+		src, err = newVault(client, name)
+	case "aws":
+		src, err = newAWS(client, name)
+	default:
+		return nil, errUnknownProvider
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Store{src: src, ttl: ttl}, nil
+}
+
+// Get returns the value of the key, empty if the secret doesn't have it.
+func (s *Store) Get(ctx context.Context, key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.values == nil || time.Now().After(s.expires) {
+		if err := s.refresh(ctx); err != nil {
+			return "", err
+		}
+	}
+
+	return s.values[key], nil
+}
+
+// Refresh fetches the secret ignoring the cache, like after the credentials were rejected.
+func (s *Store) Refresh(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.refresh(ctx)
+}
+
+func (s *Store) refresh(ctx context.Context) error {
+	values, lease, err := s.src.fetch(ctx)
+	if err != nil {
+		return fmt.Errorf("could not fetch secret: %w", err)
+	}
+
+	ttl := s.ttl
+	if lease > 0 && (ttl <= 0 || lease < ttl) {
+		ttl = lease
+	}
+
+	s.values = values
+	s.expires = time.Now().Add(ttl)
+
+	return nil
+}
@@ -0,0 +1,127 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// vault reads the secret from the KV engine (version 1 or 2) of HashiCorp Vault
+// at VAULT_ADDR with VAULT_TOKEN, renewing the token on every fetch when it's renewable.
+type vault struct {
+	client *http.Client
+	addr   string
+	token  string
+	path   string
+}
+
+func newVault(client *http.Client, path string) (*vault, error) {
+	addr := os.Getenv("VAULT_ADDR")
+	token := os.Getenv("VAULT_TOKEN")
+	if addr == "" || token == "" {
+		return nil, fmt.Errorf("%w: VAULT_ADDR and VAULT_TOKEN are required", errMissingConfig)
+	}
+
+	return &vault{
+		client: client,
+		addr:   strings.TrimSuffix(addr, "/"),
+		token:  token,
+		path:   strings.Trim(path, "/"),
+	}, nil
+}
+
+func (v *vault) fetch(ctx context.Context) (map[string]string, time.Duration, error) {
+	if err := v.renewToken(ctx); err != nil {
+		return nil, 0, err
+	}
+
+	var resp struct {
+		LeaseDuration int             `json:"lease_duration"`
+		Data          json.RawMessage `json:"data"`
+	}
+	if err := v.do(ctx, http.MethodGet, "/v1/"+v.path, &resp); err != nil {
+		return nil, 0, err
+	}
+
+	// KV version 2 nests the values into data.data next to the metadata
+	var kv2 struct {
+		Data     map[string]string `json:"data"`
+		Metadata json.RawMessage   `json:"metadata"`
+	}
+	if err := json.Unmarshal(resp.Data, &kv2); err == nil && kv2.Metadata != nil {
+		return kv2.Data, time.Duration(resp.LeaseDuration) * time.Second, nil
+	}
+
+	var kv1 map[string]string
+	if err := json.Unmarshal(resp.Data, &kv1); err != nil {
+		return nil, 0, fmt.Errorf("could not decode secret, expected string values: %w", err)
+	}
+
+	return kv1, time.Duration(resp.LeaseDuration) * time.Second, nil
+}
+
+// renewToken extends the TTL of the token, so it doesn't expire between fetches.
+func (v *vault) renewToken(ctx context.Context) error {
+	var lookup struct {
+		Data struct {
+			Renewable bool `json:"renewable"`
+		} `json:"data"`
+	}
+	if err := v.do(ctx, http.MethodGet, "/v1/auth/token/lookup-self", &lookup); err != nil {
+		return fmt.Errorf("could not look up token: %w", err)
+	}
+
+	if !lookup.Data.Renewable {
+		return nil
+	}
+
+	if err := v.do(ctx, http.MethodPost, "/v1/auth/token/renew-self", nil); err != nil {
+		return fmt.Errorf("could not renew token: %w", err)
+	}
+
+	return nil
+}
+
+func (v *vault) do(ctx context.Context, method, path string, result interface{}) error {
+	var body io.Reader = http.NoBody
+	if method == http.MethodPost {
+		body = bytes.NewReader([]byte("{}"))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, v.addr+path, body)
+	if err != nil {
+		return fmt.Errorf("could not create request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("could not read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %d %s", errBadStatus, resp.StatusCode, b)
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	if err := json.Unmarshal(b, result); err != nil {
+		return fmt.Errorf("could not decode response: %w", err)
+	}
+
+	return nil
+}
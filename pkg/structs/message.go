@@ -3,9 +3,14 @@
 package structs
 
 import (
+	"compress/gzip"
 	"errors"
+	"fmt"
+	"io"
 	"log"
 	"math"
+	"os"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -21,6 +26,146 @@ var errNoDotInTimestamp = errors.New("no dot in timestamp")
 type Message struct {
 	slack.Message
 	Replies []slack.Message `json:"replies,omitempty"`
+	// Call is the huddle or the call the message is about, slack-go doesn't decode them.
+	Call *Call `json:"call,omitempty"`
+	// Workflow has the fields of the message posted by Workflow Builder or another app.
+	Workflow *Workflow `json:"workflow,omitempty"`
+	// LocalFiles are files of the message and its replies by ID, with --download-files.
+	LocalFiles map[string]LocalFile `json:"local_files,omitempty"`
+	// ExternalFiles are files of the message and its replies stored outside Slack (like Google Drive) by ID.
+	ExternalFiles map[string]ExternalFile `json:"external_files,omitempty"`
+	// SharedMessages are messages shared (forwarded) into the message and its replies.
+	SharedMessages []SharedMessage `json:"shared_messages,omitempty"`
+	// Unfurls are previews of links of the message and its replies.
+	Unfurls []Unfurl `json:"unfurls,omitempty"`
+}
+
+// Unfurl is the preview of the link Slack adds to the message as the attachment.
+type Unfurl struct {
+	// SharedIn is ts of the message or reply the link is in.
+	SharedIn    string `json:"shared_in"`
+	URL         string `json:"url"`
+	ServiceName string `json:"service_name,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	// ThumbURL is the preview image, often served by Slack's image proxy.
+	ThumbURL string `json:"thumb_url,omitempty"`
+	// Thumbnail is the path of the downloaded preview image relative to the output directory,
+	// with --unfurl-thumbnails.
+	Thumbnail string `json:"thumbnail,omitempty"`
+}
+
+// SharedMessage is the message shared into another one, Slack keeps its permalink with the text
+// and the author at the time it was shared.
+type SharedMessage struct {
+	// SharedIn is ts of the message or reply the message is shared into.
+	SharedIn        string `json:"shared_in"`
+	Channel         string `json:"channel"`
+	Timestamp       string `json:"ts"`
+	ThreadTimestamp string `json:"thread_ts,omitempty"`
+	User            string `json:"user,omitempty"`
+	Author          string `json:"author,omitempty"`
+	Text            string `json:"text,omitempty"`
+	Permalink       string `json:"permalink"`
+	// Message is the shared message as it is now, with --shared-messages; empty if it's deleted or can't be read.
+	Message *slack.Message `json:"message,omitempty"`
+}
+
+// Statuses of LocalFile.
+const (
+	FileDownloaded = "downloaded"
+	FileFailed     = "failed"
+	// FileDeleted, FileAccessDenied and FileNotFound are why the file is missing:
+	// it's deleted (or returns 410), hidden by the plan limits or returns 401 or 403, or returns 404.
+	FileDeleted      = "deleted"
+	FileAccessDenied = "access_denied"
+	FileNotFound     = "not_found"
+	// FileSkipped is the file filtered out by its size or type, or the file without content,
+	// like the external one without the token of its provider.
+	FileSkipped = "skipped"
+)
+
+// LocalFile is where the file of the message is in the export.
+type LocalFile struct {
+	// Path is relative to the output directory, set for downloaded files.
+	Path   string `json:"path,omitempty"`
+	Status string `json:"status"`
+	// Thumbnail is the path of the thumbnail relative to the output directory, with --thumbnails.
+	Thumbnail string `json:"thumbnail,omitempty"`
+}
+
+// Providers of ExternalFile.
+const (
+	ProviderGoogleDrive = "gdrive"
+	ProviderDropbox     = "dropbox"
+)
+
+// ExternalFile is the file shared from the other service, Slack keeps only the link to it.
+type ExternalFile struct {
+	URL string `json:"url"`
+	// Provider is like gdrive, dropbox, box or onedrive.
+	Provider string `json:"provider,omitempty"`
+	Title    string `json:"title,omitempty"`
+}
+
+// Field is the named value of the structured message, like the answer to the workflow form question.
+type Field struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Workflow is the message posted by the workflow, the fields come from the message metadata
+// or from the section fields of the form submission.
+type Workflow struct {
+	Name      string  `json:"name,omitempty"`
+	EventType string  `json:"event_type,omitempty"`
+	Fields    []Field `json:"fields"`
+}
+
+// List is the Slack List shared in the channel (a file of the "list" type).
+type List struct {
+	Columns []ListColumn `json:"columns"`
+	Items   []ListItem   `json:"items"`
+}
+
+// ListColumn is the column of the list, like "Status" of the "select" type.
+type ListColumn struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// ListItem is the row of the list, Values are in the order of List.Columns.
+type ListItem struct {
+	ID        string   `json:"id"`
+	CreatedBy string   `json:"created_by,omitempty"`
+	Values    []string `json:"values"`
+}
+
+// Kinds of calls.
+const (
+	CallKindHuddle = "huddle"
+	CallKindCall   = "call"
+)
+
+// Call describes the huddle (room of huddle_thread message) or the call (call block, like Zoom).
+type Call struct {
+	ID        string `json:"id"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name,omitempty"`
+	CreatedBy string `json:"created_by,omitempty"`
+	// DateStart and DateEnd are Unix times, DateEnd is zero while the call is going on.
+	DateStart int64 `json:"date_start,omitempty"`
+	DateEnd   int64 `json:"date_end,omitempty"`
+	// Duration is in seconds.
+	Duration int64 `json:"duration,omitempty"`
+	// Participants are IDs of users who joined the call at any time.
+	Participants []string `json:"participants,omitempty"`
+	// ExternalParticipants are names of participants without Slack accounts.
+	ExternalParticipants []string `json:"external_participants,omitempty"`
+	JoinURL              string   `json:"join_url,omitempty"`
+	// FileIDs are recordings, transcripts and notes of the call, also added to the files of the message.
+	FileIDs []string `json:"file_ids,omitempty"`
 }
 
 func (m *Message) SameContext(m2 Message) bool {
@@ -57,10 +202,268 @@ func extractUnixTimestamp(ts string) (int64, error) {
 	return strconv.ParseInt(ts, 10, 64)
 }
 
+// Subtypes of thread replies also sent to the channel, reply_broadcast is used by older messages.
+const (
+	SubTypeThreadBroadcast = "thread_broadcast"
+	SubTypeReplyBroadcast  = "reply_broadcast"
+)
+
+// IsBroadcast reports whether the message is the thread reply also sent to the channel.
+// Such reply is both in the channel history and in replies of the thread,
+// renderers show the channel copy as a reference to the thread instead of the duplicate.
+func IsBroadcast(msg slack.Message) bool {
+	return msg.SubType == SubTypeThreadBroadcast || msg.SubType == SubTypeReplyBroadcast
+}
+
+// User statuses describe users who don't belong to the workspace
+// or whose records are incomplete.
+const (
+	UserStatusDeleted  = "deleted"
+	UserStatusExternal = "external"
+	UserStatusNotFound = "not_found"
+)
+
 // Data struct used to marshal/unmarshal JSON data.
 type Data struct {
-	Channel  slack.Channel          `json:"channel"`
-	Messages []Message              `json:"messages"`
-	Users    map[string]*slack.User `json:"users"`
-	Files    map[string]string      `json:"files"`
+	// SchemaVersion is the SchemaVersion the channel was exported (or migrated) with, 0 before it was versioned.
+	SchemaVersion int                    `json:"schema_version,omitempty"`
+	Channel       slack.Channel          `json:"channel"`
+	Members       []string               `json:"members,omitempty"`
+	Messages      []Message              `json:"messages"`
+	Users         map[string]*slack.User `json:"users"`
+	UserStatus    map[string]string      `json:"user_status,omitempty"`
+	TeamProfile   *slack.TeamProfile     `json:"team_profile,omitempty"`
+	Files         map[string]string      `json:"files"`
+	// FilePaths are paths of the downloaded files relative to the output directory by ID,
+	// like C0123/F0123-report.pdf; exports without them have files in the directory of the channel.
+	FilePaths map[string]string `json:"file_paths,omitempty"`
+	// MissingFiles are why the files attached to messages were not downloaded by ID:
+	// deleted, access_denied, not_found or failed.
+	MissingFiles map[string]string `json:"missing_files,omitempty"`
+	// Thumbnails are paths of thumbnails of the downloaded images and videos relative
+	// to the output directory by ID, like thumbnails/F0123.jpg, with --thumbnails.
+	Thumbnails   map[string]string          `json:"thumbnails,omitempty"`
+	FileComments map[string][]slack.Comment `json:"file_comments,omitempty"`
+	// Lists are Slack Lists shared in the channel by file ID.
+	Lists map[string]*List `json:"lists,omitempty"`
+	// Teams are workspaces of the shared channel and of authors of its messages by ID.
+	Teams map[string]*Team `json:"teams,omitempty"`
+	// Pins are messages and files pinned in the channel, with --pins.
+	Pins []slack.Item `json:"pins,omitempty"`
+	// MessageCount, ReplyCount and FileMetadata replace messages in metadata-only exports
+	MessageCount int          `json:"message_count,omitempty"`
+	ReplyCount   int          `json:"reply_count,omitempty"`
+	FileMetadata []slack.File `json:"file_metadata,omitempty"`
+}
+
+// Team is the workspace connected to the shared channel.
+type Team struct {
+	ID     string `json:"id"`
+	Name   string `json:"name,omitempty"`
+	Domain string `json:"domain,omitempty"`
+	// External is set for workspaces of other organizations (Slack Connect).
+	External bool `json:"external"`
+}
+
+// Saved is the personal archive of the items saved (starred) by the authed user.
+type Saved struct {
+	Items []SavedItem            `json:"items"`
+	Users map[string]*slack.User `json:"users"`
+	// Files are names of the downloaded files by ID, in the saved/ directory.
+	Files map[string]string `json:"files"`
+	// FilePaths are paths of the downloaded files relative to the output directory by ID.
+	FilePaths map[string]string `json:"file_paths,omitempty"`
+}
+
+// SavedItem is the saved message (with its thread) or file.
+type SavedItem struct {
+	Type    string      `json:"type"`
+	Channel string      `json:"channel,omitempty"`
+	Message *Message    `json:"message,omitempty"`
+	File    *slack.File `json:"file,omitempty"`
+}
+
+// SchemaVersion is the version of the layout of <channel>.json and the structs of this package,
+// increased on every change which older readers would misinterpret.
+const SchemaVersion = 1
+
+// ChannelManifest describes how the channel was exported, so later versions of the exporter
+// and other tools can interpret exports made long ago.
+type ChannelManifest struct {
+	Tool          string    `json:"tool"`
+	Version       string    `json:"version"`
+	SchemaVersion int       `json:"schema_version"`
+	Channel       string    `json:"channel"`
+	Exported      time.Time `json:"exported"`
+	Format        string    `json:"format"`
+	// Filters are the flags limiting which messages and files were exported, like since or user.
+	Filters  map[string]string `json:"filters,omitempty"`
+	Messages int               `json:"messages"`
+	Replies  int               `json:"replies"`
+	Files    int               `json:"files"`
+	Users    int               `json:"users"`
+	// Scopes are the scopes of the token, as reported by Slack.
+	Scopes []string `json:"scopes,omitempty"`
+	// Archived is set for channels archived at the time of the export (with --include-archived).
+	Archived bool `json:"archived,omitempty"`
+	// Workspace is the workspace the channel was exported from.
+	Workspace *Workspace `json:"workspace,omitempty"`
+	// ExportedBy is the user (or the bot) of the token the channel was exported with.
+	ExportedBy *Exporter `json:"exported_by,omitempty"`
+}
+
+// Workspace is the workspace of the token, from auth.test and team.info (requires team:read scope).
+type Workspace struct {
+	ID           string `json:"id"`
+	Name         string `json:"name,omitempty"`
+	Domain       string `json:"domain,omitempty"`
+	URL          string `json:"url,omitempty"`
+	EmailDomain  string `json:"email_domain,omitempty"`
+	Icon         string `json:"icon,omitempty"`
+	EnterpriseID string `json:"enterprise_id,omitempty"`
+}
+
+// Branding is the identity of the workspace and of its Enterprise Grid org, shown by the HTML viewers.
+type Branding struct {
+	Workspace *Workspace `json:"workspace"`
+	// Icon is the path of the downloaded icon of the workspace relative to the output directory.
+	Icon       string     `json:"icon,omitempty"`
+	Enterprise *Workspace `json:"enterprise,omitempty"`
+	// EnterpriseIcon is the path of the downloaded icon of the org relative to the output directory.
+	EnterpriseIcon string `json:"enterprise_icon,omitempty"`
+}
+
+// Exporter is the identity of the token, from auth.test.
+type Exporter struct {
+	UserID string `json:"user_id"`
+	User   string `json:"user,omitempty"`
+	BotID  string `json:"bot_id,omitempty"`
+}
+
+// ChannelMetadata is the channel info at the time of the export with the history of its settings.
+type ChannelMetadata struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	Created  time.Time `json:"created"`
+	Creator  string    `json:"creator,omitempty"`
+	Archived bool      `json:"archived"`
+	Private  bool      `json:"private"`
+	// Shared is set for channels shared with other workspaces of the organization (OrgShared)
+	// or other organizations (ExtShared, Slack Connect).
+	Shared           bool     `json:"shared"`
+	ExtShared        bool     `json:"ext_shared"`
+	OrgShared        bool     `json:"org_shared"`
+	SharedTeamIDs    []string `json:"shared_team_ids,omitempty"`
+	ConnectedTeamIDs []string `json:"connected_team_ids,omitempty"`
+	Topic            Setting  `json:"topic"`
+	Purpose          Setting  `json:"purpose"`
+	// History is changes of the topic, purpose and name, archiving and unarchiving found
+	// in the exported messages (of this and previous exports), oldest first.
+	History  []ChannelChange `json:"history,omitempty"`
+	Exported time.Time       `json:"exported"`
+}
+
+// Setting is the current topic or purpose of the channel with who set it and when.
+type Setting struct {
+	Value string     `json:"value"`
+	SetBy string     `json:"set_by,omitempty"`
+	Set   *time.Time `json:"set,omitempty"`
+}
+
+// Types of the channel changes.
+const (
+	ChannelChangeTopic     = "topic"
+	ChannelChangePurpose   = "purpose"
+	ChannelChangeName      = "name"
+	ChannelChangeArchive   = "archive"
+	ChannelChangeUnarchive = "unarchive"
+)
+
+// ChannelChange is the change of the channel setting posted to the channel.
+type ChannelChange struct {
+	Type      string `json:"type"`
+	Value     string `json:"value,omitempty"`
+	OldValue  string `json:"old_value,omitempty"`
+	User      string `json:"user,omitempty"`
+	Timestamp string `json:"ts"`
+}
+
+// SidebarSection is a section of the Slack sidebar of the authed user.
+type SidebarSection struct {
+	ID          string `json:"channel_section_id"`
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Emoji       string `json:"emoji,omitempty"`
+	NextID      string `json:"next_channel_section_id,omitempty"`
+	LastUpdated int64  `json:"last_updated,omitempty"`
+	Channels    struct {
+		IDs   []string `json:"channel_ids"`
+		Count int      `json:"count"`
+	} `json:"channel_ids_page"`
+}
+
+var channelFilename = regexp.MustCompile(`^[CDG][A-Z0-9]+\.json(\.gz)?$`)
+
+// IsChannelFile reports whether the file in the output directory contains the channel export
+// (<channel>.json, or <channel>.json.gz written with --compress), as opposed to other outputs like sidebar.json.
+func IsChannelFile(name string) bool {
+	return channelFilename.MatchString(name)
+}
+
+// gzipFile closes both the gzip reader and the file under it.
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (gf gzipFile) Close() error {
+	gf.Reader.Close()
+	return gf.file.Close()
+}
+
+// OpenChannelFile opens the channel export, decompressing files with the .gz extension.
+func OpenChannelFile(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasSuffix(path, ".gz") {
+		return file, nil
+	}
+
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("could not decompress file: %w", err)
+	}
+
+	return gzipFile{Reader: zr, file: file}, nil
+}
+
+// ReadChannelFile reads the whole channel export like os.ReadFile, decompressing files with the .gz extension.
+func ReadChannelFile(path string) ([]byte, error) {
+	file, err := OpenChannelFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return io.ReadAll(file)
+}
+
+// IntegrationLog is the change of the app or integration of the workspace, like added or removed.
+type IntegrationLog struct {
+	AppID       string `json:"app_id,omitempty"`
+	AppType     string `json:"app_type,omitempty"`
+	ServiceID   string `json:"service_id,omitempty"`
+	ServiceType string `json:"service_type,omitempty"`
+	UserID      string `json:"user_id"`
+	UserName    string `json:"user_name"`
+	Channel     string `json:"channel,omitempty"`
+	// Date is the Unix time of the change as a string.
+	Date       string `json:"date"`
+	ChangeType string `json:"change_type"`
+	Reason     string `json:"reason,omitempty"`
+	Scope      string `json:"scope,omitempty"`
 }
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// preflightSample is the number of the latest messages the rate of messages of the channel is estimated from.
+const preflightSample = 100
+
+var errNotConfirmed = fmt.Errorf("export is not confirmed, re-run with --yes to skip the confirmation")
+
+// channelEstimate is the approximate volume of the channel reported before the export.
+type channelEstimate struct {
+	Name         string
+	Created      time.Time
+	LastActivity time.Time
+	// Messages is the number of messages (without thread replies), exact for channels
+	// with fewer messages than the sample.
+	Messages int
+	Exact    bool
+}
+
+// preflight reports the estimated number of messages of the channels (by IDs and listed by types)
+// before the export and asks to confirm the export when there are more than --preflight-threshold of them,
+// so the export which would take days isn't started by accident.
+// It's skipped with --yes and without the terminal to ask in, like in cron jobs.
+func preflight(c *SlackClient, ids []string, channels []slack.Channel) error {
+	if cfg.Yes || cfg.PreflightThreshold <= 0 || !isTerminal(os.Stdin) {
+		return nil
+	}
+
+	for _, id := range ids {
+		channel, err := c.GetChannelInfo(id)
+		if err != nil {
+			// the channel is reported by the export
+			continue
+		}
+		if !channel.IsArchived || cfg.IncludeArchived {
+			channels = append(channels, *channel)
+		}
+	}
+
+	var (
+		estimates []channelEstimate
+		total     int
+	)
+	for _, channel := range channels {
+		if checkpoint.Done(channel.ID) {
+			continue
+		}
+
+		e, err := c.estimateMessages(channel)
+		if err != nil {
+			if isTokenRevoked(err) {
+				return err
+			}
+			log.Printf("Could not estimate messages of channel %q: %v", channel.ID, err)
+			continue
+		}
+
+		estimates = append(estimates, e)
+		total += e.Messages
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHANNEL\tCREATED\tLAST ACTIVITY\tMESSAGES")
+	for _, e := range estimates {
+		lastActivity, messages := "-", fmt.Sprintf("~%d", e.Messages)
+		if !e.LastActivity.IsZero() {
+			lastActivity = e.LastActivity.In(cfg.Timezone.Location).Format(dateFormat)
+		}
+		if e.Exact {
+			messages = fmt.Sprint(e.Messages)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", e.Name, e.Created.In(cfg.Timezone.Location).Format(dateFormat), lastActivity, messages)
+	}
+	tw.Flush()
+
+	if total <= cfg.PreflightThreshold {
+		return nil
+	}
+
+	fmt.Printf("About %d messages (without thread replies) in %d channels, continue? [y/N] ", total, len(estimates))
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return errNotConfirmed
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+
+	return errNotConfirmed
+}
+
+// estimateMessages estimates the number of messages of the channel between --since and --until
+// from the rate of its latest messages, assuming the channel was as active since it was created.
+func (sc *SlackClient) estimateMessages(channel slack.Channel) (channelEstimate, error) {
+	e := channelEstimate{
+		Name:    first(channel.Name, channel.User, channel.ID),
+		Created: channel.Created.Time(),
+	}
+
+	if err := sc.limiters.forMethod("conversations.history").Wait(sc.ctx); err != nil {
+		return e, fmt.Errorf("rate limit error: %w", err)
+	}
+
+	oldest, until := historyRange()
+	resp, err := sc.api.GetConversationHistoryContext(sc.ctx, &slack.GetConversationHistoryParameters{
+		ChannelID: channel.ID,
+		Limit:     preflightSample,
+		Oldest:    oldest,
+		Latest:    until,
+	})
+	if err != nil {
+		return e, err
+	}
+
+	e.Messages = len(resp.Messages)
+	e.Exact = !resp.HasMore
+	if len(resp.Messages) == 0 {
+		return e, nil
+	}
+
+	var earliest, latest time.Time
+	for _, msg := range resp.Messages {
+		t := parseTimestamp(msg.Timestamp)
+		if earliest.IsZero() || t.Before(earliest) {
+			earliest = t
+		}
+		if t.After(latest) {
+			latest = t
+		}
+	}
+	e.LastActivity = latest
+
+	if e.Exact || !latest.After(earliest) {
+		return e, nil
+	}
+
+	start := e.Created
+	if cfg.Since.After(start) {
+		start = cfg.Since.Time
+	}
+
+	rate := float64(len(resp.Messages)-1) / latest.Sub(earliest).Seconds()
+	e.Messages += int(rate * max(earliest.Sub(start).Seconds(), 0))
+
+	return e, nil
+}
+
+// isTerminal reports whether the file is a terminal, like stdin of the interactive run.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
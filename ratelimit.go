@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/chuhlomin/slack-exporter/pkg/aimd"
+)
+
+// Slack API rate limit tiers, requests per minute (https://api.slack.com/apis/rate-limits).
+const (
+	tier2 = 20
+	tier3 = 50
+	tier4 = 100
+	// tierFiles paces file downloads, they are not Web API methods and have no published limit.
+	tierFiles = 100
+)
+
+// limiterFiles is the key of the limiter of file downloads.
+const limiterFiles = "files"
+
+// methodTiers are tiers of the Slack API methods used by the exporter, other methods are Tier 3.
+var methodTiers = map[string]int{
+	"admin.conversations.search": tier2,
+	"admin.emoji.list":           tier2,
+	"admin.teams.list":           tier2,
+	"auth.test":                  tier4,
+	"chat.getPermalink":          tier4,
+	"conversations.history":      tier3,
+	"conversations.info":         tier3,
+	"conversations.list":         tier2,
+	"conversations.members":      tier4,
+	"conversations.replies":      tier3,
+	"emoji.list":                 tier2,
+	"files.info":                 tier4,
+	"pins.list":                  tier2,
+	"reminders.list":             tier2,
+	"slackLists.items.list":      tier3,
+	"stars.list":                 tier3,
+	"team.accessLogs":            tier2,
+	"team.info":                  tier3,
+	"team.integrationLogs":       tier2,
+	"team.profile.get":           tier3,
+	"users.channelSections.list": tier3,
+	"users.info":                 tier4,
+	"users.list":                 tier2,
+	"users.profile.get":          tier4,
+}
+
+// rateLimiters keeps the limiter of every tier, so Tier 4 methods are not held back
+// by the pace of Tier 2 ones; every limiter speeds up and slows down on its own.
+type rateLimiters map[string]*aimd.Limiter
+
+func newRateLimiters() rateLimiters {
+	limiters := rateLimiters{}
+
+	for _, perMinute := range []int{tier2, tier3, tier4} {
+		limiters[tierKey(perMinute)] = newTierLimiter(perMinute)
+	}
+	limiters[limiterFiles] = newTierLimiter(tierFiles)
+
+	return limiters
+}
+
+// newTierLimiter starts at the rate of the tier and may speed up to --max-rate,
+// which is set for Tier 3 and scaled for other tiers.
+func newTierLimiter(perMinute int) *aimd.Limiter {
+	return aimd.New(
+		rate.Every(time.Minute/time.Duration(perMinute)),
+		rate.Every(time.Minute/time.Duration(max(perMinute/10, 1))),
+		rate.Limit(cfg.MaxRate*float64(perMinute)/tier3/60),
+	)
+}
+
+func tierKey(perMinute int) string {
+	switch perMinute {
+	case tier2:
+		return "tier2"
+	case tier4:
+		return "tier4"
+	default:
+		return "tier3"
+	}
+}
+
+// forMethod returns the limiter of the tier of the Slack API method.
+func (rl rateLimiters) forMethod(method string) *aimd.Limiter {
+	return rl[tierKey(methodTiers[method])]
+}
+
+// Wait waits for the limiter of the tier of the Slack API method, rateLimiters is the exporter.Limiter.
+func (rl rateLimiters) Wait(ctx context.Context, method string) error {
+	return rl.forMethod(method).Wait(ctx)
+}
+
+// forRequest returns the limiter of the Slack API method of the request, file downloads have their own.
+func (rl rateLimiters) forRequest(req *http.Request) *aimd.Limiter {
+	if method, ok := strings.CutPrefix(req.URL.Path, "/api/"); ok && req.URL.Host == "slack.com" {
+		return rl.forMethod(method)
+	}
+
+	return rl[limiterFiles]
+}
+
+// Transport returns the http.RoundTripper which passes the request through the transport
+// of its limiter, so throttled requests slow down only their tier.
+func (rl rateLimiters) Transport(next http.RoundTripper) http.RoundTripper {
+	transports := make(map[*aimd.Limiter]http.RoundTripper, len(rl))
+	for _, l := range rl {
+		transports[l] = l.Transport(next)
+	}
+
+	return tierTransport{limiters: rl, transports: transports}
+}
+
+type tierTransport struct {
+	limiters   rateLimiters
+	transports map[*aimd.Limiter]http.RoundTripper
+}
+
+func (t tierTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.transports[t.limiters.forRequest(req)].RoundTrip(req)
+}
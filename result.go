@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/slack-go/slack"
+
+	"github.com/chuhlomin/slack-exporter/pkg/redact"
+)
+
+// resultFilename is the outcome of the last export run for wrappers and cron jobs.
+const resultFilename = "result.json"
+
+// Exit codes of the export, so wrappers can tell failures apart.
+const (
+	exitOK    = 0
+	exitError = 1
+	// exitAuth is the token which is missing, revoked or expired.
+	exitAuth = 2
+	// exitRateLimit is Slack rate limiting requests after all retries.
+	exitRateLimit = 3
+	// exitPartial is the export finished with more failed items than --max-failures
+	// or with failed workspaces.
+	exitPartial = 4
+	// exitDisk is the full disk or --max-total-size.
+	exitDisk = 5
+)
+
+// Categories of the error of the run in result.json.
+var exitCategories = map[int]string{
+	exitOK:        "ok",
+	exitError:     "error",
+	exitAuth:      "auth",
+	exitRateLimit: "rate_limit",
+	exitPartial:   "partial",
+	exitDisk:      "disk",
+}
+
+// exportRun is set when the app exports messages rather than runs a command.
+var exportRun bool
+
+// runResult is written to result.json after every export run.
+type runResult struct {
+	ExitCode int    `json:"exit_code"`
+	Category string `json:"category"`
+	Error    string `json:"error,omitempty"`
+	// Failures are items of errors.json by "<kind>/<status>", like "file/failed".
+	Failures map[string]int `json:"failures,omitempty"`
+	Summary  runSummary     `json:"summary"`
+}
+
+// exitCode returns the exit code of the error of the run.
+func exitCode(err error) int {
+	var rateLimitErr *slack.RateLimitedError
+
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, errTokenRevoked), isTokenRevoked(err),
+		errors.Is(err, errMissingClientIDAndSecret), errors.Is(err, errOrgToken):
+		return exitAuth
+	case errors.As(err, &rateLimitErr):
+		return exitRateLimit
+	case isOutOfSpace(err), errors.Is(err, syscall.ENOSPC):
+		return exitDisk
+	case errors.Is(err, errTooManyFailures), errors.Is(err, errWorkspacesFailed):
+		return exitPartial
+	default:
+		return exitError
+	}
+}
+
+// writeResult writes result.json to the output directory.
+func writeResult(code int, err error) error {
+	result := runResult{
+		ExitCode: code,
+		Category: exitCategories[code],
+		Failures: failures.Counts(),
+		Summary:  summary,
+	}
+	if err != nil {
+		result.Error = redact.String(err.Error())
+	}
+
+	content, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal result: %w", err)
+	}
+
+	// the run could fail before the output directory is created
+	if err := os.MkdirAll(cfg.Output, 0o755); err != nil {
+		return fmt.Errorf("could not create output directory: %w", err)
+	}
+
+	return writePending(filepath.Join(cfg.Output, resultFilename), content)
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/chuhlomin/slack-exporter/pkg/atomicfile"
+)
+
+// tokenRefreshMargin is how long before its expiry the rotating token is refreshed.
+const tokenRefreshMargin = 5 * time.Minute
+
+// apiTokenExpires is the expiry of --api-token read from --token-file,
+// without it the rotating token is refreshed before the first request.
+var apiTokenExpires time.Time
+
+// tokenPair is the token of the app with token rotation enabled and its refresh token,
+// kept in --token-file between runs.
+type tokenPair struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	Expires      time.Time `json:"expires"`
+}
+
+// tokenRotation refreshes the token of the app with token rotation enabled before it expires
+// (tokens live 12 hours). Requests are made with the token the client was created with,
+// the transport sends them with the latest token (in the header or the form), so API clients
+// are not replaced mid-run.
+type tokenRotation struct {
+	mu      sync.Mutex
+	initial string
+	pair    tokenPair
+	refresh func(refreshToken string) (tokenPair, error)
+}
+
+// start rotates the token, which requests are made with, using the pair.
+func (tr *tokenRotation) start(pair tokenPair) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	tr.initial, tr.pair = pair.AccessToken, pair
+}
+
+// current returns the latest pair, empty when the token is not rotated.
+func (tr *tokenRotation) current() tokenPair {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	return tr.pair
+}
+
+// token returns the latest token, refreshed when it's about to expire.
+func (tr *tokenRotation) token() (string, error) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	if time.Until(tr.pair.Expires) > tokenRefreshMargin {
+		return tr.pair.AccessToken, nil
+	}
+
+	pair, err := tr.refresh(tr.pair.RefreshToken)
+	if err != nil {
+		return "", fmt.Errorf("could not refresh token: %w", err)
+	}
+	tr.pair = pair
+
+	log.Printf("Token is refreshed, the new one expires at %s", pair.Expires.Format(time.RFC3339))
+
+	if err := writeTokenFile(pair); err != nil {
+		// the new pair is used for the rest of the run anyway
+		log.Printf("Could not write token file: %v", err)
+	}
+
+	return pair.AccessToken, nil
+}
+
+// Transport returns the http.RoundTripper which replaces the token of requests
+// made with the initial token by the latest one.
+func (tr *tokenRotation) Transport(next http.RoundTripper) http.RoundTripper {
+	return rotationTransport{rotation: tr, next: next}
+}
+
+type rotationTransport struct {
+	rotation *tokenRotation
+	next     http.RoundTripper
+}
+
+func (t rotationTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// slack-go sends most methods with the token in the form body, the rest with the header
+	auth := req.Header.Get("Authorization")
+
+	form, err := tokenForm(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// requests without a token, like oauth.v2.access refreshing the token
+	// while the lock is held, are sent as is
+	if auth == "" && form == nil {
+		return t.next.RoundTrip(req)
+	}
+
+	t.rotation.mu.Lock()
+	initial := t.rotation.initial
+	t.rotation.mu.Unlock()
+
+	// so are requests with other tokens, like the external users token
+	byHeader := initial != "" && auth == "Bearer "+initial
+	byForm := initial != "" && form != nil && form.Get("token") == initial
+	if !byHeader && !byForm {
+		return t.next.RoundTrip(req)
+	}
+
+	token, err := t.rotation.token()
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.Clone(req.Context())
+	if byHeader {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if byForm {
+		form.Set("token", token)
+		setBody(req, []byte(form.Encode()))
+	}
+
+	return t.next.RoundTrip(req)
+}
+
+// tokenForm returns the form of the URL-encoded request with the token field, nil for other requests.
+// The body of the request is read and restored.
+func tokenForm(req *http.Request) (url.Values, error) {
+	if req.Body == nil || req.Body == http.NoBody ||
+		req.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("could not read request: %w", err)
+	}
+	setBody(req, body)
+
+	// bodies which are not forms are sent as is
+	if form, err := url.ParseQuery(string(body)); err == nil && form.Has("token") {
+		return form, nil
+	}
+
+	return nil, nil
+}
+
+// setBody replaces the body of the request, so it can be sent (and retried) again.
+func setBody(req *http.Request, body []byte) {
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+}
+
+// setRotatedToken starts rotating the token issued by oauth.v2.access and keeps it in --token-file.
+func (sc *SlackClient) setRotatedToken(accessToken, refreshToken string, expiresIn int) error {
+	pair := tokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		Expires:      time.Now().Add(time.Duration(expiresIn) * time.Second).UTC(),
+	}
+
+	sc.rotation.start(pair)
+
+	return writeTokenFile(pair)
+}
+
+// refreshToken exchanges the refresh token for the new token and refresh token.
+func (sc *SlackClient) refreshToken(refreshToken string) (tokenPair, error) {
+	token, err := sc.oauthAccess(map[string]string{
+		"grant_type":    "refresh_token",
+		"refresh_token": refreshToken,
+	})
+	if err != nil {
+		return tokenPair{}, err
+	}
+
+	// user tokens are refreshed at the top level of the response, but are issued in authed_user
+	accessToken, newRefreshToken, expiresIn := token.AccessToken, token.RefreshToken, token.ExpiresIn
+	if accessToken == "" {
+		accessToken, newRefreshToken, expiresIn = token.AuthedUser.AccessToken, token.AuthedUser.RefreshToken, token.AuthedUser.ExpiresIn
+	}
+
+	if accessToken == "" || newRefreshToken == "" {
+		return tokenPair{}, fmt.Errorf("%w: no token", errInvalidTokenResponse)
+	}
+
+	return tokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: newRefreshToken,
+		Expires:      time.Now().Add(time.Duration(expiresIn) * time.Second).UTC(),
+	}, nil
+}
+
+// loadTokenFile sets --api-token and --refresh-token from --token-file, when it exists;
+// the file is newer than the flags, as it's updated on every refresh.
+func loadTokenFile() error {
+	content, err := os.ReadFile(cfg.TokenFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not read token file: %w", err)
+	}
+
+	var pair tokenPair
+	if err := json.Unmarshal(content, &pair); err != nil {
+		return fmt.Errorf("could not decode token file: %w", err)
+	}
+
+	cfg.APIToken, cfg.RefreshToken, apiTokenExpires = pair.AccessToken, pair.RefreshToken, pair.Expires
+
+	return nil
+}
+
+// writeTokenFile keeps the pair in --token-file, readable only by the owner.
+func writeTokenFile(pair tokenPair) error {
+	if cfg.TokenFile == "" {
+		return nil
+	}
+
+	content, err := json.MarshalIndent(pair, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal token: %w", err)
+	}
+
+	return atomicfile.WriteFile(cfg.TokenFile, content)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// roundTripFunc is the http.RoundTripper of the function.
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestRotationTransport(t *testing.T) {
+	tests := []struct {
+		name       string
+		form       url.Values
+		header     string
+		wantToken  string
+		wantHeader string
+	}{
+		{
+			name:      "form token is replaced",
+			form:      url.Values{"token": {"xoxe-old"}, "channel": {"C1"}},
+			wantToken: "xoxe-new",
+		},
+		{
+			name:       "header token is replaced",
+			header:     "Bearer xoxe-old",
+			wantHeader: "Bearer xoxe-new",
+		},
+		{
+			name:      "other token is kept",
+			form:      url.Values{"token": {"xoxp-external"}},
+			wantToken: "xoxp-external",
+		},
+		{
+			name: "request without token is kept",
+			form: url.Values{"grant_type": {"refresh_token"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setConfig(t, config{})
+
+			rotation := &tokenRotation{
+				refresh: func(refreshToken string) (tokenPair, error) {
+					return tokenPair{AccessToken: "xoxe-new", RefreshToken: "refresh-new", Expires: time.Now().Add(12 * time.Hour)}, nil
+				},
+			}
+			// the token expires within the refresh margin
+			rotation.start(tokenPair{AccessToken: "xoxe-old", RefreshToken: "refresh-old", Expires: time.Now().Add(time.Minute)})
+
+			var sent *http.Request
+			var body string
+			transport := rotation.Transport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				b, err := io.ReadAll(req.Body)
+				if err != nil {
+					return nil, err
+				}
+				sent, body = req, string(b)
+				return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+			}))
+
+			encoded := tt.form.Encode()
+			req, err := http.NewRequest(http.MethodPost, "https://slack.com/api/conversations.history", strings.NewReader(encoded))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+
+			if _, err := transport.RoundTrip(req); err != nil {
+				t.Fatalf("RoundTrip: %v", err)
+			}
+
+			form, err := url.ParseQuery(body)
+			if err != nil {
+				t.Fatalf("could not parse the sent form: %v", err)
+			}
+
+			if got := form.Get("token"); got != tt.wantToken {
+				t.Errorf("got token %q, want %q", got, tt.wantToken)
+			}
+			if got := sent.Header.Get("Authorization"); got != tt.wantHeader {
+				t.Errorf("got header %q, want %q", got, tt.wantHeader)
+			}
+			if sent.ContentLength != int64(len(body)) {
+				t.Errorf("got content length %d, want %d", sent.ContentLength, len(body))
+			}
+
+			for key := range tt.form {
+				if key != "token" && form.Get(key) != tt.form.Get(key) {
+					t.Errorf("got %s %q, want %q", key, form.Get(key), tt.form.Get(key))
+				}
+			}
+		})
+	}
+}
+
+func TestRotationTransportSlackClient(t *testing.T) {
+	setConfig(t, config{})
+
+	rotation := &tokenRotation{
+		refresh: func(refreshToken string) (tokenPair, error) {
+			return tokenPair{AccessToken: "xoxe-new", RefreshToken: "refresh-new", Expires: time.Now().Add(12 * time.Hour)}, nil
+		},
+	}
+	rotation.start(tokenPair{AccessToken: "xoxe-old", RefreshToken: "refresh-old", Expires: time.Now().Add(time.Minute)})
+
+	var tokens []string
+	transport := rotation.Transport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if req.Body != nil {
+			b, err := io.ReadAll(req.Body)
+			if err != nil {
+				return nil, err
+			}
+			if form, err := url.ParseQuery(string(b)); err == nil && form.Has("token") {
+				token = form.Get("token")
+			}
+		}
+		tokens = append(tokens, token)
+
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(`{"ok":true,"messages":[]}`)),
+		}, nil
+	}))
+
+	api := newWebAPI("xoxe-old", &http.Client{Transport: transport})
+	_, err := api.GetConversationHistory(&slack.GetConversationHistoryParameters{ChannelID: "C1"})
+	if err != nil {
+		t.Fatalf("GetConversationHistory: %v", err)
+	}
+
+	if len(tokens) != 1 || tokens[0] != "xoxe-new" {
+		t.Errorf("got tokens %q, want the refreshed one", tokens)
+	}
+}
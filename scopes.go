@@ -0,0 +1,109 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// channelTypeScopes are the scopes to list and read the history of conversations of the type.
+var channelTypeScopes = map[string][]string{
+	"public_channel":  {"channels:read", "channels:history"},
+	"private_channel": {"groups:read", "groups:history"},
+	"mpim":            {"mpim:read", "mpim:history"},
+	"im":              {"im:read", "im:history"},
+}
+
+// userScopes returns the user scopes the app asks for when it's authorized in the browser:
+// --scope when set, otherwise only the scopes of conversations in --channels and of the enabled options,
+// so the app can be approved in workspaces which review every scope.
+func userScopes() []string {
+	if len(cfg.Scopes) > 0 {
+		return cfg.Scopes
+	}
+
+	scopes := map[string]struct{}{"users:read": {}}
+	add := func(names ...string) {
+		for _, name := range names {
+			scopes[name] = struct{}{}
+		}
+	}
+
+	for _, t := range scopedChannelTypes() {
+		add(channelTypeScopes[t]...)
+	}
+
+	if cfg.DownloadFiles || cfg.FileMetadata || cfg.Lists {
+		add("files:read")
+	}
+	if cfg.FinalSnapshot {
+		add("emoji:read")
+	}
+	if cfg.ProfileFields {
+		add("users.profile:read")
+	}
+	if cfg.Reminders {
+		add("reminders:read")
+	}
+	if cfg.Saved {
+		add("stars:read")
+	}
+	if cfg.Pins {
+		add("pins:read")
+	}
+	if cfg.Lists {
+		add("lists:read")
+	}
+	if cfg.SharedTeams || cfg.Branding {
+		add("team:read")
+	}
+
+	result := make([]string, 0, len(scopes))
+	for name := range scopes {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+
+	return result
+}
+
+// scopedChannelTypes returns the types of conversations of --channels: the aliases, the types
+// or the IDs, where channel IDs can be public or private and group IDs private channels or group DMs.
+// Without --channels (or with --interactive) the conversations are picked later, so all types are returned.
+func scopedChannelTypes() []string {
+	all := []string{"public_channel", "private_channel", "mpim", "im"}
+
+	if cfg.Channels == "" || cfg.Interactive {
+		return all
+	}
+
+	switch cfg.Channels {
+	case "all":
+		return all
+	case "public":
+		return []string{"public_channel"}
+	case "private":
+		return []string{"private_channel", "mpim", "im"}
+	case "dm":
+		return []string{"im"}
+	case "group":
+		return []string{"mpim"}
+	}
+
+	var types []string
+	for _, id := range strings.Split(cfg.Channels, ",") {
+		id = strings.TrimSpace(id)
+
+		switch {
+		case channelTypeScopes[id] != nil:
+			types = append(types, id)
+		case strings.HasPrefix(id, "C"):
+			types = append(types, "public_channel", "private_channel")
+		case strings.HasPrefix(id, "G"):
+			types = append(types, "private_channel", "mpim")
+		case strings.HasPrefix(id, "D"):
+			types = append(types, "im")
+		}
+	}
+
+	return types
+}
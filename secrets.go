@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/chuhlomin/slack-exporter/pkg/redact"
+	"github.com/chuhlomin/slack-exporter/pkg/secrets"
+)
+
+// secretStore provides Slack credentials when --secrets is set.
+var secretStore *secrets.Store
+
+// secretKeys are the keys of the secret and the config fields they set.
+var secretKeys = []struct {
+	key   string
+	value *string
+}{
+	{"app_client_id", &cfg.AppClientID},
+	{"app_client_secret", &cfg.AppClientSecret},
+	{"api_token", &cfg.APIToken},
+	{"external_users_token", &cfg.ExternalUsersToken},
+	{"google_drive_token", &cfg.GoogleDriveToken},
+	{"dropbox_token", &cfg.DropboxToken},
+}
+
+// loadSecrets sets the credentials from the secret, values in the secret take precedence over flags.
+func loadSecrets(ctx context.Context) error {
+	var err error
+	secretStore, err = secrets.Open(cfg.Secrets, cfg.SecretsTTL, httpTransport)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range secretKeys {
+		value, err := secretStore.Get(ctx, k.key)
+		if err != nil {
+			return err
+		}
+		if value != "" {
+			*k.value = value
+		}
+	}
+
+	return nil
+}
+
+// redactCredentials hides the credentials which don't look like Slack tokens in the log and reports,
+// Slack tokens and signed URLs are redacted anyway.
+func redactCredentials() {
+	redact.Secret(
+		cfg.AppClientSecret,
+		cfg.APIToken,
+		cfg.RefreshToken,
+		cfg.ExternalUsersToken,
+		cfg.GoogleDriveToken,
+		cfg.DropboxToken,
+		cfg.WebhookSecret,
+		os.Getenv("VAULT_TOKEN"),
+		os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		os.Getenv("AWS_SESSION_TOKEN"),
+	)
+	// webhook URLs, like the ones of Slack incoming webhooks, are credentials themselves
+	redact.Secret(cfg.WebhookURLs...)
+}
+
+// renewToken fetches the secret again after the token was rejected
+// and reports whether the secret has a different token, like after the rotation.
+func renewToken(ctx context.Context, c *SlackClient) (bool, error) {
+	if err := secretStore.Refresh(ctx); err != nil {
+		return false, err
+	}
+
+	token, err := secretStore.Get(ctx, "api_token")
+	if err != nil {
+		return false, err
+	}
+
+	if token == "" || token == cfg.APIToken {
+		return false, nil
+	}
+
+	log.Printf("Token was rejected, continuing with the renewed token from the secret")
+
+	cfg.APIToken = token
+	c.SetToken(token)
+
+	external, err := secretStore.Get(ctx, "external_users_token")
+	if err != nil {
+		return false, fmt.Errorf("could not get external users token: %w", err)
+	}
+	if external != "" {
+		cfg.ExternalUsersToken = external
+		c.SetExternalToken(external)
+	}
+
+	return true, nil
+}
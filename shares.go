@@ -0,0 +1,106 @@
+package main
+
+import (
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/slack-go/slack"
+
+	"github.com/chuhlomin/slack-exporter/pkg/structs"
+)
+
+// permalinkPath is the channel and ts of the message in its permalink, like /archives/C0123/p1700000000123456.
+var permalinkPath = regexp.MustCompile(`/archives/([A-Z0-9]+)/p(\d{10})(\d{6})$`)
+
+// parsePermalink returns the channel, ts and thread ts (of replies) of the message by its permalink.
+func parsePermalink(link string) (channel, ts, threadTS string, ok bool) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", "", "", false
+	}
+
+	match := permalinkPath.FindStringSubmatch(u.Path)
+	if match == nil {
+		return "", "", "", false
+	}
+
+	return match[1], match[2] + "." + match[3], u.Query().Get("thread_ts"), true
+}
+
+// permalink returns the permalink of the message in the workspace, like
+// https://example.slack.com/archives/C0123/p1700000000123456, replies link to their thread.
+func permalink(workspaceURL, channel, ts, threadTS string) string {
+	link := strings.TrimSuffix(workspaceURL, "/") + "/archives/" + channel + "/p" + strings.Replace(ts, ".", "", 1)
+	if threadTS != "" && threadTS != ts {
+		link += "?thread_ts=" + threadTS + "&cid=" + channel
+	}
+
+	return link
+}
+
+// sharedMessages returns messages shared into the message and its replies: attachments
+// with the permalink of the message, made by "Share message" (or "Forward") and by pasted links.
+func sharedMessages(msg structs.Message) []structs.SharedMessage {
+	var result []structs.SharedMessage
+	add := func(m slack.Message) {
+		for _, a := range m.Attachments {
+			channel, ts, threadTS, ok := parsePermalink(a.FromURL)
+			if !ok {
+				continue
+			}
+
+			result = append(result, structs.SharedMessage{
+				SharedIn:        m.Timestamp,
+				Channel:         channel,
+				Timestamp:       ts,
+				ThreadTimestamp: threadTS,
+				User:            a.AuthorID,
+				Author:          a.AuthorName,
+				Text:            a.Text,
+				Permalink:       a.FromURL,
+			})
+		}
+	}
+
+	add(msg.Message)
+	for _, reply := range msg.Replies {
+		add(reply)
+	}
+
+	return result
+}
+
+// ResolveSharedMessages embeds messages shared into the message as they are now,
+// the ones the token can't read (like in private channels) keep the text as it was shared.
+func (sc *SlackClient) ResolveSharedMessages(msg *structs.Message) error {
+	for i, shared := range msg.SharedMessages {
+		key := shared.Channel + "/" + shared.Timestamp
+
+		resolved, ok := sc.shared[key]
+		if !ok {
+			var err error
+			resolved, err = sc.getMessage(shared.Channel, shared.Timestamp)
+			if err != nil {
+				if isTokenRevoked(err) {
+					return err
+				}
+				log.Printf("Could not get shared message %s: %v", key, err)
+				failures.Add(statusSkipped, "message", key, err)
+			}
+			sc.shared[key] = resolved
+		}
+
+		if resolved == nil {
+			continue
+		}
+
+		sc.markSeen(*resolved)
+
+		msg.SharedMessages[i].Message = resolved
+		msg.SharedMessages[i].User = first(shared.User, resolved.User)
+	}
+
+	return nil
+}
@@ -13,12 +13,17 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/slack-go/slack"
-	"golang.org/x/time/rate"
 
+	"github.com/chuhlomin/slack-exporter/pkg/cache"
+	"github.com/chuhlomin/slack-exporter/pkg/exporter"
 	"github.com/chuhlomin/slack-exporter/pkg/structs"
 )
 
@@ -27,18 +32,77 @@ var (
 	errNoContentDisposition = fmt.Errorf("no content-disposition header")
 	errInvalidTokenResponse = fmt.Errorf("invalid token response")
 	errCodeRequired         = fmt.Errorf("argument 'code' is required")
+	errTokenRevoked         = fmt.Errorf("token is no longer valid")
+	errUserNotFound         = fmt.Errorf("user not found")
+	errDownloadInterrupted  = fmt.Errorf("download is interrupted")
+	errFileDeleted          = fmt.Errorf("file is deleted")
+	errFileAccessDenied     = fmt.Errorf("access to file is denied")
+	errFileNotFound         = fmt.Errorf("file is not found")
+	errPageSize             = fmt.Errorf("--page-size must be between 1 and %d", methodPageSizes["conversations.history"])
 )
 
+const (
+	// downloadAttempts is how many times the file is requested, every attempt continues the previous one.
+	downloadAttempts = 3
+	// partSuffix marks the partially downloaded file in the store, kept between runs to continue it.
+	partSuffix = ".part"
+)
+
+// methodPageSizes are the largest pages of paginated methods (their limit or count), as Slack documents them:
+// larger limits are capped by Slack or rejected, so pages never ask for more.
+var methodPageSizes = map[string]int{
+	"admin.conversations.search": 20,
+	"admin.emoji.list":           1000,
+	"admin.teams.list":           100,
+	"conversations.history":      999,
+	"conversations.list":         999,
+	"conversations.members":      1000,
+	"conversations.replies":      1000,
+	"files.info":                 100,
+	"slackLists.items.list":      100,
+	"stars.list":                 100,
+	"team.accessLogs":            1000,
+	"team.integrationLogs":       1000,
+	"users.list":                 200,
+}
+
+// pageLimit returns the limit of the page of the method: the size (--page-size of every paginated call),
+// up to the largest page of the method.
+func pageLimit(method string, size int) int {
+	if limit, ok := methodPageSizes[method]; ok && size > limit {
+		return limit
+	}
+
+	return size
+}
+
+// userID looks like the ID of the user, like U0123ABCD or W0123ABCD of Enterprise Grid.
+var userID = regexp.MustCompile(`^[UW][A-Z0-9]{2,}$`)
+
+// isTokenRevoked reports whether the error means the token can't be used anymore,
+// so there is no point in continuing the export.
+func isTokenRevoked(err error) bool {
+	for _, code := range []string{"token_revoked", "token_expired", "account_inactive", "invalid_auth", "not_authed"} {
+		if strings.Contains(err.Error(), code) {
+			return true
+		}
+	}
+	return false
+}
+
 // TokenResponse represents the response from the Slack API when requesting a token.
-// Only Ok and AuthedUser.AccessToken are used.
+// Only Ok, the access and refresh tokens and their expiry are used.
 type TokenResponse struct {
 	Ok          bool   `json:"ok"`
 	AccessToken string `json:"access_token"`
 	TokenType   string `json:"token_type"`
 	Scope       string `json:"scope"`
-	BotUserID   string `json:"bot_user_id"`
-	AppID       string `json:"app_id"`
-	Team        struct {
+	// RefreshToken and ExpiresIn are set for apps with token rotation enabled.
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	BotUserID    string `json:"bot_user_id"`
+	AppID        string `json:"app_id"`
+	Team         struct {
 		Name string `json:"name"`
 		ID   string `json:"id"`
 	} `json:"team"`
@@ -47,39 +111,144 @@ type TokenResponse struct {
 		ID   string `json:"id"`
 	} `json:"enterprise"`
 	AuthedUser struct {
-		ID          string `json:"id"`
-		Scope       string `json:"scope"`
-		TokenType   string `json:"token_type"`
-		AccessToken string `json:"access_token"`
+		ID           string `json:"id"`
+		Scope        string `json:"scope"`
+		TokenType    string `json:"token_type"`
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int    `json:"expires_in"`
 	} `json:"authed_user"`
 }
 
 // SlackClient is a client for the Slack API.
 type SlackClient struct {
-	limiter      *rate.Limiter
-	ctx          context.Context
-	clientID     string
-	clientSecret string
-	token        string
-	api          *slack.Client
-	seenUsers    map[string]interface{}
-	files        map[string]string // id -> url_private_download
+	limiters      rateLimiters
+	httpClient    *http.Client
+	ctx           context.Context
+	clientID      string
+	clientSecret  string
+	token         string
+	api           SlackAPI
+	seenUsers     map[string]interface{}
+	files         map[string]collectedFile
+	missingFiles  map[string]string   // why files could not be downloaded by ID, like not_found
+	filesSize     int64               // size of the collected files which are not downloaded yet
+	filesInfo     map[string]fileInfo // files.info responses by file ID, shared by all the channels
+	teamProfile   *slack.TeamProfile
+	usersListed   bool
+	enrichedUsers map[string]struct{} // ids of users with custom profile fields
+	notFoundUsers map[string]struct{}
+	externalUsers map[string]struct{} // ids of users resolved with the external workspace token
+	teams         map[string]*structs.Team
+	externalAPI   SlackAPI
+	auth          *slack.AuthTestResponse
+	workspace     *structs.Workspace
+	teamID        string // workspace of the Enterprise Grid org token
+	usersCache    *cache.Cache[*slack.User]
+	profilesCache *cache.Cache[slack.UserProfile] // profiles with custom fields by user ID
+	emojiCache    *cache.Cache[map[string]string]
+	// channels are fetched once per run and cached for channelsTTL at most,
+	// so their names, topics and archived status are current
+	channels      map[string]*slack.Channel
+	channelsCache *cache.Cache[*slack.Channel]
+	// shared are messages shared into other messages by channel and ts, nil if they can't be read
+	shared map[string]*slack.Message
+	// rotation keeps the token of the app with token rotation enabled fresh
+	rotation *tokenRotation
+	scopes   *grantedScopes
 
 	UsersCache map[string]*slack.User
 }
 
 // NewSlackClient creates a new SlackClient.
 func NewSlackClient(id, secret string) *SlackClient {
-	return &SlackClient{
-		// Tier 3 Rate Limiting: 50 requests per minute
-		limiter:      rate.NewLimiter(rate.Every(time.Minute/50), 1),
-		ctx:          context.Background(),
-		clientID:     id,
-		clientSecret: secret,
-		seenUsers:    make(map[string]interface{}),
-		files:        make(map[string]string),
-		UsersCache:   make(map[string]*slack.User),
+	// every tier of Slack API methods has its own pace, the exporter speeds up
+	// until Slack starts to respond with 429 or slows down
+	limiters := newRateLimiters()
+
+	rotation := &tokenRotation{}
+
+	sc := &SlackClient{
+		limiters:      limiters,
+		httpClient:    &http.Client{},
+		rotation:      rotation,
+		scopes:        &grantedScopes{},
+		ctx:           context.Background(),
+		clientID:      id,
+		clientSecret:  secret,
+		seenUsers:     make(map[string]interface{}),
+		files:         make(map[string]collectedFile),
+		missingFiles:  make(map[string]string),
+		filesInfo:     make(map[string]fileInfo),
+		UsersCache:    make(map[string]*slack.User),
+		enrichedUsers: make(map[string]struct{}),
+		notFoundUsers: make(map[string]struct{}),
+		externalUsers: make(map[string]struct{}),
+		teams:         make(map[string]*structs.Team),
+		shared:        make(map[string]*slack.Message),
+		channels:      make(map[string]*slack.Channel),
+	}
+	rotation.refresh = sc.refreshToken
+
+	sc.httpClient.Transport = sc.scopes.Transport(
+		rotation.Transport(limiters.Transport(httpTransport)),
+		func() string { return sc.token },
+	)
+
+	return sc
+}
+
+// channelsTTL is how long channels are cached at most, renamed or archived channels
+// are picked up by the next run after it.
+const channelsTTL = 15 * time.Minute
+
+// SetCacheDir enables persistent cache of users, their profiles, channels and custom emoji
+// in the directory, so repeated exports don't re-fetch unchanged data.
+func (sc *SlackClient) SetCacheDir(dir string, ttl time.Duration) error {
+	var err error
+
+	sc.usersCache, err = cache.Open[*slack.User](filepath.Join(dir, "users.json"), ttl)
+	if err != nil {
+		return fmt.Errorf("could not open users cache: %w", err)
+	}
+
+	sc.profilesCache, err = cache.Open[slack.UserProfile](filepath.Join(dir, "profiles.json"), ttl)
+	if err != nil {
+		return fmt.Errorf("could not open profiles cache: %w", err)
+	}
+
+	sc.channelsCache, err = cache.Open[*slack.Channel](filepath.Join(dir, "channels.json"), min(ttl, channelsTTL))
+	if err != nil {
+		return fmt.Errorf("could not open channels cache: %w", err)
+	}
+
+	sc.emojiCache, err = cache.Open[map[string]string](filepath.Join(dir, emojiArchiveFilename), ttl)
+	if err != nil {
+		return fmt.Errorf("could not open emoji cache: %w", err)
+	}
+
+	return nil
+}
+
+// SaveCache writes the persistent cache to disk.
+func (sc *SlackClient) SaveCache() error {
+	if err := sc.usersCache.Save(); err != nil {
+		return fmt.Errorf("could not save users cache: %w", err)
+	}
+
+	if err := sc.profilesCache.Save(); err != nil {
+		return fmt.Errorf("could not save profiles cache: %w", err)
+	}
+
+	if err := sc.channelsCache.Save(); err != nil {
+		return fmt.Errorf("could not save channels cache: %w", err)
 	}
+
+	if err := sc.emojiCache.Save(); err != nil {
+		return fmt.Errorf("could not save emoji cache: %w", err)
+	}
+
+	return nil
 }
 
 // GetAuthorizeURL returns the URL to authorize the app and start the OAuth flow.
@@ -92,22 +261,7 @@ func (sc *SlackClient) GetAuthorizeURL(state string) string {
 
 	vals := result.Query()
 	vals.Add("scope", "")
-	vals.Add("user_scope", strings.Join(
-		[]string{
-			"users:read",
-			"files:read",
-			"emoji:read",
-			"channels:read",
-			"channels:history",
-			"groups:read",
-			"groups:history",
-			"im:read",
-			"im:history",
-			"mpim:read",
-			"mpim:history",
-		},
-		",",
-	))
+	vals.Add("user_scope", strings.Join(userScopes(), ","))
 	vals.Add("redirect_uri", "https://oauth-redirect.pages.dev")
 	vals.Add("client_id", sc.clientID)
 
@@ -120,10 +274,33 @@ func (sc *SlackClient) GetAuthorizeURL(state string) string {
 	return result.String()
 }
 
+// SetAPI replaces the Slack API implementation used by the SlackClient.
+// It must be called after the token is set, since setting the token
+// creates a new slack.Client.
+func (sc *SlackClient) SetAPI(api SlackAPI) {
+	sc.api = api
+}
+
+// SetExternalToken sets the token of another workspace,
+// used to look up users of shared channels who are not found in the workspace.
+func (sc *SlackClient) SetExternalToken(token string) {
+	sc.externalAPI = newWebAPI(token, sc.httpClient)
+}
+
 // SetToken sets the API token for the SlackClient.
 func (sc *SlackClient) SetToken(token string) {
 	sc.token = token
-	sc.api = slack.New(token)
+	sc.api = newWebAPI(token, sc.httpClient)
+
+	if token == cfg.APIToken && cfg.RefreshToken != "" {
+		sc.rotation.start(tokenPair{AccessToken: token, RefreshToken: cfg.RefreshToken, Expires: apiTokenExpires})
+	}
+}
+
+// SetTeamID limits channels and users to the workspace of the Enterprise Grid org,
+// which org-wide tokens require.
+func (sc *SlackClient) SetTeamID(id string) {
+	sc.teamID = id
 }
 
 // GetToken requests a token from the Slack API using the provided code.
@@ -132,17 +309,36 @@ func (sc *SlackClient) GetToken(code string) error {
 		return errCodeRequired
 	}
 
+	token, err := sc.oauthAccess(map[string]string{"code": code})
+	if err != nil {
+		return err
+	}
+
+	sc.SetToken(token.AuthedUser.AccessToken)
+
+	// the app has token rotation enabled
+	if token.AuthedUser.RefreshToken != "" {
+		return sc.setRotatedToken(token.AuthedUser.AccessToken, token.AuthedUser.RefreshToken, token.AuthedUser.ExpiresIn)
+	}
+
+	return nil
+}
+
+// oauthAccess calls oauth.v2.access with the app client ID and secret and the fields.
+func (sc *SlackClient) oauthAccess(fields map[string]string) (*TokenResponse, error) {
 	// set multipart/form-data values
 	multipartData := &bytes.Buffer{}
 	writer := multipart.NewWriter(multipartData)
 	if err := writer.WriteField("client_id", sc.clientID); err != nil {
-		return fmt.Errorf("could not write field: %w", err)
+		return nil, fmt.Errorf("could not write field: %w", err)
 	}
 	if err := writer.WriteField("client_secret", sc.clientSecret); err != nil {
-		return fmt.Errorf("could not write field: %w", err)
+		return nil, fmt.Errorf("could not write field: %w", err)
 	}
-	if err := writer.WriteField("code", code); err != nil {
-		return fmt.Errorf("could not write field: %w", err)
+	for name, value := range fields {
+		if err := writer.WriteField(name, value); err != nil {
+			return nil, fmt.Errorf("could not write field: %w", err)
+		}
 	}
 	writer.Close()
 
@@ -153,341 +349,1366 @@ func (sc *SlackClient) GetToken(code string) error {
 		multipartData,
 	)
 	if err != nil {
-		return fmt.Errorf("could not create request: %w", err)
+		return nil, fmt.Errorf("could not create request: %w", err)
 	}
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := sc.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("could not send request: %w", err)
+		return nil, fmt.Errorf("could not send request: %w", err)
 	}
 
 	defer resp.Body.Close()
 
 	b, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Errorf("could not read response: %w", err)
+		return nil, fmt.Errorf("could not read response: %w", err)
 	}
 
 	var token TokenResponse
 	if err := json.Unmarshal(b, &token); err != nil {
-		return fmt.Errorf("could not decode response: %w", err)
+		return nil, fmt.Errorf("could not decode response: %w", err)
 	}
 
 	if !token.Ok {
-		return fmt.Errorf("%w: %v", errInvalidTokenResponse, string(b))
+		return nil, fmt.Errorf("%w: %v", errInvalidTokenResponse, string(b))
 	}
 
-	sc.token = token.AuthedUser.AccessToken
-	sc.api = slack.New(sc.token)
-	return nil
+	return &token, nil
 }
 
-func (sc *SlackClient) GetChannels(types []string) ([]slack.Channel, error) {
-	var allChannels []slack.Channel
-	cursor := ""
-	for {
-		err := sc.limiter.Wait(sc.ctx)
-		if err != nil {
-			return nil, fmt.Errorf("rate limit error: %w", err)
-		}
+// callAPI calls the Slack API method which is not supported by slack-go
+// and decodes the response into out.
+func (sc *SlackClient) callAPI(method string, values url.Values, out interface{}) error {
+	if err := sc.limiters.forMethod(method).Wait(sc.ctx); err != nil {
+		return fmt.Errorf("rate limit error: %w", err)
+	}
 
-		resp, next, err := sc.api.GetConversations(&slack.GetConversationsParameters{
-			Types:  types,
-			Limit:  999,
-			Cursor: cursor,
-		})
-		if err != nil {
-			return nil, fmt.Errorf("could not get public channels: %w", err)
+	return sc.api.CallMethod(sc.ctx, method, values, out)
+}
+
+// GetSidebar returns the sidebar sections of the authed user in the order they are displayed.
+// The users.channelSections.list method is a part of the Slack client API
+// and may not be available for all token types.
+func (sc *SlackClient) GetSidebar() ([]structs.SidebarSection, error) {
+	var resp struct {
+		ChannelSections []structs.SidebarSection `json:"channel_sections"`
+	}
+
+	if err := sc.callAPI("users.channelSections.list", url.Values{}, &resp); err != nil {
+		return nil, err
+	}
+
+	// sections form a linked list with the next_channel_section_id field
+	byID := make(map[string]structs.SidebarSection, len(resp.ChannelSections))
+	isNext := map[string]bool{}
+	for _, section := range resp.ChannelSections {
+		byID[section.ID] = section
+		isNext[section.NextID] = true
+	}
+
+	ordered := make([]structs.SidebarSection, 0, len(resp.ChannelSections))
+	for _, section := range resp.ChannelSections {
+		if isNext[section.ID] {
+			continue
 		}
 
-		allChannels = append(allChannels, resp...)
+		// section is the head of the list
+		for id := section.ID; id != ""; {
+			next, ok := byID[id]
+			if !ok {
+				break
+			}
+			ordered = append(ordered, next)
+			delete(byID, id)
+			id = next.NextID
+		}
+	}
 
-		if next == "" {
-			break
+	// sections which are not linked (should not happen) are kept at the end
+	for _, section := range resp.ChannelSections {
+		if _, ok := byID[section.ID]; ok {
+			ordered = append(ordered, section)
 		}
-		cursor = next
 	}
 
-	return allChannels, nil
+	return ordered, nil
 }
 
-// GetUsers returns a list of users who have posted messages in the channel.
-// This method is used to get the user names for the messages.
-func (sc *SlackClient) GetUsers() (map[string]*slack.User, error) {
-	result := map[string]*slack.User{}
+// GetReminders returns reminders created by or for the authed user.
+func (sc *SlackClient) GetReminders() ([]*slack.Reminder, error) {
+	if err := sc.limiters.forMethod("reminders.list").Wait(sc.ctx); err != nil {
+		return nil, fmt.Errorf("rate limit error: %w", err)
+	}
 
-	for user := range sc.seenUsers {
-		if user == "" {
-			continue
-		}
-		if u, ok := sc.UsersCache[user]; ok {
-			result[user] = u
-			continue
+	return sc.api.ListReminders()
+}
+
+// GetSaved returns the items saved (starred) by the authed user.
+func (sc *SlackClient) GetSaved() ([]slack.Item, error) {
+	var items []slack.Item
+
+	params := slack.NewStarsParameters()
+	params.Count = pageLimit("stars.list", cfg.PageSize)
+	for {
+		if err := sc.limiters.forMethod("stars.list").Wait(sc.ctx); err != nil {
+			return nil, fmt.Errorf("rate limit error: %w", err)
 		}
 
-		u, err := sc.GetUserWithRetry(user)
+		page, paging, err := sc.api.ListStars(params)
 		if err != nil {
-			if strings.Contains(err.Error(), "user_not_found") {
-				log.Printf("User %q not found", user)
-				continue
-			}
-			return nil, fmt.Errorf("could not get user %q: %w", user, err)
+			return nil, err
 		}
 
-		sc.UsersCache[user] = u
-		result[user] = u
+		items = append(items, page...)
+
+		if paging == nil || params.Page >= paging.Pages {
+			break
+		}
+
+		params.Page++
 	}
 
-	return result, nil
+	return items, nil
 }
 
-func (sc *SlackClient) GetUserWithRetry(user string) (*slack.User, error) {
-	err := sc.limiter.Wait(sc.ctx)
-	if err != nil {
+// GetPins returns the messages and files pinned in the channel.
+func (sc *SlackClient) GetPins(channel string) ([]slack.Item, error) {
+	if err := sc.limiters.forMethod("pins.list").Wait(sc.ctx); err != nil {
 		return nil, fmt.Errorf("rate limit error: %w", err)
 	}
 
-	u, err := sc.api.GetUserInfo(user)
-	if err != nil {
-		var rateLimitErr *slack.RateLimitedError
-		if errors.As(err, &rateLimitErr) {
-			log.Printf("Rate limit exceeded. Retrying after %v", rateLimitErr.RetryAfter)
-			time.Sleep(rateLimitErr.RetryAfter)
-			return sc.GetUserWithRetry(user)
-		}
-		return nil, fmt.Errorf("%q: %w", user, err)
+	items, _, err := sc.api.ListPins(channel)
+	return items, err
+}
+
+// GetMessage returns the message of the channel (with its thread replies),
+// nil if it was deleted or can't be read.
+func (sc *SlackClient) GetMessage(channel, ts string) (*structs.Message, error) {
+	msg, err := sc.getMessage(channel, ts)
+	if err != nil || msg == nil {
+		return nil, err
 	}
 
-	return u, nil
-}
+	sc.markSeen(*msg)
 
-// GetChannelInfo returns information about the channel, such as the name.
-func (sc *SlackClient) GetChannelInfo(channel string) (*slack.Channel, error) {
-	if channel == "" {
-		return nil, errChannelRequired
+	var replies []slack.Message
+	if msg.ReplyCount > 0 {
+		replies, err = sc.Exporter(nil, nil).Thread(sc.ctx, channel, *msg)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	if err := sc.limiter.Wait(sc.ctx); err != nil {
+	converted := sc.convertToMsg(*msg, replies)
+	return &converted, nil
+}
+
+// getMessage returns the message or the thread reply of the channel, nil if it was deleted.
+func (sc *SlackClient) getMessage(channel, ts string) (*slack.Message, error) {
+	if err := sc.limiters.forMethod("conversations.history").Wait(sc.ctx); err != nil {
 		return nil, fmt.Errorf("rate limit error: %w", err)
 	}
 
-	c, err := sc.api.GetConversationInfo(&slack.GetConversationInfoInput{ChannelID: channel})
+	resp, err := sc.api.GetConversationHistoryContext(sc.ctx, &slack.GetConversationHistoryParameters{
+		ChannelID: channel,
+		Oldest:    ts,
+		Latest:    ts,
+		Inclusive: true,
+		Limit:     1,
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	// reset seen users
-	sc.seenUsers = make(map[string]interface{})
-	if c.User != "" {
-		sc.seenUsers[c.User] = struct{}{}
+	if len(resp.Messages) > 0 && resp.Messages[0].Timestamp == ts {
+		return &resp.Messages[0], nil
 	}
 
-	return c, nil
+	// thread replies are not in the history
+	return sc.findReply(channel, ts)
 }
 
-// GetMessages returns a list of all the messages in the channel.
-func (sc *SlackClient) GetMessages(channel string) ([]structs.Message, error) {
-	if channel == "" {
-		return nil, errChannelRequired
-	}
-
-	var allMessages []slack.Message
-
+// findReply returns the reply from the thread, nil if it's not there.
+func (sc *SlackClient) findReply(channel, ts string) (*slack.Message, error) {
 	cursor := ""
 	for {
-		err := sc.limiter.Wait(sc.ctx)
-		if err != nil {
+		if err := sc.limiters.forMethod("conversations.replies").Wait(sc.ctx); err != nil {
 			return nil, fmt.Errorf("rate limit error: %w", err)
 		}
 
-		resp, err := sc.api.GetConversationHistory(&slack.GetConversationHistoryParameters{
+		msgs, _, nextCursor, err := sc.api.GetConversationRepliesContext(sc.ctx, &slack.GetConversationRepliesParameters{
 			ChannelID: channel,
-			Limit:     999,
+			Timestamp: ts,
+			Limit:     pageLimit("conversations.replies", cfg.PageSize),
 			Cursor:    cursor,
 		})
 		if err != nil {
 			return nil, err
 		}
 
-		allMessages = append(allMessages, resp.Messages...)
-
-		if resp.ResponseMetaData.NextCursor == "" {
-			break
+		for i := range msgs {
+			if msgs[i].Timestamp == ts {
+				return &msgs[i], nil
+			}
 		}
 
-		cursor = resp.ResponseMetaData.NextCursor
-	}
-
-	convertedMessages := make([]structs.Message, 0, len(allMessages))
-	for _, msg := range allMessages {
-		var replies []slack.Message
-		var err error
-
-		if msg.ReplyCount > 0 {
-			replies, err = sc.getReplies(channel, msg.Timestamp)
-			if err != nil {
-				fmt.Printf("Could not get replies for message '%s': %v", msg.Timestamp, err)
-			}
+		if nextCursor == "" {
+			return nil, nil
 		}
 
-		convertedMsg := sc.convertToMsg(msg)
-		convertedMsg.Replies = replies
-		convertedMessages = append(convertedMessages, convertedMsg)
+		cursor = nextCursor
 	}
-
-	return convertedMessages, nil
 }
 
-// getReplies returns a list of all the replies to a message.
-func (sc *SlackClient) getReplies(channel, messageID string) ([]slack.Message, error) {
-	if channel == "" {
-		return nil, errChannelRequired
-	}
-
-	var allReplies []slack.Message
-
+func (sc *SlackClient) GetChannels(types []string) ([]slack.Channel, error) {
+	var allChannels []slack.Channel
 	cursor := ""
 	for {
-		err := sc.limiter.Wait(sc.ctx)
+		err := sc.limiters.forMethod("conversations.list").Wait(sc.ctx)
 		if err != nil {
 			return nil, fmt.Errorf("rate limit error: %w", err)
 		}
 
-		msgs, _, nextCursor, err := sc.api.GetConversationReplies(&slack.GetConversationRepliesParameters{
-			ChannelID: channel,
-			Limit:     999,
-			Cursor:    cursor,
-			Timestamp: messageID,
+		resp, next, err := sc.api.GetConversations(&slack.GetConversationsParameters{
+			Types:  types,
+			Limit:  pageLimit("conversations.list", cfg.PageSize),
+			Cursor: cursor,
+			TeamID: sc.teamID,
 		})
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("could not get public channels: %w", err)
 		}
 
-		allReplies = append(allReplies, msgs...)
+		allChannels = append(allChannels, resp...)
 
-		if nextCursor == "" {
+		if next == "" {
 			break
 		}
-
-		cursor = nextCursor
+		cursor = next
 	}
 
-	// Filter out reply which matches the parent message
-	filterFn := func(replies []slack.Message, parentId string) (ret []slack.Message) {
-		for _, r := range replies {
-			if r.Timestamp != parentId {
-				ret = append(ret, r)
-			}
+	return allChannels, nil
+}
+
+// GetUsers returns a list of users who have posted messages in the channel.
+// This method is used to get the user names for the messages.
+// Users missing from the cache are fetched with users.list once per run,
+// users missing from the list (like external ones) are requested one by one.
+func (sc *SlackClient) GetUsers() (map[string]*slack.User, error) {
+	missing := false
+	for user := range sc.seenUsers {
+		if _, ok := sc.UsersCache[user]; ok || user == "" {
+			continue
+		}
+
+		if u, ok := sc.usersCache.Get(user); ok {
+			sc.UsersCache[user] = u
+			continue
 		}
-		return ret
+
+		missing = true
 	}
-	filteredReplies := filterFn(allReplies, messageID)
 
-	// Add attachments to slice
-	for _, reply := range filteredReplies {
-		if reply.Files != nil {
-			for _, file := range reply.Files {
-				if file.URLPrivateDownload == "" {
-					continue
-				}
-				sc.files[file.ID] = file.URLPrivateDownload
-			}
+	if missing && !sc.usersListed {
+		if err := sc.listUsers(); err != nil {
+			return nil, fmt.Errorf("could not list users: %w", err)
 		}
 	}
 
-	return filteredReplies, nil
-}
+	result := map[string]*slack.User{}
 
-func (sc *SlackClient) convertToMsg(message slack.Message) structs.Message {
-	sc.seenUsers[message.User] = nil
+	for user := range sc.seenUsers {
+		if user == "" {
+			continue
+		}
 
-	for _, block := range message.Blocks.BlockSet {
-		switch block.BlockType() {
-		case slack.MBTRichText:
-			sc.processRichTextElements(block.(*slack.RichTextBlock).Elements)
+		u, ok := sc.UsersCache[user]
+		if !ok {
+			var err error
+			u, err = sc.getUser(user)
+			if err != nil {
+				return nil, fmt.Errorf("could not get user %q: %w", user, err)
+			}
 		}
-	}
 
-	if message.Files != nil {
-		for _, file := range message.Files {
-			if file.URLPrivateDownload == "" {
-				continue
+		if _, ok := sc.enrichedUsers[user]; cfg.ProfileFields && !ok {
+			if err := sc.enrichProfile(u); err != nil && !isUserNotFound(err) {
+				return nil, fmt.Errorf("could not get profile of user %q: %w", user, err)
 			}
-			sc.files[file.ID] = file.URLPrivateDownload
+			sc.enrichedUsers[user] = struct{}{}
+			sc.cacheUser(u)
 		}
-	}
 
-	return structs.Message{
-		Message: message,
+		result[user] = u
 	}
+
+	return result, nil
 }
 
-func (sc *SlackClient) processRichTextElements(elements []slack.RichTextElement) {
-	for _, element := range elements {
-		switch element.RichTextElementType() {
-		case slack.RTESection:
-			sc.processRichTextSectionElements(element.(*slack.RichTextSection).Elements)
-		case slack.RTEQuote:
-			sc.processRichTextSectionElements(element.(*slack.RichTextQuote).Elements)
-		case slack.RTEList:
-			sc.processRichTextElements(element.(*slack.RichTextList).Elements)
+// FindUser returns the ID of the user by the ID, @username, display name or email.
+func (sc *SlackClient) FindUser(name string) (string, error) {
+	if userID.MatchString(name) {
+		return name, nil
+	}
+
+	if !sc.usersListed {
+		if err := sc.listUsers(); err != nil {
+			return "", fmt.Errorf("could not list users: %w", err)
 		}
 	}
-}
 
-func (sc *SlackClient) processRichTextSectionElements(elements []slack.RichTextSectionElement) {
-	for _, rtEelement := range elements {
-		switch rtEelement.RichTextSectionElementType() {
-		case slack.RTSEUser:
-			sc.seenUsers[rtEelement.(*slack.RichTextSectionUserElement).UserID] = nil
+	name = strings.TrimPrefix(name, "@")
+	for id, u := range sc.UsersCache {
+		if strings.EqualFold(u.Name, name) ||
+			strings.EqualFold(u.Profile.DisplayName, name) ||
+			strings.EqualFold(u.Profile.Email, name) {
+			return id, nil
 		}
 	}
+
+	return "", fmt.Errorf("%w: %s", errUserNotFound, name)
 }
 
-// DownloadFiles downloads all the files in the channel.
-func (sc *SlackClient) DownloadFiles(channelID string) (map[string]string, error) {
-	result := make(map[string]string)
+// GetUser returns the user from the cache, listing all the users of the workspace on first miss.
+func (sc *SlackClient) GetUser(user string) (*slack.User, error) {
+	if u, ok := sc.UsersCache[user]; ok {
+		return u, nil
+	}
 
-	// create directory for files
-	err := os.MkdirAll(filepath.Join(cfg.Output, channelID), 0o755)
-	if err != nil {
-		return nil, fmt.Errorf("could not create directory: %w", err)
+	if u, ok := sc.usersCache.Get(user); ok {
+		sc.UsersCache[user] = u
+		return u, nil
 	}
 
-	for id, url := range sc.files {
-		filename, err := sc.downloadFile(channelID, id, url)
-		if err != nil {
-			log.Printf("could not download file %q: %v", id, err)
+	if !sc.usersListed {
+		if err := sc.listUsers(); err != nil {
+			return nil, fmt.Errorf("could not list users: %w", err)
 		}
 
-		result[id] = filename
+		if u, ok := sc.UsersCache[user]; ok {
+			return u, nil
+		}
 	}
 
-	return result, nil
+	return sc.getUser(user)
 }
 
-func (sc *SlackClient) downloadFile(path, id, fileURL string) (string, error) {
-	req, err := http.NewRequestWithContext(sc.ctx, http.MethodGet, fileURL, http.NoBody)
-	if err != nil {
-		return "", fmt.Errorf("could not create request: %w", err)
+// listUsers puts all the users of the workspace into UsersCache.
+// users.list returns up to 200 users per request, which is much faster
+// than requesting users one by one.
+func (sc *SlackClient) listUsers() error {
+	options := []slack.GetUsersOption{slack.GetUsersOptionLimit(pageLimit("users.list", cfg.PageSize))}
+	if sc.teamID != "" {
+		options = append(options, slack.GetUsersOptionTeamID(sc.teamID))
 	}
 
-	req.Header.Set("Authorization", "Bearer "+sc.token)
+	p := sc.api.GetUsersPaginated(options...)
 
-	err = sc.limiter.Wait(sc.ctx)
-	if err != nil {
-		return "", fmt.Errorf("rate limit error: %w", err)
+	for {
+		if err := sc.limiters.forMethod("users.list").Wait(sc.ctx); err != nil {
+			return fmt.Errorf("rate limit error: %w", err)
+		}
+
+		// the page failed with the rate limit is retried with the same cursor,
+		// Next returns the pagination with the cursor reset along with the error
+		next, err := p.Next(sc.ctx)
+		if err != nil {
+			if p.Done(err) {
+				break
+			}
+
+			var rateLimitErr *slack.RateLimitedError
+			if errors.As(err, &rateLimitErr) {
+				log.Printf("Rate limit exceeded. Retrying after %v", rateLimitErr.RetryAfter)
+				time.Sleep(rateLimitErr.RetryAfter)
+				continue
+			}
+
+			return err
+		}
+		p = next
+
+		for i := range p.Users {
+			sc.cacheUser(&p.Users[i])
+		}
+	}
+
+	sc.usersListed = true
+	return nil
+}
+
+func (sc *SlackClient) cacheUser(u *slack.User) {
+	sc.UsersCache[u.ID] = u
+	sc.usersCache.Set(u.ID, u)
+}
+
+// enrichProfile replaces the user profile with the one returned by users.profile.get,
+// which, unlike users.info, includes custom profile fields.
+// Profiles are cached apart from users, since users.list returns them without custom fields.
+func (sc *SlackClient) enrichProfile(u *slack.User) error {
+	if u.IsBot || u.Deleted {
+		return nil
+	}
+
+	if profile, ok := sc.profilesCache.Get(u.ID); ok {
+		u.Profile = profile
+		return nil
+	}
+
+	if err := sc.limiters.forMethod("users.profile.get").Wait(sc.ctx); err != nil {
+		return fmt.Errorf("rate limit error: %w", err)
+	}
+
+	profile, err := sc.api.GetUserProfile(&slack.GetUserProfileParameters{
+		UserID:        u.ID,
+		IncludeLabels: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	u.Profile = *profile
+	sc.profilesCache.Set(u.ID, *profile)
+	return nil
+}
+
+// GetTeamProfile returns the definitions of the custom profile fields of the team.
+// The result is requested once and reused for all channels.
+func (sc *SlackClient) GetTeamProfile() (*slack.TeamProfile, error) {
+	if sc.teamProfile != nil {
+		return sc.teamProfile, nil
+	}
+
+	if err := sc.limiters.forMethod("team.profile.get").Wait(sc.ctx); err != nil {
+		return nil, fmt.Errorf("rate limit error: %w", err)
+	}
+
+	profile, err := sc.api.GetTeamProfile()
+	if err != nil {
+		return nil, err
+	}
+
+	sc.teamProfile = profile
+	return profile, nil
+}
+
+// getUser requests a single user with users.info.
+// Deleted accounts and users of other workspaces in shared channels
+// may not be found: they are looked up in the external workspace (if configured),
+// otherwise a placeholder user is returned and the user is marked as not found.
+func (sc *SlackClient) getUser(user string) (*slack.User, error) {
+	u, err := sc.GetUserWithRetry(user)
+	if err == nil {
+		sc.cacheUser(u)
+		return u, nil
+	}
+
+	if !isUserNotFound(err) {
+		return nil, err
+	}
+
+	if sc.externalAPI != nil {
+		u, err = sc.getUserWithRetry(sc.externalAPI, user)
+		if err == nil {
+			sc.externalUsers[user] = struct{}{}
+			sc.cacheUser(u)
+			return u, nil
+		}
+
+		if !isUserNotFound(err) {
+			return nil, fmt.Errorf("could not get external user: %w", err)
+		}
+	}
+
+	log.Printf("User %q not found", user)
+	failures.Add(statusNotFound, "user", user, err)
+
+	// placeholder is not saved to the persistent cache,
+	// so the next run tries to resolve the user again
+	u = &slack.User{ID: user}
+	sc.notFoundUsers[user] = struct{}{}
+	sc.UsersCache[user] = u
+	return u, nil
+}
+
+// isUserNotFound reports whether the error means the user cannot be returned by the workspace.
+func isUserNotFound(err error) bool {
+	return strings.Contains(err.Error(), "user_not_found") ||
+		strings.Contains(err.Error(), "user_not_visible")
+}
+
+func (sc *SlackClient) GetUserWithRetry(user string) (*slack.User, error) {
+	return sc.getUserWithRetry(sc.api, user)
+}
+
+func (sc *SlackClient) getUserWithRetry(api SlackAPI, user string) (*slack.User, error) {
+	err := sc.limiters.forMethod("users.info").Wait(sc.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("rate limit error: %w", err)
+	}
+
+	u, err := api.GetUserInfoContext(sc.ctx, user)
+	if err != nil {
+		var rateLimitErr *slack.RateLimitedError
+		if errors.As(err, &rateLimitErr) {
+			log.Printf("Rate limit exceeded. Retrying after %v", rateLimitErr.RetryAfter)
+			time.Sleep(rateLimitErr.RetryAfter)
+			return sc.getUserWithRetry(api, user)
+		}
+		return nil, fmt.Errorf("%q: %w", user, err)
+	}
+
+	return u, nil
+}
+
+// UserStatuses returns the status of the users whose records are incomplete
+// or who don't belong to the workspace: deleted, external or not found.
+func (sc *SlackClient) UserStatuses(users map[string]*slack.User) (map[string]string, error) {
+	auth, err := sc.AuthTest()
+	if err != nil {
+		return nil, fmt.Errorf("could not get auth info: %w", err)
+	}
+
+	result := map[string]string{}
+	for id, u := range users {
+		_, notFound := sc.notFoundUsers[id]
+		_, external := sc.externalUsers[id]
+
+		switch {
+		case notFound:
+			result[id] = structs.UserStatusNotFound
+		case u.Deleted:
+			result[id] = structs.UserStatusDeleted
+		case external, u.IsStranger:
+			result[id] = structs.UserStatusExternal
+		case u.TeamID != "" && u.TeamID != auth.TeamID &&
+			(auth.EnterpriseID == "" || u.Enterprise.EnterpriseID != auth.EnterpriseID):
+			// users of other workspaces of the same Enterprise Grid org are not external
+			result[id] = structs.UserStatusExternal
+		}
+	}
+
+	return result, nil
+}
+
+// AddTeam sets the workspace of the author of the message and its replies where Slack omits it,
+// like for messages of users of other workspaces of the shared channel.
+func (sc *SlackClient) AddTeam(msg *structs.Message) error {
+	add := func(m *slack.Message) error {
+		if m.Team != "" || m.User == "" {
+			return nil
+		}
+
+		u, err := sc.GetUser(m.User)
+		if err != nil {
+			if isUserNotFound(err) {
+				return nil
+			}
+			return fmt.Errorf("could not get user %q: %w", m.User, err)
+		}
+
+		m.Team = u.TeamID
+		return nil
+	}
+
+	if err := add(&msg.Message); err != nil {
+		return err
+	}
+
+	for i := range msg.Replies {
+		if err := add(&msg.Replies[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetTeams returns the workspaces by ID: names and domains of the ones the token can see
+// (requires team:read scope), others have the ID only. Workspaces which are not internal
+// to the shared channel and are not of the token are external.
+func (sc *SlackClient) GetTeams(channel *slack.Channel, ids map[string]struct{}) (map[string]*structs.Team, error) {
+	auth, err := sc.AuthTest()
+	if err != nil {
+		return nil, fmt.Errorf("could not get auth info: %w", err)
+	}
+
+	result := make(map[string]*structs.Team, len(ids))
+	for id := range ids {
+		if id == "" {
+			continue
+		}
+
+		team, err := sc.getTeam(id)
+		if err != nil {
+			return nil, fmt.Errorf("could not get team %q: %w", id, err)
+		}
+
+		t := *team
+		t.External = id != auth.TeamID && !slices.Contains(channel.InternalTeamIDs, id)
+		result[id] = &t
+	}
+
+	return result, nil
+}
+
+func (sc *SlackClient) getTeam(id string) (*structs.Team, error) {
+	if team, ok := sc.teams[id]; ok {
+		return team, nil
+	}
+
+	if err := sc.limiters.forMethod("team.info").Wait(sc.ctx); err != nil {
+		return nil, fmt.Errorf("rate limit error: %w", err)
+	}
+
+	team := &structs.Team{ID: id}
+
+	info, err := sc.api.GetOtherTeamInfo(id)
+	switch {
+	case err == nil:
+		team.Name, team.Domain = info.Name, info.Domain
+	case strings.Contains(err.Error(), "team_not_found"), strings.Contains(err.Error(), "team_access_not_granted"):
+		// workspaces of other organizations may be hidden from the token
+	default:
+		return nil, err
+	}
+
+	sc.teams[id] = team
+	return team, nil
+}
+
+// AuthTest returns the identity of the token, the result is requested once.
+func (sc *SlackClient) AuthTest() (*slack.AuthTestResponse, error) {
+	if sc.auth != nil {
+		return sc.auth, nil
+	}
+
+	if err := sc.limiters.forMethod("auth.test").Wait(sc.ctx); err != nil {
+		return nil, fmt.Errorf("rate limit error: %w", err)
+	}
+
+	auth, err := sc.api.AuthTest()
+	if err != nil {
+		return nil, err
+	}
+
+	sc.auth = auth
+	return auth, nil
+}
+
+// GetChannelInfo returns information about the channel, such as the name.
+func (sc *SlackClient) GetChannelInfo(channel string) (*slack.Channel, error) {
+	if channel == "" {
+		return nil, errChannelRequired
+	}
+
+	c, ok := sc.channels[channel]
+	if !ok {
+		c, ok = sc.channelsCache.Get(channel)
+	}
+	if !ok {
+		if err := sc.limiters.forMethod("conversations.info").Wait(sc.ctx); err != nil {
+			return nil, fmt.Errorf("rate limit error: %w", err)
+		}
+
+		var err error
+		c, err = sc.api.GetConversationInfoContext(sc.ctx, &slack.GetConversationInfoInput{ChannelID: channel})
+		if err != nil {
+			return nil, err
+		}
+
+		sc.channelsCache.Set(channel, c)
+	}
+	sc.channels[channel] = c
+
+	// reset seen users
+	sc.seenUsers = make(map[string]interface{})
+	if c.User != "" {
+		sc.seenUsers[c.User] = struct{}{}
+	}
+
+	return c, nil
+}
+
+// GetMembers returns the IDs of all the members of the channel.
+// Members are also marked as seen, so they are included in the users export.
+func (sc *SlackClient) GetMembers(channel string) ([]string, error) {
+	if channel == "" {
+		return nil, errChannelRequired
+	}
+
+	var allMembers []string
+
+	cursor := ""
+	for {
+		err := sc.limiters.forMethod("conversations.members").Wait(sc.ctx)
+		if err != nil {
+			return nil, fmt.Errorf("rate limit error: %w", err)
+		}
+
+		members, nextCursor, err := sc.api.GetUsersInConversation(&slack.GetUsersInConversationParameters{
+			ChannelID: channel,
+			Limit:     pageLimit("conversations.members", cfg.PageSize),
+			Cursor:    cursor,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		allMembers = append(allMembers, members...)
+
+		if nextCursor == "" {
+			break
+		}
+
+		cursor = nextCursor
+	}
+
+	for _, member := range allMembers {
+		sc.seenUsers[member] = nil
+	}
+
+	// the order of members isn't documented, sorted they are the same in every export
+	sort.Strings(allMembers)
+
+	return allMembers, nil
+}
+
+// EachMessage calls fn for every message in the channel (with its thread replies) newest first,
+// fetching history page by page, so the messages are never held in memory all at once.
+// Pages are saved to the checkpoint: the interrupted channel is resumed from the last page
+// and messages of the pages fetched before are passed to fn again.
+func (sc *SlackClient) EachMessage(channel string, fn func(msg structs.Message) error) error {
+	if channel == "" {
+		return errChannelRequired
+	}
+
+	var cp exporter.Checkpoint
+	if checkpoint != nil {
+		cp = checkpoint
+	}
+
+	return sc.Exporter(nil, cp).Messages(sc.ctx, channel, func(msg structs.Message) error {
+		return fn(sc.convertToMsg(msg.Message, msg.Replies))
+	})
+}
+
+// Exporter returns the exporter of the channels with the history range, page size
+// and thread concurrency of the config, paced by the limiters of the client.
+// Threads which can't be fetched or miss replies are reported as failures.
+func (sc *SlackClient) Exporter(channels []string, cp exporter.Checkpoint) *exporter.Exporter {
+	opts := exporter.Options{
+		Channels:          channels,
+		Oldest:            cfg.Since.Time,
+		PageSize:          pageLimit("conversations.history", cfg.PageSize),
+		ThreadConcurrency: max(cfg.ThreadConcurrency, 1),
+		Limiter:           sc.limiters,
+		Checkpoint:        cp,
+		ThreadError:       threadError,
+	}
+	if !cfg.Until.IsZero() {
+		// the end of the range includes the whole --until day
+		opts.Latest = cfg.Until.AddDate(0, 0, 1)
+	}
+
+	return exporter.New(sc.api, opts)
+}
+
+// threadError reports the thread which can't be fetched or is incomplete,
+// the export goes on unless the token can't be used anymore.
+func threadError(channel string, root slack.Message, err error) error {
+	if errors.Is(err, exporter.ErrIncompleteThread) {
+		log.Printf("Thread '%s' is incomplete: %v", root.Timestamp, err)
+		failures.Add(statusIncomplete, "replies", channel+"/"+root.Timestamp, err)
+		return nil
+	}
+
+	if isTokenRevoked(err) {
+		return err
+	}
+
+	log.Printf("Could not get replies for message '%s': %v", root.Timestamp, err)
+	failures.Add(statusFailed, "replies", channel+"/"+root.Timestamp, err)
+	return nil
+}
+
+func (sc *SlackClient) convertToMsg(message slack.Message, replies []slack.Message) structs.Message {
+	return structs.Message{
+		Message:  message,
+		Replies:  replies,
+		Workflow: newWorkflow(message),
+	}
+}
+
+// markSeen remembers the author and mentioned users of the message, so they are exported.
+func (sc *SlackClient) markSeen(message slack.Message) {
+	sc.seenUsers[message.User] = nil
+
+	for _, block := range message.Blocks.BlockSet {
+		switch block.BlockType() {
+		case slack.MBTRichText:
+			sc.processRichTextElements(block.(*slack.RichTextBlock).Elements)
+		}
+	}
+}
+
+func (sc *SlackClient) processRichTextElements(elements []slack.RichTextElement) {
+	for _, element := range elements {
+		switch element.RichTextElementType() {
+		case slack.RTESection:
+			sc.processRichTextSectionElements(element.(*slack.RichTextSection).Elements)
+		case slack.RTEQuote:
+			sc.processRichTextSectionElements(element.(*slack.RichTextQuote).Elements)
+		case slack.RTEList:
+			sc.processRichTextElements(element.(*slack.RichTextList).Elements)
+		}
+	}
+}
+
+func (sc *SlackClient) processRichTextSectionElements(elements []slack.RichTextSectionElement) {
+	for _, rtEelement := range elements {
+		switch rtEelement.RichTextSectionElementType() {
+		case slack.RTSEUser:
+			sc.seenUsers[rtEelement.(*slack.RichTextSectionUserElement).UserID] = nil
+		}
+	}
+}
+
+// AddPermalinks sets permalinks of the message and its thread replies,
+// built from the workspace URL the way chat.getPermalink returns them, without a request per message.
+func (sc *SlackClient) AddPermalinks(channel string, msg *structs.Message) error {
+	auth, err := sc.AuthTest()
+	if err != nil {
+		return fmt.Errorf("could not get workspace URL: %w", err)
+	}
+
+	msg.Permalink = permalink(auth.URL, channel, msg.Timestamp, "")
+	for i := range msg.Replies {
+		msg.Replies[i].Permalink = permalink(auth.URL, channel, msg.Replies[i].Timestamp, msg.Timestamp)
+	}
+
+	return nil
+}
+
+// AddCall sets the huddle or the call of the message (like Zoom, posted as a call block)
+// and adds its recordings, transcripts and notes to the files of the message,
+// files which can't be read with the token scopes are skipped.
+func (sc *SlackClient) AddCall(channel string, msg *structs.Message) error {
+	if !isCallMessage(msg.Message) {
+		return nil
 	}
-	resp, err := http.DefaultClient.Do(req)
+
+	call, err := sc.getCall(channel, msg.Timestamp)
+	if err != nil {
+		return err
+	}
+	if call == nil {
+		return nil
+	}
+
+	msg.Call = call
+
+	for _, id := range call.FileIDs {
+		if hasFile(msg.Files, id) {
+			continue
+		}
+
+		file, _, err := sc.getFileInfo(id)
+		if err != nil {
+			if isTokenRevoked(err) {
+				return err
+			}
+			log.Printf("Could not get file %q of the call %s: %v", id, call.ID, err)
+			failures.Add(statusFailed, "file", id, err)
+			continue
+		}
+
+		msg.Files = append(msg.Files, *file)
+	}
+
+	return nil
+}
+
+// isCallMessage reports whether the message is the thread of the huddle or has the call block.
+func isCallMessage(msg slack.Message) bool {
+	if msg.SubType == "huddle_thread" {
+		return true
+	}
+
+	for _, block := range msg.Blocks.BlockSet {
+		if block.BlockType() == "call" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasFile(files []slack.File, id string) bool {
+	for _, f := range files {
+		if f.ID == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// rawCallMessage has the fields of the message which slack-go doesn't decode.
+type rawCallMessage struct {
+	Room *struct {
+		ID                 string   `json:"id"`
+		Name               string   `json:"name"`
+		CreatedBy          string   `json:"created_by"`
+		DateStart          int64    `json:"date_start"`
+		DateEnd            int64    `json:"date_end"`
+		ParticipantHistory []string `json:"participant_history"`
+		AttachedFileIDs    []string `json:"attached_file_ids"`
+	} `json:"room"`
+	Blocks []struct {
+		Type   string `json:"type"`
+		CallID string `json:"call_id"`
+		Call   struct {
+			V1 struct {
+				Name            string `json:"name"`
+				CreatedBy       string `json:"created_by"`
+				DateStart       int64  `json:"date_start"`
+				DateEnd         int64  `json:"date_end"`
+				JoinURL         string `json:"join_url"`
+				AllParticipants []struct {
+					SlackID     string `json:"slack_id"`
+					DisplayName string `json:"display_name"`
+				} `json:"all_participants"`
+			} `json:"v1"`
+		} `json:"call"`
+	} `json:"blocks"`
+}
+
+// getCall fetches the message again with conversations.history, decoding the huddle room or the call block.
+func (sc *SlackClient) getCall(channel, ts string) (*structs.Call, error) {
+	var resp struct {
+		Messages []rawCallMessage `json:"messages"`
+	}
+
+	err := sc.callAPI("conversations.history", url.Values{
+		"channel":   {channel},
+		"oldest":    {ts},
+		"latest":    {ts},
+		"inclusive": {"true"},
+		"limit":     {"1"},
+	}, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("could not get call of the message %s: %w", ts, err)
+	}
+
+	if len(resp.Messages) == 0 {
+		return nil, nil
+	}
+
+	raw := resp.Messages[0]
+
+	if room := raw.Room; room != nil {
+		return &structs.Call{
+			ID:           room.ID,
+			Kind:         structs.CallKindHuddle,
+			Name:         room.Name,
+			CreatedBy:    room.CreatedBy,
+			DateStart:    room.DateStart,
+			DateEnd:      room.DateEnd,
+			Duration:     callDuration(room.DateStart, room.DateEnd),
+			Participants: room.ParticipantHistory,
+			FileIDs:      room.AttachedFileIDs,
+		}, nil
+	}
+
+	for _, block := range raw.Blocks {
+		if block.Type != "call" {
+			continue
+		}
+
+		v1 := block.Call.V1
+		call := &structs.Call{
+			ID:        block.CallID,
+			Kind:      structs.CallKindCall,
+			Name:      v1.Name,
+			CreatedBy: v1.CreatedBy,
+			DateStart: v1.DateStart,
+			DateEnd:   v1.DateEnd,
+			Duration:  callDuration(v1.DateStart, v1.DateEnd),
+			JoinURL:   v1.JoinURL,
+		}
+		for _, p := range v1.AllParticipants {
+			if p.SlackID != "" {
+				call.Participants = append(call.Participants, p.SlackID)
+			} else if p.DisplayName != "" {
+				call.ExternalParticipants = append(call.ExternalParticipants, p.DisplayName)
+			}
+		}
+
+		return call, nil
+	}
+
+	return nil, nil
+}
+
+func callDuration(start, end int64) int64 {
+	if start == 0 || end < start {
+		return 0
+	}
+
+	return end - start
+}
+
+// AddLists adds Slack Lists shared in the message and its replies to lists,
+// lists which can't be read with the token scopes are skipped.
+func (sc *SlackClient) AddLists(msg structs.Message, lists map[string]*structs.List) error {
+	add := func(files []slack.File) error {
+		for _, file := range files {
+			if !isList(file) {
+				continue
+			}
+			if _, ok := lists[file.ID]; ok {
+				continue
+			}
+
+			list, err := sc.GetList(file.ID)
+			if err != nil {
+				if isTokenRevoked(err) {
+					return err
+				}
+				log.Printf("Could not get list %q: %v", file.ID, err)
+				failures.Add(statusFailed, "list", file.ID, err)
+				continue
+			}
+
+			lists[file.ID] = list
+		}
+		return nil
+	}
+
+	if err := add(msg.Files); err != nil {
+		return err
+	}
+	for _, reply := range msg.Replies {
+		if err := add(reply.Files); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetList returns columns of the list from files.info and all its items.
+func (sc *SlackClient) GetList(id string) (*structs.List, error) {
+	var info struct {
+		File struct {
+			ListMetadata struct {
+				Schema []structs.ListColumn `json:"schema"`
+			} `json:"list_metadata"`
+		} `json:"file"`
+	}
+	if err := sc.callAPI("files.info", url.Values{"file": {id}}, &info); err != nil {
+		return nil, err
+	}
+
+	list := &structs.List{Columns: info.File.ListMetadata.Schema}
+
+	column := make(map[string]int, len(list.Columns))
+	for i, c := range list.Columns {
+		column[c.ID] = i
+	}
+
+	cursor := ""
+	for {
+		var resp struct {
+			Items []struct {
+				ID        string         `json:"id"`
+				CreatedBy string         `json:"created_by"`
+				Fields    []rawListField `json:"fields"`
+			} `json:"items"`
+			ResponseMetadata struct {
+				NextCursor string `json:"next_cursor"`
+			} `json:"response_metadata"`
+		}
+
+		err := sc.callAPI("slackLists.items.list", url.Values{
+			"list_id": {id},
+			"limit":   {strconv.Itoa(pageLimit("slackLists.items.list", cfg.PageSize))},
+			"cursor":  {cursor},
+		}, &resp)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range resp.Items {
+			values := make([]string, len(list.Columns))
+			for _, f := range item.Fields {
+				if i, ok := column[f.ColumnID]; ok {
+					values[i] = f.String()
+				}
+			}
+
+			list.Items = append(list.Items, structs.ListItem{
+				ID:        item.ID,
+				CreatedBy: item.CreatedBy,
+				Values:    values,
+			})
+		}
+
+		if resp.ResponseMetadata.NextCursor == "" {
+			break
+		}
+
+		cursor = resp.ResponseMetadata.NextCursor
+	}
+
+	return list, nil
+}
+
+// fileInfo is the file metadata with all its comments returned by files.info.
+type fileInfo struct {
+	file     *slack.File
+	comments []slack.Comment
+}
+
+// EnrichFiles replaces files attached to the message and its replies with the full metadata
+// returned by files.info (shares, initial comment, thumbnails) and adds the file comments
+// (unless comments is nil).
+func (sc *SlackClient) EnrichFiles(msg structs.Message, comments map[string][]slack.Comment) error {
+	enrich := func(files []slack.File) error {
+		for i, file := range files {
+			info, ok := sc.filesInfo[file.ID]
+			if !ok {
+				f, fileComments, err := sc.getFileInfo(file.ID)
+				if err != nil {
+					if isTokenRevoked(err) {
+						return err
+					}
+					log.Printf("Could not get file %q info: %v", file.ID, err)
+					failures.Add(statusFailed, "file", file.ID, err)
+					continue
+				}
+				info = fileInfo{file: f, comments: fileComments}
+				sc.filesInfo[file.ID] = info
+			}
+			// the file shared in several channels has its comments in all of them
+			if len(info.comments) > 0 && comments != nil {
+				comments[file.ID] = info.comments
+			}
+			files[i] = *info.file
+		}
+		return nil
+	}
+
+	if err := enrich(msg.Files); err != nil {
+		return err
+	}
+	for _, reply := range msg.Replies {
+		if err := enrich(reply.Files); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getFileInfo returns the file metadata and all its comments.
+func (sc *SlackClient) getFileInfo(id string) (*slack.File, []slack.Comment, error) {
+	var (
+		file        *slack.File
+		allComments []slack.Comment
+	)
+
+	for page := 1; ; page++ {
+		if err := sc.limiters.forMethod("files.info").Wait(sc.ctx); err != nil {
+			return nil, nil, fmt.Errorf("rate limit error: %w", err)
+		}
+
+		f, comments, paging, err := sc.api.GetFileInfo(id, pageLimit("files.info", cfg.PageSize), page)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		file = f
+		allComments = append(allComments, comments...)
+
+		if paging == nil || page >= paging.Pages {
+			break
+		}
+	}
+
+	return file, allComments, nil
+}
+
+// CollectFiles remembers files attached to the message and its replies
+// to be downloaded with DownloadFiles.
+func (sc *SlackClient) CollectFiles(msg structs.Message) {
+	collect := func(files []slack.File) {
+		for _, file := range files {
+			if !collectable(file) {
+				continue
+			}
+			if _, ok := sc.files[file.ID]; !ok && storedFilename(file.ID) == "" {
+				sc.filesSize += int64(file.Size)
+			}
+			sc.files[file.ID] = newCollectedFile(file, msg.Timestamp)
+		}
+	}
+
+	collect(msg.Files)
+	for _, reply := range msg.Replies {
+		collect(reply.Files)
+	}
+}
+
+// DownloadFiles downloads all the collected files and links them by --file-layout,
+// returns names of the files and their paths relative to the output directory by ID.
+func (sc *SlackClient) DownloadFiles(channelID string) (map[string]string, map[string]string, error) {
+	files, paths := make(map[string]string), make(map[string]string)
+
+	// files of the next channel (or saved items) are collected from scratch
+	collected := sc.files
+	sc.files = make(map[string]collectedFile)
+
+	// no file is started when all of them don't fit
+	size := sc.filesSize
+	sc.filesSize = 0
+	if err := reserveSpace(size); err != nil {
+		return nil, nil, err
+	}
+
+	for id, file := range collected {
+		filename, err := sc.downloadFile(id, file)
+		if err == nil {
+			paths[id] = layoutPath(channelID, id, filename, file)
+			err = linkStored(paths[id], id+"-"+filename)
+		}
+		if isOutOfSpace(err) {
+			return nil, nil, err
+		}
+		if err != nil {
+			log.Printf("could not download file %q: %v", id, err)
+			failures.Add(statusFailed, "file", id, err)
+			sc.missingFiles[id] = missingReason(err)
+		}
+
+		files[id] = filename
+	}
+
+	return files, paths, nil
+}
+
+// downloadFile downloads the file to the store unless it's already there,
+// returns the name of the file without the ID prefix.
+// The interrupted download is continued, by the next attempt or by the next run.
+func (sc *SlackClient) downloadFile(id string, file collectedFile) (string, error) {
+	if filename := storedFilename(id); filename != "" {
+		return filename, nil
+	}
+
+	if err := os.MkdirAll(filepath.Join(cfg.Output, storeDirname), 0o755); err != nil {
+		return "", fmt.Errorf("could not create directory: %w", err)
+	}
+
+	if file.provider != "" {
+		return sc.downloadExternal(id, file)
+	}
+
+	var (
+		filename string
+		err      error
+	)
+	for attempt := 1; attempt <= downloadAttempts; attempt++ {
+		filename, err = sc.downloadPart(id, file.url)
+		if !errors.Is(err, errDownloadInterrupted) {
+			break
+		}
+		log.Printf("Download of file %q is interrupted (attempt %d of %d): %v", id, attempt, downloadAttempts, err)
+	}
+
+	return filename, err
+}
+
+// fileStatusError returns the error of the file download response,
+// classifying the ones which mean the file is gone or hidden from the token.
+func fileStatusError(code int) error {
+	switch code {
+	case http.StatusGone:
+		return fmt.Errorf("%w: %w: %d", errBadStatus, errFileDeleted, code)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("%w: %w: %d", errBadStatus, errFileAccessDenied, code)
+	case http.StatusNotFound:
+		return fmt.Errorf("%w: %w: %d", errBadStatus, errFileNotFound, code)
+	default:
+		return fmt.Errorf("%w: %d", errBadStatus, code)
+	}
+}
+
+// missingReason returns why the file was not downloaded by the download error.
+func missingReason(err error) string {
+	switch {
+	case errors.Is(err, errFileDeleted):
+		return structs.FileDeleted
+	case errors.Is(err, errFileAccessDenied):
+		return structs.FileAccessDenied
+	case errors.Is(err, errFileNotFound):
+		return structs.FileNotFound
+	default:
+		return structs.FileFailed
+	}
+}
+
+// downloadPart downloads the file to <id>.part in the store, continuing the part left
+// by the interrupted download with the Range request when the server supports it,
+// and moves the complete file to <id>-<name>.
+func (sc *SlackClient) downloadPart(id, fileURL string) (string, error) {
+	part := filepath.Join(cfg.Output, storeDirname, id+partSuffix)
+
+	var offset int64
+	if info, err := os.Stat(part); err == nil {
+		offset = info.Size()
+	}
+
+	req, err := http.NewRequestWithContext(sc.ctx, http.MethodGet, fileURL, http.NoBody)
+	if err != nil {
+		return "", fmt.Errorf("could not create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+sc.token)
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	err = sc.limiters[limiterFiles].Wait(sc.ctx)
+	if err != nil {
+		return "", fmt.Errorf("rate limit error: %w", err)
+	}
+	resp, err := sc.httpClient.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("could not send request: %w", err)
 	}
 
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("%w: %d", errBadStatus, resp.StatusCode)
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)):
+		// the rest of the file
+	case resp.StatusCode == http.StatusOK:
+		// the server ignored the range, the file is downloaded from the start
+		offset = 0
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		// the part doesn't match the file anymore
+		if err := os.Remove(part); err != nil {
+			return "", fmt.Errorf("could not remove partial file: %w", err)
+		}
+		return "", fmt.Errorf("%w: the partial file is outdated", errDownloadInterrupted)
+	default:
+		return "", fileStatusError(resp.StatusCode)
+	}
+
+	if err := reserveSpace(max(resp.ContentLength, 0)); err != nil {
+		return "", err
 	}
 
 	// read content-disposition header
@@ -506,15 +1727,28 @@ func (sc *SlackClient) downloadFile(path, id, fileURL string) (string, error) {
 		filename = id
 	}
 
-	content, err := io.ReadAll(resp.Body)
+	flag := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if offset == 0 {
+		flag |= os.O_TRUNC
+	}
+
+	file, err := os.OpenFile(part, flag, 0o644)
 	if err != nil {
-		return "", fmt.Errorf("could not read body: %w", err)
+		return "", fmt.Errorf("could not create file: %w", err)
 	}
 
-	// adding id prefix to filename to avoid collisions (like a few files named image.png)
-	err = os.WriteFile(filepath.Join(cfg.Output, path, id+"-"+filename), content, 0o600)
+	n, err := io.Copy(file, resp.Body)
+	written.Add(n)
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		return "", fmt.Errorf("could not close file: %w", closeErr)
+	}
 	if err != nil {
-		return "", fmt.Errorf("could not write file: %w", err)
+		return "", fmt.Errorf("%w: %w", errDownloadInterrupted, err)
+	}
+
+	// adding id prefix to filename to avoid collisions (like a few files named image.png)
+	if err := os.Rename(part, filepath.Join(cfg.Output, storeDirname, id+"-"+filename)); err != nil {
+		return "", fmt.Errorf("could not rename file: %w", err)
 	}
 
 	return filename, nil
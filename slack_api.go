@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+
+	"github.com/chuhlomin/slack-exporter/pkg/exporter"
+)
+
+// SlackAPI is the subset of slack.Client methods used by SlackClient,
+// including the ones of the history pipeline of exporter.API.
+// It allows replacing the real client with a mock in tests.
+type SlackAPI interface {
+	exporter.API
+
+	AuthTest() (*slack.AuthTestResponse, error)
+	GetConversations(params *slack.GetConversationsParameters) ([]slack.Channel, string, error)
+	GetUsersInConversation(params *slack.GetUsersInConversationParameters) ([]string, string, error)
+	GetFileInfo(fileID string, count, page int) (*slack.File, []slack.Comment, *slack.Paging, error)
+	GetUsersPaginated(options ...slack.GetUsersOption) slack.UserPagination
+	GetUserProfile(params *slack.GetUserProfileParameters) (*slack.UserProfile, error)
+	GetTeamProfile(teamID ...string) (*slack.TeamProfile, error)
+	GetOtherTeamInfo(team string) (*slack.TeamInfo, error)
+	ListReminders() ([]*slack.Reminder, error)
+	GetAccessLogs(params slack.AccessLogParameters) ([]slack.Login, *slack.Paging, error)
+	ListStars(params slack.StarsParameters) ([]slack.Item, *slack.Paging, error)
+	ListPins(channel string) ([]slack.Item, *slack.Paging, error)
+
+	// CallMethod calls the Slack API method which slack-go doesn't support (or doesn't decode fully),
+	// like users.channelSections.list or admin.emoji.list, and decodes the response into out.
+	CallMethod(ctx context.Context, method string, values url.Values, out interface{}) error
+}
+
+// webAPI is the SlackAPI of the token: slack.Client with the methods it doesn't support
+// called with the same HTTP client.
+type webAPI struct {
+	*slack.Client
+	httpClient *http.Client
+	token      string
+}
+
+var _ SlackAPI = (*webAPI)(nil)
+
+func newWebAPI(token string, httpClient *http.Client) *webAPI {
+	return &webAPI{
+		Client:     slack.New(token, slack.OptionHTTPClient(httpClient)),
+		httpClient: httpClient,
+		token:      token,
+	}
+}
+
+func (w *webAPI) CallMethod(ctx context.Context, method string, values url.Values, out interface{}) error {
+	for {
+		req, err := http.NewRequestWithContext(
+			ctx,
+			http.MethodPost,
+			"https://slack.com/api/"+method,
+			strings.NewReader(values.Encode()),
+		)
+		if err != nil {
+			return fmt.Errorf("could not create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Authorization", "Bearer "+w.token)
+
+		resp, err := w.httpClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("could not send request: %w", err)
+		}
+
+		b, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("could not read response: %w", err)
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests {
+			retryAfter, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+			log.Printf("Rate limit exceeded. Retrying after %ds", retryAfter)
+			time.Sleep(time.Duration(retryAfter) * time.Second)
+			continue
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("%w: %d", errBadStatus, resp.StatusCode)
+		}
+
+		var slackResp slack.SlackResponse
+		if err := json.Unmarshal(b, &slackResp); err != nil {
+			return fmt.Errorf("could not decode response: %w", err)
+		}
+
+		if !slackResp.Ok {
+			return fmt.Errorf("%s: %w", method, slack.SlackErrorResponse{Err: slackResp.Error})
+		}
+
+		if err := json.Unmarshal(b, out); err != nil {
+			return fmt.Errorf("could not decode response: %w", err)
+		}
+
+		return nil
+	}
+}
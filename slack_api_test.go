@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"github.com/slack-go/slack"
+	"golang.org/x/time/rate"
+
+	"github.com/chuhlomin/slack-exporter/pkg/aimd"
+)
+
+// fakeSlackAPI is the SlackAPI serving channels, threads and raw method responses from memory.
+// Methods it doesn't implement panic on the nil embedded SlackAPI.
+type fakeSlackAPI struct {
+	SlackAPI
+
+	mu sync.Mutex
+
+	// history are messages of channels in the order Slack returns them, newest first.
+	history map[string][]slack.Message
+	// threads are replies of thread roots by their timestamp, the n-th fetch of the thread
+	// returns the n-th list (the last one is repeated), the root is not in them.
+	threads map[string][][]slack.Message
+	// channels are returned by conversations.list.
+	channels []slack.Channel
+	// profiles are returned by users.profile.get.
+	profiles map[string]*slack.UserProfile
+	// files are returned by files.info with their comments.
+	files    map[string]*slack.File
+	comments map[string][]slack.Comment
+	// responses are JSON responses of CallMethod by method, returned in order.
+	responses map[string][]string
+	// errs are returned by calls of the method before the results, one error per call.
+	errs map[string][]error
+
+	// calls are the numbers of calls by method.
+	calls map[string]int
+	// fetches are the numbers of fetches of threads by the root timestamp.
+	fetches map[string]int
+	// limits are the page sizes of conversations.history calls.
+	limits []int
+}
+
+func newFakeSlackAPI() *fakeSlackAPI {
+	return &fakeSlackAPI{
+		history:   map[string][]slack.Message{},
+		threads:   map[string][][]slack.Message{},
+		profiles:  map[string]*slack.UserProfile{},
+		files:     map[string]*slack.File{},
+		comments:  map[string][]slack.Comment{},
+		responses: map[string][]string{},
+		errs:      map[string][]error{},
+		calls:     map[string]int{},
+		fetches:   map[string]int{},
+	}
+}
+
+// call counts the call of the method and returns its next error.
+func (f *fakeSlackAPI) call(method string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls[method]++
+
+	if errs := f.errs[method]; len(errs) > 0 {
+		f.errs[method] = errs[1:]
+		return errs[0]
+	}
+
+	return nil
+}
+
+// page returns the page of items from the cursor (the offset) and the cursor of the next one.
+func page[T any](items []T, cursor string, limit int) ([]T, string) {
+	start, _ := strconv.Atoi(cursor)
+	start = min(start, len(items))
+	end := len(items)
+	if limit > 0 {
+		end = min(start+limit, len(items))
+	}
+
+	next := ""
+	if end < len(items) {
+		next = strconv.Itoa(end)
+	}
+
+	return items[start:end], next
+}
+
+func (f *fakeSlackAPI) GetConversationHistoryContext(
+	_ context.Context,
+	params *slack.GetConversationHistoryParameters,
+) (*slack.GetConversationHistoryResponse, error) {
+	f.mu.Lock()
+	f.limits = append(f.limits, params.Limit)
+	f.mu.Unlock()
+
+	if err := f.call("conversations.history"); err != nil {
+		return nil, err
+	}
+
+	msgs, next := page(f.history[params.ChannelID], params.Cursor, params.Limit)
+
+	resp := &slack.GetConversationHistoryResponse{
+		SlackResponse: slack.SlackResponse{Ok: true},
+		HasMore:       next != "",
+		Messages:      msgs,
+	}
+	resp.ResponseMetaData.NextCursor = next
+
+	return resp, nil
+}
+
+func (f *fakeSlackAPI) GetConversationRepliesContext(
+	_ context.Context,
+	params *slack.GetConversationRepliesParameters,
+) ([]slack.Message, bool, string, error) {
+	if err := f.call("conversations.replies"); err != nil {
+		return nil, false, "", err
+	}
+
+	fetches := f.threads[params.Timestamp]
+	if len(fetches) == 0 {
+		return nil, false, "", slack.SlackErrorResponse{Err: "thread_not_found"}
+	}
+
+	// the fetch of the thread starts with the page without the cursor
+	f.mu.Lock()
+	if params.Cursor == "" {
+		f.fetches[params.Timestamp]++
+	}
+	n := f.fetches[params.Timestamp] - 1
+	f.mu.Unlock()
+
+	root := slack.Message{Msg: slack.Msg{Timestamp: params.Timestamp}}
+	thread := append([]slack.Message{root}, fetches[min(n, len(fetches)-1)]...)
+
+	msgs, next := page(thread, params.Cursor, params.Limit)
+	return msgs, next != "", next, nil
+}
+
+func (f *fakeSlackAPI) GetConversations(params *slack.GetConversationsParameters) ([]slack.Channel, string, error) {
+	if err := f.call("conversations.list"); err != nil {
+		return nil, "", err
+	}
+
+	channels, next := page(f.channels, params.Cursor, params.Limit)
+	return channels, next, nil
+}
+
+func (f *fakeSlackAPI) GetConversationInfoContext(
+	_ context.Context,
+	input *slack.GetConversationInfoInput,
+) (*slack.Channel, error) {
+	if err := f.call("conversations.info"); err != nil {
+		return nil, err
+	}
+
+	for i := range f.channels {
+		if f.channels[i].ID == input.ChannelID {
+			return &f.channels[i], nil
+		}
+	}
+
+	return nil, slack.SlackErrorResponse{Err: "channel_not_found"}
+}
+
+func (f *fakeSlackAPI) GetUserProfile(params *slack.GetUserProfileParameters) (*slack.UserProfile, error) {
+	if err := f.call("users.profile.get"); err != nil {
+		return nil, err
+	}
+
+	profile, ok := f.profiles[params.UserID]
+	if !ok {
+		return nil, slack.SlackErrorResponse{Err: "user_not_found"}
+	}
+
+	return profile, nil
+}
+
+func (f *fakeSlackAPI) GetFileInfo(id string, _, _ int) (*slack.File, []slack.Comment, *slack.Paging, error) {
+	if err := f.call("files.info"); err != nil {
+		return nil, nil, nil, err
+	}
+
+	file, ok := f.files[id]
+	if !ok {
+		return nil, nil, nil, slack.SlackErrorResponse{Err: "file_not_found"}
+	}
+
+	return file, f.comments[id], &slack.Paging{Pages: 1}, nil
+}
+
+func (f *fakeSlackAPI) CallMethod(_ context.Context, method string, _ url.Values, out interface{}) error {
+	if err := f.call(method); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	responses := f.responses[method]
+	if len(responses) == 0 {
+		f.mu.Unlock()
+		return fmt.Errorf("%s: unexpected call", method)
+	}
+	f.responses[method] = responses[1:]
+	f.mu.Unlock()
+
+	return json.Unmarshal([]byte(responses[0]), out)
+}
+
+// newTestClient returns the client of the API which is not rate limited.
+func newTestClient(api SlackAPI) *SlackClient {
+	sc := NewSlackClient("", "")
+	sc.SetAPI(api)
+
+	for key := range sc.limiters {
+		sc.limiters[key] = aimd.New(rate.Inf, rate.Inf, rate.Inf)
+	}
+
+	return sc
+}
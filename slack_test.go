@@ -0,0 +1,545 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+
+	"github.com/chuhlomin/slack-exporter/pkg/structs"
+)
+
+func message(ts string, replyCount int) slack.Message {
+	return slack.Message{Msg: slack.Msg{Timestamp: ts, ReplyCount: replyCount}}
+}
+
+func messages(ts ...string) []slack.Message {
+	msgs := make([]slack.Message, 0, len(ts))
+	for _, t := range ts {
+		msgs = append(msgs, message(t, 0))
+	}
+	return msgs
+}
+
+func timestamps(msgs []slack.Message) []string {
+	result := make([]string, 0, len(msgs))
+	for _, m := range msgs {
+		result = append(result, m.Timestamp)
+	}
+	return result
+}
+
+// setConfig replaces the config for the test.
+func setConfig(t *testing.T, c config) {
+	t.Helper()
+
+	prev, prevFailures := cfg, failures
+	cfg, failures = c, &failureReport{}
+
+	t.Cleanup(func() {
+		cfg, failures = prev, prevFailures
+	})
+}
+
+// failureStatuses returns the items of the failure report as <kind>/<status>.
+func failureStatuses() []string {
+	var result []string
+	for _, item := range failures.Items {
+		result = append(result, item.Kind+"/"+item.Status)
+	}
+	return result
+}
+
+func TestEachMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		pageSize int
+		history  []slack.Message
+		threads  map[string][][]slack.Message
+		errs     map[string][]error
+
+		want         []string
+		wantReplies  map[string][]string
+		wantErr      string
+		wantFailures []string
+		wantCalls    map[string]int
+		wantLimits   []int
+	}{
+		{
+			name:      "history pages",
+			pageSize:  2,
+			history:   messages("5.000000", "4.000000", "3.000000", "2.000000", "1.000000"),
+			want:      []string{"5.000000", "4.000000", "3.000000", "2.000000", "1.000000"},
+			wantCalls: map[string]int{"conversations.history": 3},
+		},
+		{
+			name:     "messages of the page are sorted newest first",
+			pageSize: 10,
+			history:  messages("3.000000", "1.000000", "2.000000", "1.000002", "1.000010"),
+			want:     []string{"3.000000", "2.000000", "1.000010", "1.000002", "1.000000"},
+		},
+		{
+			name:     "thread replies are fetched page by page and sorted oldest first",
+			pageSize: 2,
+			history:  []slack.Message{message("10.000000", 3), message("9.000000", 0)},
+			threads: map[string][][]slack.Message{
+				"10.000000": {messages("13.000000", "11.000000", "12.000000")},
+			},
+			want:        []string{"10.000000", "9.000000"},
+			wantReplies: map[string][]string{"10.000000": {"11.000000", "12.000000", "13.000000"}},
+			wantCalls:   map[string]int{"conversations.replies": 2},
+		},
+		{
+			name:     "thread missing replies is fetched again",
+			pageSize: 10,
+			history:  []slack.Message{message("10.000000", 3)},
+			threads: map[string][][]slack.Message{
+				"10.000000": {messages("11.000000", "13.000000"), messages("12.000000", "13.000000")},
+			},
+			want:        []string{"10.000000"},
+			wantReplies: map[string][]string{"10.000000": {"11.000000", "12.000000", "13.000000"}},
+			wantCalls:   map[string]int{"conversations.replies": 2},
+		},
+		{
+			name:     "incomplete thread is reported",
+			pageSize: 10,
+			history:  []slack.Message{message("10.000000", 2)},
+			threads: map[string][][]slack.Message{
+				"10.000000": {messages("11.000000")},
+			},
+			want:         []string{"10.000000"},
+			wantReplies:  map[string][]string{"10.000000": {"11.000000"}},
+			wantFailures: []string{"replies/incomplete"},
+			wantCalls:    map[string]int{"conversations.replies": 3},
+		},
+		{
+			name:     "thread which can't be fetched is reported",
+			pageSize: 10,
+			history:  []slack.Message{message("10.000000", 1), message("9.000000", 0)},
+			threads: map[string][][]slack.Message{
+				"10.000000": {messages("11.000000")},
+			},
+			errs: map[string][]error{
+				"conversations.replies": {slack.SlackErrorResponse{Err: "internal_error"}},
+			},
+			want:         []string{"10.000000", "9.000000"},
+			wantFailures: []string{"replies/failed"},
+		},
+		{
+			name:     "revoked token stops the export",
+			pageSize: 10,
+			history:  []slack.Message{message("10.000000", 1)},
+			threads: map[string][][]slack.Message{
+				"10.000000": {messages("11.000000")},
+			},
+			errs: map[string][]error{
+				"conversations.replies": {slack.SlackErrorResponse{Err: "token_revoked"}},
+			},
+			wantErr: "token_revoked",
+		},
+		{
+			name:     "history page is halved on server errors",
+			pageSize: 200,
+			history:  messages("2.000000", "1.000000"),
+			errs: map[string][]error{
+				"conversations.history": {slack.StatusCodeError{Code: http.StatusBadGateway, Status: "502 Bad Gateway"}},
+			},
+			want:       []string{"2.000000", "1.000000"},
+			wantLimits: []int{200, 100},
+		},
+		{
+			name:     "history error",
+			pageSize: 10,
+			history:  messages("1.000000"),
+			errs: map[string][]error{
+				"conversations.history": {slack.SlackErrorResponse{Err: "channel_not_found"}},
+			},
+			wantErr: "channel_not_found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setConfig(t, config{PageSize: tt.pageSize, ThreadConcurrency: 2})
+
+			api := newFakeSlackAPI()
+			api.history["C1"] = tt.history
+			for ts, fetches := range tt.threads {
+				api.threads[ts] = fetches
+			}
+			for method, errs := range tt.errs {
+				api.errs[method] = errs
+			}
+
+			var (
+				got     []string
+				replies = map[string][]string{}
+			)
+			err := newTestClient(api).EachMessage("C1", func(msg structs.Message) error {
+				got = append(got, msg.Timestamp)
+				if len(msg.Replies) > 0 {
+					replies[msg.Timestamp] = timestamps(msg.Replies)
+				}
+				return nil
+			})
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("EachMessage: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got messages %v, want %v", got, tt.want)
+			}
+
+			if tt.wantReplies == nil {
+				tt.wantReplies = map[string][]string{}
+			}
+			if !reflect.DeepEqual(replies, tt.wantReplies) {
+				t.Errorf("got replies %v, want %v", replies, tt.wantReplies)
+			}
+
+			if got := failureStatuses(); !reflect.DeepEqual(got, tt.wantFailures) {
+				t.Errorf("got failures %v, want %v", got, tt.wantFailures)
+			}
+
+			for method, want := range tt.wantCalls {
+				if got := api.calls[method]; got != want {
+					t.Errorf("got %d calls of %s, want %d", got, method, want)
+				}
+			}
+
+			if tt.wantLimits != nil && !reflect.DeepEqual(api.limits, tt.wantLimits) {
+				t.Errorf("got page sizes %v, want %v", api.limits, tt.wantLimits)
+			}
+		})
+	}
+}
+
+func TestGetMessage(t *testing.T) {
+	setConfig(t, config{PageSize: 10})
+
+	api := newFakeSlackAPI()
+	api.history["C1"] = []slack.Message{message("10.000000", 2)}
+	api.threads["10.000000"] = [][]slack.Message{messages("12.000000", "11.000000")}
+
+	msg, err := newTestClient(api).GetMessage("C1", "10.000000")
+	if err != nil {
+		t.Fatalf("GetMessage: %v", err)
+	}
+
+	if msg == nil || msg.Timestamp != "10.000000" {
+		t.Fatalf("got message %v, want 10.000000", msg)
+	}
+
+	if got, want := timestamps(msg.Replies), []string{"11.000000", "12.000000"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got replies %v, want %v", got, want)
+	}
+}
+
+func TestEnrichFiles(t *testing.T) {
+	setConfig(t, config{PageSize: 10})
+
+	api := newFakeSlackAPI()
+	api.files["F1"] = &slack.File{ID: "F1", Name: "report.pdf", CommentsCount: 1}
+	api.comments["F1"] = []slack.Comment{{ID: "Fc1", Comment: "looks good"}}
+
+	sc := newTestClient(api)
+
+	// the file is shared in two channels, the second one is enriched from the cache
+	for _, channelID := range []string{"C1", "C2"} {
+		msg := structs.Message{Message: message("10.000000", 0)}
+		msg.Files = []slack.File{{ID: "F1"}}
+
+		comments := map[string][]slack.Comment{}
+		if err := sc.EnrichFiles(msg, comments); err != nil {
+			t.Fatalf("EnrichFiles in %s: %v", channelID, err)
+		}
+
+		if msg.Files[0].Name != "report.pdf" {
+			t.Errorf("%s: got file %+v, want the files.info one", channelID, msg.Files[0])
+		}
+		if got := comments["F1"]; len(got) != 1 || got[0].ID != "Fc1" {
+			t.Errorf("%s: got comments %v, want Fc1", channelID, got)
+		}
+	}
+
+	if api.calls["files.info"] != 1 {
+		t.Errorf("got %d files.info calls, want 1", api.calls["files.info"])
+	}
+}
+
+func TestListUsersRetriesRateLimitedPage(t *testing.T) {
+	setConfig(t, config{PageSize: 10})
+
+	var cursors []string
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if err := req.ParseForm(); err != nil {
+			return nil, err
+		}
+		cursor := req.PostForm.Get("cursor")
+		cursors = append(cursors, cursor)
+
+		body := `{"ok":true,"members":[{"id":"U1"}],"response_metadata":{"next_cursor":"c2"}}`
+		switch {
+		case len(cursors) == 1:
+			return &http.Response{
+				StatusCode: http.StatusTooManyRequests,
+				Header:     http.Header{"Retry-After": {"0"}},
+				Body:       http.NoBody,
+			}, nil
+		case cursor == "c2":
+			body = `{"ok":true,"members":[{"id":"U2"}],"response_metadata":{"next_cursor":""}}`
+		}
+
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(body)),
+		}, nil
+	})
+
+	sc := newTestClient(newWebAPI("xoxb-test", &http.Client{Transport: transport}))
+	if err := sc.listUsers(); err != nil {
+		t.Fatalf("listUsers: %v", err)
+	}
+
+	if want := []string{"", "", "c2"}; !reflect.DeepEqual(cursors, want) {
+		t.Errorf("got cursors %q, want %q", cursors, want)
+	}
+	for _, id := range []string{"U1", "U2"} {
+		if _, ok := sc.UsersCache[id]; !ok {
+			t.Errorf("user %s is not listed", id)
+		}
+	}
+}
+
+func TestCacheDir(t *testing.T) {
+	dir := t.TempDir()
+	setConfig(t, config{ProfileFields: true})
+
+	api := newFakeSlackAPI()
+	channel := slack.Channel{}
+	channel.ID, channel.Name = "C1", "general"
+	api.channels = []slack.Channel{channel}
+	api.profiles["U1"] = &slack.UserProfile{DisplayName: "alice"}
+	api.responses["emoji.list"] = []string{`{"ok":true,"emoji":{"party":"https://emoji.slack-edge.com/party.png"}}`}
+
+	// the second run finds everything in the cache, its API has nothing
+	for run, api := range []*fakeSlackAPI{api, newFakeSlackAPI()} {
+		sc := newTestClient(api)
+		if err := sc.SetCacheDir(dir, time.Hour); err != nil {
+			t.Fatalf("SetCacheDir: %v", err)
+		}
+
+		c, err := sc.GetChannelInfo("C1")
+		if err != nil {
+			t.Fatalf("run %d: GetChannelInfo: %v", run, err)
+		}
+		if c.Name != "general" {
+			t.Errorf("run %d: got channel %q, want general", run, c.Name)
+		}
+
+		u := &slack.User{ID: "U1"}
+		if err := sc.enrichProfile(u); err != nil {
+			t.Fatalf("run %d: enrichProfile: %v", run, err)
+		}
+		if u.Profile.DisplayName != "alice" {
+			t.Errorf("run %d: got profile %+v, want alice", run, u.Profile)
+		}
+
+		emoji, err := sc.getEmoji()
+		if err != nil {
+			t.Fatalf("run %d: getEmoji: %v", run, err)
+		}
+		if _, ok := emoji["party"]; !ok {
+			t.Errorf("run %d: got emoji %v, want party", run, emoji)
+		}
+
+		if err := sc.SaveCache(); err != nil {
+			t.Fatalf("run %d: SaveCache: %v", run, err)
+		}
+	}
+}
+
+func TestGetChannels(t *testing.T) {
+	channels := make([]slack.Channel, 5)
+	for i := range channels {
+		channels[i].ID = "C" + string(rune('1'+i))
+	}
+
+	tests := []struct {
+		name      string
+		pageSize  int
+		errs      []error
+		want      int
+		wantCalls int
+		wantErr   string
+	}{
+		{name: "one page", pageSize: 10, want: 5, wantCalls: 1},
+		{name: "pages", pageSize: 2, want: 5, wantCalls: 3},
+		{name: "page size is capped", pageSize: 5000, want: 5, wantCalls: 1},
+		{name: "error", pageSize: 2, errs: []error{slack.SlackErrorResponse{Err: "missing_scope"}}, wantErr: "missing_scope"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setConfig(t, config{PageSize: tt.pageSize})
+
+			api := newFakeSlackAPI()
+			api.channels = channels
+			api.errs["conversations.list"] = tt.errs
+
+			got, err := newTestClient(api).GetChannels([]string{"public_channel"})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetChannels: %v", err)
+			}
+
+			if len(got) != tt.want {
+				t.Errorf("got %d channels, want %d", len(got), tt.want)
+			}
+			if api.calls["conversations.list"] != tt.wantCalls {
+				t.Errorf("got %d calls, want %d", api.calls["conversations.list"], tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestGetList(t *testing.T) {
+	const info = `{"ok":true,"file":{"list_metadata":{"schema":[
+		{"id":"Col1","name":"Task","type":"text"},
+		{"id":"Col2","name":"Owner","type":"user"}
+	]}}}`
+
+	tests := []struct {
+		name      string
+		responses map[string][]string
+		errs      map[string][]error
+		want      *structs.List
+		wantErr   string
+	}{
+		{
+			name: "items pages",
+			responses: map[string][]string{
+				"files.info": {info},
+				"slackLists.items.list": {
+					`{"ok":true,"items":[{"id":"I1","created_by":"U1","fields":[{"column_id":"Col1","text":"Write tests"}]}],
+					"response_metadata":{"next_cursor":"next"}}`,
+					`{"ok":true,"items":[{"id":"I2","fields":[{"column_id":"Col2","user":["U1","U2"]},{"column_id":"Col9","text":"x"}]}]}`,
+				},
+			},
+			want: &structs.List{
+				Columns: []structs.ListColumn{{ID: "Col1", Name: "Task", Type: "text"}, {ID: "Col2", Name: "Owner", Type: "user"}},
+				Items: []structs.ListItem{
+					{ID: "I1", CreatedBy: "U1", Values: []string{"Write tests", ""}},
+					{ID: "I2", Values: []string{"", "<@U1>, <@U2>"}},
+				},
+			},
+		},
+		{
+			name:    "files.info error",
+			errs:    map[string][]error{"files.info": {slack.SlackErrorResponse{Err: "file_not_found"}}},
+			wantErr: "file_not_found",
+		},
+		{
+			name: "items error",
+			responses: map[string][]string{
+				"files.info":            {info},
+				"slackLists.items.list": {`{"ok":true,"items":[],"response_metadata":{"next_cursor":"next"}}`},
+			},
+			errs:    map[string][]error{"slackLists.items.list": {nil, slack.SlackErrorResponse{Err: "ratelimited"}}},
+			wantErr: "ratelimited",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setConfig(t, config{PageSize: 100})
+
+			api := newFakeSlackAPI()
+			for method, responses := range tt.responses {
+				api.responses[method] = responses
+			}
+			for method, errs := range tt.errs {
+				api.errs[method] = errs
+			}
+
+			got, err := newTestClient(api).GetList("F1")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetList: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetSidebar(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     []string
+	}{
+		{
+			name: "sections are ordered by their links",
+			response: `{"ok":true,"channel_sections":[
+				{"channel_section_id":"S3","name":"c"},
+				{"channel_section_id":"S1","name":"a","next_channel_section_id":"S2"},
+				{"channel_section_id":"S2","name":"b","next_channel_section_id":"S3"}
+			]}`,
+			want: []string{"S1", "S2", "S3"},
+		},
+		{
+			name: "sections which are not linked are kept at the end",
+			response: `{"ok":true,"channel_sections":[
+				{"channel_section_id":"S2","name":"b","next_channel_section_id":"S2"},
+				{"channel_section_id":"S1","name":"a"}
+			]}`,
+			want: []string{"S1", "S2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newFakeSlackAPI()
+			api.responses["users.channelSections.list"] = []string{tt.response}
+
+			sections, err := newTestClient(api).GetSidebar()
+			if err != nil {
+				t.Fatalf("GetSidebar: %v", err)
+			}
+
+			var got []string
+			for _, s := range sections {
+				got = append(got, s.ID)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got sections %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
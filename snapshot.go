@@ -0,0 +1,305 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chuhlomin/slack-exporter/pkg/atomicfile"
+	"github.com/chuhlomin/slack-exporter/pkg/json2html"
+)
+
+// manifestFilename lists every file of the final snapshot with its checksum.
+const manifestFilename = "manifest.json"
+
+var (
+	errManifestMismatch    = fmt.Errorf("file does not match the manifest")
+	errFinalSnapshotFormat = fmt.Errorf("--final-snapshot requires the json format without --split-by, --no-content, --files-only and --skip-files")
+)
+
+// snapshotManifest describes the final snapshot, so its integrity can be checked
+// long after the workspace is gone.
+type snapshotManifest struct {
+	Created time.Time      `json:"created"`
+	Summary runSummary     `json:"summary"`
+	Files   []manifestFile `json:"files"`
+}
+
+type manifestFile struct {
+	// Path is relative to the output directory, with forward slashes.
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// applyFinalSnapshot turns on everything worth keeping of the workspace which is shut down.
+func applyFinalSnapshot() error {
+	if cfg.Format != formatJSON || cfg.SplitBy != "" || cfg.NoContent || cfg.FilesOnly || cfg.SkipFiles {
+		return errFinalSnapshotFormat
+	}
+
+	if cfg.Channels == "" {
+		cfg.Channels = "all"
+	}
+	if cfg.CacheDir == "" {
+		cfg.CacheDir = filepath.Join(cfg.Output, ".cache")
+	}
+
+	cfg.IncludeArchived = true
+	cfg.DownloadFiles = true
+	cfg.DownloadAvatars = true
+	cfg.UnfurlThumbnails = true
+	cfg.Branding = true
+	cfg.FileMetadata = true
+	cfg.ChannelMetadata = true
+	cfg.SharedTeams = true
+	cfg.Calls = true
+	cfg.Lists = true
+	cfg.ProfileFields = true
+	cfg.Permalinks = true
+	cfg.Sidebar = true
+	cfg.Reminders = true
+	cfg.Saved = true
+	cfg.Pins = true
+	cfg.AuditLogs = true
+	cfg.HumanTime = true
+	// the snapshot is likely to be interrupted by rate limits or expired tokens
+	cfg.Resume = true
+
+	return nil
+}
+
+// finishSnapshot completes the exported workspace with custom emoji, emoji usage, all users,
+// the activity report and HTML, writes the manifest, verifies the files against it
+// and compresses the output directory.
+func finishSnapshot(c *SlackClient) error {
+	emojiDir := filepath.Join(cfg.Output, emojiArchiveDirname)
+
+	// the snapshot is still complete without custom emoji, like with the token lacking emoji:read scope
+	download := emojiDownloadCommand{Dir: emojiDir}
+	if err := download.Execute(nil); err != nil {
+		log.Printf("Could not download custom emoji: %v", err)
+	}
+
+	usage := emojiCommand{EmojiDir: emojiDir, Limit: 10}
+	if err := usage.Execute(nil); err != nil {
+		return fmt.Errorf("could not count emoji: %w", err)
+	}
+
+	log.Println("Exporting users")
+	if err := writeUsers(c); err != nil {
+		return fmt.Errorf("could not export users: %w", err)
+	}
+
+	log.Println("Analyzing activity")
+	analyze := analyzeCommand{CSV: true, HTML: true, Limit: 10}
+	if err := analyze.Execute(nil); err != nil {
+		return fmt.Errorf("could not analyze activity: %w", err)
+	}
+
+	log.Println("Rendering HTML")
+	if err := json2html.Convert(cfg.Output, cfg.Output, json2html.Options{EmojiDir: emojiDir}); err != nil {
+		return fmt.Errorf("could not render HTML: %w", err)
+	}
+
+	log.Println("Writing manifest")
+	if err := writeManifest(cfg.Output); err != nil {
+		return fmt.Errorf("could not write manifest: %w", err)
+	}
+
+	log.Println("Verifying files")
+	if err := verifyManifest(cfg.Output); err != nil {
+		return fmt.Errorf("could not verify snapshot: %w", err)
+	}
+
+	output, err := filepath.Abs(cfg.Output)
+	if err != nil {
+		return fmt.Errorf("could not get output directory path: %w", err)
+	}
+
+	archive := output + ".tar.gz"
+	log.Printf("Compressing the snapshot to %s", archive)
+	if err := compressDir(cfg.Output, archive); err != nil {
+		return fmt.Errorf("could not compress snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// snapshotFiles walks the output directory, skipping the cache, the manifest and unfinished files.
+func snapshotFiles(dir string, fn func(path, rel string, info fs.FileInfo) error) error {
+	return filepath.Walk(dir, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			if path != dir && info.Name() == ".cache" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if rel == manifestFilename || strings.HasSuffix(rel, atomicfile.Suffix) || !info.Mode().IsRegular() {
+			return nil
+		}
+
+		return fn(path, filepath.ToSlash(rel), info)
+	})
+}
+
+func writeManifest(dir string) error {
+	manifest := snapshotManifest{
+		Created: time.Now().UTC(),
+		Summary: summary,
+	}
+	manifest.Summary.Finished = manifest.Created
+
+	err := snapshotFiles(dir, func(path, rel string, info fs.FileInfo) error {
+		sum, err := fileSHA256(path)
+		if err != nil {
+			return err
+		}
+
+		manifest.Files = append(manifest.Files, manifestFile{Path: rel, Size: info.Size(), SHA256: sum})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(manifest.Files, func(i, j int) bool {
+		return manifest.Files[i].Path < manifest.Files[j].Path
+	})
+
+	file, err := createPending(filepath.Join(dir, manifestFilename))
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(file)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(manifest); err != nil {
+		file.Abort()
+		return fmt.Errorf("could not encode manifest: %w", err)
+	}
+
+	return file.Commit()
+}
+
+// verifyManifest reads every file of the manifest back and compares its checksum.
+func verifyManifest(dir string) error {
+	content, err := os.ReadFile(filepath.Join(dir, manifestFilename))
+	if err != nil {
+		return fmt.Errorf("could not read manifest: %w", err)
+	}
+
+	var manifest snapshotManifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return fmt.Errorf("could not unmarshal manifest: %w", err)
+	}
+
+	for _, f := range manifest.Files {
+		sum, err := fileSHA256(filepath.Join(dir, filepath.FromSlash(f.Path)))
+		if err != nil {
+			return err
+		}
+
+		if sum != f.SHA256 {
+			return fmt.Errorf("%w: %s", errManifestMismatch, f.Path)
+		}
+	}
+
+	log.Printf("%d files match the manifest", len(manifest.Files))
+
+	return nil
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("could not open file: %w", err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("could not read file %s: %w", path, err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// compressDir writes the directory (with the manifest) to the tar.gz archive.
+func compressDir(dir, archive string) error {
+	file, err := createPending(archive)
+	if err != nil {
+		return err
+	}
+	defer file.Abort()
+
+	gw := gzip.NewWriter(file)
+	tw := tar.NewWriter(gw)
+
+	add := func(path, rel string, info fs.FileInfo) error {
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return fmt.Errorf("could not create header of %s: %w", rel, err)
+		}
+		header.Name = rel
+
+		if err := tw.WriteHeader(header); err != nil {
+			return fmt.Errorf("could not write header of %s: %w", rel, err)
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("could not open file: %w", err)
+		}
+		defer f.Close()
+
+		if _, err := io.Copy(tw, f); err != nil {
+			return fmt.Errorf("could not write %s: %w", rel, err)
+		}
+
+		return nil
+	}
+
+	manifestPath := filepath.Join(dir, manifestFilename)
+	info, err := os.Stat(manifestPath)
+	if err != nil {
+		return fmt.Errorf("could not stat manifest: %w", err)
+	}
+	if err := add(manifestPath, manifestFilename, info); err != nil {
+		return err
+	}
+
+	if err := snapshotFiles(dir, add); err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("could not close tar: %w", err)
+	}
+	if err := gw.Close(); err != nil {
+		return fmt.Errorf("could not close gzip: %w", err)
+	}
+
+	return file.Commit()
+}
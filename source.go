@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/slack-go/slack"
+
+	"github.com/chuhlomin/slack-exporter/pkg/exporter"
+	"github.com/chuhlomin/slack-exporter/pkg/structs"
+)
+
+// Sources of channels of commands reading the export.
+const (
+	sourceArchive = "archive"
+	sourceSlack   = "slack"
+)
+
+var (
+	errSourceToken    = fmt.Errorf("--source slack requires --api-token")
+	errSourceChannels = fmt.Errorf("--source slack requires --channels with channel IDs")
+)
+
+// source provides channels to the commands rendering and analyzing them,
+// so they run the same against the saved export and the live Slack API.
+type source interface {
+	// Channels calls fn for every channel, one at a time.
+	Channels(fn func(data *structs.Data) error) error
+}
+
+// newSource returns the source of --source, dir is the export read by the archive source.
+func newSource(dir string) (source, error) {
+	if cfg.Source != sourceSlack {
+		return archiveSource(dir), nil
+	}
+
+	if cfg.APIToken == "" {
+		return nil, errSourceToken
+	}
+
+	var channels []string
+	for _, id := range strings.Split(cfg.Channels, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			channels = append(channels, id)
+		}
+	}
+	if len(channels) == 0 || cfg.Channels == "public" {
+		return nil, errSourceChannels
+	}
+
+	// channels are read with the pipeline of the export, paced by the tiers of the methods
+	c := NewSlackClient(cfg.AppClientID, cfg.AppClientSecret)
+	c.SetToken(cfg.APIToken)
+
+	return &slackSource{exporter: c.Exporter(channels, nil)}, nil
+}
+
+// archiveSource is the directory with the JSON export.
+type archiveSource string
+
+func (dir archiveSource) Channels(fn func(data *structs.Data) error) error {
+	return readArchive(string(dir), func(_ string, data *structs.Data) error {
+		return fn(data)
+	})
+}
+
+// slackSource reads channels with their messages and authors from the Slack API
+// without writing them to the output directory.
+type slackSource struct {
+	exporter *exporter.Exporter
+}
+
+func (ss *slackSource) Channels(fn func(data *structs.Data) error) error {
+	return ss.exporter.Export(context.Background(), &channelCollector{fn: fn})
+}
+
+// channelCollector is the exporter.Sink collecting the channel into structs.Data
+// and passing it to fn when the next channel starts or the export is finished.
+type channelCollector struct {
+	fn   func(data *structs.Data) error
+	data *structs.Data
+}
+
+func (cc *channelCollector) WriteChannel(channel *slack.Channel) error {
+	if err := cc.flush(); err != nil {
+		return err
+	}
+
+	cc.data = &structs.Data{
+		Channel: *channel,
+		Users:   map[string]*slack.User{},
+		Files:   map[string]string{},
+	}
+	return nil
+}
+
+func (cc *channelCollector) WriteMessage(_ string, msg structs.Message) error {
+	cc.data.Messages = append(cc.data.Messages, msg)
+	return nil
+}
+
+func (cc *channelCollector) WriteFile(string, slack.File, io.Reader) error {
+	return nil
+}
+
+func (cc *channelCollector) WriteUser(_ string, user *slack.User) error {
+	cc.data.Users[user.ID] = user
+	return nil
+}
+
+// Close passes the last channel to fn unless the export failed.
+func (cc *channelCollector) Close(exportErr error) error {
+	if exportErr != nil {
+		cc.data = nil
+		return nil
+	}
+
+	return cc.flush()
+}
+
+func (cc *channelCollector) flush() error {
+	if cc.data == nil {
+		return nil
+	}
+
+	data := cc.data
+	cc.data = nil
+
+	return cc.fn(data)
+}
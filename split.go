@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/slack-go/slack"
+
+	"github.com/chuhlomin/slack-exporter/pkg/structs"
+)
+
+// splitLayouts are the period names of --split-by values.
+var splitLayouts = map[string]string{
+	"day":   "2006-01-02",
+	"month": "2006-01",
+	"year":  "2006",
+}
+
+var errPeriodRevisited = fmt.Errorf("messages are out of order")
+
+// splitWriter writes messages (with threads) of every day, month or year to the separate
+// <channel>.<period>.<format> file in the output format and the rest of the data to <channel>.meta.json.
+// Slack returns history newest first, so the file of the period is finished
+// as soon as the older message comes and only one file is open at a time.
+type splitWriter struct {
+	meta     *pendingFile
+	head     channelHead
+	users    userLookup
+	layout   string
+	period   string
+	chunk    channelWriter
+	finished map[string]bool
+}
+
+func newSplitWriter(channel *slack.Channel, members []string, users userLookup) (*splitWriter, error) {
+	_, metaFilename := channelFilenames(channel.ID, "")
+
+	meta, err := createPending(metaFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	return &splitWriter{
+		meta:     meta,
+		head:     newChannelHead(channel, members),
+		users:    users,
+		layout:   splitLayouts[cfg.SplitBy],
+		finished: map[string]bool{},
+	}, nil
+}
+
+func (sw *splitWriter) WriteMessage(msg structs.Message) error {
+	period := parseTimestamp(msg.Timestamp).Format(sw.layout)
+
+	if period != sw.period {
+		if err := sw.finishChunk(); err != nil {
+			return err
+		}
+
+		if sw.finished[period] {
+			return fmt.Errorf("%w: %s is already written", errPeriodRevisited, period)
+		}
+
+		chunk, err := newFormatWriter(sw.head.Channel, sw.head.Members, sw.users, period)
+		if err != nil {
+			return err
+		}
+
+		sw.chunk, sw.period = chunk, period
+	}
+
+	return sw.chunk.WriteMessage(msg)
+}
+
+// finishChunk moves the file of the current period in place,
+// its meta has only channel info and members, the rest of the data is known on Close.
+func (sw *splitWriter) finishChunk() error {
+	if sw.chunk == nil {
+		return nil
+	}
+
+	err := sw.chunk.Close(structs.Data{})
+	sw.chunk = nil
+	sw.finished[sw.period] = true
+
+	if err != nil {
+		return fmt.Errorf("could not write messages of %s: %w", sw.period, err)
+	}
+
+	return nil
+}
+
+func (sw *splitWriter) Close(data structs.Data) error {
+	if err := sw.finishChunk(); err != nil {
+		sw.Abort()
+		return err
+	}
+
+	if err := writeMeta(sw.meta, sw.head, data); err != nil {
+		sw.Abort()
+		return err
+	}
+
+	return sw.meta.Commit()
+}
+
+func (sw *splitWriter) Sync() error {
+	if s, ok := sw.chunk.(syncer); ok {
+		return s.Sync()
+	}
+
+	return nil
+}
+
+func (sw *splitWriter) Abort() {
+	if sw.chunk != nil {
+		sw.chunk.Abort()
+	}
+	sw.meta.Abort()
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/slack-go/slack"
+)
+
+// pickerHeight is the number of conversations shown at a time.
+const pickerHeight = 15
+
+var errNothingPicked = fmt.Errorf("no conversations were picked")
+
+// conversation is the channel or DM in the picker.
+type conversation struct {
+	id    string
+	label string
+}
+
+// modelPicker lists conversations filtered by the search query,
+// space selects the focused one and enter exports the selected.
+type modelPicker struct {
+	search        textinput.Model
+	conversations []conversation
+	// filtered are indexes of conversations matching the search
+	filtered   []int
+	focusIndex int
+	offset     int
+	selected   map[int]struct{}
+	cancelled  bool
+}
+
+func initialModelPicker(conversations []conversation) modelPicker {
+	search := textinput.New()
+	search.Prompt = "Search ▶︎ "
+	search.Placeholder = "channel or user name"
+	search.Cursor.Style = cursorStyle
+	search.PromptStyle = focusedStyle
+	search.Focus()
+
+	mp := modelPicker{
+		search:        search,
+		conversations: conversations,
+		selected:      map[int]struct{}{},
+	}
+	mp.filter()
+
+	return mp
+}
+
+// filter keeps conversations with the label containing the search query.
+func (mp *modelPicker) filter() {
+	query := strings.ToLower(strings.TrimSpace(mp.search.Value()))
+
+	mp.filtered = mp.filtered[:0]
+	for i, c := range mp.conversations {
+		if strings.Contains(strings.ToLower(c.label), query) {
+			mp.filtered = append(mp.filtered, i)
+		}
+	}
+
+	mp.focusIndex, mp.offset = 0, 0
+}
+
+func (mp modelPicker) Init() tea.Cmd {
+	return tea.Batch(tea.SetWindowTitle("Select conversations to export"), textinput.Blink)
+}
+
+func (mp modelPicker) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "ctrl+c", "esc":
+			mp.cancelled = true
+			return mp, tea.Quit
+		case "enter":
+			return mp, tea.Quit
+		case "up", "shift+tab":
+			mp.move(-1)
+			return mp, nil
+		case "down", "tab":
+			mp.move(1)
+			return mp, nil
+		case " ":
+			if len(mp.filtered) > 0 {
+				i := mp.filtered[mp.focusIndex]
+				if _, ok := mp.selected[i]; ok {
+					delete(mp.selected, i)
+				} else {
+					mp.selected[i] = struct{}{}
+				}
+			}
+			return mp, nil
+		case "ctrl+a":
+			// selects all the conversations matching the search
+			for _, i := range mp.filtered {
+				mp.selected[i] = struct{}{}
+			}
+			return mp, nil
+		}
+	}
+
+	query := mp.search.Value()
+
+	var cmd tea.Cmd
+	mp.search, cmd = mp.search.Update(msg)
+	if mp.search.Value() != query {
+		mp.filter()
+	}
+
+	return mp, cmd
+}
+
+// move moves the focus keeping it in the shown window of conversations.
+func (mp *modelPicker) move(delta int) {
+	if len(mp.filtered) == 0 {
+		return
+	}
+
+	mp.focusIndex = (mp.focusIndex + delta + len(mp.filtered)) % len(mp.filtered)
+
+	switch {
+	case mp.focusIndex < mp.offset:
+		mp.offset = mp.focusIndex
+	case mp.focusIndex >= mp.offset+pickerHeight:
+		mp.offset = mp.focusIndex - pickerHeight + 1
+	}
+}
+
+func (mp modelPicker) View() string {
+	var b strings.Builder
+	b.WriteString("What conversations do you want to export?\n\n")
+	b.WriteString(mp.search.View() + "\n\n")
+
+	end := min(mp.offset+pickerHeight, len(mp.filtered))
+	for n := mp.offset; n < end; n++ {
+		i := mp.filtered[n]
+
+		focusIndex := " "
+		style := noStyle
+		if n == mp.focusIndex {
+			focusIndex = "▶︎"
+			style = focusedStyle
+		}
+
+		checked := " "
+		if _, ok := mp.selected[i]; ok {
+			checked = "×"
+		}
+
+		b.WriteString(style.Render(fmt.Sprintf("%s [%s] %s", focusIndex, checked, mp.conversations[i].label)) + "\n")
+	}
+
+	fmt.Fprintf(&b, "\n%d of %d shown, %d selected\n", len(mp.filtered), len(mp.conversations), len(mp.selected))
+	b.WriteString(blurredStyle.Render("Type to search, ↑ and ↓ to move, space to select, ctrl+a to select all shown, enter to export.") + "\n")
+
+	return b.String()
+}
+
+// pickChannels lists conversations of the token and returns IDs of the ones picked in the terminal UI.
+func pickChannels(c *SlackClient) ([]string, error) {
+	channels, err := c.GetChannels([]string{"public_channel", "private_channel", "mpim", "im"})
+	if err != nil {
+		return nil, fmt.Errorf("could not list conversations: %w", err)
+	}
+
+	var conversations []conversation
+	for _, channel := range channels {
+		if channel.IsArchived && !cfg.IncludeArchived {
+			continue
+		}
+		conversations = append(conversations, conversation{id: channel.ID, label: conversationLabel(c, channel)})
+	}
+
+	sort.Slice(conversations, func(i, j int) bool {
+		return strings.ToLower(conversations[i].label) < strings.ToLower(conversations[j].label)
+	})
+
+	result, err := tea.NewProgram(initialModelPicker(conversations)).Run()
+	if err != nil {
+		return nil, err
+	}
+
+	picker := result.(modelPicker)
+	if picker.cancelled || len(picker.selected) == 0 {
+		return nil, errNothingPicked
+	}
+
+	ids := make([]string, 0, len(picker.selected))
+	for i := range picker.selected {
+		ids = append(ids, conversations[i].id)
+	}
+	sort.Strings(ids)
+
+	return ids, nil
+}
+
+// conversationLabel returns #name of channels, 🔒name of private ones and @name of the user of DMs.
+func conversationLabel(c *SlackClient, channel slack.Channel) string {
+	switch {
+	case channel.IsIM:
+		if u, err := c.GetUser(channel.User); err == nil && u != nil {
+			return "@" + u.Name + " (" + userDisplayName(u) + ")"
+		}
+		return "@" + channel.User
+	case channel.IsMpIM:
+		return "👥 " + first(channel.Purpose.Value, channel.Name)
+	case channel.IsPrivate:
+		return "🔒 " + channel.Name
+	default:
+		return "#" + channel.Name
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // decoders of downloaded images
+	"image/jpeg"
+	_ "image/png"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	// thumbnailDirname keeps thumbnails of downloaded files by ID, like thumbnails/F0123.jpg.
+	thumbnailDirname = "thumbnails"
+	// thumbnailSize is the largest side of thumbnails, in pixels.
+	thumbnailSize = 360
+	// thumbnailMaxPixels skips images too large to decode in memory.
+	thumbnailMaxPixels = 50_000_000
+)
+
+var (
+	errTooLarge = fmt.Errorf("image is too large")
+	errNoFrame  = fmt.Errorf("ffmpeg returned no frame")
+)
+
+var (
+	imageExtensions = map[string]struct{}{".png": {}, ".jpg": {}, ".jpeg": {}, ".gif": {}}
+	videoExtensions = map[string]struct{}{".mp4": {}, ".mov": {}, ".m4v": {}, ".webm": {}, ".mkv": {}, ".avi": {}}
+)
+
+// ffmpegPath is the ffmpeg found in PATH, video thumbnails are skipped without it.
+var ffmpegPath = sync.OnceValue(func() string {
+	path, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		log.Printf("ffmpeg is not found in PATH, skipping thumbnails of videos")
+		return ""
+	}
+	return path
+})
+
+// makeThumbnails generates thumbnails of the downloaded images and videos (by names of files by ID),
+// returns paths of the thumbnails relative to the output directory by ID.
+// Files without a thumbnail are still linked by renderers, so errors are only logged.
+func makeThumbnails(files map[string]string) map[string]string {
+	paths := map[string]string{}
+
+	for id, filename := range files {
+		if filename == "" {
+			continue
+		}
+
+		path, err := makeThumbnail(id, filename)
+		if err != nil {
+			log.Printf("could not make thumbnail of file %q: %v", id, err)
+			continue
+		}
+		if path != "" {
+			paths[id] = path
+		}
+	}
+
+	return paths
+}
+
+// makeThumbnail generates the thumbnail of the stored file unless it's already there,
+// returns its path relative to the output directory, empty for files of other types.
+func makeThumbnail(id, filename string) (string, error) {
+	ext := strings.ToLower(filepath.Ext(filename))
+
+	_, isImage := imageExtensions[ext]
+	_, isVideo := videoExtensions[ext]
+	if !isImage && (!isVideo || ffmpegPath() == "") {
+		return "", nil
+	}
+
+	path := filepath.Join(thumbnailDirname, id+".jpg")
+	target := filepath.Join(cfg.Output, path)
+	if _, err := os.Stat(target); err == nil {
+		return path, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return "", fmt.Errorf("could not create directory: %w", err)
+	}
+
+	stored := filepath.Join(cfg.Output, storeDirname, id+"-"+filename)
+
+	var (
+		content []byte
+		err     error
+	)
+	if isImage {
+		content, err = imageThumbnail(stored)
+	} else {
+		content, err = videoThumbnail(stored)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	dst, err := createPending(target)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := dst.Write(content); err != nil {
+		dst.Abort()
+		return "", fmt.Errorf("could not write thumbnail: %w", err)
+	}
+
+	if err := dst.Commit(); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
+
+// imageThumbnail returns the image scaled down to thumbnailSize as JPEG.
+func imageThumbnail(stored string) ([]byte, error) {
+	file, err := os.Open(stored)
+	if err != nil {
+		return nil, fmt.Errorf("could not open stored file: %w", err)
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode image: %w", err)
+	}
+	if config.Width*config.Height > thumbnailMaxPixels {
+		return nil, fmt.Errorf("%w: %dx%d", errTooLarge, config.Width, config.Height)
+	}
+
+	if _, err := file.Seek(0, 0); err != nil {
+		return nil, fmt.Errorf("could not read stored file: %w", err)
+	}
+
+	src, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode image: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, scaleDown(src, thumbnailSize), &jpeg.Options{Quality: 80}); err != nil {
+		return nil, fmt.Errorf("could not encode thumbnail: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// scaleDown fits the image into size×size, averaging the pixels of the source covered
+// by every pixel of the result; smaller images are kept as is.
+func scaleDown(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	w, h := fitSize(bounds.Dx(), bounds.Dy(), size, size)
+	if w >= bounds.Dx() && h >= bounds.Dy() {
+		return src
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/h
+		y1 := max(bounds.Min.Y+(y+1)*bounds.Dy()/h, y0+1)
+
+		for x := 0; x < w; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/w
+			x1 := max(bounds.Min.X+(x+1)*bounds.Dx()/w, x0+1)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, b, a, n = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n),
+			})
+		}
+	}
+
+	return dst
+}
+
+// fitSize returns the size of the w×h box fitted into maxW×maxH, keeping its aspect ratio.
+func fitSize(w, h, maxW, maxH int) (int, int) {
+	if w <= 0 || h <= 0 {
+		return maxW, maxH
+	}
+	if w > maxW {
+		h, w = max(h*maxW/w, 1), maxW
+	}
+	if h > maxH {
+		w, h = max(w*maxH/h, 1), maxH
+	}
+	return w, h
+}
+
+// videoThumbnail returns the representative frame of the video scaled down to thumbnailSize as JPEG.
+func videoThumbnail(stored string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+
+	// the thumbnail filter picks the most representative of the first frames, skipping black ones
+	cmd := exec.Command(ffmpegPath(), // #nosec G204
+		"-v", "error",
+		"-i", stored,
+		"-vf", fmt.Sprintf("thumbnail,scale=w=%d:h=%d:force_original_aspect_ratio=decrease", thumbnailSize, thumbnailSize),
+		"-frames:v", "1",
+		"-f", "image2pipe", "-c:v", "mjpeg",
+		"pipe:1",
+	)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("could not run ffmpeg: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if stdout.Len() == 0 {
+		return nil, errNoFrame
+	}
+
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/slack-go/slack"
+
+	"github.com/chuhlomin/slack-exporter/pkg/structs"
+)
+
+// unfurlsDirname is the directory of preview images of links, with --unfurl-thumbnails.
+const unfurlsDirname = "unfurls"
+
+// unfurls returns previews of links in the message and its replies: attachments Slack adds
+// for the links, except the shared messages.
+func unfurls(msg structs.Message) []structs.Unfurl {
+	var result []structs.Unfurl
+	add := func(m slack.Message) {
+		for _, a := range m.Attachments {
+			link := first(a.OriginalURL, a.FromURL)
+			if link == "" {
+				continue
+			}
+			if _, _, _, ok := parsePermalink(a.FromURL); ok {
+				continue
+			}
+
+			result = append(result, structs.Unfurl{
+				SharedIn:    m.Timestamp,
+				URL:         link,
+				ServiceName: a.ServiceName,
+				Title:       a.Title,
+				Description: a.Text,
+				ThumbURL:    first(a.ThumbURL, a.ImageURL),
+			})
+		}
+	}
+
+	add(msg.Message)
+	for _, reply := range msg.Replies {
+		add(reply)
+	}
+
+	return result
+}
+
+// downloadUnfurlThumbnails downloads preview images of the links to unfurls/ and sets their paths.
+// Images are named by the hash of their URL, so the image shared many times is downloaded once;
+// the ones which can't be downloaded are skipped, the link keeps its thumb_url.
+func downloadUnfurlThumbnails(unfurls []structs.Unfurl) {
+	for i, u := range unfurls {
+		if u.ThumbURL == "" {
+			continue
+		}
+
+		name := unfurlThumbnailName(u.ThumbURL)
+		dst := filepath.Join(cfg.Output, unfurlsDirname, name)
+
+		if _, err := os.Stat(dst); err != nil {
+			if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+				log.Printf("Could not create unfurls directory: %v", err)
+				return
+			}
+
+			if err := downloadURL(u.ThumbURL, dst); err != nil {
+				log.Printf("Could not download preview of %s: %v", u.URL, err)
+				failures.Add(statusSkipped, "unfurl", u.URL, fmt.Errorf("could not download preview: %w", err))
+				continue
+			}
+		}
+
+		unfurls[i].Thumbnail = filepath.Join(unfurlsDirname, name)
+	}
+}
+
+// unfurlThumbnailName returns the file name of the preview image: the hash of its URL
+// with the extension of the URL path, if it has a short one.
+func unfurlThumbnailName(imageURL string) string {
+	sum := sha256.Sum256([]byte(imageURL))
+	name := hex.EncodeToString(sum[:16])
+
+	if u, err := url.Parse(imageURL); err == nil {
+		if ext := path.Ext(u.Path); len(ext) > 1 && len(ext) <= 5 {
+			name += ext
+		}
+	}
+
+	return name
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/slack-go/slack"
+
+	"github.com/chuhlomin/slack-exporter/pkg/structs"
+)
+
+// formField is the question and the answer of the form submission, like "*Team*\nPlatform".
+var formField = regexp.MustCompile(`^\*([^*\n]+)\*:?\s*\n?((?s).*)$`)
+
+// newWorkflow returns the fields of the message posted by Workflow Builder or another app,
+// nil for messages without structured fields.
+func newWorkflow(msg slack.Message) *structs.Workflow {
+	if msg.BotID == "" {
+		return nil
+	}
+
+	wf := &structs.Workflow{
+		Name:      msg.Username,
+		EventType: msg.Metadata.EventType,
+		Fields:    payloadFields(msg.Metadata.EventPayload),
+	}
+	if msg.BotProfile != nil && msg.BotProfile.Name != "" {
+		wf.Name = msg.BotProfile.Name
+	}
+
+	if len(wf.Fields) == 0 {
+		wf.Fields = formFields(msg.Blocks)
+	}
+
+	if len(wf.Fields) == 0 {
+		return nil
+	}
+
+	return wf
+}
+
+// payloadFields returns the fields of the metadata payload sorted by name,
+// values other than strings are kept as JSON.
+func payloadFields(payload map[string]interface{}) []structs.Field {
+	fields := make([]structs.Field, 0, len(payload))
+
+	for name, value := range payload {
+		s, ok := value.(string)
+		if !ok {
+			b, err := json.Marshal(value)
+			if err != nil {
+				continue
+			}
+			s = string(b)
+		}
+
+		fields = append(fields, structs.Field{Name: name, Value: s})
+	}
+
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].Name < fields[j].Name
+	})
+
+	return fields
+}
+
+// formFields returns the section texts and fields which look like questions with answers.
+func formFields(blocks slack.Blocks) []structs.Field {
+	var fields []structs.Field
+
+	add := func(t *slack.TextBlockObject) {
+		if t == nil {
+			return
+		}
+		if m := formField.FindStringSubmatch(strings.TrimSpace(t.Text)); m != nil {
+			fields = append(fields, structs.Field{Name: m[1], Value: strings.TrimSpace(m[2])})
+		}
+	}
+
+	for _, block := range blocks.BlockSet {
+		section, ok := block.(*slack.SectionBlock)
+		if !ok {
+			continue
+		}
+
+		add(section.Text)
+		for _, field := range section.Fields {
+			add(field)
+		}
+	}
+
+	return fields
+}
+
+// isList reports whether the file is the Slack List.
+func isList(file slack.File) bool {
+	return file.Filetype == "list"
+}
+
+// rawListField is the cell of the list item, only one of the typed values is set
+// depending on the column type.
+type rawListField struct {
+	ColumnID string          `json:"column_id"`
+	Text     string          `json:"text"`
+	Value    json.RawMessage `json:"value"`
+	User     []string        `json:"user"`
+	Date     []string        `json:"date"`
+	Select   []string        `json:"select"`
+	Checkbox *bool           `json:"checkbox"`
+}
+
+// String returns the value of the cell as text, users as <@U0123> mentions.
+func (f rawListField) String() string {
+	switch {
+	case f.Text != "":
+		return f.Text
+	case len(f.User) > 0:
+		mentions := make([]string, 0, len(f.User))
+		for _, u := range f.User {
+			mentions = append(mentions, "<@"+u+">")
+		}
+		return strings.Join(mentions, ", ")
+	case len(f.Date) > 0:
+		return strings.Join(f.Date, ", ")
+	case len(f.Select) > 0:
+		return strings.Join(f.Select, ", ")
+	case f.Checkbox != nil:
+		return fmt.Sprint(*f.Checkbox)
+	}
+
+	var s string
+	if err := json.Unmarshal(f.Value, &s); err == nil {
+		return s
+	}
+
+	return string(f.Value)
+}
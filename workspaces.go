@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chuhlomin/slack-exporter/pkg/redact"
+)
+
+// workspacesFilename lists the workspaces exported by --workspaces with their summaries.
+const workspacesFilename = "workspaces.json"
+
+var (
+	errWorkspaceName    = fmt.Errorf("workspace name must be unique and usable as a directory name")
+	errWorkspaceToken   = fmt.Errorf("api_token or secrets is required")
+	errWorkspacesFailed = fmt.Errorf("workspaces failed")
+)
+
+// workspaceConfig is the workspace of the --workspaces file,
+// empty fields keep the values of flags.
+type workspaceConfig struct {
+	// Name is the directory of the workspace in the output directory.
+	Name               string `json:"name"`
+	APIToken           string `json:"api_token"`
+	Secrets            string `json:"secrets"`
+	TeamID             string `json:"team_id"`
+	ExternalUsersToken string `json:"external_users_token"`
+	Channels           string `json:"channels"`
+
+	teamName string // known without auth.test, like workspaces of the org
+}
+
+// workspacesManifest is the combined summary of the workspaces exported in one run.
+type workspacesManifest struct {
+	Created time.Time  `json:"created"`
+	Summary runSummary `json:"summary"`
+	// People is the number of users of all workspaces, the users who are the same person
+	// (with --identities) are counted once.
+	People     int               `json:"people"`
+	Workspaces []workspaceResult `json:"workspaces"`
+}
+
+type workspaceResult struct {
+	Name     string `json:"name"`
+	TeamID   string `json:"team_id,omitempty"`
+	TeamName string `json:"team_name,omitempty"`
+	// Output is the directory of the workspace relative to the output directory.
+	Output  string     `json:"output"`
+	Summary runSummary `json:"summary"`
+	// Users is the number of users of the workspace resolved by the export.
+	Users int `json:"users"`
+}
+
+func readWorkspaces(path string) ([]workspaceConfig, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read workspaces: %w", err)
+	}
+
+	var workspaces []workspaceConfig
+	if err := json.Unmarshal(content, &workspaces); err != nil {
+		return nil, fmt.Errorf("could not unmarshal workspaces: %w", err)
+	}
+
+	names := map[string]bool{}
+	for _, ws := range workspaces {
+		if ws.Name == "" || ws.Name == "." || ws.Name == ".." || filepath.Base(ws.Name) != ws.Name || names[ws.Name] {
+			return nil, fmt.Errorf("%w: %q", errWorkspaceName, ws.Name)
+		}
+		names[ws.Name] = true
+
+		if ws.APIToken == "" && ws.Secrets == "" {
+			return nil, fmt.Errorf("workspace %s: %w", ws.Name, errWorkspaceToken)
+		}
+	}
+
+	return workspaces, nil
+}
+
+// exportWorkspaces exports every workspace of the --workspaces file to its own directory,
+// a failed workspace doesn't stop the rest.
+func exportWorkspaces() error {
+	workspaces, err := readWorkspaces(cfg.Workspaces)
+	if err != nil {
+		return err
+	}
+
+	return exportWorkspaceList(workspaces)
+}
+
+// exportWorkspaceList exports every workspace with its own client, so every workspace
+// is paced by its own rate limiters, and writes workspaces.json.
+func exportWorkspaceList(workspaces []workspaceConfig) error {
+	base, baseStore := cfg, secretStore
+	total := summary
+	// failures of every workspace are in its errors.json, the run result counts all of them
+	allFailures := &failureReport{}
+	manifest := workspacesManifest{}
+	people := map[string]bool{}
+	var failed []string
+
+	for _, ws := range workspaces {
+		log.Printf("Exporting workspace %s", ws.Name)
+
+		cfg = base
+		// export resolves users in place
+		cfg.User = slices.Clone(base.User)
+		cfg.Output = filepath.Join(base.Output, ws.Name)
+		if base.CacheDir != "" {
+			cfg.CacheDir = filepath.Join(base.CacheDir, ws.Name)
+		}
+		if ws.Channels != "" {
+			cfg.Channels = ws.Channels
+		}
+		if ws.ExternalUsersToken != "" {
+			cfg.ExternalUsersToken = ws.ExternalUsersToken
+		}
+
+		summary, failures = runSummary{Started: time.Now()}, &failureReport{}
+		c, err := exportWorkspaceOf(ws)
+		summary.Finished = time.Now()
+		if err != nil {
+			log.Printf("Could not export workspace %s: %v", ws.Name, err)
+			summary.Failures = append(summary.Failures, redact.String(err.Error()))
+			failed = append(failed, ws.Name)
+		}
+
+		result := workspaceResult{Name: ws.Name, TeamID: ws.TeamID, TeamName: ws.teamName, Output: ws.Name, Summary: summary}
+		if c != nil {
+			result.Users = len(c.UsersCache)
+			for id := range c.UsersCache {
+				people[identities.Canonical(id)] = true
+			}
+		}
+		if c != nil && c.api != nil && result.TeamName == "" {
+			if auth, err := c.AuthTest(); err == nil {
+				result.TeamName = auth.Team
+				if result.TeamID == "" {
+					result.TeamID = auth.TeamID
+				}
+			}
+		}
+		manifest.Workspaces = append(manifest.Workspaces, result)
+
+		allFailures.Items = append(allFailures.Items, failures.Items...)
+
+		total.Channels += summary.Channels
+		total.Messages += summary.Messages
+		total.MessagesAdded += summary.MessagesAdded
+		for _, failure := range summary.Failures {
+			total.Failures = append(total.Failures, ws.Name+": "+failure)
+		}
+	}
+
+	cfg, secretStore, summary, failures = base, baseStore, total, allFailures
+
+	manifest.Created = time.Now().UTC()
+	manifest.Summary = summary
+	manifest.People = len(people)
+	manifest.Summary.Finished = manifest.Created
+
+	if err := writeWorkspacesManifest(manifest); err != nil {
+		return err
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%w: %s", errWorkspacesFailed, strings.Join(failed, ", "))
+	}
+
+	return nil
+}
+
+// exportWorkspaceOf exports the workspace with its own token, the secret of the workspace
+// replaces the one of --secrets, so a revoked token is renewed from the right secret.
+func exportWorkspaceOf(ws workspaceConfig) (*SlackClient, error) {
+	secretStore = nil
+	if ws.APIToken != "" {
+		cfg.APIToken = ws.APIToken
+	}
+	if ws.Secrets != "" {
+		cfg.Secrets = ws.Secrets
+		if err := loadSecrets(context.Background()); err != nil {
+			return nil, fmt.Errorf("could not load secrets: %w", err)
+		}
+	}
+
+	c := NewSlackClient(cfg.AppClientID, cfg.AppClientSecret)
+	if ws.TeamID != "" {
+		c.SetTeamID(ws.TeamID)
+	}
+
+	return c, exportWorkspace(c)
+}
+
+func writeWorkspacesManifest(manifest workspacesManifest) error {
+	if err := os.MkdirAll(cfg.Output, 0o755); err != nil {
+		return fmt.Errorf("could not create output directory: %w", err)
+	}
+
+	file, err := createPending(filepath.Join(cfg.Output, workspacesFilename))
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(file)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(manifest); err != nil {
+		file.Abort()
+		return fmt.Errorf("could not encode workspaces: %w", err)
+	}
+
+	return file.Commit()
+}
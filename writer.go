@@ -0,0 +1,984 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+
+	"github.com/chuhlomin/slack-exporter/pkg/atomicfile"
+	"github.com/chuhlomin/slack-exporter/pkg/exporter"
+	"github.com/chuhlomin/slack-exporter/pkg/render"
+	"github.com/chuhlomin/slack-exporter/pkg/structs"
+)
+
+const (
+	formatJSON    = "json"
+	formatNDJSON  = "ndjson"
+	formatCSV     = "csv"
+	formatParquet = "parquet"
+	formatPDF     = "pdf"
+	formatMbox    = "mbox"
+	formatEML     = "eml"
+)
+
+var errCompressFormat = fmt.Errorf("--compress requires the json format")
+
+// userLookup returns the user by ID, used by formats which show user names next to messages.
+type userLookup func(id string) (*slack.User, error)
+
+// channelWriter streams the channel export to the output directory message by message,
+// so channels with hundreds of thousands of messages are exported with constant memory.
+// Files are written next to the destination and moved in place on Close,
+// so the previous export is kept if the run fails midway.
+type channelWriter interface {
+	// WriteMessage appends the message to the output.
+	WriteMessage(msg structs.Message) error
+	// Close writes the rest of the data (messages are ignored) and moves the files in place.
+	Close(data structs.Data) error
+	// Abort removes the partially written files; it's a no-op after Close.
+	Abort()
+}
+
+// newChannelWriter creates the writer for the output format from the config.
+func newChannelWriter(channel *slack.Channel, members []string, users userLookup) (channelWriter, error) {
+	var (
+		w   channelWriter
+		err error
+	)
+	switch {
+	case cfg.FilesOnly:
+		w, err = newFilesIndexWriter(channel, users)
+	case cfg.SplitBy != "":
+		w, err = newSplitWriter(channel, members, users)
+	default:
+		w, err = newFormatWriter(channel, members, users, "")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.FlushEvery > 0 {
+		if s, ok := w.(syncer); ok {
+			w = &flushingWriter{channelWriter: w, syncer: s, every: cfg.FlushEvery}
+		}
+	}
+
+	return w, nil
+}
+
+// outputSink is the exporter.Sink writing channels to the output directory with the channelWriter
+// of --format. The channel is moved in place once the next one starts or the export is finished
+// and removed when the export fails, so the previous export of the channel is kept.
+type outputSink struct {
+	members []string
+	users   userLookup
+	w       channelWriter
+	data    structs.Data
+}
+
+var _ exporter.DataSink = (*outputSink)(nil)
+
+// newChannelSink returns the sink of the channel with the members: the output in --format,
+// and the search index with --index.
+func newChannelSink(members []string, users userLookup) exporter.DataSink {
+	sinks := []exporter.Sink{&outputSink{members: members, users: users}}
+	if searchIndex != nil {
+		sinks = append(sinks, &indexSink{ctx: context.Background(), users: users})
+	}
+
+	return exporter.MultiSink(sinks...)
+}
+
+func (s *outputSink) WriteChannel(channel *slack.Channel) error {
+	if err := s.finish(); err != nil {
+		return err
+	}
+
+	w, err := newChannelWriter(channel, s.members, s.users)
+	if err != nil {
+		return fmt.Errorf("could not create output file: %w", err)
+	}
+
+	s.w, s.data = w, structs.Data{}
+	return nil
+}
+
+func (s *outputSink) WriteMessage(_ string, msg structs.Message) error {
+	return s.w.WriteMessage(msg)
+}
+
+// WriteFile ignores the content, the app downloads files to the file store of --file-layout.
+func (s *outputSink) WriteFile(string, slack.File, io.Reader) error {
+	return nil
+}
+
+// WriteUser ignores the user, users are written with the data.
+func (s *outputSink) WriteUser(string, *slack.User) error {
+	return nil
+}
+
+func (s *outputSink) WriteData(_ string, data structs.Data) error {
+	s.data = data
+	return nil
+}
+
+func (s *outputSink) Close(exportErr error) error {
+	if exportErr != nil {
+		if s.w != nil {
+			s.w.Abort()
+			s.w = nil
+		}
+		return nil
+	}
+
+	return s.finish()
+}
+
+// finish writes the data of the channel and moves its files in place.
+func (s *outputSink) finish() error {
+	if s.w == nil {
+		return nil
+	}
+
+	w := s.w
+	s.w = nil
+
+	return w.Close(s.data)
+}
+
+// syncer is implemented by the writers streaming messages to disk.
+type syncer interface {
+	// Sync commits the messages written so far to disk.
+	Sync() error
+}
+
+// flushingWriter syncs the underlying writer every few messages,
+// trading I/O overhead for losing less of the output on a crash.
+type flushingWriter struct {
+	channelWriter
+	syncer
+	every   int
+	written int
+}
+
+func (fw *flushingWriter) WriteMessage(msg structs.Message) error {
+	if err := fw.channelWriter.WriteMessage(msg); err != nil {
+		return err
+	}
+
+	fw.written++
+	if fw.written%fw.every != 0 {
+		return nil
+	}
+
+	return fw.syncer.Sync()
+}
+
+// newFormatWriter creates the writer for the output format,
+// period is the day, month or year of the messages with --split-by.
+func newFormatWriter(channel *slack.Channel, members []string, users userLookup, period string) (channelWriter, error) {
+	switch cfg.Format {
+	case formatCSV:
+		return newCSVWriter(channel, members, users, period)
+	case formatParquet:
+		return newParquetWriter(channel, members, period)
+	case formatNDJSON:
+		return newNDJSONWriter(channel, members, period)
+	case formatPDF:
+		return newPDFWriter(channel, members, users, period), nil
+	case formatMbox, formatEML:
+		return newMailWriter(channel, members, users, period)
+	default:
+		return newJSONWriter(channel, members, period)
+	}
+}
+
+// channelFilenames returns the files the channel is exported to in the output format:
+// the one with the messages and the one with the rest of the data.
+// For JSON it's the same <channel>.json file (<channel>.json.gz with --compress), for eml it's the <channel>.eml directory.
+// With --split-by messages of the period go to <channel>.<period>.<format>,
+// without the period the messages file is the pattern matching all the periods.
+func channelFilenames(channelID, period string) (messages, meta string) {
+	ext := cfg.Format
+	if cfg.Compress {
+		ext += ".gz"
+	}
+
+	name := channelID
+	switch {
+	case period != "":
+		name += "." + period
+	case cfg.SplitBy != "":
+		return filepath.Join(cfg.Output, channelID+".[0-9]*."+ext), filepath.Join(cfg.Output, channelID+".meta.json")
+	}
+
+	switch cfg.Format {
+	case formatNDJSON, formatCSV, formatParquet, formatPDF, formatMbox, formatEML:
+		return filepath.Join(cfg.Output, name+"."+ext), filepath.Join(cfg.Output, name+".meta.json")
+	default:
+		filename := filepath.Join(cfg.Output, name+"."+ext)
+		return filename, filename
+	}
+}
+
+// readPrevious reads users and timestamps of the messages of the previous export of the channel,
+// missing export results in empty users and timestamps.
+func readPrevious(channelID string) (map[string]*slack.User, map[string]struct{}, error) {
+	messagesFilename, metaFilename := channelFilenames(channelID, "")
+	timestamps := map[string]struct{}{}
+
+	file, err := structs.OpenChannelFile(metaFilename)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, timestamps, nil
+		}
+		return nil, nil, fmt.Errorf("could not open file: %w", err)
+	}
+	defer file.Close()
+
+	users, err := decodeData(file, timestamps)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// timestamps are read back only from json, ndjson and csv, with other formats all the messages are counted as new
+	if messagesFilename == metaFilename || (cfg.Format != formatJSON && cfg.Format != formatNDJSON && cfg.Format != formatCSV) {
+		return users, timestamps, nil
+	}
+
+	// the pattern of the periods with --split-by, the file itself otherwise
+	filenames, err := filepath.Glob(messagesFilename)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not list files: %w", err)
+	}
+
+	for _, filename := range filenames {
+		if err := readTimestampsFile(filename, timestamps); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return users, timestamps, nil
+}
+
+func readTimestampsFile(filename string, timestamps map[string]struct{}) error {
+	file, err := structs.OpenChannelFile(filename)
+	if err != nil {
+		return fmt.Errorf("could not open file: %w", err)
+	}
+	defer file.Close()
+
+	return readTimestamps(file, timestamps)
+}
+
+// readTimestamps adds timestamps of the messages in json, ndjson or csv file.
+func readTimestamps(r io.Reader, timestamps map[string]struct{}) error {
+	switch cfg.Format {
+	case formatJSON:
+		_, err := decodeData(r, timestamps)
+		return err
+	case formatCSV:
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+
+		// skip the header
+		if _, err := cr.Read(); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("could not read csv: %w", err)
+		}
+
+		for {
+			record, err := cr.Read()
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					return nil
+				}
+				return fmt.Errorf("could not read csv: %w", err)
+			}
+			timestamps[record[0]] = struct{}{}
+		}
+	}
+
+	dec := json.NewDecoder(r)
+	for {
+		var msg struct {
+			Timestamp string `json:"ts"`
+		}
+		if err := dec.Decode(&msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("could not decode message: %w", err)
+		}
+		timestamps[msg.Timestamp] = struct{}{}
+	}
+}
+
+// decodeData adds timestamps of the messages in the channel export in json and returns its users,
+// the file is decoded token by token, so only timestamps and users are kept in memory.
+func decodeData(r io.Reader, timestamps map[string]struct{}) (map[string]*slack.User, error) {
+	dec := json.NewDecoder(r)
+
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, err
+	}
+
+	var users map[string]*slack.User
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("could not decode data: %w", err)
+		}
+
+		switch tok {
+		case "messages":
+			if err := decodeTimestamps(dec, timestamps); err != nil {
+				return nil, err
+			}
+		case "users":
+			if err := dec.Decode(&users); err != nil {
+				return nil, fmt.Errorf("could not decode users: %w", err)
+			}
+		default:
+			if err := skipValue(dec); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := expectDelim(dec, '}'); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// decodeTimestamps adds timestamps of the messages in the array, null is an empty array.
+func decodeTimestamps(dec *json.Decoder, timestamps map[string]struct{}) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("could not decode messages: %w", err)
+	}
+	if tok == nil {
+		return nil
+	}
+	if tok != json.Delim('[') {
+		return fmt.Errorf("could not decode messages: unexpected %v", tok)
+	}
+
+	for dec.More() {
+		var msg struct {
+			Timestamp string `json:"ts"`
+		}
+		if err := dec.Decode(&msg); err != nil {
+			return fmt.Errorf("could not decode message: %w", err)
+		}
+		timestamps[msg.Timestamp] = struct{}{}
+	}
+
+	return expectDelim(dec, ']')
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("could not decode data: %w", err)
+	}
+	if tok != delim {
+		return fmt.Errorf("could not decode data: unexpected %v, expected %v", tok, delim)
+	}
+	return nil
+}
+
+// skipValue reads the next value without keeping it.
+func skipValue(dec *json.Decoder) error {
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("could not decode data: %w", err)
+		}
+
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+// pendingFile is a file written next to the destination and moved in place on Commit,
+// committed files count towards --max-total-size.
+type pendingFile struct {
+	*atomicfile.File
+}
+
+func createPending(path string) (*pendingFile, error) {
+	file, err := atomicfile.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pendingFile{file}, nil
+}
+
+// Commit flushes the file and moves it in place.
+func (pf *pendingFile) Commit() error {
+	if err := pf.File.Commit(); err != nil {
+		return err
+	}
+
+	if info, err := os.Stat(pf.Path()); err == nil {
+		written.Add(info.Size())
+	}
+
+	return nil
+}
+
+// writePending writes the whole file like os.WriteFile, the previous file is kept until it's written.
+func writePending(path string, content []byte) error {
+	file, err := createPending(path)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(content); err != nil {
+		file.Abort()
+		return fmt.Errorf("could not write file: %w", err)
+	}
+
+	return file.Commit()
+}
+
+// channelHead is the part of structs.Data written before the messages.
+type channelHead struct {
+	SchemaVersion int            `json:"schema_version"`
+	Channel       *slack.Channel `json:"channel"`
+	Members       []string       `json:"members,omitempty"`
+}
+
+func newChannelHead(channel *slack.Channel, members []string) channelHead {
+	return channelHead{SchemaVersion: structs.SchemaVersion, Channel: channel, Members: members}
+}
+
+// channelTail is the part of structs.Data written after the messages.
+type channelTail struct {
+	Users        map[string]*slack.User     `json:"users"`
+	UserStatus   map[string]string          `json:"user_status,omitempty"`
+	TeamProfile  *slack.TeamProfile         `json:"team_profile,omitempty"`
+	Files        map[string]string          `json:"files"`
+	FilePaths    map[string]string          `json:"file_paths,omitempty"`
+	MissingFiles map[string]string          `json:"missing_files,omitempty"`
+	Thumbnails   map[string]string          `json:"thumbnails,omitempty"`
+	FileComments map[string][]slack.Comment `json:"file_comments,omitempty"`
+	Lists        map[string]*structs.List   `json:"lists,omitempty"`
+	Teams        map[string]*structs.Team   `json:"teams,omitempty"`
+	Pins         []slack.Item               `json:"pins,omitempty"`
+	MessageCount int                        `json:"message_count,omitempty"`
+	ReplyCount   int                        `json:"reply_count,omitempty"`
+	FileMetadata []slack.File               `json:"file_metadata,omitempty"`
+}
+
+func newChannelTail(data structs.Data) channelTail {
+	return channelTail{
+		Users:        data.Users,
+		UserStatus:   data.UserStatus,
+		TeamProfile:  data.TeamProfile,
+		Files:        data.Files,
+		FilePaths:    data.FilePaths,
+		MissingFiles: data.MissingFiles,
+		Thumbnails:   data.Thumbnails,
+		FileComments: data.FileComments,
+		Lists:        data.Lists,
+		Teams:        data.Teams,
+		Pins:         data.Pins,
+		MessageCount: data.MessageCount,
+		ReplyCount:   data.ReplyCount,
+		FileMetadata: data.FileMetadata,
+	}
+}
+
+// jsonIndent is the indent of JSON written with --pretty.
+const jsonIndent = "  "
+
+// marshalJSON is json.Marshal, indenting the JSON with --pretty.
+func marshalJSON(v any) ([]byte, error) {
+	if cfg.Pretty {
+		return json.MarshalIndent(v, "", jsonIndent)
+	}
+	return json.Marshal(v)
+}
+
+// jsonWriter writes <channel>.json with the same structs.Data layout
+// as the one written with marshalJSON, compressed to <channel>.json.gz with --compress.
+type jsonWriter struct {
+	file  *pendingFile
+	gzip  *gzip.Writer
+	w     io.Writer
+	count int
+}
+
+func newJSONWriter(channel *slack.Channel, members []string, period string) (*jsonWriter, error) {
+	filename, _ := channelFilenames(channel.ID, period)
+
+	file, err := createPending(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	jw := &jsonWriter{file: file, w: file}
+	if cfg.Compress {
+		jw.gzip = gzip.NewWriter(file)
+		jw.w = jw.gzip
+	}
+
+	head, err := marshalJSON(newChannelHead(channel, members))
+	if err != nil {
+		file.Abort()
+		return nil, fmt.Errorf("could not marshal channel: %w", err)
+	}
+
+	// leave the object open for the messages
+	jw.w.Write(bytes.TrimSuffix(bytes.TrimSuffix(head, []byte("}")), []byte("\n")))
+	if cfg.Pretty {
+		io.WriteString(jw.w, ",\n"+jsonIndent+`"messages": [`)
+	} else {
+		io.WriteString(jw.w, `,"messages":[`)
+	}
+
+	return jw, nil
+}
+
+func (jw *jsonWriter) WriteMessage(msg structs.Message) error {
+	content, err := marshalMessage(msg)
+	if err != nil {
+		return fmt.Errorf("could not marshal message: %w", err)
+	}
+
+	if jw.count > 0 {
+		io.WriteString(jw.w, ",")
+	}
+	jw.count++
+
+	if cfg.Pretty {
+		// messages are the elements of the array in the object, two levels deep
+		prefix := "\n" + jsonIndent + jsonIndent
+		var buf bytes.Buffer
+		buf.WriteString(prefix)
+		if err := json.Indent(&buf, content, prefix[1:], jsonIndent); err != nil {
+			return fmt.Errorf("could not indent message: %w", err)
+		}
+		content = buf.Bytes()
+	}
+
+	if _, err := jw.w.Write(content); err != nil {
+		return fmt.Errorf("could not write message: %w", err)
+	}
+
+	return nil
+}
+
+func (jw *jsonWriter) Close(data structs.Data) error {
+	tail, err := marshalJSON(newChannelTail(data))
+	if err != nil {
+		jw.Abort()
+		return fmt.Errorf("could not marshal data: %w", err)
+	}
+
+	if cfg.Pretty && jw.count > 0 {
+		io.WriteString(jw.w, "\n"+jsonIndent)
+	}
+	io.WriteString(jw.w, "],")
+	jw.w.Write(bytes.TrimPrefix(tail, []byte("{")))
+
+	if jw.gzip != nil {
+		if err := jw.gzip.Close(); err != nil {
+			jw.Abort()
+			return fmt.Errorf("could not compress file: %w", err)
+		}
+	}
+
+	return jw.file.Commit()
+}
+
+func (jw *jsonWriter) Sync() error {
+	if jw.gzip != nil {
+		if err := jw.gzip.Flush(); err != nil {
+			return fmt.Errorf("could not compress file: %w", err)
+		}
+	}
+	return jw.file.Sync()
+}
+
+func (jw *jsonWriter) Abort() {
+	jw.file.Abort()
+}
+
+// timedReply is the thread reply with the human-readable time.
+type timedReply struct {
+	slack.Message
+	Time string `json:"time"`
+}
+
+// timedMessage is the message with the human-readable time of it and its replies.
+type timedMessage struct {
+	structs.Message
+	Time    string       `json:"time"`
+	Replies []timedReply `json:"replies,omitempty"`
+}
+
+// marshalMessage returns JSON of the message, with --human-time "time" is added next to "ts"
+// of the message and its replies.
+func marshalMessage(msg structs.Message) ([]byte, error) {
+	if !cfg.HumanTime {
+		return json.Marshal(msg)
+	}
+
+	tm := timedMessage{
+		Message: msg,
+		Time:    humanTime(msg.Timestamp),
+	}
+	for _, reply := range msg.Replies {
+		tm.Replies = append(tm.Replies, timedReply{reply, humanTime(reply.Timestamp)})
+	}
+
+	return json.Marshal(tm)
+}
+
+// writeMeta writes structs.Data without messages to the file.
+func writeMeta(file *pendingFile, head channelHead, data structs.Data) error {
+	content, err := marshalJSON(struct {
+		channelHead
+		channelTail
+	}{head, newChannelTail(data)})
+	if err != nil {
+		return fmt.Errorf("could not marshal data: %w", err)
+	}
+
+	_, err = file.Write(content)
+	return err
+}
+
+// ndjsonWriter writes one message per line to <channel>.ndjson
+// and the rest of the data to <channel>.meta.json.
+type ndjsonWriter struct {
+	messages *pendingFile
+	meta     *pendingFile
+	head     channelHead
+}
+
+func newNDJSONWriter(channel *slack.Channel, members []string, period string) (*ndjsonWriter, error) {
+	messagesFilename, metaFilename := channelFilenames(channel.ID, period)
+
+	messages, err := createPending(messagesFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	meta, err := createPending(metaFilename)
+	if err != nil {
+		messages.Abort()
+		return nil, err
+	}
+
+	return &ndjsonWriter{
+		messages: messages,
+		meta:     meta,
+		head:     newChannelHead(channel, members),
+	}, nil
+}
+
+func (nw *ndjsonWriter) WriteMessage(msg structs.Message) error {
+	content, err := marshalMessage(msg)
+	if err != nil {
+		return fmt.Errorf("could not marshal message: %w", err)
+	}
+
+	nw.messages.Write(content)
+	if err := nw.messages.WriteByte('\n'); err != nil {
+		return fmt.Errorf("could not write message: %w", err)
+	}
+
+	return nil
+}
+
+func (nw *ndjsonWriter) Close(data structs.Data) error {
+	if err := writeMeta(nw.meta, nw.head, data); err != nil {
+		nw.Abort()
+		return err
+	}
+
+	if err := nw.messages.Commit(); err != nil {
+		nw.meta.Abort()
+		return err
+	}
+
+	return nw.meta.Commit()
+}
+
+func (nw *ndjsonWriter) Sync() error {
+	return nw.messages.Sync()
+}
+
+func (nw *ndjsonWriter) Abort() {
+	nw.messages.Abort()
+	nw.meta.Abort()
+}
+
+// csvHeader lists the columns of <channel>.csv.
+var csvHeader = []string{"ts", "user", "display_name", "thread_ts", "text", "reactions", "files"}
+
+// csvColumns returns the header of <channel>.csv, with --human-time "time" follows "ts".
+func csvColumns() []string {
+	if !cfg.HumanTime {
+		return csvHeader
+	}
+
+	return append([]string{csvHeader[0], "time"}, csvHeader[1:]...)
+}
+
+// csvWriter writes messages and thread replies as rows of <channel>.csv,
+// for analyzing history in spreadsheets, and the rest of the data to <channel>.meta.json.
+type csvWriter struct {
+	messages *pendingFile
+	meta     *pendingFile
+	csv      *csv.Writer
+	head     channelHead
+	users    userLookup
+}
+
+func newCSVWriter(channel *slack.Channel, members []string, users userLookup, period string) (*csvWriter, error) {
+	messagesFilename, metaFilename := channelFilenames(channel.ID, period)
+
+	messages, err := createPending(messagesFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	meta, err := createPending(metaFilename)
+	if err != nil {
+		messages.Abort()
+		return nil, err
+	}
+
+	cw := &csvWriter{
+		messages: messages,
+		meta:     meta,
+		csv:      csv.NewWriter(messages),
+		head:     newChannelHead(channel, members),
+		users:    users,
+	}
+
+	if err := cw.csv.Write(csvColumns()); err != nil {
+		cw.Abort()
+		return nil, fmt.Errorf("could not write header: %w", err)
+	}
+
+	return cw, nil
+}
+
+func (cw *csvWriter) WriteMessage(msg structs.Message) error {
+	if err := cw.writeRow(msg.Message); err != nil {
+		return err
+	}
+
+	for _, reply := range msg.Replies {
+		if err := cw.writeRow(reply); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (cw *csvWriter) writeRow(msg slack.Message) error {
+	displayName := ""
+	if msg.User != "" {
+		u, err := cw.users(msg.User)
+		if err != nil {
+			return fmt.Errorf("could not get user %q: %w", msg.User, err)
+		}
+		displayName = userDisplayName(u)
+	} else {
+		displayName = msg.Username
+	}
+
+	record := []string{
+		msg.Timestamp,
+		msg.User,
+		csvCell(displayName),
+		msg.ThreadTimestamp,
+		csvCell(render.Text(msg)),
+		csvCell(reactionsSummary(msg)),
+		csvCell(fileNames(msg)),
+	}
+	if cfg.HumanTime {
+		record = append([]string{record[0], humanTime(msg.Timestamp)}, record[1:]...)
+	}
+
+	if err := cw.csv.Write(record); err != nil {
+		return fmt.Errorf("could not write message: %w", err)
+	}
+
+	return nil
+}
+
+// csvCell returns the text of the cell which spreadsheets show as text: cells starting with = + - @
+// (or tab and carriage return) are formulas there, so they are prefixed with '.
+func csvCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+
+	return s
+}
+
+func (cw *csvWriter) Close(data structs.Data) error {
+	cw.csv.Flush()
+	if err := cw.csv.Error(); err != nil {
+		cw.Abort()
+		return fmt.Errorf("could not write csv: %w", err)
+	}
+
+	if err := writeMeta(cw.meta, cw.head, data); err != nil {
+		cw.Abort()
+		return err
+	}
+
+	if err := cw.messages.Commit(); err != nil {
+		cw.meta.Abort()
+		return err
+	}
+
+	return cw.meta.Commit()
+}
+
+func (cw *csvWriter) Sync() error {
+	cw.csv.Flush()
+	if err := cw.csv.Error(); err != nil {
+		return fmt.Errorf("could not write csv: %w", err)
+	}
+
+	return cw.messages.Sync()
+}
+
+func (cw *csvWriter) Abort() {
+	cw.messages.Abort()
+	cw.meta.Abort()
+}
+
+// reactionsSummary returns reactions of the message like ":thumbsup: 3, :heart: 1".
+func reactionsSummary(msg slack.Message) string {
+	reactions := make([]string, 0, len(msg.Reactions))
+	for _, r := range msg.Reactions {
+		reactions = append(reactions, fmt.Sprintf(":%s: %d", r.Name, r.Count))
+	}
+
+	return strings.Join(reactions, ", ")
+}
+
+// fileNames returns comma-separated names of the files attached to the message.
+func fileNames(msg slack.Message) string {
+	return strings.Join(fileNameList(msg), ", ")
+}
+
+// fileNameList returns names of the files attached to the message.
+func fileNameList(msg slack.Message) []string {
+	files := make([]string, 0, len(msg.Files))
+	for _, f := range msg.Files {
+		files = append(files, f.Name)
+	}
+
+	return files
+}
+
+// userDisplayName returns the name of the user as shown in Slack.
+func userDisplayName(u *slack.User) string {
+	switch {
+	case u.Profile.DisplayName != "":
+		return u.Profile.DisplayName
+	case u.RealName != "":
+		return u.RealName
+	default:
+		return u.Name
+	}
+}
+
+var mrkdwnToken = regexp.MustCompile(`<([^<>]+)>`)
+
+// plainText converts Slack mrkdwn of the message to readable text:
+// mentions are replaced with names and links with their labels and URLs.
+func plainText(text string, users userLookup) string {
+	text = mrkdwnToken.ReplaceAllStringFunc(text, func(token string) string {
+		target, label, _ := strings.Cut(token[1:len(token)-1], "|")
+
+		switch {
+		case strings.HasPrefix(target, "@"):
+			if u, err := users(target[1:]); err == nil && u != nil {
+				return "@" + userDisplayName(u)
+			}
+			return target
+		case strings.HasPrefix(target, "#"):
+			if label != "" {
+				return "#" + label
+			}
+			return target
+		case strings.HasPrefix(target, "!"):
+			return specialMention(target[1:], label)
+		case label != "" && label != target:
+			return label + " (" + target + ")"
+		default:
+			return target
+		}
+	})
+
+	return strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&").Replace(text)
+}
+
+// specialMention converts <!...> tokens: announcements like <!here>, user groups like <!subteam^S0123|@team>
+// and dates like <!date^1700000000^{date_short} at {time}|fallback> in --timezone.
+func specialMention(target, label string) string {
+	name, args, _ := strings.Cut(target, "^")
+
+	switch name {
+	case "channel", "here", "everyone":
+		return "@" + name
+	case "date":
+		ts, format, _ := strings.Cut(args, "^")
+		sec, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			return label
+		}
+		// the optional link follows the format
+		format, _, _ = strings.Cut(format, "^")
+		return render.Date(inTimezone(time.Unix(sec, 0)), format)
+	}
+
+	if label != "" {
+		return label
+	}
+	if args != "" {
+		return "@" + args
+	}
+	return "@" + name
+}
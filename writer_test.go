@@ -0,0 +1,83 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestDecodeData(t *testing.T) {
+	tests := []struct {
+		name           string
+		data           string
+		wantTimestamps []string
+		wantUsers      []string
+		wantErr        bool
+	}{
+		{
+			name: "messages and users",
+			data: `{"schema_version":2,"channel":{"id":"C1","topic":{"value":"[]"}},"messages":[` +
+				`{"ts":"1.000001","text":"{\"ts\":\"2\"}","files":[{"id":"F1"}]},{"ts":"1.000002","replies":[]}],` +
+				`"users":{"U1":{"id":"U1","name":"alice"}},"files":{"F1":"a.txt"}}`,
+			wantTimestamps: []string{"1.000001", "1.000002"},
+			wantUsers:      []string{"U1"},
+		},
+		{
+			name:           "null messages",
+			data:           `{"messages":null,"users":null}`,
+			wantTimestamps: []string{},
+		},
+		{
+			name:    "not an object",
+			data:    `[]`,
+			wantErr: true,
+		},
+		{
+			name:    "truncated",
+			data:    `{"messages":[{"ts":"1.000001"}`,
+			wantErr: true,
+		},
+		{
+			name:    "truncated after messages",
+			data:    `{"messages":[]`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timestamps := map[string]struct{}{}
+			users, err := decodeData(strings.NewReader(tt.data), timestamps)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("decodeData succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeData: %v", err)
+			}
+
+			gotTimestamps := []string{}
+			for ts := range timestamps {
+				gotTimestamps = append(gotTimestamps, ts)
+			}
+			sort.Strings(gotTimestamps)
+			if !reflect.DeepEqual(gotTimestamps, tt.wantTimestamps) {
+				t.Errorf("got timestamps %q, want %q", gotTimestamps, tt.wantTimestamps)
+			}
+
+			var gotUsers []string
+			for id, user := range users {
+				if user.ID != id {
+					t.Errorf("got user %q under %q", user.ID, id)
+				}
+				gotUsers = append(gotUsers, id)
+			}
+			if !reflect.DeepEqual(gotUsers, tt.wantUsers) {
+				t.Errorf("got users %q, want %q", gotUsers, tt.wantUsers)
+			}
+		})
+	}
+}